@@ -46,6 +46,18 @@ type (
 	}
 )
 
+type LivecommentDraft struct {
+	LivestreamID int64  `json:"livestream_id" validate:"required"`
+	Comment      string `json:"comment"`
+	Tip          int64  `json:"tip"`
+	UpdatedAt    int64  `json:"updated_at" validate:"required"`
+}
+
+type DryRunLivecommentResponse struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
 type (
 	ModerateRequest struct {
 		NGWord string `json:"ng_word"`
@@ -56,6 +68,13 @@ type (
 	}
 )
 
+type TimelineEvent struct {
+	Type     string       `json:"type" validate:"oneof=comment reaction"`
+	At       int64        `json:"at" validate:"required"`
+	Comment  *Livecomment `json:"comment" validate:"required_if=Type comment"`
+	Reaction *Reaction    `json:"reaction" validate:"required_if=Type reaction"`
+}
+
 type NGWord struct {
 	ID           int64  `json:"id" validate:"required"`
 	UserID       int64  `json:"user_id" validate:"required"`
@@ -64,7 +83,40 @@ type NGWord struct {
 	CreatedAt    int64  `json:"created_at" validate:"required"`
 }
 
+// ライブコメント一覧の1ページ分
+// NextCursorは次のページを取得するためのcursorで、最後のページでは空文字になる
+type LivecommentsPage struct {
+	Livecomments []*Livecomment `json:"livecomments"`
+	NextCursor   string         `json:"next_cursor"`
+}
+
+// GetLivecomments は、ライブコメントを新しい順に取得する
+// limitを指定した場合は最新の1ページだけを、指定しない場合はnext_cursorをたどって全件を取得する
 func (c *Client) GetLivecomments(ctx context.Context, livestreamID int64, streamerName string, opts ...ClientOption) ([]*Livecomment, error) {
+	o := newClientOptions(http.StatusOK, opts...)
+
+	page, err := c.GetLivecommentsPage(ctx, livestreamID, streamerName, "", opts...)
+	if err != nil {
+		return nil, err
+	}
+	livecomments := page.Livecomments
+	if o.limitParam != nil {
+		return livecomments, nil
+	}
+
+	for page.NextCursor != "" {
+		page, err = c.GetLivecommentsPage(ctx, livestreamID, streamerName, page.NextCursor, opts...)
+		if err != nil {
+			return nil, err
+		}
+		livecomments = append(livecomments, page.Livecomments...)
+	}
+
+	return livecomments, nil
+}
+
+// GetLivecommentsPage は、cursorより前のライブコメントを1ページ分取得する (cursorが空の場合は最新から)
+func (c *Client) GetLivecommentsPage(ctx context.Context, livestreamID int64, streamerName string, cursor string, opts ...ClientOption) (*LivecommentsPage, error) {
 	var (
 		defaultStatusCode = http.StatusOK
 		o                 = newClientOptions(defaultStatusCode, opts...)
@@ -79,11 +131,14 @@ func (c *Client) GetLivecomments(ctx context.Context, livestreamID int64, stream
 		return nil, bencherror.NewInternalError(err)
 	}
 
+	query := req.URL.Query()
 	if o.limitParam != nil {
-		query := req.URL.Query()
 		query.Add("limit", strconv.Itoa(o.limitParam.Limit))
-		req.URL.RawQuery = query.Encode()
 	}
+	if cursor != "" {
+		query.Add("cursor", cursor)
+	}
+	req.URL.RawQuery = query.Encode()
 
 	resp, err := sendRequest(ctx, c.themeAgent, req)
 	if err != nil {
@@ -98,18 +153,71 @@ func (c *Client) GetLivecomments(ctx context.Context, livestreamID int64, stream
 		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
 	}
 
-	livecomments := []*Livecomment{}
+	page := &LivecommentsPage{Livecomments: []*Livecomment{}}
 	if resp.StatusCode == defaultStatusCode {
-		if err := json.NewDecoder(resp.Body).Decode(&livecomments); err != nil {
-			return livecomments, bencherror.NewHttpResponseError(err, req)
+		if err := json.NewDecoder(resp.Body).Decode(page); err != nil {
+			return page, bencherror.NewHttpResponseError(err, req)
 		}
 
-		if err := ValidateSlice(req, livecomments); err != nil {
+		if err := ValidateSlice(req, page.Livecomments); err != nil {
 			return nil, err
 		}
 	}
 
-	return livecomments, nil
+	return page, nil
+}
+
+// 配信のタイムライン (ライブコメントとリアクション) 取得
+// cursorが0の場合は、最新のイベントから取得する
+func (c *Client) GetTimeline(ctx context.Context, livestreamID int64, streamerName string, cursor int64, opts ...ClientOption) ([]TimelineEvent, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	if err := c.setStreamerURL(streamerName); err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	urlPath := fmt.Sprintf("/api/livestream/%d/timeline", livestreamID)
+	req, err := c.themeAgent.NewRequest(http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+
+	query := req.URL.Query()
+	if cursor != 0 {
+		query.Add("cursor", strconv.FormatInt(cursor, 10))
+	}
+	if o.limitParam != nil {
+		query.Add("limit", strconv.Itoa(o.limitParam.Limit))
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := sendRequest(ctx, c.themeAgent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	events := []TimelineEvent{}
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateSlice(req, events); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
 }
 
 func (c *Client) GetLivecommentReports(ctx context.Context, livestreamID int64, streamerName string, opts ...ClientOption) ([]LivecommentReport, error) {
@@ -252,6 +360,180 @@ func (c *Client) PostLivecomment(ctx context.Context, livestreamID int64, stream
 	return livecommentResponse, tip.Tip, nil
 }
 
+// DryRunLivecomment は投稿せずにコメントが許可されるかどうかを確認します
+func (c *Client) DryRunLivecomment(ctx context.Context, livestreamID int64, streamerName string, comment string, tip int64, opts ...ClientOption) (*DryRunLivecommentResponse, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+		r                 = &PostLivecommentRequest{
+			Comment: comment,
+			Tip:     tip,
+		}
+	)
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+
+	if err := c.setStreamerURL(streamerName); err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	urlPath := fmt.Sprintf("/api/livestream/%d/livecomment", livestreamID)
+	req, err := c.themeAgent.NewRequest(http.MethodPost, urlPath, bytes.NewReader(payload))
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	req.Header.Add("Content-Type", "application/json;charset=utf-8")
+
+	query := req.URL.Query()
+	query.Add("dry_run", "true")
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := sendRequest(ctx, c.themeAgent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	var dryRunResponse *DryRunLivecommentResponse
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&dryRunResponse); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+	}
+
+	return dryRunResponse, nil
+}
+
+func (c *Client) SaveLivecommentDraft(ctx context.Context, livestreamID int64, streamerName string, r *PostLivecommentRequest, opts ...ClientOption) (*LivecommentDraft, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+
+	if err := c.setStreamerURL(streamerName); err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	urlPath := fmt.Sprintf("/api/livestream/%d/livecomment-draft", livestreamID)
+	req, err := c.themeAgent.NewRequest(http.MethodPost, urlPath, bytes.NewReader(payload))
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	req.Header.Add("Content-Type", "application/json;charset=utf-8")
+
+	resp, err := sendRequest(ctx, c.themeAgent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	var draft *LivecommentDraft
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&draft); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateResponse(req, draft); err != nil {
+			return nil, err
+		}
+	}
+
+	return draft, nil
+}
+
+func (c *Client) GetLivecommentDraft(ctx context.Context, livestreamID int64, streamerName string, opts ...ClientOption) (*LivecommentDraft, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	if err := c.setStreamerURL(streamerName); err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	urlPath := fmt.Sprintf("/api/livestream/%d/livecomment-draft", livestreamID)
+	req, err := c.themeAgent.NewRequest(http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+
+	resp, err := sendRequest(ctx, c.themeAgent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	var draft *LivecommentDraft
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&draft); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateResponse(req, draft); err != nil {
+			return nil, err
+		}
+	}
+
+	return draft, nil
+}
+
+func (c *Client) DeleteLivecommentDraft(ctx context.Context, livestreamID int64, streamerName string, opts ...ClientOption) error {
+	var (
+		defaultStatusCode = http.StatusNoContent
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	if err := c.setStreamerURL(streamerName); err != nil {
+		return bencherror.NewInternalError(err)
+	}
+	urlPath := fmt.Sprintf("/api/livestream/%d/livecomment-draft", livestreamID)
+	req, err := c.themeAgent.NewRequest(http.MethodDelete, urlPath, nil)
+	if err != nil {
+		return bencherror.NewInternalError(err)
+	}
+
+	resp, err := sendRequest(ctx, c.themeAgent, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	return nil
+}
+
 func (c *Client) ReportLivecomment(ctx context.Context, livestreamID int64, streamerName string, livecommentID int64, opts ...ClientOption) error {
 	var (
 		defaultStatusCode = http.StatusCreated
@@ -2,6 +2,7 @@ package isupipe
 
 import (
 	"context"
+	"net/http"
 	"testing"
 	"time"
 
@@ -113,3 +114,108 @@ func TestGetNgWordsBug(t *testing.T) {
 		assert.NotZero(t, ngWord.CreatedAt)
 	}
 }
+
+func TestClient_DryRunLivecomment(t *testing.T) {
+	ctx := context.Background()
+
+	testLogger, err := logger.InitTestLogger()
+	assert.NoError(t, err)
+
+	client, err := NewClient(
+		testLogger,
+		agent.WithBaseURL(config.TargetBaseURL),
+		agent.WithTimeout(1*time.Minute),
+	)
+	assert.NoError(t, err)
+
+	user := scheduler.UserScheduler.GetRandomStreamer()
+	client.Register(ctx, &RegisterRequest{
+		Name:        user.Name,
+		DisplayName: user.DisplayName,
+		Description: user.Description,
+		Password:    user.RawPassword,
+		Theme: Theme{
+			DarkMode: user.DarkMode,
+		},
+	})
+
+	err = client.Login(ctx, &LoginRequest{
+		Username: user.Name,
+		Password: user.RawPassword,
+	})
+	assert.NoError(t, err)
+
+	livestream, err := client.ReserveLivestream(ctx, user.Name, &ReserveLivestreamRequest{
+		Title:        "dryrun-test",
+		Description:  "dryrun-test",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC).Unix(),
+		EndAt:        time.Date(2024, 5, 20, 5, 0, 0, 0, time.UTC).Unix(),
+		Tags:         []int64{},
+	})
+	assert.NoError(t, err)
+
+	err = client.Moderate(ctx, livestream.ID, livestream.Owner.Name, "dryrunng")
+	assert.NoError(t, err)
+
+	resp, err := client.DryRunLivecomment(ctx, livestream.ID, livestream.Owner.Name, "hello", 0)
+	assert.NoError(t, err)
+	assert.True(t, resp.Allowed)
+
+	resp, err = client.DryRunLivecomment(ctx, livestream.ID, livestream.Owner.Name, "this is dryrunng", 0)
+	assert.NoError(t, err)
+	assert.False(t, resp.Allowed)
+	assert.Equal(t, "contains banned word", resp.Reason)
+
+	livecomments, err := client.GetLivecomments(ctx, livestream.ID, livestream.Owner.Name)
+	assert.NoError(t, err)
+	assert.Empty(t, livecomments)
+}
+
+func TestLivecommentDraft(t *testing.T) {
+	ctx := context.Background()
+
+	streamer := newReservationClients(t, ctx, 1)[0]
+	startAt, endAt := nextReservationTerm()
+	livestream, err := streamer.client.ReserveLivestream(ctx, streamer.name, &ReserveLivestreamRequest{
+		Title:        "draft-test",
+		Description:  "draft-test",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      startAt,
+		EndAt:        endAt,
+		Tags:         []int64{},
+	})
+	assert.NoError(t, err)
+
+	viewer := newReservationClients(t, ctx, 1)[0]
+
+	// 下書きがなければ404
+	_, err = viewer.client.GetLivecommentDraft(ctx, livestream.ID, streamer.name, WithStatusCode(http.StatusNotFound))
+	assert.NoError(t, err)
+
+	// 上書き保存できる
+	_, err = viewer.client.SaveLivecommentDraft(ctx, livestream.ID, streamer.name, &PostLivecommentRequest{Comment: "draft1", Tip: 100})
+	assert.NoError(t, err)
+	_, err = viewer.client.SaveLivecommentDraft(ctx, livestream.ID, streamer.name, &PostLivecommentRequest{Comment: "draft2", Tip: 0})
+	assert.NoError(t, err)
+	draft, err := viewer.client.GetLivecommentDraft(ctx, livestream.ID, streamer.name)
+	assert.NoError(t, err)
+	assert.Equal(t, "draft2", draft.Comment)
+	assert.Equal(t, int64(0), draft.Tip)
+
+	// 破棄できる
+	err = viewer.client.DeleteLivecommentDraft(ctx, livestream.ID, streamer.name)
+	assert.NoError(t, err)
+	err = viewer.client.DeleteLivecommentDraft(ctx, livestream.ID, streamer.name, WithStatusCode(http.StatusNotFound))
+	assert.NoError(t, err)
+
+	// ライブコメントを投稿すると下書きは消える
+	_, err = viewer.client.SaveLivecommentDraft(ctx, livestream.ID, streamer.name, &PostLivecommentRequest{Comment: "draft3"})
+	assert.NoError(t, err)
+	_, _, err = viewer.client.PostLivecomment(ctx, livestream.ID, streamer.name, "posted", &scheduler.Tip{})
+	assert.NoError(t, err)
+	_, err = viewer.client.GetLivecommentDraft(ctx, livestream.ID, streamer.name, WithStatusCode(http.StatusNotFound))
+	assert.NoError(t, err)
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/isucon/isucon13/bench/internal/bencherror"
@@ -23,6 +24,10 @@ type Livestream struct {
 	ThumbnailUrl string `json:"thumbnail_url" validate:"required"`
 	StartAt      int64  `json:"start_at" validate:"required"`
 	EndAt        int64  `json:"end_at" validate:"required"`
+	TotalTip     int64  `json:"total_tip"`
+	MaxViewers   int64  `json:"max_viewers"`
+	Status       string `json:"status" validate:"oneof=scheduled live ended"`
+	ViewersCount int64  `json:"viewers_count"`
 }
 
 func (l *Livestream) Hours() int {
@@ -39,6 +44,20 @@ type (
 		ThumbnailUrl string  `json:"thumbnail_url"`
 		StartAt      int64   `json:"start_at"`
 		EndAt        int64   `json:"end_at"`
+		// MaxViewers は、同時視聴者数の上限 (0は無制限)
+		MaxViewers int64 `json:"max_viewers"`
+	}
+
+	ReservationSlot struct {
+		ID      int64 `json:"id" validate:"required"`
+		Slot    int64 `json:"slot"`
+		StartAt int64 `json:"start_at" validate:"required"`
+		EndAt   int64 `json:"end_at" validate:"required"`
+	}
+
+	Slot struct {
+		ReservationSlot
+		Available bool `json:"available"`
 	}
 )
 
@@ -107,6 +126,21 @@ func (c *Client) SearchLivestreams(
 		query.Add("tag", o.searchTag.Tag)
 		req.URL.RawQuery = query.Encode()
 	}
+	if o.searchStatus != "" {
+		query := req.URL.Query()
+		query.Add("status", o.searchStatus)
+		req.URL.RawQuery = query.Encode()
+	}
+	if o.searchTags != nil {
+		query := req.URL.Query()
+		for _, tag := range o.searchTags.Tags {
+			query.Add("tag", tag)
+		}
+		if o.searchTags.MatchAll {
+			query.Add("tag_mode", "and")
+		}
+		req.URL.RawQuery = query.Encode()
+	}
 
 	if o.limitParam != nil {
 		query := req.URL.Query()
@@ -114,6 +148,70 @@ func (c *Client) SearchLivestreams(
 		req.URL.RawQuery = query.Encode()
 	}
 
+	return c.searchLivestreams(ctx, req, o)
+}
+
+// 配信開始時刻の範囲によるライブ配信検索
+// startAfter, startBeforeが0の場合は、その条件を指定しない
+func (c *Client) SearchLivestreamsByDateRange(
+	ctx context.Context,
+	startAfter, startBefore int64,
+	opts ...ClientOption,
+) ([]*Livestream, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	req, err := c.agent.NewRequest(http.MethodGet, "/api/livestream/search", nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	query := req.URL.Query()
+	if o.searchTag != nil {
+		query.Add("tag", o.searchTag.Tag)
+	}
+	if startAfter != 0 {
+		query.Add("start_after", strconv.FormatInt(startAfter, 10))
+	}
+	if startBefore != 0 {
+		query.Add("start_before", strconv.FormatInt(startBefore, 10))
+	}
+	req.URL.RawQuery = query.Encode()
+
+	return c.searchLivestreams(ctx, req, o)
+}
+
+// 配信者によるライブ配信検索
+func (c *Client) SearchLivestreamsByUserIDs(
+	ctx context.Context,
+	userIDs []int64,
+	opts ...ClientOption,
+) ([]*Livestream, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	req, err := c.agent.NewRequest(http.MethodGet, "/api/livestream/search", nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	ids := make([]string, len(userIDs))
+	for i := range userIDs {
+		ids[i] = strconv.FormatInt(userIDs[i], 10)
+	}
+	query := req.URL.Query()
+	query.Add("user_ids", strings.Join(ids, ","))
+	if o.searchTag != nil {
+		query.Add("tag", o.searchTag.Tag)
+	}
+	req.URL.RawQuery = query.Encode()
+
+	return c.searchLivestreams(ctx, req, o)
+}
+
+func (c *Client) searchLivestreams(ctx context.Context, req *http.Request, o *ClientOptions) ([]*Livestream, error) {
 	resp, err := sendRequest(ctx, c.agent, req)
 	if err != nil {
 		return nil, err
@@ -128,7 +226,7 @@ func (c *Client) SearchLivestreams(
 	}
 
 	var livestreams []*Livestream
-	if resp.StatusCode == defaultStatusCode {
+	if resp.StatusCode == http.StatusOK {
 		if err := json.NewDecoder(resp.Body).Decode(&livestreams); err != nil {
 			return nil, err
 		}
@@ -180,6 +278,89 @@ func (c *Client) GetMyLivestreams(ctx context.Context, opts ...ClientOption) ([]
 	return livestreams, nil
 }
 
+// おすすめライブ配信取得
+func (c *Client) GetRecommendedLivestreams(ctx context.Context, opts ...ClientOption) ([]*Livestream, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	req, err := c.agent.NewRequest(http.MethodGet, "/api/livestreams/recommended", nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	if o.limitParam != nil {
+		query := req.URL.Query()
+		query.Add("limit", strconv.Itoa(o.limitParam.Limit))
+		req.URL.RawQuery = query.Encode()
+	}
+
+	resp, err := sendRequest(ctx, c.agent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	var livestreams []*Livestream
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&livestreams); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateSlice(req, livestreams); err != nil {
+			return nil, err
+		}
+	}
+
+	return livestreams, nil
+}
+
+// 視聴履歴に基づくおすすめライブ配信取得
+func (c *Client) GetPersonalisedRecommendations(ctx context.Context, opts ...ClientOption) ([]*Livestream, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	req, err := c.agent.NewRequest(http.MethodGet, "/api/user/me/recommended-streams", nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+
+	resp, err := sendRequest(ctx, c.agent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	var livestreams []*Livestream
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&livestreams); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateSlice(req, livestreams); err != nil {
+			return nil, err
+		}
+	}
+
+	return livestreams, nil
+}
+
 // 特定ユーザのライブ配信取得
 func (c *Client) GetUserLivestreams(ctx context.Context, username string, opts ...ClientOption) ([]*Livestream, error) {
 	var (
@@ -219,6 +400,97 @@ func (c *Client) GetUserLivestreams(ctx context.Context, username string, opts .
 	return livestreams, nil
 }
 
+// 予約枠の空き状況取得 (予約枠のETagも返す)
+func (c *Client) GetReservationSlots(ctx context.Context, streamerName string, startAt, endAt int64, opts ...ClientOption) ([]ReservationSlot, string, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	if err := c.setStreamerURL(streamerName); err != nil {
+		return nil, "", bencherror.NewInternalError(err)
+	}
+	req, err := c.themeAgent.NewRequest(http.MethodGet, "/api/livestream/reservation/slots", nil)
+	if err != nil {
+		return nil, "", bencherror.NewInternalError(err)
+	}
+	query := req.URL.Query()
+	query.Add("start_at", strconv.FormatInt(startAt, 10))
+	query.Add("end_at", strconv.FormatInt(endAt, 10))
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := sendRequest(ctx, c.themeAgent, req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, "", bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	slots := []ReservationSlot{}
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&slots); err != nil {
+			return nil, "", bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateSlice(req, slots); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return slots, resp.Header.Get("ETag"), nil
+}
+
+// 予約枠空き状況プレビュー (ログイン不要)
+func (c *Client) GetSlots(ctx context.Context, startAt, endAt int64, opts ...ClientOption) ([]Slot, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	req, err := c.agent.NewRequest(http.MethodGet, "/api/slots", nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	query := req.URL.Query()
+	query.Add("start_at", strconv.FormatInt(startAt, 10))
+	query.Add("end_at", strconv.FormatInt(endAt, 10))
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := sendRequest(ctx, c.agent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	slots := []Slot{}
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&slots); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateSlice(req, slots); err != nil {
+			return nil, err
+		}
+	}
+
+	return slots, nil
+}
+
+// ライブ配信予約
+// WithIfMatchを指定すると、予約枠が空き状況取得時から変わっていない場合のみ予約される
 func (c *Client) ReserveLivestream(ctx context.Context, streamerName string, r *ReserveLivestreamRequest, opts ...ClientOption) (*Livestream, error) {
 	var (
 		defaultStatusCode = http.StatusCreated
@@ -238,6 +510,9 @@ func (c *Client) ReserveLivestream(ctx context.Context, streamerName string, r *
 		return nil, bencherror.NewInternalError(err)
 	}
 	req.Header.Add("Content-Type", "application/json;charset=utf-8")
+	if o.ifMatch != "" {
+		req.Header.Set("If-Match", `"`+o.ifMatch+`"`)
+	}
 
 	resp, err := sendRequest(ctx, c.themeAgent, req)
 	if err != nil {
@@ -298,6 +573,38 @@ func (c *Client) EnterLivestream(ctx context.Context, livestreamID int64, stream
 	return nil
 }
 
+// ライブ配信予約取消 (配信開始前のみ)
+func (c *Client) CancelLivestream(ctx context.Context, livestreamID int64, streamerName string, opts ...ClientOption) error {
+	var (
+		defaultStatusCode = http.StatusNoContent
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	if err := c.setStreamerURL(streamerName); err != nil {
+		return bencherror.NewInternalError(err)
+	}
+	urlPath := fmt.Sprintf("/api/livestream/%d", livestreamID)
+	req, err := c.themeAgent.NewRequest(http.MethodDelete, urlPath, nil)
+	if err != nil {
+		return bencherror.NewInternalError(err)
+	}
+
+	resp, err := sendRequest(ctx, c.themeAgent, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	return nil
+}
+
 func (c *Client) ExitLivestream(ctx context.Context, livestreamID int64, streamerName string, opts ...ClientOption) error {
 	var (
 		defaultStatusCode = http.StatusOK
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -139,3 +142,543 @@ func TestLivestream(t *testing.T) {
 		}
 	}
 }
+
+func TestReserveLivestream_NoMatchingSlots(t *testing.T) {
+	ctx := context.Background()
+
+	testLogger, err := logger.InitTestLogger()
+	assert.NoError(t, err)
+
+	client, err := NewClient(
+		testLogger,
+		agent.WithBaseURL(config.TargetBaseURL),
+		agent.WithTimeout(1*time.Minute),
+	)
+	assert.NoError(t, err)
+
+	user := scheduler.UserScheduler.GetRandomStreamer()
+	client.Register(ctx, &RegisterRequest{
+		Name:        user.Name,
+		DisplayName: user.DisplayName,
+		Description: user.Description,
+		Password:    user.RawPassword,
+		Theme: Theme{
+			DarkMode: user.DarkMode,
+		},
+	})
+
+	err = client.Login(ctx, &LoginRequest{
+		Username: user.Name,
+		Password: user.RawPassword,
+	})
+	assert.NoError(t, err)
+
+	// 予約枠は1時間単位なので、30分だけの区間に収まる枠は存在しない
+	_, err = client.ReserveLivestream(ctx, user.Name, &ReserveLivestreamRequest{
+		Title:        "no-matching-slots",
+		Description:  "no-matching-slots",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC).Unix(),
+		EndAt:        time.Date(2024, 8, 1, 0, 30, 0, 0, time.UTC).Unix(),
+		Tags:         []int64{},
+	}, WithStatusCode(http.StatusInternalServerError))
+	assert.NoError(t, err)
+}
+
+func TestSearchLivestreamsByDateRange(t *testing.T) {
+	ctx := context.Background()
+
+	clients := newReservationClients(t, ctx, 1)
+	startAt, endAt := nextReservationTerm()
+
+	// タグID 2 は「ゲーム実況」
+	const gamingTagName = "ゲーム実況"
+	livestream, err := clients[0].client.ReserveLivestream(ctx, clients[0].name, &ReserveLivestreamRequest{
+		Title:        "search-by-date-range",
+		Description:  "search-by-date-range",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      startAt,
+		EndAt:        endAt,
+		Tags:         []int64{2},
+	})
+	assert.NoError(t, err)
+
+	livestreams, err := clients[0].client.SearchLivestreamsByDateRange(ctx, startAt-1, endAt, WithSearchTagQueryParam(gamingTagName))
+	assert.NoError(t, err)
+
+	found := false
+	for _, l := range livestreams {
+		assert.Greater(t, l.StartAt, startAt-1)
+		assert.Less(t, l.StartAt, endAt)
+		tagNames := make([]string, len(l.Tags))
+		for i := range l.Tags {
+			tagNames[i] = l.Tags[i].Name
+		}
+		assert.Contains(t, tagNames, gamingTagName)
+		if l.ID == livestream.ID {
+			found = true
+		}
+	}
+	assert.True(t, found)
+
+	// 範囲外を指定した場合は含まれない
+	livestreams, err = clients[0].client.SearchLivestreamsByDateRange(ctx, startAt, endAt, WithSearchTagQueryParam(gamingTagName))
+	assert.NoError(t, err)
+	for _, l := range livestreams {
+		assert.NotEqual(t, livestream.ID, l.ID)
+	}
+
+	// start_after >= start_before は不正な指定
+	_, err = clients[0].client.SearchLivestreamsByDateRange(ctx, endAt, startAt, WithStatusCode(http.StatusBadRequest))
+	assert.NoError(t, err)
+}
+
+func TestSearchLivestreams_MultipleTags(t *testing.T) {
+	ctx := context.Background()
+
+	clients := newReservationClients(t, ctx, 1)
+	streamer := clients[0]
+
+	// タグID 1 は「ライブ配信」、2 は「ゲーム実況」
+	const (
+		liveTagName   = "ライブ配信"
+		gamingTagName = "ゲーム実況"
+	)
+	reserve := func(tags []int64) *Livestream {
+		startAt, endAt := nextReservationTerm()
+		livestream, err := streamer.client.ReserveLivestream(ctx, streamer.name, &ReserveLivestreamRequest{
+			Title:        "search-by-tags",
+			Description:  "search-by-tags",
+			PlaylistUrl:  "https://example.com",
+			ThumbnailUrl: "https://example.com",
+			StartAt:      startAt,
+			EndAt:        endAt,
+			Tags:         tags,
+		})
+		assert.NoError(t, err)
+		return livestream
+	}
+	liveOnly := reserve([]int64{1})
+	gamingOnly := reserve([]int64{2})
+	both := reserve([]int64{1, 2})
+
+	ids := func(livestreams []*Livestream) []int64 {
+		ids := make([]int64, len(livestreams))
+		for i := range livestreams {
+			ids[i] = livestreams[i].ID
+		}
+		return ids
+	}
+
+	livestreams, err := streamer.client.SearchLivestreams(ctx, WithSearchTagsQueryParam([]string{liveTagName, gamingTagName}, false))
+	assert.NoError(t, err)
+	assert.Subset(t, ids(livestreams), []int64{liveOnly.ID, gamingOnly.ID, both.ID})
+
+	livestreams, err = streamer.client.SearchLivestreams(ctx, WithSearchTagsQueryParam([]string{liveTagName, gamingTagName}, true))
+	assert.NoError(t, err)
+	assert.Contains(t, ids(livestreams), both.ID)
+	assert.NotContains(t, ids(livestreams), liveOnly.ID)
+	assert.NotContains(t, ids(livestreams), gamingOnly.ID)
+}
+
+func TestSearchLivestreams_Status(t *testing.T) {
+	ctx := context.Background()
+
+	clients := newReservationClients(t, ctx, 1)
+	for _, status := range []string{"scheduled", "live", "ended"} {
+		livestreams, err := clients[0].client.SearchLivestreams(ctx, WithSearchStatusQueryParam(status), WithLimitQueryParam(50))
+		assert.NoError(t, err)
+		for _, l := range livestreams {
+			assert.Equal(t, status, l.Status, "livestream %d", l.ID)
+		}
+	}
+
+	_, err := clients[0].client.SearchLivestreams(ctx, WithSearchStatusQueryParam("unknown"), WithStatusCode(http.StatusBadRequest))
+	assert.NoError(t, err)
+}
+
+func TestGetLivestream_ViewersCount(t *testing.T) {
+	ctx := context.Background()
+
+	clients := newReservationClients(t, ctx, 2)
+	streamer, viewer := clients[0], clients[1]
+	startAt, endAt := nextReservationTerm()
+	livestream, err := streamer.client.ReserveLivestream(ctx, streamer.name, &ReserveLivestreamRequest{
+		Title:        "viewers-count",
+		Description:  "viewers-count",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      startAt,
+		EndAt:        endAt,
+		Tags:         []int64{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), livestream.ViewersCount)
+
+	viewersCount := func() int64 {
+		l, err := viewer.client.GetLivestream(ctx, livestream.ID, streamer.name)
+		assert.NoError(t, err)
+		return l.ViewersCount
+	}
+
+	assert.NoError(t, viewer.client.EnterLivestream(ctx, livestream.ID, streamer.name))
+	assert.Equal(t, int64(1), viewersCount())
+
+	// 退室すると視聴履歴が削除され、再入室しても1人として数える
+	assert.NoError(t, viewer.client.ExitLivestream(ctx, livestream.ID, streamer.name))
+	assert.Equal(t, int64(0), viewersCount())
+	assert.NoError(t, viewer.client.EnterLivestream(ctx, livestream.ID, streamer.name))
+	assert.Equal(t, int64(1), viewersCount())
+}
+
+func TestReserveLivestream_WithTags(t *testing.T) {
+	ctx := context.Background()
+
+	streamer := newReservationClients(t, ctx, 1)[0]
+	startAt, endAt := nextReservationTerm()
+	tagIDs := []int64{1, 2, 3, 4, 5}
+	livestream, err := streamer.client.ReserveLivestream(ctx, streamer.name, &ReserveLivestreamRequest{
+		Title:        "tags-test",
+		Description:  "tags-test",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      startAt,
+		EndAt:        endAt,
+		Tags:         tagIDs,
+	})
+	assert.NoError(t, err)
+
+	gotTagIDs := make([]int64, len(livestream.Tags))
+	for i, tag := range livestream.Tags {
+		gotTagIDs[i] = tag.ID
+	}
+	assert.ElementsMatch(t, tagIDs, gotTagIDs)
+}
+
+func TestClient_GetSlots_Unauthenticated(t *testing.T) {
+	ctx := context.Background()
+
+	testLogger, err := logger.InitTestLogger()
+	assert.NoError(t, err)
+	anonymous, err := NewClient(
+		testLogger,
+		agent.WithBaseURL(config.TargetBaseURL),
+		agent.WithTimeout(10*time.Second),
+	)
+	assert.NoError(t, err)
+
+	clients := newReservationClients(t, ctx, 1)
+	streamer := clients[0]
+	startAt, endAt := nextReservationTerm()
+
+	slots, err := anonymous.GetSlots(ctx, startAt, endAt)
+	assert.NoError(t, err)
+	assert.Len(t, slots, 1)
+	before := slots[0].Slot
+	assert.Equal(t, before > 0, slots[0].Available)
+
+	_, err = streamer.client.ReserveLivestream(ctx, streamer.name, &ReserveLivestreamRequest{
+		Title:        "slots-test",
+		Description:  "slots-test",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      startAt,
+		EndAt:        endAt,
+		Tags:         []int64{},
+	})
+	assert.NoError(t, err)
+
+	slots, err = anonymous.GetSlots(ctx, startAt, endAt)
+	assert.NoError(t, err)
+	assert.Len(t, slots, 1)
+	assert.Equal(t, before-1, slots[0].Slot)
+	assert.Equal(t, slots[0].Slot > 0, slots[0].Available)
+
+	// 予約期間外はエラーにせず空配列を返す
+	slots, err = anonymous.GetSlots(ctx, 0, 3600)
+	assert.NoError(t, err)
+	assert.Empty(t, slots)
+}
+
+func TestCancelLivestream_RestoresSlot(t *testing.T) {
+	ctx := context.Background()
+
+	clients := newReservationClients(t, ctx, 2)
+	streamer, other := clients[0], clients[1]
+	startAt, endAt := nextReservationTerm()
+
+	slots, _, err := streamer.client.GetReservationSlots(ctx, streamer.name, startAt, endAt)
+	assert.NoError(t, err)
+	assert.Len(t, slots, 1)
+	before := slots[0].Slot
+
+	livestream, err := streamer.client.ReserveLivestream(ctx, streamer.name, &ReserveLivestreamRequest{
+		Title:        "cancel-test",
+		Description:  "cancel-test",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      startAt,
+		EndAt:        endAt,
+		Tags:         []int64{1, 2},
+	})
+	assert.NoError(t, err)
+
+	// 他人の予約は取り消せない
+	err = other.client.CancelLivestream(ctx, livestream.ID, streamer.name, WithStatusCode(http.StatusForbidden))
+	assert.NoError(t, err)
+
+	err = streamer.client.CancelLivestream(ctx, livestream.ID, streamer.name)
+	assert.NoError(t, err)
+
+	// 予約枠が戻っている
+	slots, _, err = streamer.client.GetReservationSlots(ctx, streamer.name, startAt, endAt)
+	assert.NoError(t, err)
+	assert.Len(t, slots, 1)
+	assert.Equal(t, before, slots[0].Slot)
+
+	_, err = streamer.client.GetLivestream(ctx, livestream.ID, streamer.name, WithStatusCode(http.StatusNotFound))
+	assert.NoError(t, err)
+	err = streamer.client.CancelLivestream(ctx, livestream.ID, streamer.name, WithStatusCode(http.StatusNotFound))
+	assert.NoError(t, err)
+}
+
+func TestClient_Recommended_FallbackNoHistory(t *testing.T) {
+	ctx := context.Background()
+
+	// 登録直後のユーザには視聴・リアクション履歴がない
+	clients := newReservationClients(t, ctx, 1)
+	now := time.Now().Unix()
+
+	livestreams, err := clients[0].client.GetRecommendedLivestreams(ctx, WithLimitQueryParam(5))
+	// NOTE: 配信予定の配信がない期間に実行すると空になるため、件数の下限は確認しない
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(livestreams), 5)
+	for _, l := range livestreams {
+		// 終了済みの配信は推薦されない
+		assert.Greater(t, l.EndAt, now)
+	}
+
+	_, err = clients[0].client.GetRecommendedLivestreams(ctx, WithLimitQueryParam(0), WithStatusCode(http.StatusBadRequest))
+	assert.NoError(t, err)
+}
+
+func TestClient_PersonalisedRecommendations_EmptyForNewUser(t *testing.T) {
+	ctx := context.Background()
+
+	// 登録直後のユーザには視聴履歴がないので、おすすめは空になる
+	clients := newReservationClients(t, ctx, 1)
+
+	livestreams, err := clients[0].client.GetPersonalisedRecommendations(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, livestreams)
+}
+
+// 予約枠のFOR UPDATEによる排他が効いているか検証するため、時間帯が重なる予約を並列に行う
+// NOTE: 同一ユーザは同一時間で１つしか予約を取れないので、予約ごとにユーザを作成する
+
+var reservationHourCounter atomic.Int64
+
+// nextReservationTerm は、他のテストと重ならない1時間の予約区間を払い出す
+func nextReservationTerm() (int64, int64) {
+	base := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	startAt := base.Add(time.Duration(reservationHourCounter.Add(1)) * time.Hour)
+	return startAt.Unix(), startAt.Add(1 * time.Hour).Unix()
+}
+
+type reservationClient struct {
+	client *Client
+	name   string
+}
+
+func newReservationClients(tb testing.TB, ctx context.Context, n int) []reservationClient {
+	testLogger, err := logger.InitTestLogger()
+	assert.NoError(tb, err)
+
+	clients := make([]reservationClient, n)
+	for i := 0; i < n; i++ {
+		client, err := NewClient(
+			testLogger,
+			agent.WithBaseURL(config.TargetBaseURL),
+			agent.WithTimeout(10*time.Second),
+		)
+		assert.NoError(tb, err)
+
+		name := fmt.Sprintf("rsv%d-%d", time.Now().UnixNano(), i)
+		_, err = client.Register(ctx, &RegisterRequest{
+			Name:        name,
+			DisplayName: name,
+			Description: "concurrent-reservation-test",
+			Password:    "test",
+			Theme: Theme{
+				DarkMode: true,
+			},
+		})
+		assert.NoError(tb, err)
+
+		err = client.Login(ctx, &LoginRequest{
+			Username: name,
+			Password: "test",
+		})
+		assert.NoError(tb, err)
+
+		clients[i] = reservationClient{
+			client: client,
+			name:   name,
+		}
+	}
+	return clients
+}
+
+// reserveConcurrently は、全クライアントから同じ区間を同時に予約し、成功数を返す
+// 失敗した予約は400で弾かれている必要がある
+func reserveConcurrently(tb testing.TB, ctx context.Context, clients []reservationClient, startAt, endAt int64) int64 {
+	var (
+		wg        sync.WaitGroup
+		succeeded atomic.Int64
+	)
+	for i := range clients {
+		wg.Add(1)
+		go func(rc reservationClient) {
+			defer wg.Done()
+			_, err := rc.client.ReserveLivestream(ctx, rc.name, &ReserveLivestreamRequest{
+				Title:        "concurrent-reservation-test",
+				Description:  "concurrent-reservation-test",
+				PlaylistUrl:  "https://example.com",
+				ThumbnailUrl: "https://example.com",
+				StartAt:      startAt,
+				EndAt:        endAt,
+				Tags:         []int64{},
+			})
+			if err == nil {
+				succeeded.Add(1)
+				return
+			}
+			assert.Contains(tb, err.Error(), fmt.Sprintf("actual:%d", http.StatusBadRequest))
+		}(clients[i])
+	}
+	wg.Wait()
+
+	return succeeded.Load()
+}
+
+func TestConcurrentReservation_NoOverbooking(t *testing.T) {
+	ctx := context.Background()
+
+	clients := newReservationClients(t, ctx, config.NumSlots*3)
+	startAt, endAt := nextReservationTerm()
+
+	succeeded := reserveConcurrently(t, ctx, clients, startAt, endAt)
+	// 枠数を超えて予約できていれば、予約枠の残数が負になっている
+	assert.Equal(t, int64(config.NumSlots), succeeded)
+
+	// 枠を使い切った後は必ず失敗する
+	extra := newReservationClients(t, ctx, 1)
+	assert.Zero(t, reserveConcurrently(t, ctx, extra, startAt, endAt))
+}
+
+func BenchmarkConcurrentReservation(b *testing.B) {
+	ctx := context.Background()
+
+	b.StopTimer()
+	clients := newReservationClients(b, ctx, b.N)
+	startAt, endAt := nextReservationTerm()
+	b.StartTimer()
+
+	succeeded := reserveConcurrently(b, ctx, clients, startAt, endAt)
+
+	b.StopTimer()
+	want := int64(b.N)
+	if want > config.NumSlots {
+		want = config.NumSlots
+	}
+	assert.Equal(b, want, succeeded)
+}
+
+func TestEnterLivestream_MaxViewers(t *testing.T) {
+	ctx := context.Background()
+
+	const maxViewers = 3
+
+	streamer := newReservationClients(t, ctx, 1)[0]
+	startAt, endAt := nextReservationTerm()
+	livestream, err := streamer.client.ReserveLivestream(ctx, streamer.name, &ReserveLivestreamRequest{
+		Title:        "max-viewers-test",
+		Description:  "max-viewers-test",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      startAt,
+		EndAt:        endAt,
+		Tags:         []int64{},
+		MaxViewers:   maxViewers,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(maxViewers), livestream.MaxViewers)
+
+	// 上限を超える視聴者が同時に入室しても、上限までしか入室できない
+	viewers := newReservationClients(t, ctx, maxViewers*3)
+	var (
+		wg        sync.WaitGroup
+		succeeded atomic.Int64
+	)
+	for i := range viewers {
+		wg.Add(1)
+		go func(rc reservationClient) {
+			defer wg.Done()
+			err := rc.client.EnterLivestream(ctx, livestream.ID, streamer.name)
+			if err == nil {
+				succeeded.Add(1)
+				return
+			}
+			assert.Contains(t, err.Error(), fmt.Sprintf("actual:%d", http.StatusTooManyRequests))
+		}(viewers[i])
+	}
+	wg.Wait()
+	assert.Equal(t, int64(maxViewers), succeeded.Load())
+}
+
+// 2台のサーバが同じ空き状況を読んだ後に、それぞれから同時に予約する状況を再現する
+func TestConcurrentReservation_IfMatch(t *testing.T) {
+	ctx := context.Background()
+
+	clients := newReservationClients(t, ctx, 2)
+	startAt, endAt := nextReservationTerm()
+
+	// 両者が同じ残数を読む
+	slots, eTag, err := clients[0].client.GetReservationSlots(ctx, clients[0].name, startAt, endAt)
+	assert.NoError(t, err)
+	assert.Len(t, slots, 1)
+	_, otherETag, err := clients[1].client.GetReservationSlots(ctx, clients[1].name, startAt, endAt)
+	assert.NoError(t, err)
+	assert.Equal(t, eTag, otherETag)
+
+	var (
+		wg        sync.WaitGroup
+		succeeded atomic.Int64
+	)
+	for i := range clients {
+		wg.Add(1)
+		go func(rc reservationClient) {
+			defer wg.Done()
+			_, err := rc.client.ReserveLivestream(ctx, rc.name, &ReserveLivestreamRequest{
+				Title:        "if-match-reservation-test",
+				Description:  "if-match-reservation-test",
+				PlaylistUrl:  "https://example.com",
+				ThumbnailUrl: "https://example.com",
+				StartAt:      startAt,
+				EndAt:        endAt,
+				Tags:         []int64{},
+			}, WithIfMatch(strings.Trim(eTag, `"`)))
+			if err == nil {
+				succeeded.Add(1)
+				return
+			}
+			assert.Contains(t, err.Error(), fmt.Sprintf("actual:%d", http.StatusPreconditionFailed))
+		}(clients[i])
+	}
+	wg.Wait()
+
+	// 先に予約した方で残数が減るので、もう一方はETagが一致しない
+	assert.Equal(t, int64(1), succeeded.Load())
+}
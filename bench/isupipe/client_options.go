@@ -10,11 +10,23 @@ type SearchTagParam struct {
 	Tag string
 }
 
+// SearchTagsParam は、複数タグによる検索条件
+// MatchAllがtrueの場合は全てのタグ、falseの場合はいずれかのタグを持つ配信を検索する
+type SearchTagsParam struct {
+	Tags     []string
+	MatchAll bool
+}
+
 type ClientOptions struct {
-	wantStatusCode int
-	limitParam     *LimitParam
-	searchTag      *SearchTagParam
-	eTag           string
+	wantStatusCode  int
+	limitParam      *LimitParam
+	searchTag       *SearchTagParam
+	searchTags      *SearchTagsParam
+	searchStatus    string
+	eTag            string
+	ifModifiedSince string
+	ifMatch         string
+	emoji           string
 	// NOTE: スパム報告は、ベンチ走行中は粛清されたライブコメントを期待する場合が有り、エラーになることがある
 	// Pretestでのみスパム報告のバリデーションを行うための対応
 	validateReportLivecomment bool
@@ -55,6 +67,40 @@ func WithSearchTagQueryParam(tag string) ClientOption {
 	}
 }
 
+func WithSearchTagsQueryParam(tags []string, matchAll bool) ClientOption {
+	return func(o *ClientOptions) {
+		o.searchTags = &SearchTagsParam{
+			Tags:     tags,
+			MatchAll: matchAll,
+		}
+	}
+}
+
+// WithSearchStatusQueryParam は、配信状況 (scheduled, live, ended) で検索結果を絞り込む
+func WithSearchStatusQueryParam(status string) ClientOption {
+	return func(o *ClientOptions) {
+		o.searchStatus = status
+	}
+}
+
+func WithEmoji(name string) ClientOption {
+	return func(o *ClientOptions) {
+		o.emoji = name
+	}
+}
+
+func WithIfModifiedSince(lastModified string) ClientOption {
+	return func(o *ClientOptions) {
+		o.ifModifiedSince = lastModified
+	}
+}
+
+func WithIfMatch(eTag string) ClientOption {
+	return func(o *ClientOptions) {
+		o.ifMatch = eTag
+	}
+}
+
 func WithETag(eTag string) ClientOption {
 	return func(o *ClientOptions) {
 		o.eTag = eTag
@@ -72,6 +72,61 @@ func (c *Client) GetReactions(ctx context.Context, livestreamID int64, streamerN
 	return reactions, nil
 }
 
+// GetReactionEvents は、cursorより小さいIDのリアクションを新しい順に取得する (cursorが0の場合は最新から)
+func (c *Client) GetReactionEvents(ctx context.Context, livestreamID int64, streamerName string, cursor int64, opts ...ClientOption) ([]Reaction, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	if err := c.setStreamerURL(streamerName); err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	urlPath := fmt.Sprintf("/api/livestream/%d/reactions", livestreamID)
+	req, err := c.themeAgent.NewRequest(http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+
+	query := req.URL.Query()
+	if o.limitParam != nil {
+		query.Add("limit", strconv.Itoa(o.limitParam.Limit))
+	}
+	if cursor > 0 {
+		query.Add("cursor", strconv.FormatInt(cursor, 10))
+	}
+	if o.emoji != "" {
+		query.Add("emoji", o.emoji)
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := sendRequest(ctx, c.themeAgent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	reactions := []Reaction{}
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&reactions); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateSlice(req, reactions); err != nil {
+			return nil, err
+		}
+	}
+
+	return reactions, nil
+}
+
 func (c *Client) PostReaction(ctx context.Context, livestreamID int64, streamerName string, r *PostReactionRequest, opts ...ClientOption) (*Reaction, error) {
 	var (
 		defaultStatusCode = http.StatusCreated
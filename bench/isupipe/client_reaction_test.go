@@ -1 +1,62 @@
 package isupipe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetReactionEvents(t *testing.T) {
+	ctx := context.Background()
+
+	streamer := newReservationClients(t, ctx, 1)[0]
+	startAt, endAt := nextReservationTerm()
+	livestream, err := streamer.client.ReserveLivestream(ctx, streamer.name, &ReserveLivestreamRequest{
+		Title:        "reaction-events-test",
+		Description:  "reaction-events-test",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      startAt,
+		EndAt:        endAt,
+		Tags:         []int64{},
+	})
+	assert.NoError(t, err)
+
+	viewers := newReservationClients(t, ctx, 2)
+	var posted []*Reaction
+	for _, p := range []struct {
+		viewer    reservationClient
+		emojiName string
+	}{
+		{viewers[0], "heart"},
+		{viewers[1], "smile"},
+		{viewers[0], "smile"},
+	} {
+		reaction, err := p.viewer.client.PostReaction(ctx, livestream.ID, streamer.name, &PostReactionRequest{EmojiName: p.emojiName})
+		assert.NoError(t, err)
+		posted = append(posted, reaction)
+	}
+
+	// 新しい順にページングできる
+	page1, err := viewers[0].client.GetReactionEvents(ctx, livestream.ID, streamer.name, 0, WithLimitQueryParam(2))
+	assert.NoError(t, err)
+	if assert.Len(t, page1, 2) {
+		assert.Equal(t, posted[2].ID, page1[0].ID)
+		assert.Equal(t, posted[1].ID, page1[1].ID)
+		assert.Equal(t, viewers[1].name, page1[1].User.Name)
+	}
+	page2, err := viewers[0].client.GetReactionEvents(ctx, livestream.ID, streamer.name, page1[len(page1)-1].ID, WithLimitQueryParam(2))
+	assert.NoError(t, err)
+	if assert.Len(t, page2, 1) {
+		assert.Equal(t, posted[0].ID, page2[0].ID)
+	}
+
+	// 絵文字で絞り込める
+	smiles, err := viewers[0].client.GetReactionEvents(ctx, livestream.ID, streamer.name, 0, WithEmoji("smile"))
+	assert.NoError(t, err)
+	assert.Len(t, smiles, 2)
+	for _, r := range smiles {
+		assert.Equal(t, "smile", r.EmojiName)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/isucon/isucon13/bench/internal/bencherror"
 )
@@ -18,6 +19,18 @@ type LivestreamStatistics struct {
 	MaxTip         int64 `json:"max_tip"`
 }
 
+type ComparisonResult struct {
+	Stream1 LivestreamStatistics `json:"stream1" validate:"required"`
+	Stream2 LivestreamStatistics `json:"stream2" validate:"required"`
+	Winner  string               `json:"winner" validate:"oneof=stream1 stream2 tie"`
+}
+
+type HeatmapBucket struct {
+	OffsetSeconds int64 `json:"offset_seconds"`
+	ViewerCount   int64 `json:"viewer_count"`
+	ReactionCount int64 `json:"reaction_count"`
+}
+
 type UserStatistics struct {
 	Rank              int64 `json:"rank" validate:"required"`
 	ViewersCount      int64 `json:"viewers_count"`
@@ -28,6 +41,33 @@ type UserStatistics struct {
 	FavoriteEmoji string `json:"favorite_emoji"`
 }
 
+type LivestreamEarning struct {
+	LivestreamID int64  `json:"livestream_id" validate:"required"`
+	Title        string `json:"title" validate:"required"`
+	Tip          int64  `json:"tip"`
+}
+
+type StreamEarnings struct {
+	TotalTip     int64               `json:"total_tip"`
+	ByLivestream []LivestreamEarning `json:"by_livestream" validate:"dive"`
+}
+
+type TipHistoryEntry struct {
+	LivecommentID   int64  `json:"livecomment_id" validate:"required"`
+	LivestreamID    int64  `json:"livestream_id" validate:"required"`
+	LivestreamTitle string `json:"livestream_title" validate:"required"`
+	Tip             int64  `json:"tip" validate:"required"`
+	Comment         string `json:"comment" validate:"required"`
+	CreatedAt       int64  `json:"created_at" validate:"required"`
+}
+
+type DonorEntry struct {
+	Rank int64 `json:"rank" validate:"required"`
+	// NOTE: ランキングへの表示を拒否したユーザは名前 (anonymous) しか返らないので、validate対象外
+	User     User  `json:"user" validate:"-"`
+	TotalTip int64 `json:"total_tip" validate:"required"`
+}
+
 func (c *Client) GetUserStatistics(ctx context.Context, username string, opts ...ClientOption) (*UserStatistics, error) {
 	var (
 		defaultStatusCode = http.StatusOK
@@ -108,3 +148,232 @@ func (c *Client) GetLivestreamStatistics(ctx context.Context, livestreamID int64
 
 	return stats, nil
 }
+
+// 2つの配信の統計情報比較
+func (c *Client) CompareLivestreams(ctx context.Context, livestreamID1, livestreamID2 int64, opts ...ClientOption) (*ComparisonResult, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	urlPath := fmt.Sprintf("/api/livestream/%d/stats/compare/%d", livestreamID1, livestreamID2)
+	req, err := c.agent.NewRequest(http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+
+	resp, err := sendRequest(ctx, c.agent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	var result *ComparisonResult
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateResponse(req, result); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// 配信の盛り上がりヒートマップ取得 (bucketSecondsが0の場合はサーバのデフォルト)
+func (c *Client) GetLivestreamHeatmap(ctx context.Context, livestreamID int64, streamerName string, bucketSeconds int64, opts ...ClientOption) ([]HeatmapBucket, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	if err := c.setStreamerURL(streamerName); err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	urlPath := fmt.Sprintf("/api/livestream/%d/heatmap", livestreamID)
+	req, err := c.themeAgent.NewRequest(http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	if bucketSeconds != 0 {
+		query := req.URL.Query()
+		query.Add("bucket_seconds", strconv.FormatInt(bucketSeconds, 10))
+		req.URL.RawQuery = query.Encode()
+	}
+
+	resp, err := sendRequest(ctx, c.themeAgent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	buckets := []HeatmapBucket{}
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&buckets); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+	}
+
+	return buckets, nil
+}
+
+// 自分の配信のチップ収益取得
+// since, untilが0の場合は、その条件を指定しない
+func (c *Client) GetStreamEarnings(ctx context.Context, since, until int64, opts ...ClientOption) (*StreamEarnings, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	req, err := c.agent.NewRequest(http.MethodGet, "/api/user/me/stream-earnings", nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	query := req.URL.Query()
+	if since != 0 {
+		query.Add("since", strconv.FormatInt(since, 10))
+	}
+	if until != 0 {
+		query.Add("until", strconv.FormatInt(until, 10))
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := sendRequest(ctx, c.agent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	var earnings *StreamEarnings
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&earnings); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateResponse(req, earnings); err != nil {
+			return nil, err
+		}
+	}
+
+	return earnings, nil
+}
+
+// 自分が送ったチップの履歴取得
+// cursorが0の場合は最新から
+func (c *Client) GetTipSentHistory(ctx context.Context, cursor int64, opts ...ClientOption) ([]TipHistoryEntry, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	req, err := c.agent.NewRequest(http.MethodGet, "/api/user/me/tip-sent-history", nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	query := req.URL.Query()
+	if o.limitParam != nil {
+		query.Add("limit", strconv.Itoa(o.limitParam.Limit))
+	}
+	if cursor != 0 {
+		query.Add("cursor", strconv.FormatInt(cursor, 10))
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := sendRequest(ctx, c.agent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	history := []TipHistoryEntry{}
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateSlice(req, history); err != nil {
+			return nil, err
+		}
+	}
+
+	return history, nil
+}
+
+// 配信のチップランキング取得
+func (c *Client) GetDonorLeaderboard(ctx context.Context, livestreamID int64, streamerName string, opts ...ClientOption) ([]DonorEntry, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	if err := c.setStreamerURL(streamerName); err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+	urlPath := fmt.Sprintf("/api/livestream/%d/donor-leaderboard", livestreamID)
+	req, err := c.themeAgent.NewRequest(http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, bencherror.NewInternalError(err)
+	}
+
+	if o.limitParam != nil {
+		query := req.URL.Query()
+		query.Add("limit", strconv.Itoa(o.limitParam.Limit))
+		req.URL.RawQuery = query.Encode()
+	}
+
+	resp, err := sendRequest(ctx, c.themeAgent, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	entries := []DonorEntry{}
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+			return nil, bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateSlice(req, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
@@ -2,6 +2,8 @@ package isupipe
 
 import (
 	"context"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -114,6 +116,56 @@ func TestGetUserStats(t *testing.T) {
 	assert.Equal(t, int64(1), stats4.TotalLivecomments-stats.TotalLivecomments)
 }
 
+func TestGetUserStats_FavoriteEmojiIgnoresCase(t *testing.T) {
+	ctx := context.Background()
+
+	testLogger, err := logger.InitTestLogger()
+	assert.NoError(t, err)
+
+	streamerClient, err := NewClient(testLogger, agent.WithTimeout(20*time.Second))
+	assert.NoError(t, err)
+	streamer, err := streamerClient.Register(ctx, &RegisterRequest{
+		Name:        "favorite-emoji-case-streamer",
+		DisplayName: "favorite-emoji-case-streamer",
+		Description: "blah",
+		Password:    "test",
+		Theme: Theme{
+			DarkMode: true,
+		},
+	})
+	assert.NoError(t, err)
+	err = streamerClient.Login(ctx, &LoginRequest{
+		Username: streamer.Name,
+		Password: "test",
+	})
+	assert.NoError(t, err)
+
+	livestream, err := streamerClient.ReserveLivestream(ctx, streamer.Name, &ReserveLivestreamRequest{
+		Title:        "favorite-emoji-case",
+		Description:  "favorite-emoji-case",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      time.Date(2024, 9, 10, 0, 0, 0, 0, time.UTC).Unix(),
+		EndAt:        time.Date(2024, 9, 10, 1, 0, 0, 0, time.UTC).Unix(),
+		Tags:         []int64{},
+	})
+	assert.NoError(t, err)
+
+	// 大文字小文字を区別するとHeart, heart, smileが1件ずつで並び、smileがお気に入りになってしまう
+	for _, emojiName := range []string{"Heart", "heart", "smile"} {
+		reaction, err := streamerClient.PostReaction(ctx, livestream.ID, streamer.Name, &PostReactionRequest{
+			EmojiName: emojiName,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, strings.ToLower(emojiName), reaction.EmojiName)
+	}
+
+	stats, err := streamerClient.GetUserStatistics(ctx, streamer.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats.TotalReactions)
+	assert.Equal(t, "heart", stats.FavoriteEmoji)
+}
+
 func TestGetLivestreamStats(t *testing.T) {
 	ctx := context.Background()
 
@@ -191,6 +243,78 @@ func TestGetLivestreamStats(t *testing.T) {
 	assert.Equal(t, int64(1), stats5.TotalReports-stats.TotalReports)
 }
 
+func TestClient_TipHistory_EmptyForNewUser(t *testing.T) {
+	ctx := context.Background()
+
+	viewer := newReservationClients(t, ctx, 1)[0]
+	history, err := viewer.client.GetTipSentHistory(ctx, 0)
+	assert.NoError(t, err)
+	assert.NotNil(t, history)
+	assert.Empty(t, history)
+}
+
+func TestClient_CompareLivestreams_Tie(t *testing.T) {
+	ctx := context.Background()
+
+	// リアクションもチップもない配信同士は引き分け
+	streamers := newReservationClients(t, ctx, 2)
+	livestreamIDs := make([]int64, len(streamers))
+	for i, streamer := range streamers {
+		startAt, endAt := nextReservationTerm()
+		livestream, err := streamer.client.ReserveLivestream(ctx, streamer.name, &ReserveLivestreamRequest{
+			Title:        "compare-test",
+			Description:  "compare-test",
+			PlaylistUrl:  "https://example.com",
+			ThumbnailUrl: "https://example.com",
+			StartAt:      startAt,
+			EndAt:        endAt,
+			Tags:         []int64{},
+		})
+		assert.NoError(t, err)
+		livestreamIDs[i] = livestream.ID
+	}
+
+	result, err := streamers[0].client.CompareLivestreams(ctx, livestreamIDs[0], livestreamIDs[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "tie", result.Winner)
+	assert.Equal(t, int64(0), result.Stream1.TotalReactions)
+	assert.Equal(t, int64(0), result.Stream2.TotalReactions)
+
+	// 同じ配信同士は比較できない
+	_, err = streamers[0].client.CompareLivestreams(ctx, livestreamIDs[0], livestreamIDs[0], WithStatusCode(http.StatusBadRequest))
+	assert.NoError(t, err)
+}
+
+func TestClient_LivestreamHeatmap(t *testing.T) {
+	ctx := context.Background()
+
+	streamer := newReservationClients(t, ctx, 1)[0]
+	startAt, endAt := nextReservationTerm()
+	livestream, err := streamer.client.ReserveLivestream(ctx, streamer.name, &ReserveLivestreamRequest{
+		Title:        "heatmap-test",
+		Description:  "heatmap-test",
+		PlaylistUrl:  "https://example.com",
+		ThumbnailUrl: "https://example.com",
+		StartAt:      startAt,
+		EndAt:        endAt,
+		Tags:         []int64{},
+	})
+	assert.NoError(t, err)
+
+	// 1時間の配信を10分ごとに区切る
+	buckets, err := streamer.client.GetLivestreamHeatmap(ctx, livestream.ID, streamer.name, 600)
+	assert.NoError(t, err)
+	assert.Len(t, buckets, 6)
+	for i, b := range buckets {
+		assert.Equal(t, int64(i*600), b.OffsetSeconds)
+		assert.Zero(t, b.ViewerCount)
+		assert.Zero(t, b.ReactionCount)
+	}
+
+	_, err = streamer.client.GetLivestreamHeatmap(ctx, livestream.ID, streamer.name, -1, WithStatusCode(http.StatusBadRequest))
+	assert.NoError(t, err)
+}
+
 func TestStatsRank(t *testing.T) {
 
 }
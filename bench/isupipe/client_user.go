@@ -18,8 +18,9 @@ type User struct {
 	DisplayName string `json:"display_name" validate:"required"`
 	Description string `json:"description" validate:"required"`
 	// NOTE: themeはboolのフィールドにアクセスすることしかないので、validate対象外
-	Theme    Theme  `json:"theme"`
-	IconHash string `json:"icon_hash" validate:"required"`
+	Theme      Theme  `json:"theme"`
+	IconHash   string `json:"icon_hash" validate:"required"`
+	BadgeCount int    `json:"badge_count"`
 }
 
 type (
@@ -179,7 +180,63 @@ func (c *Client) PostIcon(ctx context.Context, r *PostIconRequest, opts ...Clien
 	return iconResp, nil
 }
 
+// アイコン更新 (更新後のアイコンのETagも返す)
+// WithIfMatchを指定すると、現在のアイコンのハッシュと一致する場合のみ更新される
+func (c *Client) PatchIcon(ctx context.Context, r *PostIconRequest, opts ...ClientOption) (*PostIconResponse, string, error) {
+	var (
+		defaultStatusCode = http.StatusOK
+		o                 = newClientOptions(defaultStatusCode, opts...)
+	)
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, "", bencherror.NewInternalError(err)
+	}
+
+	endpoint := "/api/user/me/icon"
+	req, err := c.agent.NewRequest(http.MethodPatch, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, "", bencherror.NewInternalError(err)
+	}
+	req.Header.Add("Content-Type", "application/json;charset=utf-8")
+	if o.ifMatch != "" {
+		req.Header.Set("If-Match", `"`+o.ifMatch+`"`)
+	}
+	resp, err := sendRequest(ctx, c.agent, req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != o.wantStatusCode {
+		return nil, "", bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+	}
+
+	var iconResp *PostIconResponse
+	if resp.StatusCode == defaultStatusCode {
+		if err := json.NewDecoder(resp.Body).Decode(&iconResp); err != nil {
+			return nil, "", bencherror.NewHttpResponseError(err, req)
+		}
+
+		if err := ValidateResponse(req, iconResp); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return iconResp, resp.Header.Get("ETag"), nil
+}
+
 func (c *Client) GetUser(ctx context.Context, username string, opts ...ClientOption) (*User, error) {
+	user, _, err := c.GetUserWithLastModified(ctx, username, opts...)
+	return user, err
+}
+
+// ユーザ取得 (Last-Modifiedヘッダも返す)
+// WithIfModifiedSinceを指定して304が返った場合、ユーザはnilになる
+func (c *Client) GetUserWithLastModified(ctx context.Context, username string, opts ...ClientOption) (*User, string, error) {
 	var (
 		defaultStatusCode = http.StatusOK
 		o                 = newClientOptions(defaultStatusCode, opts...)
@@ -188,12 +245,15 @@ func (c *Client) GetUser(ctx context.Context, username string, opts ...ClientOpt
 	urlPath := fmt.Sprintf("/api/user/%s", username)
 	req, err := c.agent.NewRequest(http.MethodGet, urlPath, nil)
 	if err != nil {
-		return nil, bencherror.NewInternalError(err)
+		return nil, "", bencherror.NewInternalError(err)
+	}
+	if o.ifModifiedSince != "" {
+		req.Header.Set("If-Modified-Since", o.ifModifiedSince)
 	}
 
 	resp, err := sendRequest(ctx, c.agent, req)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer func() {
 		io.Copy(io.Discard, resp.Body)
@@ -201,21 +261,21 @@ func (c *Client) GetUser(ctx context.Context, username string, opts ...ClientOpt
 	}()
 
 	if resp.StatusCode != o.wantStatusCode {
-		return nil, bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
+		return nil, "", bencherror.NewHttpStatusError(req, o.wantStatusCode, resp.StatusCode)
 	}
 
 	var user *User
 	if resp.StatusCode == defaultStatusCode {
 		if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-			return nil, bencherror.NewHttpResponseError(err, req)
+			return nil, "", bencherror.NewHttpResponseError(err, req)
 		}
 
 		if err := ValidateResponse(req, user); err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
 
-	return user, nil
+	return user, resp.Header.Get("Last-Modified"), nil
 }
 
 func (c *Client) GetMe(ctx context.Context, opts ...ClientOption) (*User, error) {
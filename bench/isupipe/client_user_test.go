@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"fmt"
 	"image"
 	_ "image/jpeg"
+	"net/http"
 	"testing"
 	"time"
 
@@ -75,3 +77,92 @@ func TestClientUser_Login(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "jpeg", imageFormat)
 }
+
+func TestClientUser_GetUserNotModified(t *testing.T) {
+	ctx := context.Background()
+
+	testLogger, err := logger.InitTestLogger()
+	assert.NoError(t, err)
+
+	client, err := NewClient(
+		testLogger,
+		agent.WithBaseURL(config.TargetBaseURL),
+		agent.WithTimeout(1*time.Minute),
+	)
+	assert.NoError(t, err)
+
+	streamer := scheduler.UserScheduler.GetRandomStreamer()
+	client.Register(ctx, &RegisterRequest{
+		Name:        streamer.Name,
+		DisplayName: streamer.DisplayName,
+		Description: streamer.Description,
+		Password:    streamer.RawPassword,
+		Theme: Theme{
+			DarkMode: streamer.DarkMode,
+		},
+	})
+
+	err = client.Login(ctx, &LoginRequest{
+		Username: streamer.Name,
+		Password: streamer.RawPassword,
+	})
+	assert.NoError(t, err)
+
+	user, lastModified, err := client.GetUserWithLastModified(ctx, streamer.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, streamer.Name, user.Name)
+	assert.NotEmpty(t, lastModified)
+
+	// 更新がなければ、返却されたLast-Modifiedでの再取得は304になる
+	_, _, err = client.GetUserWithLastModified(ctx, streamer.Name, WithIfModifiedSince(lastModified), WithStatusCode(http.StatusNotModified))
+	assert.NoError(t, err)
+}
+
+func TestClient_PatchIcon_PreconditionFailed(t *testing.T) {
+	ctx := context.Background()
+
+	testLogger, err := logger.InitTestLogger()
+	assert.NoError(t, err)
+
+	client, err := NewClient(
+		testLogger,
+		agent.WithBaseURL(config.TargetBaseURL),
+		agent.WithTimeout(1*time.Minute),
+	)
+	assert.NoError(t, err)
+
+	streamer := scheduler.UserScheduler.GetRandomStreamer()
+	client.Register(ctx, &RegisterRequest{
+		Name:        streamer.Name,
+		DisplayName: streamer.DisplayName,
+		Description: streamer.Description,
+		Password:    streamer.RawPassword,
+		Theme: Theme{
+			DarkMode: streamer.DarkMode,
+		},
+	})
+
+	err = client.Login(ctx, &LoginRequest{
+		Username: streamer.Name,
+		Password: streamer.RawPassword,
+	})
+	assert.NoError(t, err)
+
+	user, err := client.GetUser(ctx, streamer.Name)
+	assert.NoError(t, err)
+
+	// 現在のアイコンと異なるハッシュを指定すると更新されない
+	// 画像として不正な内容は先に400で拒否されるので、実在するアイコン画像を使う
+	newIcon := scheduler.IconSched.GetRandomIcon().Image
+	_, _, err = client.PatchIcon(ctx, &PostIconRequest{Image: newIcon}, WithIfMatch("stale"), WithStatusCode(http.StatusPreconditionFailed))
+	assert.NoError(t, err)
+
+	after, err := client.GetUser(ctx, streamer.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, user.IconHash, after.IconHash)
+
+	// 現在のアイコンのハッシュを指定すると更新され、新しいアイコンのETagが返る
+	_, eTag, err := client.PatchIcon(ctx, &PostIconRequest{Image: newIcon}, WithIfMatch(user.IconHash))
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("\"%x\"", sha256.Sum256(newIcon)), eTag)
+}
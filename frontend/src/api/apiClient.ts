@@ -76,9 +76,11 @@ export interface Parameter$get$livestream$_livestreamid$livecomment {
   livestreamid: string;
   /** 取得件数の最大数 */
   limit?: number;
+  /** 前回のレスポンスのnext_cursor */
+  cursor?: string;
 }
 export interface Response$get$livestream$_livestreamid$livecomment$Status$200 {
-  'application/json': Schemas.Livecomment[];
+  'application/json': Schemas.LivecommentPage;
 }
 export interface Parameter$post$livestream$livestreamid$livecomment {
   livestreamid: string;
@@ -648,6 +650,7 @@ export class Client<RequestOption> {
     };
     const queryParameters: QueryParameters = {
       limit: { value: params.parameter.limit, explode: false },
+      cursor: { value: params.parameter.cursor, explode: false },
     };
     return this.apiClient.request(
       {
@@ -5,6 +5,7 @@ import useSWR, { type SWRConfiguration } from 'swr';
 import { getThumbnailUrl } from '~/assets';
 import { Parameter$get$livestream$search } from './apiClient';
 import { HTTPError, apiClient } from './client';
+import { Schemas } from './types';
 
 export function useUserMe(config?: SWRConfiguration) {
   return useSWR(
@@ -75,19 +76,31 @@ export function useLiveUserStream(
   );
 }
 
+const liveStreamCommentLimit = 100;
+
 export function useLiveStreamComment(
   id: string | null,
   config?: SWRConfiguration,
 ) {
   return useSWR(
     id && `/livestream/${id}/livecomment`,
-    () =>
-      apiClient.get$livestream$_livestreamid$livecomment({
-        parameter: {
-          livestreamid: id ?? '',
-          limit: 100,
-        },
-      }),
+    async () => {
+      // 新しい順に返るので、next_cursorを辿って最新のliveStreamCommentLimit件を集める
+      const livecomments: Schemas.Livecomment[] = [];
+      let cursor: string | undefined;
+      do {
+        const page = await apiClient.get$livestream$_livestreamid$livecomment({
+          parameter: {
+            livestreamid: id ?? '',
+            limit: liveStreamCommentLimit - livecomments.length,
+            cursor,
+          },
+        });
+        livecomments.push(...page.livecomments);
+        cursor = page.next_cursor || undefined;
+      } while (cursor && livecomments.length < liveStreamCommentLimit);
+      return livecomments;
+    },
     config,
   );
 }
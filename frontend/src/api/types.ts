@@ -55,6 +55,11 @@ export namespace Schemas {
     created_at?: number;
     updated_at?: number;
   }
+  /** ライブコメントの取得結果 (next_cursorが空でなければ続きがある) */
+  export interface LivecommentPage {
+    livecomments: Schemas.Livecomment[];
+    next_cursor: string;
+  }
   export interface LivestreamStatistics {
     rank: number;
     viewers_count: number;
@@ -135,7 +140,7 @@ export namespace Responses {
   /** Example response */
   export namespace GetLivecomments {
     export interface Content {
-      'application/json': Schemas.Livecomment[];
+      'application/json': Schemas.LivecommentPage;
     }
   }
 }
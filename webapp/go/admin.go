@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v4"
+)
+
+const adminSecretHeader = "X-Admin-Secret"
+
+// adminSecret は、管理APIの認証に使う共有シークレット
+// 未設定の場合は、管理APIへのリクエストを全て拒否する
+var adminSecret string
+
+func init() {
+	if v, ok := os.LookupEnv("ISUCON13_ADMIN_SECRET"); ok {
+		adminSecret = v
+	}
+}
+
+// AdminAuthMiddleware は、X-Admin-Secretヘッダが管理用シークレットと一致しないリクエストを403で拒否する
+func AdminAuthMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !isAdminSecret(c.Request().Header.Get(adminSecretHeader)) {
+				return echo.NewHTTPError(http.StatusForbidden, "invalid admin secret")
+			}
+			return next(c)
+		}
+	}
+}
+
+func isAdminSecret(v string) bool {
+	if adminSecret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(v), []byte(adminSecret)) == 1
+}
+
+// registerAdminHandlers は、管理APIをAdminAuthMiddleware付きで登録する
+func registerAdminHandlers(e *echo.Echo) {
+	admin := AdminAuthMiddleware()
+	e.POST("/api/admin/optimize-db", postOptimizeDBHandler, admin)
+	e.GET("/api/admin/optimize-db/status", getOptimizeDBStatusHandler, admin)
+	e.GET("/api/admin/audit-log", getAuditLogHandler, admin)
+	// ルートごとのレスポンスタイム
+	e.GET("/api/metrics/latency", getLatencyMetricsHandler, admin)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/goccy/go-json"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+// アナウンスの最大文字数 (livestream_announcements.messageのVARCHAR(500))
+const MaxAnnouncementLength = 500
+
+// アナウンス購読中に、プロキシに切断されないようコメント行を送る間隔
+const announcementStreamKeepAliveInterval = 15 * time.Second
+
+type AnnouncementModel struct {
+	ID           int64  `db:"id"`
+	LivestreamID int64  `db:"livestream_id"`
+	Message      string `db:"message"`
+	ExpiresAt    int64  `db:"expires_at"`
+	CreatedAt    int64  `db:"created_at"`
+}
+
+type PostAnnouncementRequest struct {
+	Message         string `json:"message"`
+	DurationSeconds int64  `json:"duration_seconds"`
+}
+
+type Announcement struct {
+	ID           int64  `json:"id"`
+	LivestreamID int64  `json:"livestream_id"`
+	Message      string `json:"message"`
+	ExpiresAt    int64  `json:"expires_at"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// 配信者アナウンス投稿API (配信者のみ)
+// POST /api/livestream/:livestream_id/announce
+func postAnnouncementHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PostAnnouncementRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if req.Message == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "message must not be empty")
+	}
+	if utf8.RuneCountInString(req.Message) > MaxAnnouncementLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("message must be at most %d characters", MaxAnnouncementLength))
+	}
+	if req.DurationSeconds <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "duration_seconds must be positive")
+	}
+
+	announcement, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (Announcement, error) {
+		if _, err := lockOwnLivestream(ctx, tx, int64(livestreamID), userID); err != nil {
+			return Announcement{}, err
+		}
+
+		now := time.Now().Unix()
+		announcementModel := AnnouncementModel{
+			LivestreamID: int64(livestreamID),
+			Message:      req.Message,
+			ExpiresAt:    now + req.DurationSeconds,
+			CreatedAt:    now,
+		}
+		rs, err := tx.NamedExecContext(ctx, "INSERT INTO livestream_announcements (livestream_id, message, expires_at, created_at) VALUES (:livestream_id, :message, :expires_at, :created_at)", announcementModel)
+		if err != nil {
+			return Announcement{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert announcement: "+err.Error()).SetInternal(err)
+		}
+		announcementID, err := rs.LastInsertId()
+		if err != nil {
+			return Announcement{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted announcement id: "+err.Error()).SetInternal(err)
+		}
+
+		return Announcement{
+			ID:           announcementID,
+			LivestreamID: announcementModel.LivestreamID,
+			Message:      announcementModel.Message,
+			ExpiresAt:    announcementModel.ExpiresAt,
+			CreatedAt:    announcementModel.CreatedAt,
+		}, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+	// コミット後に配信するので、ロールバックされたアナウンスは購読者に届かない
+	announcementBroadcasters.Publish(announcement.LivestreamID, announcement)
+
+	return c.JSON(http.StatusCreated, announcement)
+}
+
+// 配信者アナウンス購読API (Server-Sent Events)
+// GET /api/livestream/:livestream_id/announcements/stream
+func getAnnouncementStreamHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	var exists bool
+	if err := dbConn.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM livestreams WHERE id = ?)", livestreamID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+	}
+
+	// 現在のアナウンスを読む前に購読しておき、その間に投稿されたものを取りこぼさない
+	b, ch := announcementBroadcasters.Subscribe(int64(livestreamID))
+	defer b.Unsubscribe(ch)
+
+	active, err := getActiveAnnouncement(ctx, dbConn, int64(livestreamID), time.Now())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get announcement: "+err.Error())
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	if active != nil {
+		if err := writeAnnouncementEvent(res, *active); err != nil {
+			return nil
+		}
+	}
+	res.Flush()
+
+	ticker := time.NewTicker(announcementStreamKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case announcement, ok := <-ch:
+			if !ok {
+				// 読み出しが遅く切断された。クライアントに再接続させる
+				return nil
+			}
+			if err := writeAnnouncementEvent(res, announcement); err != nil {
+				return nil
+			}
+		case <-ticker.C:
+			if _, err := res.Write([]byte(": keep-alive\n\n")); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+	}
+}
+
+func writeAnnouncementEvent(w http.ResponseWriter, announcement Announcement) error {
+	b, err := json.Marshal(announcement)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: announcement\ndata: %s\n\n", b)
+	return err
+}
+
+// getActiveAnnouncement は、配信の有効期限内で最新のアナウンスを返す (無ければnil)
+func getActiveAnnouncement(ctx context.Context, q sqlx.QueryerContext, livestreamID int64, now time.Time) (*Announcement, error) {
+	var announcementModel AnnouncementModel
+	if err := sqlx.GetContext(ctx, q, &announcementModel, "SELECT * FROM livestream_announcements WHERE livestream_id = ? AND expires_at > ? ORDER BY created_at DESC, id DESC LIMIT 1", livestreamID, now.Unix()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &Announcement{
+		ID:           announcementModel.ID,
+		LivestreamID: announcementModel.LivestreamID,
+		Message:      announcementModel.Message,
+		ExpiresAt:    announcementModel.ExpiresAt,
+		CreatedAt:    announcementModel.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+func TestGetAnnouncementStreamHandler(t *testing.T) {
+	const (
+		userID       = int64(1)
+		livestreamID = int64(10)
+	)
+	d := &fakeDB{}
+	d.onQuery("SELECT EXISTS(SELECT 1 FROM livestreams WHERE id = ?)", func(_ string, args []driver.Value) (driver.Rows, error) {
+		return fakeValue("exists", args[0] == livestreamID), nil
+	})
+	d.onQuery("SELECT * FROM livestream_announcements", func(string, []driver.Value) (driver.Rows, error) {
+		return &fakeRows{
+			columns: []string{"id", "livestream_id", "message", "expires_at", "created_at"},
+			values:  [][]driver.Value{{int64(1), livestreamID, "welcome", time.Now().Add(time.Hour).Unix(), time.Now().Unix()}},
+		}, nil
+	})
+	useFakeDB(t, d)
+	useSessionVersion(t, userID, 0)
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	e.GET("/api/livestream/:livestream_id/announcements/stream", func(c echo.Context) error {
+		// ログイン済みのセッションとして扱う
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultUserIDKey] = userID
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+		return getAnnouncementStreamHandler(c)
+	})
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	res, err := http.Get(srv.URL + "/api/livestream/11/announcements/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("status for missing livestream = %d, want %d", res.StatusCode, http.StatusNotFound)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/livestream/10/announcements/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if ct := res.Header.Get(echo.HeaderContentType); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	r := bufio.NewReader(res.Body)
+	readEvent := func() Announcement {
+		t.Helper()
+		var data string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read event: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" && data != "" {
+				break
+			}
+			if v, ok := strings.CutPrefix(line, "data: "); ok {
+				data = v
+			}
+		}
+		var a Announcement
+		if err := json.Unmarshal([]byte(data), &a); err != nil {
+			t.Fatalf("failed to decode event %q: %v", data, err)
+		}
+		return a
+	}
+
+	// 接続時に有効なアナウンスが届く
+	if got := readEvent(); got.ID != 1 || got.Message != "welcome" {
+		t.Errorf("first event = %+v, want the active announcement", got)
+	}
+
+	// 最初のイベントを受け取った時点で購読済みなので、投稿されたアナウンスが届く
+	announcementBroadcasters.Publish(livestreamID, Announcement{ID: 2, LivestreamID: livestreamID, Message: "starting soon"})
+	if got := readEvent(); got.ID != 2 || got.Message != "starting soon" {
+		t.Errorf("published event = %+v, want announcement 2", got)
+	}
+
+	// 切断すると購読が解除される
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		b, ok := announcementBroadcasters.data.Load(livestreamID)
+		if !ok || b.(*Broadcaster[Announcement]).Len() == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber must be removed after the client disconnects")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
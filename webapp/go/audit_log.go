@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+// 監査ログに記録する操作の種類
+const (
+	AuditActionGrantModerator    = "moderator.grant"
+	AuditActionRevokeModerator   = "moderator.revoke"
+	AuditActionDeleteLivecomment = "livecomment.delete"
+	AuditActionChangePassword    = "user.password_change"
+)
+
+type AuditLogModel struct {
+	ID       int64  `db:"id"`
+	UserID   int64  `db:"user_id"`
+	Action   string `db:"action"`
+	TargetID int64  `db:"target_id"`
+	// 操作ごとの付加情報 (JSON)
+	Metadata  sql.NullString `db:"metadata"`
+	CreatedAt int64          `db:"created_at"`
+}
+
+const (
+	defaultAuditLogLimit = 50
+	maxAuditLogLimit     = 200
+)
+
+type AuditLog struct {
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"user_id"`
+	Action   string `json:"action"`
+	TargetID int64  `json:"target_id"`
+	// 付加情報がない場合は省略する
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt int64           `json:"created_at"`
+}
+
+// 監査ログ一覧のレスポンス
+// NextCursorは次のページを取得するためのcursorで、最後のページでは空文字になる
+type GetAuditLogResponse struct {
+	AuditLogs  []AuditLog `json:"audit_logs"`
+	NextCursor string     `json:"next_cursor"`
+}
+
+// logAudit は、操作を行ったトランザクションの中で監査ログを書き込む
+// 操作がロールバックされた場合は監査ログも残らない
+// metadataはJSONとして保存し、nilの場合はNULLにする
+func logAudit(ctx context.Context, tx *sqlx.Tx, userID int64, action string, targetID int64, metadata interface{}) error {
+	auditLogModel := AuditLogModel{
+		UserID:    userID,
+		Action:    action,
+		TargetID:  targetID,
+		CreatedAt: time.Now().Unix(),
+	}
+	if metadata != nil {
+		b, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+		auditLogModel.Metadata = sql.NullString{String: string(b), Valid: true}
+	}
+
+	if _, err := tx.NamedExecContext(ctx, "INSERT INTO audit_log (user_id, action, target_id, metadata, created_at) VALUES (:user_id, :action, :target_id, :metadata, :created_at)", auditLogModel); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 監査ログ一覧取得API (管理者のみ)
+// GET /api/admin/audit-log
+// 新しい順に返し、続きはnext_cursorをcursorに指定して取得する
+func getAuditLogHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	limit := defaultAuditLogLimit
+	if v := c.QueryParam("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAuditLogLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit query parameter must be integer between 1 and %d", maxAuditLogLimit))
+		}
+	}
+
+	var cursor int64
+	if v := c.QueryParam("cursor"); v != "" {
+		var err error
+		cursor, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || cursor < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "cursor query parameter must be positive integer")
+		}
+	}
+
+	query := "SELECT * FROM audit_log"
+	args := []any{}
+	if cursor > 0 {
+		query += " WHERE id < ?"
+		args = append(args, cursor)
+	}
+	// 次のページがあるかを知るため1件多く取得する
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	auditLogModels := []AuditLogModel{}
+	if err := dbConn.SelectContext(ctx, &auditLogModels, query, args...); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get audit logs: "+err.Error())
+	}
+
+	var nextCursor string
+	if len(auditLogModels) > limit {
+		auditLogModels = auditLogModels[:limit]
+		nextCursor = strconv.FormatInt(auditLogModels[limit-1].ID, 10)
+	}
+
+	auditLogs := make([]AuditLog, len(auditLogModels))
+	for i, m := range auditLogModels {
+		auditLogs[i] = AuditLog{
+			ID:        m.ID,
+			UserID:    m.UserID,
+			Action:    m.Action,
+			TargetID:  m.TargetID,
+			CreatedAt: m.CreatedAt,
+		}
+		if m.Metadata.Valid {
+			auditLogs[i].Metadata = json.RawMessage(m.Metadata.String)
+		}
+	}
+
+	return c.JSON(http.StatusOK, GetAuditLogResponse{
+		AuditLogs:  auditLogs,
+		NextCursor: nextCursor,
+	})
+}
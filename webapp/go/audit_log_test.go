@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+// newFakeAuditDB は、配信の所有者の取得にだけ応答し、更新系のクエリを記録するfakeDBを作る
+func newFakeAuditDB(ownerID int64) *fakeDB {
+	d := &fakeDB{}
+	d.onQuery("SELECT user_id FROM livestreams", func(string, []driver.Value) (driver.Rows, error) {
+		return fakeValue("user_id", ownerID), nil
+	})
+	d.onExec("", fakeExecOK)
+	return d
+}
+
+func TestDeleteModeratorHandler_WritesAuditLog(t *testing.T) {
+	const (
+		ownerID     = int64(1)
+		moderatorID = int64(2)
+	)
+	d := newFakeAuditDB(ownerID)
+	useFakeDB(t, d)
+	useSessionVersion(t, ownerID, 0)
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	e.DELETE("/api/livestream/:livestream_id/moderators/:user_id", func(c echo.Context) error {
+		// ログイン済みのセッションとして扱う
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultUserIDKey] = ownerID
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+		return deleteModeratorHandler(c)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/livestream/10/moderators/2", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body.String())
+	}
+	if d.commits != 1 {
+		t.Fatalf("commits = %d, want 1", d.commits)
+	}
+
+	execs := d.execs()
+	var audit *fakeStatement
+	for i := range execs {
+		if strings.HasPrefix(execs[i].query, "INSERT INTO audit_log") {
+			audit = &execs[i]
+		}
+	}
+	if audit == nil {
+		t.Fatalf("audit log is not written: %+v", execs)
+	}
+	// user_id, action, target_id, metadata, created_at の順
+	want := []driver.Value{ownerID, AuditActionRevokeModerator, moderatorID, `{"livestream_id":10}`}
+	for i := range want {
+		if audit.args[i] != want[i] {
+			t.Errorf("args[%d] = %v, want %v", i, audit.args[i], want[i])
+		}
+	}
+}
+
+func TestLogAudit_NilMetadata(t *testing.T) {
+	d := newFakeAuditDB(0)
+	db := d.open(t)
+
+	ctx := context.Background()
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := logAudit(ctx, tx, 1, AuditActionGrantModerator, 2, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	execs := d.execs()
+	if len(execs) != 1 {
+		t.Fatalf("execs = %d, want 1", len(execs))
+	}
+	if got := execs[0].args[3]; got != nil {
+		t.Errorf("metadata = %v, want NULL", got)
+	}
+}
+
+func TestGetAuditLogHandler(t *testing.T) {
+	orig := adminSecret
+	adminSecret = "s3cret"
+	t.Cleanup(func() { adminSecret = orig })
+
+	d := &fakeDB{}
+	// id, user_id, action, target_id, metadata, created_at の順で新しい順に並べる
+	rows := [][]driver.Value{
+		{int64(3), int64(1), AuditActionChangePassword, int64(1), nil, int64(300)},
+		{int64(2), int64(1), AuditActionRevokeModerator, int64(2), `{"livestream_id":10}`, int64(200)},
+		{int64(1), int64(1), AuditActionGrantModerator, int64(2), `{"livestream_id":10}`, int64(100)},
+	}
+	d.onQuery("SELECT * FROM audit_log", func(query string, args []driver.Value) (driver.Rows, error) {
+		page := rows
+		if strings.Contains(query, "id < ?") {
+			page = slices.DeleteFunc(slices.Clone(rows), func(r []driver.Value) bool { return r[0].(int64) >= args[0].(int64) })
+		}
+		limit := int(args[len(args)-1].(int64))
+		page = page[:min(limit, len(page))]
+		return &fakeRows{columns: []string{"id", "user_id", "action", "target_id", "metadata", "created_at"}, values: page}, nil
+	})
+	useFakeDB(t, d)
+
+	e := echo.New()
+	registerAdminHandlers(e)
+	get := func(target, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if secret != "" {
+			req.Header.Set(adminSecretHeader, secret)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 管理者以外には見せない
+	if rec := get("/api/admin/audit-log", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("status without admin secret = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := get("/api/admin/audit-log?limit=0", "s3cret"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status with limit=0 = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	var ids []int64
+	cursor := ""
+	for page := 0; ; page++ {
+		target := "/api/admin/audit-log?limit=2"
+		if cursor != "" {
+			target += "&cursor=" + cursor
+		}
+		rec := get(target, "s3cret")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var resp GetAuditLogResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if page == 0 && string(resp.AuditLogs[1].Metadata) != `{"livestream_id":10}` {
+			t.Errorf("metadata = %s, want the stored json", resp.AuditLogs[1].Metadata)
+		}
+		for _, l := range resp.AuditLogs {
+			ids = append(ids, l.ID)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		cursor = resp.NextCursor
+	}
+	if want := []int64{3, 2, 1}; !slices.Equal(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+}
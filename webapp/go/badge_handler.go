@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+// 実績バッジの種類
+const (
+	// 初めて配信を予約した
+	BadgeTypeFirstStream = "first_stream"
+	// 累計チップ額がtycoonTipThresholdを超えた
+	BadgeTypeTycoon = "tycoon"
+	// ユーザランキングで1位になった
+	BadgeTypePopular = "popular"
+	// 登録からveteranRegisteredPeriodが経過した
+	BadgeTypeVeteran = "veteran"
+)
+
+const (
+	tycoonTipThreshold      = 10000
+	veteranRegisteredPeriod = 90 * 24 * time.Hour
+
+	badgeCheckInterval = 24 * time.Hour
+	badgeCheckTimeout  = 1 * time.Minute
+
+	// バッジは1日1回しか付与しないので、他のサーバで付与された分はこの時間だけ遅れて反映される
+	badgeCountCacheTTL = 60 * time.Second
+)
+
+type BadgeModel struct {
+	UserID    int64  `db:"user_id"`
+	BadgeType string `db:"badge_type"`
+	EarnedAt  int64  `db:"earned_at"`
+}
+
+type Badge struct {
+	Type     string `json:"type"`
+	EarnedAt int64  `json:"earned_at"`
+}
+
+// 実績バッジ一覧取得API
+// GET /api/user/:username/badges
+func getUserBadgesHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	username := c.Param("username")
+
+	var userModel UserModel
+	if err := dbConn.GetContext(ctx, &userModel, "SELECT * FROM users WHERE name = ?", username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "not found user that has the given username")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
+	}
+
+	badges := []Badge{}
+	if err := dbConn.SelectContext(ctx, &badges, "SELECT badge_type AS type, earned_at FROM user_badges WHERE user_id = ? ORDER BY earned_at ASC, badge_type ASC", userModel.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get badges: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, badges)
+}
+
+var badgeCountCache = &BadgeCountCache{}
+
+type badgeCountEntry struct {
+	value      int
+	expiration time.Time
+}
+
+// BadgeCountCache は、ユーザIDごとのバッジ数を保持する
+type BadgeCountCache struct {
+	data sync.Map
+}
+
+func (m *BadgeCountCache) Set(userID int64, count int, ttl time.Duration) {
+	m.data.Store(userID, badgeCountEntry{
+		value:      count,
+		expiration: time.Now().Add(jitteredTTL(ttl)),
+	})
+}
+
+func (m *BadgeCountCache) Get(userID int64) (int, bool) {
+	v, ok := m.data.Load(userID)
+	if !ok {
+		return 0, false
+	}
+
+	e := v.(badgeCountEntry)
+	if time.Now().After(e.expiration) {
+		m.data.Delete(userID)
+		return 0, false
+	}
+	return e.value, true
+}
+
+func (m *BadgeCountCache) Delete(userID int64) {
+	m.data.Delete(userID)
+}
+
+func (m *BadgeCountCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+}
+
+func getBadgeCount(ctx context.Context, q sqlx.QueryerContext, userID int64) (int, error) {
+	if count, ok := badgeCountCache.Get(userID); ok {
+		return count, nil
+	}
+
+	var count int
+	if err := sqlx.GetContext(ctx, q, &count, "SELECT COUNT(*) FROM user_badges WHERE user_id = ?", userID); err != nil {
+		return 0, err
+	}
+	badgeCountCache.Set(userID, count, badgeCountCacheTTL)
+
+	return count, nil
+}
+
+// getBadgeCountMap は、ユーザIDをキーとしたバッジ数を返す
+// バッジのないユーザはmapに含まれない。キャッシュにないユーザのバッジ数だけをまとめて取得する
+func getBadgeCountMap(ctx context.Context, q sqlx.QueryerContext, userIDs []int64) (map[int64]int, error) {
+	countMap := make(map[int64]int, len(userIDs))
+	missingIDs := make([]int64, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if count, ok := badgeCountCache.Get(userID); ok {
+			if count > 0 {
+				countMap[userID] = count
+			}
+		} else {
+			missingIDs = append(missingIDs, userID)
+		}
+	}
+	if len(missingIDs) == 0 {
+		return countMap, nil
+	}
+
+	query, params, err := sqlx.In("SELECT user_id, COUNT(*) AS count FROM user_badges WHERE user_id IN (?) GROUP BY user_id", missingIDs)
+	if err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		UserID int64 `db:"user_id"`
+		Count  int   `db:"count"`
+	}
+	if err := sqlx.SelectContext(ctx, q, &counts, query, params...); err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		countMap[c.UserID] = c.Count
+	}
+	// バッジのないユーザも0件としてキャッシュする
+	for _, userID := range missingIDs {
+		badgeCountCache.Set(userID, countMap[userID], badgeCountCacheTTL)
+	}
+	return countMap, nil
+}
+
+func hasEarnedFirstStream(totalStreams int64) bool {
+	return totalStreams > 0
+}
+
+func hasEarnedTycoon(totalTip int64) bool {
+	return totalTip > tycoonTipThreshold
+}
+
+// スコアが0のまま1位になっている場合は対象外
+func hasEarnedPopular(rank, score int64) bool {
+	return rank == 1 && score > 0
+}
+
+// 登録日時が不明 (0) なユーザは対象外
+func hasEarnedVeteran(createdAt int64, now time.Time) bool {
+	return createdAt > 0 && now.Sub(time.Unix(createdAt, 0)) > veteranRegisteredPeriod
+}
+
+func runBadgeCheck() {
+	ticker := time.NewTicker(badgeCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), badgeCheckTimeout)
+		if err := awardBadges(ctx, time.Now()); err != nil {
+			log.Printf("failed to award badges: %v", err)
+		}
+		cancel()
+	}
+}
+
+// awardBadges は、ユーザ統計と同じ集計を使ってバッジの獲得条件を調べ、未獲得のバッジを付与する
+func awardBadges(ctx context.Context, now time.Time) error {
+	scores, err := getUserScores(ctx)
+	if err != nil {
+		return err
+	}
+
+	var streamCounts []struct {
+		UserID int64 `db:"user_id"`
+		Count  int64 `db:"count"`
+	}
+	if err := dbConn.SelectContext(ctx, &streamCounts, "SELECT user_id, COUNT(*) AS count FROM livestreams GROUP BY user_id"); err != nil {
+		return err
+	}
+	streamCountMap := make(map[int64]int64, len(streamCounts))
+	for _, c := range streamCounts {
+		streamCountMap[c.UserID] = c.Count
+	}
+
+	// ランキングは昇順なので、末尾が1位
+	ranking := scores.ranking()
+	rankMap := make(map[string]int64, len(ranking))
+	for i := range ranking {
+		rankMap[ranking[i].Username] = int64(len(ranking) - i)
+	}
+
+	var badges []BadgeModel
+	for _, user := range scores.users {
+		var earned []string
+		if hasEarnedFirstStream(streamCountMap[user.ID]) {
+			earned = append(earned, BadgeTypeFirstStream)
+		}
+		if hasEarnedTycoon(scores.tips[user.ID]) {
+			earned = append(earned, BadgeTypeTycoon)
+		}
+		if hasEarnedPopular(rankMap[user.Name], scores.reactions[user.ID]+scores.tips[user.ID]) {
+			earned = append(earned, BadgeTypePopular)
+		}
+		if hasEarnedVeteran(user.CreatedAt, now) {
+			earned = append(earned, BadgeTypeVeteran)
+		}
+		for _, badgeType := range earned {
+			badges = append(badges, BadgeModel{
+				UserID:    user.ID,
+				BadgeType: badgeType,
+				EarnedAt:  now.Unix(),
+			})
+		}
+	}
+	return grantBadges(ctx, badges, now)
+}
+
+// grantBadges は、badgesのうち未獲得のものを付与する
+// 新しくバッジを獲得したユーザは、プロフィールのbadge_countが変わるので最終更新日時を進める
+func grantBadges(ctx context.Context, badges []BadgeModel, now time.Time) error {
+	if len(badges) == 0 {
+		return nil
+	}
+
+	var owned []BadgeModel
+	if err := dbConn.SelectContext(ctx, &owned, "SELECT user_id, badge_type, earned_at FROM user_badges"); err != nil {
+		return err
+	}
+	type badgeKey struct {
+		userID    int64
+		badgeType string
+	}
+	ownedSet := make(map[badgeKey]struct{}, len(owned))
+	for _, b := range owned {
+		ownedSet[badgeKey{b.UserID, b.BadgeType}] = struct{}{}
+	}
+
+	var newBadges []BadgeModel
+	var userIDs []int64
+	for _, b := range badges {
+		if _, ok := ownedSet[badgeKey{b.UserID, b.BadgeType}]; ok {
+			continue
+		}
+		if len(newBadges) == 0 || newBadges[len(newBadges)-1].UserID != b.UserID {
+			userIDs = append(userIDs, b.UserID)
+		}
+		newBadges = append(newBadges, b)
+	}
+	if len(newBadges) == 0 {
+		return nil
+	}
+
+	// 他のサーバが同時に付与した場合も、獲得済みのバッジは獲得日時を変えない
+	if _, err := dbConn.NamedExecContext(ctx, "INSERT IGNORE INTO user_badges (user_id, badge_type, earned_at) VALUES (:user_id, :badge_type, :earned_at)", newBadges); err != nil {
+		return err
+	}
+	query, params, err := sqlx.In("UPDATE users SET updated_at = ? WHERE id IN (?)", now.Unix(), userIDs)
+	if err != nil {
+		return err
+	}
+	if _, err := dbConn.ExecContext(ctx, query, params...); err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		badgeCountCache.Delete(userID)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHasEarnedFirstStream(t *testing.T) {
+	if hasEarnedFirstStream(0) {
+		t.Error("hasEarnedFirstStream(0) = true, want false")
+	}
+	if !hasEarnedFirstStream(1) {
+		t.Error("hasEarnedFirstStream(1) = false, want true")
+	}
+}
+
+func TestHasEarnedTycoon(t *testing.T) {
+	tests := []struct {
+		totalTip int64
+		want     bool
+	}{
+		{totalTip: 0, want: false},
+		// しきい値ちょうどは対象外
+		{totalTip: tycoonTipThreshold, want: false},
+		{totalTip: tycoonTipThreshold + 1, want: true},
+	}
+	for _, tt := range tests {
+		if got := hasEarnedTycoon(tt.totalTip); got != tt.want {
+			t.Errorf("hasEarnedTycoon(%d) = %v, want %v", tt.totalTip, got, tt.want)
+		}
+	}
+}
+
+func TestHasEarnedPopular(t *testing.T) {
+	tests := []struct {
+		name  string
+		rank  int64
+		score int64
+		want  bool
+	}{
+		{name: "rank 1", rank: 1, score: 10, want: true},
+		{name: "rank 2", rank: 2, score: 10, want: false},
+		{name: "rank 1 without score", rank: 1, score: 0, want: false},
+	}
+	for _, tt := range tests {
+		if got := hasEarnedPopular(tt.rank, tt.score); got != tt.want {
+			t.Errorf("%s: hasEarnedPopular(%d, %d) = %v, want %v", tt.name, tt.rank, tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestHasEarnedVeteran(t *testing.T) {
+	now := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		createdAt int64
+		want      bool
+	}{
+		{name: "registered 91 days ago", createdAt: now.Add(-91 * 24 * time.Hour).Unix(), want: true},
+		{name: "registered 89 days ago", createdAt: now.Add(-89 * 24 * time.Hour).Unix(), want: false},
+		{name: "exactly 90 days", createdAt: now.Add(-veteranRegisteredPeriod).Unix(), want: false},
+		{name: "unknown registration date", createdAt: 0, want: false},
+	}
+	for _, tt := range tests {
+		if got := hasEarnedVeteran(tt.createdAt, now); got != tt.want {
+			t.Errorf("%s: hasEarnedVeteran = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUserRankingRankOf(t *testing.T) {
+	scores := userScores{
+		users: []*UserModel{
+			{ID: 1, Name: "alice"},
+			{ID: 2, Name: "bob"},
+			{ID: 3, Name: "carol"},
+		},
+		reactions: map[int64]int64{1: 5, 2: 1},
+		tips:      map[int64]int64{2: 10},
+	}
+	ranking := scores.ranking()
+	for name, want := range map[string]int64{"bob": 1, "alice": 2, "carol": 3} {
+		if got := ranking.rankOf(name); got != want {
+			t.Errorf("rankOf(%q) = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestGrantBadges_TouchesOnlyNewlyBadgedUsers(t *testing.T) {
+	d := &fakeDB{}
+	// ユーザ1は初配信バッジを獲得済み
+	d.onQuery("SELECT user_id, badge_type, earned_at FROM user_badges", func(string, []driver.Value) (driver.Rows, error) {
+		return &fakeRows{
+			columns: []string{"user_id", "badge_type", "earned_at"},
+			values:  [][]driver.Value{{int64(1), BadgeTypeFirstStream, int64(100)}},
+		}, nil
+	})
+	d.onExec("", fakeExecOK)
+	useFakeDB(t, d)
+	badgeCountCache.Set(1, 1, time.Hour)
+	badgeCountCache.Set(2, 0, time.Hour)
+	t.Cleanup(badgeCountCache.CleanupAll)
+
+	now := time.Unix(200, 0)
+	err := grantBadges(context.Background(), []BadgeModel{
+		{UserID: 1, BadgeType: BadgeTypeFirstStream, EarnedAt: now.Unix()},
+		{UserID: 2, BadgeType: BadgeTypeFirstStream, EarnedAt: now.Unix()},
+		{UserID: 2, BadgeType: BadgeTypeTycoon, EarnedAt: now.Unix()},
+	}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	execs := d.execs()
+	if len(execs) != 2 {
+		t.Fatalf("execs = %v, want INSERT and UPDATE", d.execQueries())
+	}
+	// 獲得済みのバッジは書き込まない
+	if want := []driver.Value{int64(2), BadgeTypeFirstStream, int64(200), int64(2), BadgeTypeTycoon, int64(200)}; !slices.Equal(execs[0].args, want) {
+		t.Errorf("inserted = %v, want %v", execs[0].args, want)
+	}
+	// 新しくバッジを獲得したユーザだけ最終更新日時を進める
+	if want := []driver.Value{int64(200), int64(2)}; !slices.Equal(execs[1].args, want) {
+		t.Errorf("touched = %v, want %v", execs[1].args, want)
+	}
+	if _, ok := badgeCountCache.Get(2); ok {
+		t.Error("badge count of the newly badged user must be invalidated")
+	}
+	if _, ok := badgeCountCache.Get(1); !ok {
+		t.Error("badge count of the other user must be kept")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// 購読者ごとのチャネルのバッファ。溢れた購読者は遅いとみなして切断する
+	broadcasterBufferSize = 64
+	// 最後の購読者が抜けてから、配信ごとのBroadcasterを破棄するまでの時間
+	broadcasterIdleTTL = 30 * time.Second
+)
+
+var (
+	livecommentBroadcasters  = NewBroadcasterRegistry[Livecomment](broadcasterIdleTTL)
+	reactionBroadcasters     = NewBroadcasterRegistry[Reaction](broadcasterIdleTTL)
+	announcementBroadcasters = NewBroadcasterRegistry[Announcement](broadcasterIdleTTL)
+)
+
+// Broadcaster は、Publishされたイベントを全購読者のチャネルへ配る
+// Publishはブロックしないので、バッファが溢れた購読者はチャネルを閉じて切断する
+type Broadcaster[T any] struct {
+	mu          sync.Mutex
+	subscribers map[<-chan T]chan T
+	// 購読者が0人になった時に呼ばれる
+	onIdle func()
+	// BroadcasterRegistryから破棄された後は購読できない
+	closed bool
+}
+
+func NewBroadcaster[T any]() *Broadcaster[T] {
+	return &Broadcaster[T]{
+		subscribers: make(map[<-chan T]chan T),
+	}
+}
+
+func (b *Broadcaster[T]) Subscribe() <-chan T {
+	ch, _ := b.subscribe()
+	return ch
+}
+
+func (b *Broadcaster[T]) subscribe() (<-chan T, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, false
+	}
+	ch := make(chan T, broadcasterBufferSize)
+	b.subscribers[ch] = ch
+	return ch, true
+}
+
+// Unsubscribe は、購読を解除してチャネルを閉じる
+// 切断済みのチャネルを渡しても何もしない
+func (b *Broadcaster[T]) Unsubscribe(ch <-chan T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if sub, ok := b.subscribers[ch]; ok {
+		b.remove(ch, sub)
+	}
+}
+
+func (b *Broadcaster[T]) Publish(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key, sub := range b.subscribers {
+		select {
+		case sub <- v:
+		default:
+			b.remove(key, sub)
+		}
+	}
+}
+
+func (b *Broadcaster[T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// b.muを取得した状態で呼ぶこと
+func (b *Broadcaster[T]) remove(key <-chan T, sub chan T) {
+	delete(b.subscribers, key)
+	close(sub)
+	if len(b.subscribers) == 0 && b.onIdle != nil {
+		b.onIdle()
+	}
+}
+
+// closeIfIdle は、購読者がいなければ以降の購読を受け付けないようにしてtrueを返す
+func (b *Broadcaster[T]) closeIfIdle() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.subscribers) > 0 {
+		return false
+	}
+	b.closed = true
+	return true
+}
+
+// BroadcasterRegistry は、配信IDごとのBroadcasterを保持する
+// Broadcasterは最初の購読時に作り、最後の購読者が抜けてからidleTTL後に破棄する
+type BroadcasterRegistry[T any] struct {
+	data    sync.Map
+	idleTTL time.Duration
+}
+
+func NewBroadcasterRegistry[T any](idleTTL time.Duration) *BroadcasterRegistry[T] {
+	return &BroadcasterRegistry[T]{idleTTL: idleTTL}
+}
+
+// Subscribe は、配信のイベントを購読する
+// 購読をやめる時は、返したBroadcasterのUnsubscribeを呼ぶこと
+func (r *BroadcasterRegistry[T]) Subscribe(livestreamID int64) (*Broadcaster[T], <-chan T) {
+	for {
+		b := r.getOrCreate(livestreamID)
+		if ch, ok := b.subscribe(); ok {
+			return b, ch
+		}
+		// 破棄されたBroadcasterを掴んだ場合は作り直す
+		r.data.CompareAndDelete(livestreamID, b)
+	}
+}
+
+// Publish は、購読者がいる配信にだけイベントを配る
+func (r *BroadcasterRegistry[T]) Publish(livestreamID int64, v T) {
+	if b, ok := r.data.Load(livestreamID); ok {
+		b.(*Broadcaster[T]).Publish(v)
+	}
+}
+
+func (r *BroadcasterRegistry[T]) getOrCreate(livestreamID int64) *Broadcaster[T] {
+	if b, ok := r.data.Load(livestreamID); ok {
+		return b.(*Broadcaster[T])
+	}
+
+	b := NewBroadcaster[T]()
+	b.onIdle = func() {
+		time.AfterFunc(r.idleTTL, func() {
+			if b.closeIfIdle() {
+				r.data.CompareAndDelete(livestreamID, b)
+			}
+		})
+	}
+	actual, _ := r.data.LoadOrStore(livestreamID, b)
+	return actual.(*Broadcaster[T])
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBroadcaster_MultipleSubscribers(t *testing.T) {
+	b := NewBroadcaster[int]()
+	subs := []<-chan int{b.Subscribe(), b.Subscribe(), b.Subscribe()}
+
+	b.Publish(1)
+	b.Publish(2)
+
+	for i, ch := range subs {
+		for _, want := range []int{1, 2} {
+			select {
+			case got := <-ch:
+				if got != want {
+					t.Errorf("subscriber %d: got %d, want %d", i, got, want)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("subscriber %d: timed out waiting for %d", i, want)
+			}
+		}
+	}
+
+	// 購読を解除したチャネルは閉じられ、以降は配られない
+	b.Unsubscribe(subs[0])
+	if _, ok := <-subs[0]; ok {
+		t.Error("unsubscribed channel must be closed")
+	}
+	b.Publish(3)
+	if got := <-subs[1]; got != 3 {
+		t.Errorf("got %d, want 3", got)
+	}
+	if b.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", b.Len())
+	}
+}
+
+func TestBroadcaster_SlowConsumerDrop(t *testing.T) {
+	b := NewBroadcaster[int]()
+	slow := b.Subscribe()
+	fast := b.Subscribe()
+
+	// slowは読まないので、バッファが溢れた時点で切断される
+	for i := 0; i <= broadcasterBufferSize; i++ {
+		b.Publish(i)
+		<-fast
+	}
+
+	if b.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", b.Len())
+	}
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != broadcasterBufferSize {
+		t.Errorf("slow consumer received %d events before drop, want %d", n, broadcasterBufferSize)
+	}
+
+	// 切断後もPublishはブロックせず、残りの購読者には配られる
+	b.Publish(-1)
+	if got := <-fast; got != -1 {
+		t.Errorf("got %d, want -1", got)
+	}
+}
+
+func TestBroadcasterRegistry_RemovedAfterIdle(t *testing.T) {
+	r := NewBroadcasterRegistry[int](10 * time.Millisecond)
+
+	b, ch := r.Subscribe(1)
+	r.Publish(1, 42)
+	if got := <-ch; got != 42 {
+		t.Errorf("got %d, want 42", got)
+	}
+	b.Unsubscribe(ch)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := r.data.Load(int64(1)); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("idle broadcaster must be removed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 破棄後に購読すると新しいBroadcasterが作られる
+	b2, ch2 := r.Subscribe(1)
+	if b2 == b {
+		t.Error("closed broadcaster must not be reused")
+	}
+	r.Publish(1, 7)
+	if got := <-ch2; got != 7 {
+		t.Errorf("got %d, want 7", got)
+	}
+}
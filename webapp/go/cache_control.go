@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	cacheControlNoStore = "no-store"
+	cacheControlPrivate = "private, no-cache"
+	cacheControlPublic  = "public, max-age=60"
+)
+
+// キャッシュ可能な公開リソースのルート
+var publicCacheableRoutes = map[string]struct{}{
+	"/api/tag":          {},
+	"/api/tags/search":  {},
+	"/api/tags/popular": {},
+}
+
+// 個別にキャッシュ制御を行うルート
+// アイコンはIf-None-Matchによる条件付きリクエストに対応しているので、ヘッダを付与しない
+var selfCacheControlledRoutes = map[string]struct{}{
+	"/api/user/:username/icon": {},
+}
+
+// cacheControlFor は、ルートに応じたCache-ControlとVaryの値を返す
+// どちらも空の場合はヘッダを付与しない
+func cacheControlFor(route string) (cacheControl, vary string) {
+	if !strings.HasPrefix(route, "/api/") {
+		return "", ""
+	}
+	if _, ok := selfCacheControlledRoutes[route]; ok {
+		return "", ""
+	}
+	if _, ok := publicCacheableRoutes[route]; ok {
+		return cacheControlPublic, ""
+	}
+	// ログインユーザ自身の情報や、公開設定が閲覧者によって変わるプロフィールは、セッションCookieによって内容が変わる
+	// プロフィールはLast-Modifiedによる再検証ができるよう、保存は許可する
+	if route == "/api/user/me" || strings.HasPrefix(route, "/api/user/me/") || route == "/api/user/:username" {
+		return cacheControlPrivate, "Cookie"
+	}
+	return cacheControlNoStore, ""
+}
+
+// NoCacheMiddleware は、プロキシがJSONレスポンスをヒューリスティックにキャッシュしないよう、
+// ルートごとにCache-ControlとVaryを付与する
+func NoCacheMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cacheControl, vary := cacheControlFor(c.Path())
+			if cacheControl != "" {
+				c.Response().Header().Set(echo.HeaderCacheControl, cacheControl)
+			}
+			if vary != "" {
+				c.Response().Header().Add(echo.HeaderVary, vary)
+			}
+			return next(c)
+		}
+	}
+}
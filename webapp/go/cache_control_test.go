@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestNoCacheMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(NoCacheMiddleware())
+	ok := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+	e.GET("/api/tag", ok)
+	e.GET("/api/user/me", ok)
+	e.GET("/api/user/me/notification-preferences", ok)
+	e.GET("/api/user/:username", ok)
+	e.GET("/api/user/:username/icon", ok)
+	e.GET("/api/livestream/:livestream_id", ok)
+	e.GET("/health", ok)
+
+	tests := []struct {
+		path             string
+		wantCacheControl string
+		wantVary         string
+	}{
+		// 公開リソース
+		{path: "/api/tag", wantCacheControl: "public, max-age=60"},
+		// ログインユーザ自身の情報とプロフィール
+		{path: "/api/user/me", wantCacheControl: "private, no-cache", wantVary: "Cookie"},
+		{path: "/api/user/me/notification-preferences", wantCacheControl: "private, no-cache", wantVary: "Cookie"},
+		{path: "/api/user/test001", wantCacheControl: "private, no-cache", wantVary: "Cookie"},
+		// その他のAPI
+		{path: "/api/livestream/1", wantCacheControl: "no-store"},
+		// アイコンとAPI以外は付与しない
+		{path: "/api/user/test001/icon"},
+		{path: "/health"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if got := rec.Header().Get(echo.HeaderCacheControl); got != tt.wantCacheControl {
+			t.Errorf("%s: Cache-Control = %q, want %q", tt.path, got, tt.wantCacheControl)
+		}
+		if got := rec.Header().Get(echo.HeaderVary); got != tt.wantVary {
+			t.Errorf("%s: Vary = %q, want %q", tt.path, got, tt.wantVary)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/goccy/go-json"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultStreamClipsLimit = 20
+
+type StreamClipModel struct {
+	ID              int64  `db:"id"`
+	LivestreamID    int64  `db:"livestream_id"`
+	SubmitterUserID int64  `db:"submitter_user_id"`
+	Title           string `db:"title"`
+	OffsetSeconds   int64  `db:"offset_seconds"`
+	DurationSeconds int64  `db:"duration_seconds"`
+	CreatedAt       int64  `db:"created_at"`
+}
+
+type StreamClip struct {
+	ID              int64  `json:"id"`
+	LivestreamID    int64  `json:"livestream_id"`
+	Submitter       User   `json:"submitter"`
+	Title           string `json:"title"`
+	OffsetSeconds   int64  `json:"offset_seconds"`
+	DurationSeconds int64  `json:"duration_seconds"`
+	ReactionsCount  int64  `json:"reactions_count"`
+	CreatedAt       int64  `json:"created_at"`
+}
+
+type PostStreamClipRequest struct {
+	Title           string `json:"title"`
+	OffsetSeconds   int64  `json:"offset_seconds"`
+	DurationSeconds int64  `json:"duration_seconds"`
+}
+
+// クリップ投稿API
+// POST /api/livestream/:livestream_id/clips
+func postStreamClipHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PostStreamClipRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if req.Title == "" || utf8.RuneCountInString(req.Title) > MaxTitleLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("title must be between 1 and %d characters", MaxTitleLength))
+	}
+	if req.OffsetSeconds < 0 || req.DurationSeconds <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "offset_seconds must not be negative and duration_seconds must be positive")
+	}
+
+	clip, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (StreamClip, error) {
+		var livestreamModel LivestreamModel
+		if err := tx.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", livestreamID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return StreamClip{}, echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+			}
+			return StreamClip{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error()).SetInternal(err)
+		}
+		// クリップは配信時間内に収まっている必要がある
+		if req.OffsetSeconds+req.DurationSeconds > livestreamModel.EndAt-livestreamModel.StartAt {
+			return StreamClip{}, echo.NewHTTPError(http.StatusBadRequest, "clip must be within the livestream duration")
+		}
+
+		clipModel := StreamClipModel{
+			LivestreamID:    int64(livestreamID),
+			SubmitterUserID: userID,
+			Title:           req.Title,
+			OffsetSeconds:   req.OffsetSeconds,
+			DurationSeconds: req.DurationSeconds,
+			CreatedAt:       time.Now().Unix(),
+		}
+		rs, err := tx.NamedExecContext(ctx, "INSERT INTO stream_clips (livestream_id, submitter_user_id, title, offset_seconds, duration_seconds, created_at) VALUES (:livestream_id, :submitter_user_id, :title, :offset_seconds, :duration_seconds, :created_at)", clipModel)
+		if err != nil {
+			return StreamClip{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert stream clip: "+err.Error()).SetInternal(err)
+		}
+		clipID, err := rs.LastInsertId()
+		if err != nil {
+			return StreamClip{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted stream clip id: "+err.Error()).SetInternal(err)
+		}
+		clipModel.ID = clipID
+
+		clip, err := fillStreamClipResponse(ctx, tx, clipModel)
+		if err != nil {
+			return StreamClip{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to fill stream clip: "+err.Error()).SetInternal(err)
+		}
+		return clip, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+
+	return c.JSON(http.StatusCreated, clip)
+}
+
+// クリップ一覧取得API (リアクションの多い順)
+// GET /api/livestream/:livestream_id/clips
+func getStreamClipsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	limit := defaultStreamClipsLimit
+	if c.QueryParam("limit") != "" {
+		limit, err = strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || limit <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be positive integer")
+		}
+	}
+
+	type StreamClipWithReactions struct {
+		StreamClipModel
+		ReactionsCount int64 `db:"reactions_count"`
+	}
+	var clipModels []StreamClipWithReactions
+	if err := dbConn.SelectContext(ctx, &clipModels, `
+		SELECT c.*, IFNULL(r.cnt, 0) AS reactions_count FROM stream_clips c
+		LEFT JOIN (SELECT clip_id, COUNT(*) AS cnt FROM clip_reactions GROUP BY clip_id) r ON r.clip_id = c.id
+		WHERE c.livestream_id = ?
+		ORDER BY reactions_count DESC, c.id ASC
+		LIMIT ?`, livestreamID, limit); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get stream clips: "+err.Error())
+	}
+	if len(clipModels) == 0 {
+		return c.JSON(http.StatusOK, []StreamClip{})
+	}
+
+	userIDs := make([]int64, len(clipModels))
+	for i := range clipModels {
+		userIDs[i] = clipModels[i].SubmitterUserID
+	}
+	query, params, err := sqlx.In("SELECT * FROM users WHERE id IN (?)", userIDs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to construct IN query: "+err.Error())
+	}
+	var userModels []UserModel
+	if err := dbConn.SelectContext(ctx, &userModels, query, params...); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get users: "+err.Error())
+	}
+	users, err := fillUsersResponseWithoutTx(ctx, userModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill users: "+err.Error())
+	}
+	userMap := make(map[int64]User, len(users))
+	for i := range users {
+		userMap[users[i].ID] = users[i]
+	}
+
+	clips := make([]StreamClip, 0, len(clipModels))
+	for i := range clipModels {
+		user, ok := userMap[clipModels[i].SubmitterUserID]
+		if !ok {
+			continue
+		}
+		clips = append(clips, StreamClip{
+			ID:              clipModels[i].ID,
+			LivestreamID:    clipModels[i].LivestreamID,
+			Submitter:       user,
+			Title:           clipModels[i].Title,
+			OffsetSeconds:   clipModels[i].OffsetSeconds,
+			DurationSeconds: clipModels[i].DurationSeconds,
+			ReactionsCount:  clipModels[i].ReactionsCount,
+			CreatedAt:       clipModels[i].CreatedAt,
+		})
+	}
+
+	return c.JSON(http.StatusOK, clips)
+}
+
+func fillStreamClipResponse(ctx context.Context, tx *sqlx.Tx, clipModel StreamClipModel) (StreamClip, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
+	submitterModel := UserModel{}
+	if err := tx.GetContext(ctx, &submitterModel, "SELECT * FROM users WHERE id = ?", clipModel.SubmitterUserID); err != nil {
+		return StreamClip{}, err
+	}
+	submitter, err := fillUserResponse(ctx, tx, submitterModel, noViewerID)
+	if err != nil {
+		return StreamClip{}, err
+	}
+
+	var reactionsCount int64
+	if err := tx.GetContext(ctx, &reactionsCount, "SELECT COUNT(*) FROM clip_reactions WHERE clip_id = ?", clipModel.ID); err != nil {
+		return StreamClip{}, err
+	}
+
+	return StreamClip{
+		ID:              clipModel.ID,
+		LivestreamID:    clipModel.LivestreamID,
+		Submitter:       submitter,
+		Title:           clipModel.Title,
+		OffsetSeconds:   clipModel.OffsetSeconds,
+		DurationSeconds: clipModel.DurationSeconds,
+		ReactionsCount:  reactionsCount,
+		CreatedAt:       clipModel.CreatedAt,
+	}, nil
+}
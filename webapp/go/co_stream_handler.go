@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	coStreamRequestStatusPending  = "pending"
+	coStreamRequestStatusApproved = "approved"
+	coStreamRequestStatusRejected = "rejected"
+)
+
+type CoStreamRequestModel struct {
+	ID              int64  `db:"id"`
+	LivestreamID    int64  `db:"livestream_id"`
+	RequesterUserID int64  `db:"requester_user_id"`
+	Status          string `db:"status"`
+	CreatedAt       int64  `db:"created_at"`
+}
+
+type CoStreamRequest struct {
+	ID           int64  `json:"id"`
+	LivestreamID int64  `json:"livestream_id"`
+	Requester    User   `json:"requester"`
+	Status       string `json:"status"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+type PatchCoStreamRequestRequest struct {
+	Status string `json:"status"`
+}
+
+// 共同配信リクエストAPI
+// POST /api/livestream/:livestream_id/co-stream-request
+func postCoStreamRequestHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	request, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (CoStreamRequest, error) {
+		var ownerID int64
+		if err := tx.GetContext(ctx, &ownerID, "SELECT user_id FROM livestreams WHERE id = ? FOR UPDATE", livestreamID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return CoStreamRequest{}, echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+			}
+			return CoStreamRequest{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error()).SetInternal(err)
+		}
+		if ownerID == userID {
+			return CoStreamRequest{}, echo.NewHTTPError(http.StatusBadRequest, "the owner of the livestream can't request co-streaming")
+		}
+
+		// NOTE: 配信行をFOR UPDATEでロックしているので、同一ユーザの並列なリクエストでも二重登録されない
+		var pendingCount int64
+		if err := tx.GetContext(ctx, &pendingCount, "SELECT COUNT(*) FROM co_stream_requests WHERE livestream_id = ? AND requester_user_id = ? AND status = ?", livestreamID, userID, coStreamRequestStatusPending); err != nil {
+			return CoStreamRequest{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to count co-stream requests: "+err.Error()).SetInternal(err)
+		}
+		if pendingCount > 0 {
+			return CoStreamRequest{}, echo.NewHTTPError(http.StatusConflict, "co-stream request is already pending")
+		}
+
+		requestModel := CoStreamRequestModel{
+			LivestreamID:    int64(livestreamID),
+			RequesterUserID: userID,
+			Status:          coStreamRequestStatusPending,
+			CreatedAt:       time.Now().Unix(),
+		}
+		rs, err := tx.NamedExecContext(ctx, "INSERT INTO co_stream_requests (livestream_id, requester_user_id, status, created_at) VALUES (:livestream_id, :requester_user_id, :status, :created_at)", requestModel)
+		if err != nil {
+			return CoStreamRequest{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert co-stream request: "+err.Error()).SetInternal(err)
+		}
+		requestID, err := rs.LastInsertId()
+		if err != nil {
+			return CoStreamRequest{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted co-stream request id: "+err.Error()).SetInternal(err)
+		}
+		requestModel.ID = requestID
+
+		request, err := fillCoStreamRequestResponse(ctx, tx, requestModel)
+		if err != nil {
+			return CoStreamRequest{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to fill co-stream request: "+err.Error()).SetInternal(err)
+		}
+		return request, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+
+	return c.JSON(http.StatusCreated, request)
+}
+
+// 承認待ちの共同配信リクエスト一覧取得API (配信者のみ)
+// GET /api/livestream/:livestream_id/co-stream-requests
+func getCoStreamRequestsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	if err := verifyLivestreamOwner(ctx, dbConn, int64(livestreamID), userID); err != nil {
+		return err
+	}
+
+	var requestModels []CoStreamRequestModel
+	if err := dbConn.SelectContext(ctx, &requestModels, "SELECT * FROM co_stream_requests WHERE livestream_id = ? AND status = ? ORDER BY created_at ASC, id ASC", livestreamID, coStreamRequestStatusPending); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get co-stream requests: "+err.Error())
+	}
+	if len(requestModels) == 0 {
+		return c.JSON(http.StatusOK, []CoStreamRequest{})
+	}
+
+	userIDs := make([]int64, len(requestModels))
+	for i := range requestModels {
+		userIDs[i] = requestModels[i].RequesterUserID
+	}
+	query, params, err := sqlx.In("SELECT * FROM users WHERE id IN (?)", userIDs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to construct IN query: "+err.Error())
+	}
+	var userModels []UserModel
+	if err := dbConn.SelectContext(ctx, &userModels, query, params...); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get users: "+err.Error())
+	}
+	users, err := fillUsersResponseWithoutTx(ctx, userModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill users: "+err.Error())
+	}
+	userMap := make(map[int64]User, len(users))
+	for i := range users {
+		userMap[users[i].ID] = users[i]
+	}
+
+	requests := make([]CoStreamRequest, 0, len(requestModels))
+	for i := range requestModels {
+		user, ok := userMap[requestModels[i].RequesterUserID]
+		if !ok {
+			continue
+		}
+		requests = append(requests, CoStreamRequest{
+			ID:           requestModels[i].ID,
+			LivestreamID: requestModels[i].LivestreamID,
+			Requester:    user,
+			Status:       requestModels[i].Status,
+			CreatedAt:    requestModels[i].CreatedAt,
+		})
+	}
+
+	return c.JSON(http.StatusOK, requests)
+}
+
+// 共同配信リクエスト承認・却下API (配信者のみ)
+// PATCH /api/livestream/:livestream_id/co-stream-requests/:request_id
+func patchCoStreamRequestHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+	requestID, err := strconv.Atoi(c.Param("request_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "request_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PatchCoStreamRequestRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if req.Status != coStreamRequestStatusApproved && req.Status != coStreamRequestStatusRejected {
+		return echo.NewHTTPError(http.StatusBadRequest, "status must be either approved or rejected")
+	}
+
+	request, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (CoStreamRequest, error) {
+		if err := verifyLivestreamOwner(ctx, tx, int64(livestreamID), userID); err != nil {
+			return CoStreamRequest{}, err
+		}
+
+		var requestModel CoStreamRequestModel
+		if err := tx.GetContext(ctx, &requestModel, "SELECT * FROM co_stream_requests WHERE id = ? AND livestream_id = ? FOR UPDATE", requestID, livestreamID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return CoStreamRequest{}, echo.NewHTTPError(http.StatusNotFound, "co-stream request not found")
+			}
+			return CoStreamRequest{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get co-stream request: "+err.Error()).SetInternal(err)
+		}
+		if requestModel.Status != coStreamRequestStatusPending {
+			return CoStreamRequest{}, echo.NewHTTPError(http.StatusConflict, "co-stream request has already been "+requestModel.Status)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE co_stream_requests SET status = ? WHERE id = ?", req.Status, requestModel.ID); err != nil {
+			return CoStreamRequest{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to update co-stream request: "+err.Error()).SetInternal(err)
+		}
+		requestModel.Status = req.Status
+
+		// 承認されたゲストは共同配信者としてモデレーター権限を得る
+		if req.Status == coStreamRequestStatusApproved {
+			moderatorModel := LivestreamModeratorModel{
+				LivestreamID: requestModel.LivestreamID,
+				UserID:       requestModel.RequesterUserID,
+				GrantedAt:    time.Now().Unix(),
+				IsCoStreamer: true,
+			}
+			if _, err := tx.NamedExecContext(ctx, "INSERT INTO livestream_moderators (livestream_id, user_id, granted_at, is_co_streamer) VALUES (:livestream_id, :user_id, :granted_at, :is_co_streamer) ON DUPLICATE KEY UPDATE is_co_streamer = VALUES(is_co_streamer)", moderatorModel); err != nil {
+				return CoStreamRequest{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert moderator: "+err.Error()).SetInternal(err)
+			}
+		}
+
+		request, err := fillCoStreamRequestResponse(ctx, tx, requestModel)
+		if err != nil {
+			return CoStreamRequest{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to fill co-stream request: "+err.Error()).SetInternal(err)
+		}
+		return request, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, request)
+}
+
+func fillCoStreamRequestResponse(ctx context.Context, tx *sqlx.Tx, requestModel CoStreamRequestModel) (CoStreamRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
+	requesterModel := UserModel{}
+	if err := tx.GetContext(ctx, &requesterModel, "SELECT * FROM users WHERE id = ?", requestModel.RequesterUserID); err != nil {
+		return CoStreamRequest{}, err
+	}
+	requester, err := fillUserResponse(ctx, tx, requesterModel, noViewerID)
+	if err != nil {
+		return CoStreamRequest{}, err
+	}
+
+	return CoStreamRequest{
+		ID:           requestModel.ID,
+		LivestreamID: requestModel.LivestreamID,
+		Requester:    requester,
+		Status:       requestModel.Status,
+		CreatedAt:    requestModel.CreatedAt,
+	}, nil
+}
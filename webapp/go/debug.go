@@ -0,0 +1,32 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"os"
+
+	"github.com/kaz/pprotein/integration"
+	"github.com/labstack/echo/v4"
+)
+
+// pprofEnabled は、/debug/以下のプロファイリング用エンドポイントを公開するか (環境変数ENABLE_PPROF=trueで有効)
+var pprofEnabled = os.Getenv("ENABLE_PPROF") == "true"
+
+// registerDebugHandlers は、pprof (pprotein経由) とexpvarを/debug/以下に登録する
+func registerDebugHandlers(e *echo.Echo, enabled bool) {
+	g := e.Group("/debug", DebugEnabledMiddleware(enabled))
+	g.GET("/vars", echo.WrapHandler(expvar.Handler()))
+	g.Any("/*", echo.WrapHandler(integration.NewDebugHandler()))
+}
+
+// DebugEnabledMiddleware は、プロファイリングが無効な場合に/debug/以下のリクエストを404で拒否する
+func DebugEnabledMiddleware(enabled bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !enabled {
+				return echo.NewHTTPError(http.StatusNotFound, "Not Found")
+			}
+			return next(c)
+		}
+	}
+}
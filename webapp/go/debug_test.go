@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRegisterDebugHandlers(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		want    int
+	}{
+		{name: "enabled", enabled: true, want: http.StatusOK},
+		{name: "disabled", enabled: false, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			registerDebugHandlers(e, tt.enabled)
+
+			for _, path := range []string{"/debug/pprof/", "/debug/vars"} {
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				if rec.Code != tt.want {
+					t.Errorf("GET %s: status = %d, want %d", path, rec.Code, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const streamEarningsCacheTTL = 10 * time.Second
+
+type LivestreamEarning struct {
+	LivestreamID int64  `db:"livestream_id" json:"livestream_id"`
+	Title        string `db:"title" json:"title"`
+	Tip          int64  `db:"tip" json:"tip"`
+}
+
+type StreamEarnings struct {
+	TotalTip     int64               `json:"total_tip"`
+	ByLivestream []LivestreamEarning `json:"by_livestream"`
+}
+
+var streamEarningsCache = &StreamEarningsCache{}
+
+type streamEarningsKey struct {
+	UserID int64
+	Since  int64
+	Until  int64
+}
+
+type streamEarningsEntry struct {
+	earnings   StreamEarnings
+	expiration time.Time
+}
+
+// StreamEarningsCache は、配信者ごと・集計期間ごとのチップ収益を保持する
+type StreamEarningsCache struct {
+	data sync.Map
+}
+
+func (m *StreamEarningsCache) Set(key streamEarningsKey, earnings StreamEarnings, ttl time.Duration) {
+	m.data.Store(key, streamEarningsEntry{
+		earnings:   earnings,
+		expiration: time.Now().Add(jitteredTTL(ttl)),
+	})
+}
+
+func (m *StreamEarningsCache) Get(key streamEarningsKey) (StreamEarnings, bool) {
+	v, ok := m.data.Load(key)
+	if !ok {
+		return StreamEarnings{}, false
+	}
+
+	e := v.(streamEarningsEntry)
+	if time.Now().After(e.expiration) {
+		m.data.Delete(key)
+		return StreamEarnings{}, false
+	}
+	return e.earnings, true
+}
+
+func (m *StreamEarningsCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+}
+
+// 配信収益取得API
+// GET /api/user/me/stream-earnings
+func getStreamEarningsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	// 集計期間 (ライブコメントの投稿日時) 未指定の場合は全期間
+	key := streamEarningsKey{
+		UserID: userID,
+		Since:  0,
+		Until:  math.MaxInt64,
+	}
+	if v := c.QueryParam("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "since query parameter must be integer")
+		}
+		key.Since = n
+	}
+	if v := c.QueryParam("until"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "until query parameter must be integer")
+		}
+		key.Until = n
+	}
+
+	if earnings, ok := streamEarningsCache.Get(key); ok {
+		return c.JSON(http.StatusOK, earnings)
+	}
+
+	earnings, err := getStreamEarnings(ctx, key)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get stream earnings: "+err.Error())
+	}
+	streamEarningsCache.Set(key, earnings, streamEarningsCacheTTL)
+
+	return c.JSON(http.StatusOK, earnings)
+}
+
+func getStreamEarnings(ctx context.Context, key streamEarningsKey) (StreamEarnings, error) {
+	// チップのない配信も0として含めるため、期間の絞り込みはJOINの条件で行う
+	byLivestream := []LivestreamEarning{}
+	if err := dbConn.SelectContext(ctx, &byLivestream, `
+		SELECT l.id AS livestream_id, l.title, IFNULL(SUM(lc.tip), 0) AS tip FROM livestreams l
+		LEFT JOIN livecomments lc ON lc.livestream_id = l.id AND lc.created_at >= ? AND lc.created_at <= ?
+		WHERE l.user_id = ?
+		GROUP BY l.id, l.title
+		ORDER BY tip DESC, l.id ASC`, key.Since, key.Until, key.UserID); err != nil {
+		return StreamEarnings{}, err
+	}
+
+	var totalTip int64
+	for i := range byLivestream {
+		totalTip += byLivestream[i].Tip
+	}
+
+	return StreamEarnings{
+		TotalTip:     totalTip,
+		ByLivestream: byLivestream,
+	}, nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDB は、テストで共通に使うdatabase/sqlドライバ
+// 発行されたクエリを、先頭が一致する登録済みのハンドラに登録順で振り分け、引数とともに記録する
+// トランザクションはコネクションそのもので、onBegin・onCommit・onRollbackがあれば呼び出す
+type fakeDB struct {
+	queryRoutes []fakeQueryRoute
+	execRoutes  []fakeExecRoute
+
+	onBegin    func() error
+	onCommit   func() error
+	onRollback func() error
+
+	// ハンドラの呼び出しとログの記録は直列に行う
+	mu        sync.Mutex
+	queryLog  []fakeStatement
+	execLog   []fakeStatement
+	begins    int
+	commits   int
+	rollbacks int
+}
+
+// fakeStatement は、fakeDBに発行されたクエリと引数
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+}
+
+type fakeQueryRoute struct {
+	prefix string
+	fn     func(query string, args []driver.Value) (driver.Rows, error)
+}
+
+type fakeExecRoute struct {
+	prefix string
+	fn     func(query string, args []driver.Value) (driver.Result, error)
+}
+
+// onQuery は、prefixで始まるクエリのハンドラを登録する
+// 空文字列のprefixは全てのクエリに一致する
+func (d *fakeDB) onQuery(prefix string, fn func(query string, args []driver.Value) (driver.Rows, error)) {
+	d.queryRoutes = append(d.queryRoutes, fakeQueryRoute{prefix: prefix, fn: fn})
+}
+
+// onExec は、prefixで始まる更新系クエリのハンドラを登録する
+// 空文字列のprefixは全てのクエリに一致する
+func (d *fakeDB) onExec(prefix string, fn func(query string, args []driver.Value) (driver.Result, error)) {
+	d.execRoutes = append(d.execRoutes, fakeExecRoute{prefix: prefix, fn: fn})
+}
+
+// queryCount は、これまでに発行されたクエリ (更新系を除く) の数を返す
+func (d *fakeDB) queryCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queryLog)
+}
+
+// queriesWithPrefix は、prefixで始まるクエリ (更新系を含む) が発行された回数を返す
+func (d *fakeDB) queriesWithPrefix(prefix string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, log := range [][]fakeStatement{d.queryLog, d.execLog} {
+		for _, s := range log {
+			if strings.HasPrefix(s.query, prefix) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// queries は、これまでに発行されたクエリ (更新系を除く) の文字列を返す
+func (d *fakeDB) queries() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	queries := make([]string, len(d.queryLog))
+	for i, s := range d.queryLog {
+		queries[i] = s.query
+	}
+	return queries
+}
+
+// resetLog は、これまでに記録したクエリを消す
+func (d *fakeDB) resetLog() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queryLog = nil
+	d.execLog = nil
+}
+
+// execs は、これまでに発行された更新系クエリを返す
+func (d *fakeDB) execs() []fakeStatement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]fakeStatement(nil), d.execLog...)
+}
+
+// execQueries は、これまでに発行された更新系クエリの文字列を返す
+func (d *fakeDB) execQueries() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	queries := make([]string, len(d.execLog))
+	for i, s := range d.execLog {
+		queries[i] = s.query
+	}
+	return queries
+}
+
+// open は、dを使うDBを開き、テストの終了時に閉じる
+func (d *fakeDB) open(tb testing.TB) *sqlx.DB {
+	db := sqlx.NewDb(sql.OpenDB(d), "mysql")
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// useFakeDB は、テストの間だけdbConnをdに差し替える
+func useFakeDB(tb testing.TB, d *fakeDB) {
+	orig := dbConn
+	dbConn = sqlx.NewDb(sql.OpenDB(d), "mysql")
+	tb.Cleanup(func() {
+		dbConn.Close()
+		dbConn = orig
+	})
+}
+
+func (d *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{d: d}, nil }
+func (d *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	d *fakeDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fakeDB: Prepare is not supported")
+}
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.begins++
+	if c.d.onBegin != nil {
+		if err := c.d.onBegin(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.commits++
+	if c.d.onCommit != nil {
+		return c.d.onCommit()
+	}
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.rollbacks++
+	if c.d.onRollback != nil {
+		return c.d.onRollback()
+	}
+	return nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	values := namedValues(args)
+	c.d.queryLog = append(c.d.queryLog, fakeStatement{query: query, args: values})
+	for _, r := range c.d.queryRoutes {
+		if strings.HasPrefix(query, r.prefix) {
+			v, err := r.fn(query, values)
+			// 実際のドライバと同様に、実行中に期限が切れたクエリは失敗させる
+			if ctxErr := ctx.Err(); err == nil && ctxErr != nil {
+				return nil, ctxErr
+			}
+			return v, err
+		}
+	}
+	return nil, errors.New("fakeDB: unexpected query: " + query)
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	values := namedValues(args)
+	c.d.execLog = append(c.d.execLog, fakeStatement{query: query, args: values})
+	for _, r := range c.d.execRoutes {
+		if strings.HasPrefix(query, r.prefix) {
+			v, err := r.fn(query, values)
+			// 実際のドライバと同様に、実行中に期限が切れたクエリは失敗させる
+			if ctxErr := ctx.Err(); err == nil && ctxErr != nil {
+				return nil, ctxErr
+			}
+			return v, err
+		}
+	}
+	return nil, errors.New("fakeDB: unexpected exec: " + query)
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+// fakeRows は、columnsとvaluesをそのまま返す結果セット
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+// fakeValue は、1行1列の結果セットを返す
+func fakeValue(column string, v driver.Value) *fakeRows {
+	return &fakeRows{columns: []string{column}, values: [][]driver.Value{{v}}}
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// fakeResult は、更新系クエリの結果
+type fakeResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+// fakeExecOK は、1行を更新したことにするハンドラ
+func fakeExecOK(string, []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
@@ -3,6 +3,7 @@ module github.com/isucon/isucon13/webapp/go
 go 1.23.3
 
 require (
+	github.com/HugoSmits86/nativewebp v1.1.4
 	github.com/go-sql-driver/mysql v1.8.1
 	github.com/goccy/go-json v0.10.3
 	github.com/google/uuid v1.3.1
@@ -14,6 +15,8 @@ require (
 	github.com/labstack/gommon v0.4.2
 	github.com/miekg/dns v1.1.62
 	golang.org/x/crypto v0.29.0
+	golang.org/x/image v0.24.0
+	golang.org/x/sync v0.11.0
 )
 
 require (
@@ -46,9 +49,8 @@ require (
 	github.com/xanzy/ssh-agent v0.3.3 // indirect
 	golang.org/x/mod v0.22.0 // indirect
 	golang.org/x/net v0.31.0 // indirect
-	golang.org/x/sync v0.9.0 // indirect
 	golang.org/x/sys v0.27.0 // indirect
-	golang.org/x/text v0.20.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
 	golang.org/x/time v0.5.0 // indirect
 	golang.org/x/tools v0.27.0 // indirect
 	gopkg.in/warnings.v0 v0.1.2 // indirect
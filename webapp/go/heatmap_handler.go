@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	heatmapCacheTTL = 60 * time.Second
+
+	defaultHeatmapBucketSeconds = 60
+	// 配信時間に対してbucket_secondsが小さすぎる場合は400を返す
+	maxHeatmapBuckets = 1440
+)
+
+// HeatmapBucket は、配信開始からOffsetSeconds秒後からの1区間の盛り上がり
+type HeatmapBucket struct {
+	OffsetSeconds int64 `json:"offset_seconds"`
+	// ViewerCount は、この区間に入室した視聴者数
+	ViewerCount   int64 `json:"viewer_count"`
+	ReactionCount int64 `json:"reaction_count"`
+}
+
+var heatmapCache = &HeatmapCache{}
+
+type heatmapKey struct {
+	LivestreamID  int64
+	BucketSeconds int64
+}
+
+type heatmapEntry struct {
+	buckets    []HeatmapBucket
+	expiration time.Time
+}
+
+// HeatmapCache は、配信ごと・区間の長さごとのヒートマップを保持する
+type HeatmapCache struct {
+	data sync.Map
+}
+
+func (m *HeatmapCache) Set(key heatmapKey, buckets []HeatmapBucket, ttl time.Duration) {
+	m.data.Store(key, heatmapEntry{
+		buckets:    buckets,
+		expiration: time.Now().Add(jitteredTTL(ttl)),
+	})
+}
+
+func (m *HeatmapCache) Get(key heatmapKey) ([]HeatmapBucket, bool) {
+	v, ok := m.data.Load(key)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(heatmapEntry)
+	if time.Now().After(e.expiration) {
+		m.data.Delete(key)
+		return nil, false
+	}
+	return e.buckets, true
+}
+
+func (m *HeatmapCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+}
+
+// 配信の盛り上がりヒートマップ取得API
+// GET /api/livestream/:livestream_id/heatmap
+func getLivestreamHeatmapHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	key := heatmapKey{
+		LivestreamID:  int64(livestreamID),
+		BucketSeconds: defaultHeatmapBucketSeconds,
+	}
+	if v := c.QueryParam("bucket_seconds"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "bucket_seconds query parameter must be positive integer")
+		}
+		key.BucketSeconds = n
+	}
+
+	if buckets, ok := heatmapCache.Get(key); ok {
+		return c.JSON(http.StatusOK, buckets)
+	}
+
+	var livestreamModel LivestreamModel
+	if err := dbConn.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", livestreamID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+	duration := livestreamModel.EndAt - livestreamModel.StartAt
+	if (duration+key.BucketSeconds-1)/key.BucketSeconds > maxHeatmapBuckets {
+		return echo.NewHTTPError(http.StatusBadRequest, "bucket_seconds is too small for the livestream duration")
+	}
+
+	buckets, err := getLivestreamHeatmap(ctx, livestreamModel, key.BucketSeconds)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get heatmap: "+err.Error())
+	}
+	heatmapCache.Set(key, buckets, heatmapCacheTTL)
+
+	return c.JSON(http.StatusOK, buckets)
+}
+
+// getLivestreamHeatmap は、配信開始から終了までをbucketSeconds秒ごとに区切り、区間ごとの入室数とリアクション数を返す
+// 配信時間外の入室・リアクションは含めない
+func getLivestreamHeatmap(ctx context.Context, livestreamModel LivestreamModel, bucketSeconds int64) ([]HeatmapBucket, error) {
+	type count struct {
+		OffsetSeconds int64 `db:"offset_seconds"`
+		Count         int64 `db:"count"`
+	}
+
+	var viewerCounts []count
+	if err := dbConn.SelectContext(ctx, &viewerCounts, `
+		SELECT FLOOR((created_at - ?) / ?) * ? AS offset_seconds, COUNT(*) AS count FROM livestream_viewers_history
+		WHERE livestream_id = ? AND created_at >= ? AND created_at < ?
+		GROUP BY offset_seconds`,
+		livestreamModel.StartAt, bucketSeconds, bucketSeconds, livestreamModel.ID, livestreamModel.StartAt, livestreamModel.EndAt); err != nil {
+		return nil, err
+	}
+
+	var reactionCounts []count
+	if err := dbConn.SelectContext(ctx, &reactionCounts, `
+		SELECT FLOOR((created_at - ?) / ?) * ? AS offset_seconds, COUNT(*) AS count FROM reactions
+		WHERE livestream_id = ? AND created_at >= ? AND created_at < ?
+		GROUP BY offset_seconds`,
+		livestreamModel.StartAt, bucketSeconds, bucketSeconds, livestreamModel.ID, livestreamModel.StartAt, livestreamModel.EndAt); err != nil {
+		return nil, err
+	}
+
+	buckets := []HeatmapBucket{}
+	for offset := int64(0); offset < livestreamModel.EndAt-livestreamModel.StartAt; offset += bucketSeconds {
+		buckets = append(buckets, HeatmapBucket{OffsetSeconds: offset})
+	}
+	for _, c := range viewerCounts {
+		if i := c.OffsetSeconds / bucketSeconds; i < int64(len(buckets)) {
+			buckets[i].ViewerCount = c.Count
+		}
+	}
+	for _, c := range reactionCounts {
+		if i := c.OffsetSeconds / bucketSeconds; i < int64(len(buckets)) {
+			buckets[i].ReactionCount = c.Count
+		}
+	}
+	return buckets, nil
+}
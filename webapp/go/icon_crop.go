@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"net/http"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	iconCropJPEGQuality = 85
+	// 切り抜き後の一辺の最小ピクセル数
+	iconCropMinSize = 32
+	// 切り抜き元の画像の最大ピクセル数 (展開後のメモリ使用量を抑える)
+	iconCropMaxPixels = 4096 * 4096
+)
+
+var errInvalidIconCrop = errors.New("invalid icon crop")
+
+type PostIconCropRequest struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Image  []byte `json:"image"`
+}
+
+type PostIconCropResponse struct {
+	ID   int64  `json:"id"`
+	Hash string `json:"hash"`
+}
+
+// アイコン切り抜き登録API
+// POST /api/user/me/icon/crop
+func postIconCropHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PostIconCropRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+
+	icon, err := cropIcon(req.Image, image.Rect(req.X, req.Y, req.X+req.Width, req.Y+req.Height))
+	if err != nil {
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			return he
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to crop icon: "+err.Error())
+	}
+
+	iconID, err := replaceUserIcon(ctx, userID, icon, "")
+	if err != nil {
+		return txHTTPError(err)
+	}
+
+	return c.JSON(http.StatusCreated, &PostIconCropResponse{
+		ID:   iconID,
+		Hash: iconHash(icon),
+	})
+}
+
+// cropIcon は、JPEG/PNG画像をrect (画像の左上を原点とする) で切り抜き、JPEGで返す
+// 展開する前に、サイズと形式、ヘッダに書かれた画素数を検証する
+func cropIcon(icon []byte, rect image.Rectangle) ([]byte, error) {
+	if err := validateIconImage(icon); err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(icon))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > iconCropMaxPixels {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("icon image must be at most %d pixels", iconCropMaxPixels))
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(icon))
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	if rect.Dx() < iconCropMinSize || rect.Dy() < iconCropMinSize {
+		return nil, fmt.Errorf("%w: width and height must be at least %d", errInvalidIconCrop, iconCropMinSize)
+	}
+	if rect.Min.X < 0 || rect.Min.Y < 0 || rect.Max.X > b.Dx() || rect.Max.Y > b.Dy() {
+		return nil, fmt.Errorf("%w: crop area exceeds the %dx%d image", errInvalidIconCrop, b.Dx(), b.Dy())
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min.Add(rect.Min), draw.Src)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: iconCropJPEGQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestIconCrop_Dimensions(t *testing.T) {
+	icon := newTestJPEG(t, 300, 200)
+
+	cropped, err := cropIcon(icon, image.Rect(10, 20, 110, 70))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(cropped))
+	if err != nil {
+		t.Fatalf("failed to decode cropped icon as jpeg: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("cropped dimensions = %dx%d, want 100x50", b.Dx(), b.Dy())
+	}
+}
+
+func TestIconCrop_InvalidArea(t *testing.T) {
+	icon := newTestJPEG(t, 300, 200)
+
+	tests := []struct {
+		name string
+		rect image.Rectangle
+	}{
+		{name: "exceeds width", rect: image.Rect(250, 0, 301, 100)},
+		{name: "exceeds height", rect: image.Rect(0, 150, 100, 201)},
+		{name: "negative origin", rect: image.Rect(-1, 0, 99, 100)},
+		{name: "smaller than minimum", rect: image.Rect(0, 0, 31, 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := cropIcon(icon, tt.rect); !errors.Is(err, errInvalidIconCrop) {
+				t.Errorf("err = %v, want %v", err, errInvalidIconCrop)
+			}
+		})
+	}
+}
+
+func TestIconCrop_InvalidImage(t *testing.T) {
+	if _, err := cropIcon([]byte("not an image"), image.Rect(0, 0, 32, 32)); err == nil {
+		t.Fatal("expected error for invalid image")
+	}
+}
+
+func TestIconCrop_RejectsBeforeDecoding(t *testing.T) {
+	// ヘッダ上は巨大な画像 (展開すると数百MBになる) に見える、中身の小さいPNG
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	bomb := buf.Bytes()
+	ihdr := bomb[12:29]
+	binary.BigEndian.PutUint32(ihdr[4:8], 20000)
+	binary.BigEndian.PutUint32(ihdr[8:12], 20000)
+	binary.BigEndian.PutUint32(bomb[29:33], crc32.ChecksumIEEE(ihdr))
+
+	tests := []struct {
+		name string
+		icon []byte
+	}{
+		{name: "too many pixels", icon: bomb},
+		{name: "oversized", icon: append(newTestJPEG(t, 300, 200), make([]byte, maxIconBytes)...)},
+		{name: "unsupported type", icon: []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := cropIcon(tt.icon, image.Rect(0, 0, 32, 32))
+			var he *echo.HTTPError
+			if !errors.As(err, &he) || he.Code != http.StatusBadRequest {
+				t.Errorf("err = %v, want 400", err)
+			}
+		})
+	}
+}
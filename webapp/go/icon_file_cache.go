@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultIconCacheMaxFiles = 10000
+
+// iconFileCache は、ICON_CACHE_DIRが設定されている場合のみ有効
+var iconFileCache *IconFileCache
+
+func init() {
+	dir, ok := os.LookupEnv("ICON_CACHE_DIR")
+	if !ok || dir == "" {
+		return
+	}
+	maxFiles := defaultIconCacheMaxFiles
+	if v, ok := os.LookupEnv("ICON_CACHE_MAX_FILES"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("failed to parse environment variable 'ICON_CACHE_MAX_FILES' as positive integer: %s", v)
+		}
+		maxFiles = n
+	}
+	cache, err := NewIconFileCache(dir, maxFiles)
+	if err != nil {
+		log.Fatalf("failed to create icon cache directory: %v", err)
+	}
+	iconFileCache = cache
+}
+
+// IconFileCache は、アイコン画像をローカルディスクに保持する
+// ファイル数がmaxFilesを超えた場合は、更新日時の古いものから削除する (参照時に更新日時を更新するのでLRUになる)
+// ファイル名に画像のハッシュを含めるので、更新前に読んだ画像が後から書き込まれても新しいハッシュでは参照されない
+type IconFileCache struct {
+	dir      string
+	maxFiles int
+	// 書き込みと削除を直列化する
+	mu sync.Mutex
+}
+
+func NewIconFileCache(dir string, maxFiles int) (*IconFileCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &IconFileCache{
+		dir:      dir,
+		maxFiles: maxFiles,
+	}, nil
+}
+
+func (m *IconFileCache) path(userID int64, hash string) string {
+	return filepath.Join(m.dir, strconv.FormatInt(userID, 10)+"_"+hash+".jpg")
+}
+
+// Get は、ハッシュがhashのキャッシュされたアイコンのパスを返す
+func (m *IconFileCache) Get(userID int64, hash string) (string, bool) {
+	p := m.path(userID, hash)
+	now := time.Now()
+	if err := os.Chtimes(p, now, now); err != nil {
+		return "", false
+	}
+	return p, true
+}
+
+// Put は、アイコンを書き込んでそのパスを返す
+func (m *IconFileCache) Put(userID int64, image []byte) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 読み込み途中のファイルを配信しないよう、一時ファイルに書いてからリネームする
+	f, err := os.CreateTemp(m.dir, ".icon-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(image); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	p := m.path(userID, iconHash(image))
+	if err := os.Rename(f.Name(), p); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	if err := m.evict(); err != nil {
+		log.Printf("failed to evict icon cache: %v", err)
+	}
+	return p, nil
+}
+
+// Delete は、ユーザのキャッシュされたアイコンをハッシュによらずすべて削除する
+func (m *IconFileCache) Delete(userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(m.dir, strconv.FormatInt(userID, 10)+"_*.jpg"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanupAll は、キャッシュされたアイコンをすべて削除する
+func (m *IconFileCache) CleanupAll() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries, err := m.cachedFiles()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.Remove(filepath.Join(m.dir, e.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// evict は、ファイル数がmaxFilesを超えている分を更新日時の古い順に削除する
+func (m *IconFileCache) evict() error {
+	entries, err := m.cachedFiles()
+	if err != nil {
+		return err
+	}
+	if len(entries) <= m.maxFiles {
+		return nil
+	}
+
+	type cachedFile struct {
+		name    string
+		modTime time.Time
+	}
+	files := make([]cachedFile, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			// 参照中に削除された
+			continue
+		}
+		files = append(files, cachedFile{name: e.Name(), modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for i := 0; i < len(files)-m.maxFiles; i++ {
+		if err := os.Remove(filepath.Join(m.dir, files[i].name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// cachedFiles は、書き込み途中の一時ファイルを除いたキャッシュファイルを返す
+func (m *IconFileCache) cachedFiles() ([]fs.DirEntry, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := entries[:0]
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), ".jpg") {
+			files = append(files, e)
+		}
+	}
+	return files, nil
+}
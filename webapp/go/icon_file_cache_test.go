@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIconFilesystemCache_MissHit(t *testing.T) {
+	cache, err := NewIconFileCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	icon := []byte("icon image")
+	if _, ok := cache.Get(1, iconHash(icon)); ok {
+		t.Fatal("Get before Put must miss")
+	}
+
+	p, err := cache.Put(1, icon)
+	if err != nil {
+		t.Fatalf("failed to put icon: %v", err)
+	}
+
+	got, ok := cache.Get(1, iconHash(icon))
+	if !ok {
+		t.Fatal("Get after Put must hit")
+	}
+	if got != p {
+		t.Errorf("Get = %q, want %q", got, p)
+	}
+	b, err := os.ReadFile(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, icon) {
+		t.Errorf("cached icon = %q, want %q", b, icon)
+	}
+
+	// アイコン更新時に削除される
+	if err := cache.Delete(1); err != nil {
+		t.Fatalf("failed to delete icon: %v", err)
+	}
+	if _, ok := cache.Get(1, iconHash(icon)); ok {
+		t.Error("Get after Delete must miss")
+	}
+	if err := cache.Delete(1); err != nil {
+		t.Errorf("deleting missing icon must not fail: %v", err)
+	}
+}
+
+func TestIconFilesystemCache_StalePut(t *testing.T) {
+	cache, err := NewIconFileCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldIcon, newIcon := []byte("old icon"), []byte("new icon")
+	// アイコン更新の前にDBから読んだ画像が、更新後のDeleteより後に書き込まれる
+	if err := cache.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Put(1, oldIcon); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cache.Get(1, iconHash(newIcon)); ok {
+		t.Fatal("stale icon must not be served for the new hash")
+	}
+	p, err := cache.Put(1, newIcon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := cache.Get(1, iconHash(newIcon))
+	if !ok || got != p {
+		t.Fatalf("Get = %q, %v, want %q", got, ok, p)
+	}
+	b, err := os.ReadFile(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, newIcon) {
+		t.Errorf("cached icon = %q, want %q", b, newIcon)
+	}
+
+	// Deleteは古いハッシュのファイルも含めて消す
+	if err := cache.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	for _, icon := range [][]byte{oldIcon, newIcon} {
+		if _, ok := cache.Get(1, iconHash(icon)); ok {
+			t.Errorf("icon %q must be deleted", icon)
+		}
+	}
+}
+
+func TestIconFilesystemCache_Evict(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewIconFileCache(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().Add(-time.Hour)
+	for i := int64(1); i <= 2; i++ {
+		p, err := cache.Put(i, []byte("icon"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 参照されたアイコンは最近使われたものとして残る
+	if _, ok := cache.Get(1, iconHash([]byte("icon"))); !ok {
+		t.Fatal("icon 1 must be cached")
+	}
+
+	if _, err := cache.Put(3, []byte("icon")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cache.Get(2, iconHash([]byte("icon"))); ok {
+		t.Error("least recently used icon 2 must be evicted")
+	}
+	for _, id := range []int64{1, 3} {
+		if _, ok := cache.Get(id, iconHash([]byte("icon"))); !ok {
+			t.Errorf("icon %d must be cached", id)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		names := make([]string, len(entries))
+		for i := range entries {
+			names[i] = filepath.Join(dir, entries[i].Name())
+		}
+		t.Errorf("cache dir has %d files, want 2: %v", len(entries), names)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/image/draw"
+)
+
+const (
+	iconThumbnailMimeType = "image/webp"
+	iconSizeOriginal      = "original"
+)
+
+// 生成するサムネイルの一辺のピクセル数
+var iconThumbnailSizes = []int{64, 128}
+
+type IconThumbnailModel struct {
+	UserID   int64  `db:"user_id"`
+	Size     string `db:"size"`
+	Image    []byte `db:"image"`
+	MimeType string `db:"mime_type"`
+}
+
+type IconThumbnail struct {
+	Size     string `json:"size"`
+	MimeType string `json:"mime_type"`
+}
+
+// アイコンサムネイル生成API
+// POST /api/user/me/icon/thumbnail
+func postIconThumbnailHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var icon []byte
+	if err := dbConn.GetContext(ctx, &icon, "SELECT image FROM icons WHERE user_id = ?", userID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user icon: "+err.Error())
+		}
+		icon = noimage
+	}
+
+	thumbnailModels, err := generateIconThumbnails(userID, icon)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to generate icon thumbnails: "+err.Error())
+	}
+
+	thumbnails, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) ([]IconThumbnail, error) {
+		thumbnails := make([]IconThumbnail, len(thumbnailModels))
+		for i, m := range thumbnailModels {
+			if _, err := tx.NamedExecContext(ctx, "INSERT INTO icon_thumbnails (user_id, size, image, mime_type) VALUES (:user_id, :size, :image, :mime_type) ON DUPLICATE KEY UPDATE image = VALUES(image), mime_type = VALUES(mime_type)", m); err != nil {
+				return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert icon thumbnail: "+err.Error()).SetInternal(err)
+			}
+			thumbnails[i] = IconThumbnail{
+				Size:     m.Size,
+				MimeType: m.MimeType,
+			}
+		}
+		return thumbnails, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+
+	return c.JSON(http.StatusCreated, thumbnails)
+}
+
+// getIconThumbnail は、?size= で指定されたサイズのサムネイルを返す
+func getIconThumbnail(c echo.Context, userID int64, size string) error {
+	ctx := c.Request().Context()
+
+	px, err := strconv.Atoi(size)
+	if err != nil || !slices.Contains(iconThumbnailSizes, px) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unsupported icon size: "+size)
+	}
+
+	var thumbnail IconThumbnailModel
+	if err := dbConn.GetContext(ctx, &thumbnail, "SELECT * FROM icon_thumbnails WHERE user_id = ? AND size = ?", userID, size); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "icon thumbnail not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get icon thumbnail: "+err.Error())
+	}
+
+	return c.Blob(http.StatusOK, thumbnail.MimeType, thumbnail.Image)
+}
+
+// generateIconThumbnails は、アイコン画像を中央で正方形に切り抜き、各サイズに縮小したWebP画像を生成する
+func generateIconThumbnails(userID int64, icon []byte) ([]IconThumbnailModel, error) {
+	src, _, err := image.Decode(bytes.NewReader(icon))
+	if err != nil {
+		return nil, err
+	}
+
+	// 縦横比を保つため、短辺に合わせて中央を切り抜く
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2))
+
+	thumbnails := make([]IconThumbnailModel, len(iconThumbnailSizes))
+	for i, px := range iconThumbnailSizes {
+		dst := image.NewRGBA(image.Rect(0, 0, px, px))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+		var buf bytes.Buffer
+		if err := nativewebp.Encode(&buf, dst, nil); err != nil {
+			return nil, fmt.Errorf("failed to encode %dx%d thumbnail: %w", px, px, err)
+		}
+		thumbnails[i] = IconThumbnailModel{
+			UserID:   userID,
+			Size:     strconv.Itoa(px),
+			Image:    buf.Bytes(),
+			MimeType: iconThumbnailMimeType,
+		}
+	}
+	return thumbnails, nil
+}
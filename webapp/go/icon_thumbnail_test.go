@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strconv"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+func newTestJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("failed to encode test jpeg: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerateIconThumbnails(t *testing.T) {
+	tests := []struct {
+		name string
+		icon []byte
+	}{
+		{name: "landscape", icon: newTestJPEG(t, 300, 200)},
+		{name: "portrait", icon: newTestJPEG(t, 90, 240)},
+		{name: "smaller than thumbnail", icon: newTestJPEG(t, 32, 32)},
+		{name: "fallback image", icon: noimage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumbnails, err := generateIconThumbnails(1, tt.icon)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(thumbnails) != len(iconThumbnailSizes) {
+				t.Fatalf("len(thumbnails) = %d, want %d", len(thumbnails), len(iconThumbnailSizes))
+			}
+
+			for i, px := range iconThumbnailSizes {
+				thumbnail := thumbnails[i]
+				if thumbnail.UserID != 1 {
+					t.Errorf("UserID = %d, want 1", thumbnail.UserID)
+				}
+				if thumbnail.Size != strconv.Itoa(px) {
+					t.Errorf("Size = %q, want %q", thumbnail.Size, strconv.Itoa(px))
+				}
+				if thumbnail.MimeType != "image/webp" {
+					t.Errorf("MimeType = %q, want image/webp", thumbnail.MimeType)
+				}
+
+				img, err := nativewebp.Decode(bytes.NewReader(thumbnail.Image))
+				if err != nil {
+					t.Fatalf("failed to decode %dpx thumbnail as webp: %v", px, err)
+				}
+				if b := img.Bounds(); b.Dx() != px || b.Dy() != px {
+					t.Errorf("thumbnail dimensions = %dx%d, want %dx%d", b.Dx(), b.Dy(), px, px)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateIconThumbnails_InvalidImage(t *testing.T) {
+	if _, err := generateIconThumbnails(1, []byte("not an image")); err == nil {
+		t.Fatal("expected error for invalid image")
+	}
+}
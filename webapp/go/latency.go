@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ルートごとに保持するレスポンスタイムの件数 (古いものから上書きする)
+const latencyTrackerCapacity = 10000
+
+var latencyTracker = NewLatencyTracker(latencyTrackerCapacity)
+
+// LatencyPercentiles は、ルートごとのレスポンスタイムの分布 (ミリ秒)
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// LatencyTracker は、ルートごとに直近capacity件のレスポンスタイムをリングバッファで保持する
+type LatencyTracker struct {
+	capacity int
+	routes   sync.Map
+}
+
+type latencyRing struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func NewLatencyTracker(capacity int) *LatencyTracker {
+	return &LatencyTracker{capacity: capacity}
+}
+
+func (t *LatencyTracker) Record(route string, d time.Duration) {
+	v, ok := t.routes.Load(route)
+	if !ok {
+		v, _ = t.routes.LoadOrStore(route, &latencyRing{samples: make([]time.Duration, 0, t.capacity)})
+	}
+	r := v.(*latencyRing)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.samples) < t.capacity {
+		r.samples = append(r.samples, d)
+		return
+	}
+	r.samples[r.next] = d
+	r.next = (r.next + 1) % t.capacity
+}
+
+// Snapshot は、ルートをキーとしたパーセンタイルを返す
+func (t *LatencyTracker) Snapshot() map[string]LatencyPercentiles {
+	snapshot := make(map[string]LatencyPercentiles)
+	t.routes.Range(func(key, value interface{}) bool {
+		r := value.(*latencyRing)
+		r.mu.Lock()
+		samples := slices.Clone(r.samples)
+		r.mu.Unlock()
+		if len(samples) == 0 {
+			return true
+		}
+
+		slices.Sort(samples)
+		snapshot[key.(string)] = LatencyPercentiles{
+			P50: durationMilliseconds(percentile(samples, 50)),
+			P95: durationMilliseconds(percentile(samples, 95)),
+			P99: durationMilliseconds(percentile(samples, 99)),
+			Max: durationMilliseconds(samples[len(samples)-1]),
+		}
+		return true
+	})
+	return snapshot
+}
+
+func (t *LatencyTracker) CleanupAll() {
+	t.routes.Range(func(key, value interface{}) bool {
+		t.routes.Delete(key)
+		return true
+	})
+}
+
+// percentile は、昇順に並んだsortedのpパーセンタイルを最近傍順位法で返す
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func durationMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// LatencyMiddleware は、ハンドラの処理時間をルート (c.Path()) ごとに記録する
+// どのルートにもマッチしなかったリクエストは記録しない
+func LatencyMiddleware(tracker *LatencyTracker) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if route := c.Path(); route != "" {
+				tracker.Record(route, time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// レスポンスタイム取得API (管理者のみ)
+// GET /api/metrics/latency
+func getLatencyMetricsHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, latencyTracker.Snapshot())
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestLatencyTracker_Percentiles(t *testing.T) {
+	tracker := NewLatencyTracker(latencyTrackerCapacity)
+
+	// 1ms〜1000msを1件ずつ、順不同で記録する
+	for _, i := range rand.Perm(1000) {
+		tracker.Record("/api/livestream/:livestream_id", time.Duration(i+1)*time.Millisecond)
+	}
+
+	got, ok := tracker.Snapshot()["/api/livestream/:livestream_id"]
+	if !ok {
+		t.Fatal("route is not recorded")
+	}
+	for _, tt := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"p50", got.P50, 500},
+		{"p95", got.P95, 950},
+		{"p99", got.P99, 990},
+		{"max", got.Max, 1000},
+	} {
+		if math.Abs(tt.got-tt.want) > tt.want*0.01 {
+			t.Errorf("%s = %v, want %v (±1%%)", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLatencyTracker_KeepsLatestSamples(t *testing.T) {
+	tracker := NewLatencyTracker(10)
+
+	// 古い遅いリクエストは上書きされる
+	for i := 0; i < 10; i++ {
+		tracker.Record("/api/tag", time.Second)
+	}
+	for i := 0; i < 10; i++ {
+		tracker.Record("/api/tag", time.Millisecond)
+	}
+
+	if got := tracker.Snapshot()["/api/tag"].Max; got != 1 {
+		t.Errorf("max = %v, want 1", got)
+	}
+}
+
+func TestLatencyTracker_Concurrent(t *testing.T) {
+	tracker := NewLatencyTracker(100)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				tracker.Record("/api/tag", time.Millisecond)
+				tracker.Snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := tracker.Snapshot()["/api/tag"].P50; got != 1 {
+		t.Errorf("p50 = %v, want 1", got)
+	}
+}
+
+func TestLatencyMiddleware_KeyedByRoute(t *testing.T) {
+	tracker := NewLatencyTracker(100)
+
+	e := echo.New()
+	e.Use(LatencyMiddleware(tracker))
+	e.GET("/api/livestream/:livestream_id", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, path := range []string{"/api/livestream/1", "/api/livestream/2", "/not-found"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	snapshot := tracker.Snapshot()
+	if _, ok := snapshot["/api/livestream/:livestream_id"]; !ok || len(snapshot) != 1 {
+		t.Errorf("snapshot = %v, want only /api/livestream/:livestream_id", snapshot)
+	}
+}
+
+func TestGetLatencyMetricsHandler_RequiresAdmin(t *testing.T) {
+	orig := adminSecret
+	adminSecret = "s3cret"
+	t.Cleanup(func() { adminSecret = orig })
+
+	e := echo.New()
+	registerAdminHandlers(e)
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{name: "no secret", header: "", want: http.StatusForbidden},
+		{name: "wrong secret", header: "wrong", want: http.StatusForbidden},
+		{name: "admin", header: "s3cret", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/metrics/latency", nil)
+			if tt.header != "" {
+				req.Header.Set(adminSecretHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
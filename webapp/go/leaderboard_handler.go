@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultDonorLeaderboardLimit = 10
+	maxDonorLeaderboardLimit     = 100
+)
+
+// ランキングへの表示を拒否したユーザの代わりに表示する名前
+const anonymousDonorName = "anonymous"
+
+type DonorEntry struct {
+	Rank     int64 `json:"rank"`
+	User     User  `json:"user"`
+	TotalTip int64 `json:"total_tip"`
+}
+
+// 配信のチップランキング取得API
+// GET /api/livestream/:livestream_id/donor-leaderboard
+func getDonorLeaderboardHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	limit := defaultDonorLeaderboardLimit
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxDonorLeaderboardLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be integer between 1 and 100")
+		}
+	}
+
+	var livestreamModel LivestreamModel
+	if err := dbConn.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", livestreamID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+
+	type donor struct {
+		UserID   int64 `db:"user_id"`
+		TotalTip int64 `db:"total_tip"`
+	}
+	var donors []donor
+	if err := dbConn.SelectContext(ctx, &donors, `
+		SELECT user_id, SUM(tip) AS total_tip FROM livecomments
+		WHERE livestream_id = ? AND tip > 0
+		GROUP BY user_id
+		ORDER BY total_tip DESC, user_id ASC
+		LIMIT ?`, livestreamID, limit); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get donors: "+err.Error())
+	}
+	if len(donors) == 0 {
+		return c.JSON(http.StatusOK, []DonorEntry{})
+	}
+
+	userIDs := make([]int64, len(donors))
+	for i := range donors {
+		userIDs[i] = donors[i].UserID
+	}
+
+	query, params, err := sqlx.In("SELECT * FROM users WHERE id IN (?)", userIDs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to construct IN query: "+err.Error())
+	}
+	var userModels []UserModel
+	if err := dbConn.SelectContext(ctx, &userModels, query, params...); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get users: "+err.Error())
+	}
+	users, err := fillUsersResponseWithoutTx(ctx, userModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill users: "+err.Error())
+	}
+	userMap := make(map[int64]User, len(users))
+	for i := range users {
+		userMap[userModels[i].ID] = users[i]
+	}
+
+	privacyMap, err := getUserPrivacyMap(ctx, dbConn, userIDs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user privacy: "+err.Error())
+	}
+
+	entries := make([]DonorEntry, len(donors))
+	for i := range donors {
+		privacy, ok := privacyMap[donors[i].UserID]
+		if !ok {
+			privacy = defaultUserPrivacy
+		}
+
+		// 表示を拒否したユーザも、チップの金額はランキングに残す
+		user := User{Name: anonymousDonorName}
+		if privacy.ShowOnLeaderboard {
+			user = userMap[donors[i].UserID]
+		}
+
+		entries[i] = DonorEntry{
+			Rank:     int64(i + 1),
+			User:     user,
+			TotalTip: donors[i].TotalTip,
+		}
+	}
+
+	return c.JSON(http.StatusOK, entries)
+}
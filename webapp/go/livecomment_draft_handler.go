@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+// ライブコメントの最大文字数 (livecomments.commentのVARCHAR(255))
+const MaxLivecommentLength = 255
+
+type LivecommentDraftModel struct {
+	UserID       int64  `db:"user_id"`
+	LivestreamID int64  `db:"livestream_id"`
+	Comment      string `db:"comment"`
+	Tip          int64  `db:"tip"`
+	UpdatedAt    int64  `db:"updated_at"`
+}
+
+type PostLivecommentDraftRequest struct {
+	Comment string `json:"comment"`
+	Tip     int64  `json:"tip"`
+}
+
+type LivecommentDraft struct {
+	LivestreamID int64  `json:"livestream_id"`
+	Comment      string `json:"comment"`
+	Tip          int64  `json:"tip"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+// ライブコメント下書き保存API
+// POST /api/livestream/:livestream_id/livecomment-draft
+func postLivecommentDraftHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PostLivecommentDraftRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if utf8.RuneCountInString(req.Comment) > MaxLivecommentLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("comment must be at most %d characters", MaxLivecommentLength))
+	}
+	if req.Tip < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "tip must not be negative")
+	}
+
+	var exists bool
+	if err := dbConn.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM livestreams WHERE id = ?)", livestreamID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+	}
+
+	draftModel := LivecommentDraftModel{
+		UserID:       userID,
+		LivestreamID: int64(livestreamID),
+		Comment:      req.Comment,
+		Tip:          req.Tip,
+		UpdatedAt:    time.Now().Unix(),
+	}
+	if _, err := dbConn.NamedExecContext(ctx, "INSERT INTO livecomment_drafts (user_id, livestream_id, comment, tip, updated_at) VALUES (:user_id, :livestream_id, :comment, :tip, :updated_at) ON DUPLICATE KEY UPDATE comment = VALUES(comment), tip = VALUES(tip), updated_at = VALUES(updated_at)", draftModel); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save livecomment draft: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, LivecommentDraft{
+		LivestreamID: draftModel.LivestreamID,
+		Comment:      draftModel.Comment,
+		Tip:          draftModel.Tip,
+		UpdatedAt:    draftModel.UpdatedAt,
+	})
+}
+
+// ライブコメント下書き取得API
+// GET /api/livestream/:livestream_id/livecomment-draft
+func getLivecommentDraftHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var draftModel LivecommentDraftModel
+	if err := dbConn.GetContext(ctx, &draftModel, "SELECT * FROM livecomment_drafts WHERE user_id = ? AND livestream_id = ?", userID, livestreamID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "livecomment draft not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomment draft: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, LivecommentDraft{
+		LivestreamID: draftModel.LivestreamID,
+		Comment:      draftModel.Comment,
+		Tip:          draftModel.Tip,
+		UpdatedAt:    draftModel.UpdatedAt,
+	})
+}
+
+// ライブコメント下書き破棄API
+// DELETE /api/livestream/:livestream_id/livecomment-draft
+func deleteLivecommentDraftHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	rs, err := dbConn.ExecContext(ctx, "DELETE FROM livecomment_drafts WHERE user_id = ? AND livestream_id = ?", userID, livestreamID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livecomment draft: "+err.Error())
+	}
+	if n, err := rs.RowsAffected(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get affected rows: "+err.Error())
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "livecomment draft not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
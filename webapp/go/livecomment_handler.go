@@ -21,6 +21,12 @@ type PostLivecommentRequest struct {
 	Tip     int64  `json:"tip"`
 }
 
+// dry_run=true の場合のレスポンス
+type DryRunLivecommentResponse struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
 type LivecommentModel struct {
 	ID           int64  `db:"id"`
 	UserID       int64  `db:"user_id"`
@@ -36,7 +42,14 @@ type Livecomment struct {
 	Livestream Livestream `json:"livestream"`
 	Comment    string     `json:"comment"`
 	Tip        int64      `json:"tip"`
-	CreatedAt  int64      `json:"created_at"`
+	// TipFormatted は、表示用に整形したチップ額 (チップなしの場合は空文字)
+	TipFormatted string `json:"tip_formatted"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+type ChatReplayLivecomment struct {
+	Livecomment
+	OffsetFromStart int64 `json:"offset_from_start"`
 }
 
 type LivecommentReport struct {
@@ -58,6 +71,31 @@ type ModerateRequest struct {
 	NGWord string `json:"ng_word"`
 }
 
+// 一括登録できるNGワードの上限
+const maxBulkModerateWords = 500
+
+type BulkModerateRequest struct {
+	Words []string `json:"words"`
+}
+
+type BulkModerateResponse struct {
+	InsertedCount int `json:"inserted_count"`
+	// リクエスト内での重複と、登録済みのNGワードの数
+	SkippedCount int `json:"skipped_count"`
+}
+
+const (
+	defaultLivecommentsLimit = 20
+	maxLivecommentsLimit     = 100
+)
+
+// ライブコメント一覧のレスポンス
+// NextCursorは次のページを取得するためのcursorで、最後のページでは空文字になる
+type GetLivecommentsResponse struct {
+	Livecomments []Livecomment `json:"livecomments"`
+	NextCursor   string        `json:"next_cursor"`
+}
+
 type NGWord struct {
 	ID           int64  `json:"id" db:"id"`
 	UserID       int64  `json:"user_id" db:"user_id"`
@@ -79,6 +117,22 @@ func getLivecommentsHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
+	limit := defaultLivecommentsLimit
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxLivecommentsLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit query parameter must be integer between 1 and %d", maxLivecommentsLimit))
+		}
+	}
+
+	var cursor int64
+	if v := c.QueryParam("cursor"); v != "" {
+		cursor, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || cursor < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "cursor query parameter must be positive integer")
+		}
+	}
+
 	var livestreamModel LivestreamModel
 	if err := dbConn.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", livestreamID); err != nil {
 		return err
@@ -88,33 +142,125 @@ func getLivecommentsHandler(c echo.Context) error {
 		return err
 	}
 
-	query := "SELECT * FROM livecomments WHERE livestream_id = ? ORDER BY id DESC"
+	livecommentModels, nextCursor, err := getLivecommentModelsPage(ctx, int64(livestreamID), cursor, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomments: "+err.Error())
+	}
+	if len(livecommentModels) == 0 {
+		return c.JSON(http.StatusOK, GetLivecommentsResponse{Livecomments: []Livecomment{}})
+	}
+
+	livecomments, err := fillLivecommentsResponseWithoutTx(ctx, livecommentModels, livestream)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomments: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, GetLivecommentsResponse{
+		Livecomments: livecomments,
+		NextCursor:   nextCursor,
+	})
+}
+
+// getLivecommentModelsPage は、cursorより小さいIDのライブコメントを新しい順に最大limit件返す
+// cursorが0の場合は最新のライブコメントから返す
+// 続きがある場合は、最後のライブコメントのIDを次のcursorとして返す (続きがなければ空文字)
+func getLivecommentModelsPage(ctx context.Context, livestreamID, cursor int64, limit int) ([]LivecommentModel, string, error) {
+	query := "SELECT * FROM livecomments WHERE livestream_id = ?"
+	args := []any{livestreamID}
+	if cursor > 0 {
+		query += " AND id < ?"
+		args = append(args, cursor)
+	}
+	// 次のページがあるかを知るため1件多く取得する
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	livecommentModels := []LivecommentModel{}
+	if err := dbConn.SelectContext(ctx, &livecommentModels, query, args...); err != nil {
+		return nil, "", err
+	}
+	if len(livecommentModels) <= limit {
+		return livecommentModels, "", nil
+	}
+
+	livecommentModels = livecommentModels[:limit]
+	return livecommentModels, strconv.FormatInt(livecommentModels[limit-1].ID, 10), nil
+}
+
+// VOD再生向けのライブコメント取得API
+// 配信開始からの経過秒数を基準にライブコメントを返す
+// GET /api/livestream/:livestream_id/chat-replay
+func getChatReplayHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	var offsetSeconds int64
+	if c.QueryParam("offset_seconds") != "" {
+		offsetSeconds, err = strconv.ParseInt(c.QueryParam("offset_seconds"), 10, 64)
+		if err != nil || offsetSeconds < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "offset_seconds query parameter must be non-negative integer")
+		}
+	}
+
+	var windowSeconds int64 = 10
+	if c.QueryParam("window_seconds") != "" {
+		windowSeconds, err = strconv.ParseInt(c.QueryParam("window_seconds"), 10, 64)
+		if err != nil || windowSeconds <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "window_seconds query parameter must be positive integer")
+		}
+	}
+
+	limit := 50
 	if c.QueryParam("limit") != "" {
-		limit, err := strconv.Atoi(c.QueryParam("limit"))
-		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be integer")
+		limit, err = strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || limit <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be positive integer")
 		}
-		query += fmt.Sprintf(" LIMIT %d", limit)
 	}
 
-	livecommentModels := []LivecommentModel{}
-	err = dbConn.SelectContext(ctx, &livecommentModels, query, livestreamID)
-	if errors.Is(err, sql.ErrNoRows) {
-		return c.JSON(http.StatusOK, []*Livecomment{})
+	var livestreamModel LivestreamModel
+	if err := dbConn.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", livestreamID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
 	}
+	livestream, err := fillLivestreamResponseWithoutTx(ctx, livestreamModel)
 	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
+	}
+
+	from := livestreamModel.StartAt + offsetSeconds
+	to := from + windowSeconds
+
+	livecommentModels := []LivecommentModel{}
+	if err := dbConn.SelectContext(ctx, &livecommentModels, "SELECT * FROM livecomments WHERE livestream_id = ? AND created_at >= ? AND created_at < ? ORDER BY created_at ASC LIMIT ?", livestreamID, from, to, limit); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomments: "+err.Error())
 	}
 
 	livecomments, err := fillLivecommentsResponseWithoutTx(ctx, livecommentModels, livestream)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomments: "+err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomments: "+err.Error())
+	}
+
+	replay := make([]ChatReplayLivecomment, len(livecomments))
+	for i := range livecomments {
+		replay[i] = ChatReplayLivecomment{
+			Livecomment:     livecomments[i],
+			OffsetFromStart: livecomments[i].CreatedAt - livestreamModel.StartAt,
+		}
 	}
 
-	return c.JSON(http.StatusOK, livecomments)
+	return c.JSON(http.StatusOK, replay)
 }
 
-func getNgwords(c echo.Context) error {
+// NGワード一覧取得API (配信者向け)
+// GET /api/livestream/:livestream_id/ngwords
+func getNGWordsHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	if err := verifyUserSession(c); err != nil {
@@ -131,18 +277,62 @@ func getNgwords(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	var ngWords []*NGWord
+	if err := verifyLivestreamOwner(ctx, dbConn, int64(livestreamID), userID); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	ngWords := []*NGWord{}
 	if err := dbConn.SelectContext(ctx, &ngWords, "SELECT * FROM ng_words WHERE user_id = ? AND livestream_id = ? ORDER BY created_at DESC", userID, livestreamID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return c.JSON(http.StatusOK, []*NGWord{})
-		} else {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get NG words: "+err.Error())
-		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get NG words: "+err.Error())
 	}
 
 	return c.JSON(http.StatusOK, ngWords)
 }
 
+// NGワード削除API (配信者向け)
+// 削除済みのライブコメントは元に戻らない
+// DELETE /api/livestream/:livestream_id/ngword/:ngword_id
+func deleteNGWordHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+	ngWordID, err := strconv.ParseInt(c.Param("ngword_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "ngword_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	if err := verifyLivestreamOwner(ctx, dbConn, int64(livestreamID), userID); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	rs, err := dbConn.ExecContext(ctx, "DELETE FROM ng_words WHERE id = ? AND livestream_id = ?", ngWordID, livestreamID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete NG word: "+err.Error())
+	}
+	if n, err := rs.RowsAffected(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get affected rows: "+err.Error())
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "NG word not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
 func postLivecommentHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 	defer c.Request().Body.Close()
@@ -161,11 +351,26 @@ func postLivecommentHandler(c echo.Context) error {
 	// existence already checked
 	userID := sess.Values[defaultUserIDKey].(int64)
 
+	var dryRun bool
+	if c.QueryParam("dry_run") != "" {
+		dryRun, err = strconv.ParseBool(c.QueryParam("dry_run"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "dry_run query parameter must be boolean")
+		}
+	}
+
 	var req *PostLivecommentRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
 	}
 
+	if req.Tip < 0 {
+		if dryRun {
+			return c.JSON(http.StatusOK, DryRunLivecommentResponse{Allowed: false, Reason: "invalid tip"})
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, "tip must not be negative")
+	}
+
 	tx, err := dbConn.BeginTxx(ctx, nil)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
@@ -193,11 +398,19 @@ func postLivecommentHandler(c echo.Context) error {
 			hitSpam++
 		}
 	}
-	c.Logger().Infof("[hitSpam=%d] comment = %s", hitSpam, req.Comment)
+	loggerFromContext(ctx).Info("spam check", "hit_spam", hitSpam, "comment", req.Comment)
 	if hitSpam >= 1 {
+		if dryRun {
+			return c.JSON(http.StatusOK, DryRunLivecommentResponse{Allowed: false, Reason: "contains banned word"})
+		}
 		return echo.NewHTTPError(http.StatusBadRequest, "このコメントがスパム判定されました")
 	}
 
+	// 検証のみ行い、投稿はしない
+	if dryRun {
+		return c.JSON(http.StatusOK, DryRunLivecommentResponse{Allowed: true})
+	}
+
 	now := time.Now().Unix()
 	livecommentModel := LivecommentModel{
 		UserID:       userID,
@@ -218,6 +431,11 @@ func postLivecommentHandler(c echo.Context) error {
 	}
 	livecommentModel.ID = livecommentID
 
+	// 投稿できたので下書きは不要になる
+	if _, err := tx.ExecContext(ctx, "DELETE FROM livecomment_drafts WHERE user_id = ? AND livestream_id = ?", userID, livestreamID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livecomment draft: "+err.Error())
+	}
+
 	livecomment, err := fillLivecommentResponse(ctx, tx, livecommentModel)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment: "+err.Error())
@@ -227,6 +445,10 @@ func postLivecommentHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
 	}
 
+	notifyTipWebhooks(c.Logger(), livecomment)
+	invalidateLivestreamActivityCaches(livestreamModel.ID, livestreamModel.UserID)
+	livecommentBroadcasters.Publish(livecomment.Livestream.ID, livecomment)
+
 	return c.JSON(http.StatusCreated, livecomment)
 }
 
@@ -304,6 +526,71 @@ func reportLivecommentHandler(c echo.Context) error {
 	return c.JSON(http.StatusCreated, report)
 }
 
+// ライブコメント削除API (配信者向け)
+// DELETE /api/livestream/:livestream_id/livecomment/:livecomment_id
+func deleteLivecommentHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+	livecommentID, err := strconv.ParseInt(c.Param("livecomment_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livecomment_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	ownerID, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (int64, error) {
+		// コメントした本人ではなく、配信者だけが削除できる
+		livestreamModel, err := lockOwnLivestream(ctx, tx, int64(livestreamID), userID)
+		if err != nil {
+			return 0, err
+		}
+
+		// 別の配信のライブコメントを消さないよう、livestream_idも条件に含める
+		rs, err := tx.ExecContext(ctx, "DELETE FROM livecomments WHERE id = ? AND livestream_id = ?", livecommentID, livestreamID)
+		if err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livecomment: "+err.Error()).SetInternal(err)
+		}
+		n, err := rs.RowsAffected()
+		if err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get affected rows: "+err.Error()).SetInternal(err)
+		}
+		if n == 0 {
+			return 0, echo.NewHTTPError(http.StatusNotFound, "livecomment not found")
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM livecomment_reports WHERE livecomment_id = ?", livecommentID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livecomment reports: "+err.Error()).SetInternal(err)
+		}
+		// ピン留めされていた場合は解除する
+		if _, err := tx.ExecContext(ctx, "UPDATE livestreams SET pinned_livecomment_id = NULL WHERE id = ? AND pinned_livecomment_id = ?", livestreamID, livecommentID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to unpin livecomment: "+err.Error()).SetInternal(err)
+		}
+
+		if err := logAudit(ctx, tx, userID, AuditActionDeleteLivecomment, livecommentID, map[string]int64{"livestream_id": int64(livestreamID)}); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert audit log: "+err.Error()).SetInternal(err)
+		}
+		return livestreamModel.UserID, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+	invalidateLivestreamActivityCaches(int64(livestreamID), ownerID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
 // NGワードを登録
 func moderateHandler(c echo.Context) error {
 	ctx := c.Request().Context()
@@ -334,17 +621,27 @@ func moderateHandler(c echo.Context) error {
 	}
 	defer tx.Rollback()
 
-	// 配信者自身の配信に対するmoderateなのかを検証
-	var ownedLivestreams []LivestreamModel
-	if err := tx.SelectContext(ctx, &ownedLivestreams, "SELECT * FROM livestreams WHERE id = ? AND user_id = ?", livestreamID, userID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
+	// 配信者自身、もしくは共同モデレーターによるmoderateなのかを検証
+	var livestreamModel LivestreamModel
+	if err := tx.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", livestreamID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
 	}
-	if len(ownedLivestreams) == 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, "A streamer can't moderate livestreams that other streamers own")
+	if livestreamModel.UserID != userID {
+		isModerator, err := isLivestreamModerator(ctx, tx, livestreamModel.ID, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderators: "+err.Error())
+		}
+		if !isModerator {
+			return echo.NewHTTPError(http.StatusBadRequest, "A streamer can't moderate livestreams that other streamers own")
+		}
 	}
 
+	// スパム判定は配信者のuser_idで行うので、モデレーターが登録した場合も配信者のNGワードとして登録する
 	rs, err := tx.NamedExecContext(ctx, "INSERT INTO ng_words(user_id, livestream_id, word, created_at) VALUES (:user_id, :livestream_id, :word, :created_at)", &NGWord{
-		UserID:       int64(userID),
+		UserID:       livestreamModel.UserID,
 		LivestreamID: int64(livestreamID),
 		Word:         req.NGWord,
 		CreatedAt:    time.Now().Unix(),
@@ -365,18 +662,136 @@ func moderateHandler(c echo.Context) error {
 	if err := tx.Commit(); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
 	}
+	// NGワードに該当するライブコメントは他の配信からも消えるので、全配信・全ユーザーの統計キャッシュを捨てる
+	purgeAllLivestreamStatsCache()
+	userStatsCache.CleanupAll()
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
 		"word_id": wordID,
 	})
 }
 
+// NGワード一括登録API
+// 他サービスからの移行向けで、登録済みのNGワードは読み飛ばす
+// moderateと異なり、既存のライブコメントは削除しない
+// POST /api/livestream/:livestream_id/ngwords/bulk
+func bulkModerateHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.ParseInt(c.Param("livestream_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *BulkModerateRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if len(req.Words) == 0 || len(req.Words) > maxBulkModerateWords {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("words must contain between 1 and %d NG words", maxBulkModerateWords))
+	}
+
+	// リクエスト内の重複を取り除く (順序は保つ)
+	words := make([]string, 0, len(req.Words))
+	seen := make(map[string]struct{}, len(req.Words))
+	for _, word := range req.Words {
+		if word == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "NG word must not be empty")
+		}
+		if _, ok := seen[word]; ok {
+			continue
+		}
+		seen[word] = struct{}{}
+		words = append(words, word)
+	}
+
+	inserted, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (int, error) {
+		// 配信者自身、もしくは共同モデレーターによる登録なのかを検証
+		var livestreamModel LivestreamModel
+		if err := tx.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ? FOR UPDATE", livestreamID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+			}
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error()).SetInternal(err)
+		}
+		if livestreamModel.UserID != userID {
+			isModerator, err := isLivestreamModerator(ctx, tx, livestreamModel.ID, userID)
+			if err != nil {
+				return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderators: "+err.Error()).SetInternal(err)
+			}
+			if !isModerator {
+				return 0, echo.NewHTTPError(http.StatusForbidden, "only the owner or moderators of the livestream can moderate it")
+			}
+		}
+
+		// ng_wordsには一意制約がないため、登録済みのNGワードを引いてから除く
+		// 配信の行をロックしているので、同じ配信への一括登録が並行しても二重には登録されない
+		var existingWords []string
+		query, params, err := sqlx.In("SELECT word FROM ng_words WHERE livestream_id = ? AND word IN (?)", livestreamID, words)
+		if err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to build query: "+err.Error()).SetInternal(err)
+		}
+		if err := tx.SelectContext(ctx, &existingWords, query, params...); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get NG words: "+err.Error()).SetInternal(err)
+		}
+		existing := make(map[string]struct{}, len(existingWords))
+		for _, word := range existingWords {
+			existing[word] = struct{}{}
+		}
+
+		now := time.Now().Unix()
+		ngWords := make([]NGWord, 0, len(words))
+		for _, word := range words {
+			if _, ok := existing[word]; ok {
+				continue
+			}
+			// moderateと同じく、配信者のNGワードとして登録する
+			ngWords = append(ngWords, NGWord{
+				UserID:       livestreamModel.UserID,
+				LivestreamID: livestreamModel.ID,
+				Word:         word,
+				CreatedAt:    now,
+			})
+		}
+		if len(ngWords) == 0 {
+			return 0, nil
+		}
+
+		if _, err := tx.NamedExecContext(ctx, "INSERT INTO ng_words (user_id, livestream_id, word, created_at) VALUES (:user_id, :livestream_id, :word, :created_at)", ngWords); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert NG words: "+err.Error()).SetInternal(err)
+		}
+		return len(ngWords), nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+
+	return c.JSON(http.StatusCreated, BulkModerateResponse{
+		InsertedCount: inserted,
+		SkippedCount:  len(req.Words) - inserted,
+	})
+}
+
 func fillLivecommentResponse(ctx context.Context, tx *sqlx.Tx, livecommentModel LivecommentModel) (Livecomment, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	commentOwnerModel := UserModel{}
 	if err := tx.GetContext(ctx, &commentOwnerModel, "SELECT * FROM users WHERE id = ?", livecommentModel.UserID); err != nil {
 		return Livecomment{}, err
 	}
-	commentOwner, err := fillUserResponse(ctx, tx, commentOwnerModel)
+	commentOwner, err := fillUserResponse(ctx, tx, commentOwnerModel, noViewerID)
 	if err != nil {
 		return Livecomment{}, err
 	}
@@ -391,23 +806,27 @@ func fillLivecommentResponse(ctx context.Context, tx *sqlx.Tx, livecommentModel
 	}
 
 	livecomment := Livecomment{
-		ID:         livecommentModel.ID,
-		User:       commentOwner,
-		Livestream: livestream,
-		Comment:    livecommentModel.Comment,
-		Tip:        livecommentModel.Tip,
-		CreatedAt:  livecommentModel.CreatedAt,
+		ID:           livecommentModel.ID,
+		User:         commentOwner,
+		Livestream:   livestream,
+		Comment:      livecommentModel.Comment,
+		Tip:          livecommentModel.Tip,
+		TipFormatted: formatTip(livecommentModel.Tip),
+		CreatedAt:    livecommentModel.CreatedAt,
 	}
 
 	return livecomment, nil
 }
 
 func fillLivecommentResponseWithoutTx(ctx context.Context, livecommentModel LivecommentModel) (Livecomment, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	commentOwnerModel := UserModel{}
 	if err := dbConn.GetContext(ctx, &commentOwnerModel, "SELECT * FROM users WHERE id = ?", livecommentModel.UserID); err != nil {
 		return Livecomment{}, err
 	}
-	commentOwner, err := fillUserResponseWithoutTx(ctx, commentOwnerModel)
+	commentOwner, err := fillUserResponseWithoutTx(ctx, commentOwnerModel, noViewerID)
 	if err != nil {
 		return Livecomment{}, err
 	}
@@ -422,18 +841,22 @@ func fillLivecommentResponseWithoutTx(ctx context.Context, livecommentModel Live
 	}
 
 	livecomment := Livecomment{
-		ID:         livecommentModel.ID,
-		User:       commentOwner,
-		Livestream: livestream,
-		Comment:    livecommentModel.Comment,
-		Tip:        livecommentModel.Tip,
-		CreatedAt:  livecommentModel.CreatedAt,
+		ID:           livecommentModel.ID,
+		User:         commentOwner,
+		Livestream:   livestream,
+		Comment:      livecommentModel.Comment,
+		Tip:          livecommentModel.Tip,
+		TipFormatted: formatTip(livecommentModel.Tip),
+		CreatedAt:    livecommentModel.CreatedAt,
 	}
 
 	return livecomment, nil
 }
 
 func fillLivecommentsResponse(ctx context.Context, tx *sqlx.Tx, livecommentModels []LivecommentModel, livestream Livestream) ([]Livecomment, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	if len(livecommentModels) == 0 {
 		return []Livecomment{}, nil
 	}
@@ -461,18 +884,22 @@ func fillLivecommentsResponse(ctx context.Context, tx *sqlx.Tx, livecommentModel
 	for i := range livecommentModels {
 		m := livecommentModels[i]
 		livecomments[i] = Livecomment{
-			ID:         m.ID,
-			User:       userIDUsers[m.UserID],
-			Livestream: livestream,
-			Comment:    m.Comment,
-			Tip:        m.Tip,
-			CreatedAt:  m.CreatedAt,
+			ID:           m.ID,
+			User:         userIDUsers[m.UserID],
+			Livestream:   livestream,
+			Comment:      m.Comment,
+			Tip:          m.Tip,
+			TipFormatted: formatTip(m.Tip),
+			CreatedAt:    m.CreatedAt,
 		}
 	}
 	return livecomments, nil
 }
 
 func fillLivecommentsResponseWithoutTx(ctx context.Context, livecommentModels []LivecommentModel, livestream Livestream) ([]Livecomment, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	if len(livecommentModels) == 0 {
 		return []Livecomment{}, nil
 	}
@@ -500,23 +927,27 @@ func fillLivecommentsResponseWithoutTx(ctx context.Context, livecommentModels []
 	for i := range livecommentModels {
 		m := livecommentModels[i]
 		livecomments[i] = Livecomment{
-			ID:         m.ID,
-			User:       userIDUsers[m.UserID],
-			Livestream: livestream,
-			Comment:    m.Comment,
-			Tip:        m.Tip,
-			CreatedAt:  m.CreatedAt,
+			ID:           m.ID,
+			User:         userIDUsers[m.UserID],
+			Livestream:   livestream,
+			Comment:      m.Comment,
+			Tip:          m.Tip,
+			TipFormatted: formatTip(m.Tip),
+			CreatedAt:    m.CreatedAt,
 		}
 	}
 	return livecomments, nil
 }
 
 func fillLivecommentReportResponse(ctx context.Context, tx *sqlx.Tx, reportModel LivecommentReportModel) (LivecommentReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	reporterModel := UserModel{}
 	if err := tx.GetContext(ctx, &reporterModel, "SELECT * FROM users WHERE id = ?", reportModel.UserID); err != nil {
 		return LivecommentReport{}, err
 	}
-	reporter, err := fillUserResponse(ctx, tx, reporterModel)
+	reporter, err := fillUserResponse(ctx, tx, reporterModel, noViewerID)
 	if err != nil {
 		return LivecommentReport{}, err
 	}
@@ -540,11 +971,14 @@ func fillLivecommentReportResponse(ctx context.Context, tx *sqlx.Tx, reportModel
 }
 
 func fillLivecommentReportResponseWithoutTx(ctx context.Context, reportModel LivecommentReportModel) (LivecommentReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	reporterModel := UserModel{}
 	if err := dbConn.GetContext(ctx, &reporterModel, "SELECT * FROM users WHERE id = ?", reportModel.UserID); err != nil {
 		return LivecommentReport{}, err
 	}
-	reporter, err := fillUserResponseWithoutTx(ctx, reporterModel)
+	reporter, err := fillUserResponseWithoutTx(ctx, reporterModel, noViewerID)
 	if err != nil {
 		return LivecommentReport{}, err
 	}
@@ -566,3 +1000,144 @@ func fillLivecommentReportResponseWithoutTx(ctx context.Context, reportModel Liv
 	}
 	return report, nil
 }
+
+// fillLivecommentReportsResponseWithoutTx は、報告者・ライブコメント・配信をそれぞれIN句でまとめて取得し、
+// 報告件数によらず一定回数のクエリで報告一覧を組み立てる
+func fillLivecommentReportsResponseWithoutTx(ctx context.Context, reportModels []LivecommentReportModel) ([]LivecommentReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
+	if len(reportModels) == 0 {
+		return []LivecommentReport{}, nil
+	}
+
+	livecommentIDs := make([]int64, 0, len(reportModels))
+	seenLivecommentIDs := make(map[int64]struct{}, len(reportModels))
+	for i := range reportModels {
+		if _, ok := seenLivecommentIDs[reportModels[i].LivecommentID]; ok {
+			continue
+		}
+		seenLivecommentIDs[reportModels[i].LivecommentID] = struct{}{}
+		livecommentIDs = append(livecommentIDs, reportModels[i].LivecommentID)
+	}
+	var livecommentModels []LivecommentModel
+	q, params, err := sqlx.In("SELECT * FROM livecomments WHERE id IN (?)", livecommentIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbConn.SelectContext(ctx, &livecommentModels, q, params...); err != nil {
+		return nil, err
+	}
+
+	// 報告者とライブコメントの投稿者は1回で取得する
+	userIDs := make([]int64, 0, len(reportModels)+len(livecommentModels))
+	seenUserIDs := make(map[int64]struct{}, len(reportModels)+len(livecommentModels))
+	addUserID := func(id int64) {
+		if _, ok := seenUserIDs[id]; ok {
+			return
+		}
+		seenUserIDs[id] = struct{}{}
+		userIDs = append(userIDs, id)
+	}
+	for i := range reportModels {
+		addUserID(reportModels[i].UserID)
+	}
+	for i := range livecommentModels {
+		addUserID(livecommentModels[i].UserID)
+	}
+	var userModels []UserModel
+	q, params, err = sqlx.In("SELECT * FROM users WHERE id IN (?)", userIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbConn.SelectContext(ctx, &userModels, q, params...); err != nil {
+		return nil, err
+	}
+	users, err := fillUsersResponseWithoutTx(ctx, userModels)
+	if err != nil {
+		return nil, err
+	}
+	userMap := make(map[int64]User, len(users))
+	for i := range users {
+		userMap[users[i].ID] = users[i]
+	}
+
+	livestreamIDs := make([]int64, 0, 1)
+	seenLivestreamIDs := make(map[int64]struct{}, 1)
+	for i := range livecommentModels {
+		if _, ok := seenLivestreamIDs[livecommentModels[i].LivestreamID]; ok {
+			continue
+		}
+		seenLivestreamIDs[livecommentModels[i].LivestreamID] = struct{}{}
+		livestreamIDs = append(livestreamIDs, livecommentModels[i].LivestreamID)
+	}
+	livestreamMap := make(map[int64]Livestream, len(livestreamIDs))
+	if len(livestreamIDs) > 0 {
+		var livestreamModels []LivestreamModel
+		q, params, err = sqlx.In("SELECT * FROM livestreams WHERE id IN (?)", livestreamIDs)
+		if err != nil {
+			return nil, err
+		}
+		if err := dbConn.SelectContext(ctx, &livestreamModels, q, params...); err != nil {
+			return nil, err
+		}
+		livestreams, err := fillLivestreamsResponseWithoutTx(ctx, livestreamModels)
+		if err != nil {
+			return nil, err
+		}
+		for i := range livestreams {
+			livestreamMap[livestreams[i].ID] = livestreams[i]
+		}
+	}
+
+	livecommentMap := make(map[int64]Livecomment, len(livecommentModels))
+	for _, m := range livecommentModels {
+		livecommentMap[m.ID] = Livecomment{
+			ID:           m.ID,
+			User:         userMap[m.UserID],
+			Livestream:   livestreamMap[m.LivestreamID],
+			Comment:      m.Comment,
+			Tip:          m.Tip,
+			TipFormatted: formatTip(m.Tip),
+			CreatedAt:    m.CreatedAt,
+		}
+	}
+
+	reports := make([]LivecommentReport, len(reportModels))
+	for i := range reportModels {
+		reporter, ok := userMap[reportModels[i].UserID]
+		if !ok {
+			return nil, fmt.Errorf("reporter not found for livecomment report id %d", reportModels[i].ID)
+		}
+		livecomment, ok := livecommentMap[reportModels[i].LivecommentID]
+		if !ok {
+			return nil, fmt.Errorf("livecomment not found for livecomment report id %d", reportModels[i].ID)
+		}
+		reports[i] = LivecommentReport{
+			ID:          reportModels[i].ID,
+			Reporter:    reporter,
+			Livecomment: livecomment,
+			CreatedAt:   reportModels[i].CreatedAt,
+		}
+	}
+	return reports, nil
+}
+
+// formatTip は、チップ額 (円) を "¥1,000" の形式に整形する
+// チップなし (0以下) の場合は空文字を返す
+func formatTip(tip int64) string {
+	if tip <= 0 {
+		return ""
+	}
+
+	digits := strconv.FormatInt(tip, 10)
+	var b strings.Builder
+	b.WriteString("¥")
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return b.String()
+}
@@ -0,0 +1,779 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const fakeFillUserCount = 10
+
+// newFakeFillDB は、レスポンスのfillに必要な最小限のカラムだけを返すfakeDBを作る
+// IDを指定したクエリには、引数のIDごとに1行を返す
+func newFakeFillDB() *fakeDB {
+	d := &fakeDB{}
+	perID := func(columns []string, row func(id int64) []driver.Value) func(string, []driver.Value) (driver.Rows, error) {
+		return func(_ string, args []driver.Value) (driver.Rows, error) {
+			rows := &fakeRows{columns: columns}
+			for _, arg := range args {
+				rows.values = append(rows.values, row(arg.(int64)))
+			}
+			return rows, nil
+		}
+	}
+	zero := func(string, []driver.Value) (driver.Rows, error) { return fakeValue("v", int64(0)), nil }
+	d.onQuery("SELECT COUNT(*)", zero)
+	d.onQuery("SELECT IFNULL(SUM(tip), 0)", zero)
+	d.onQuery("SELECT * FROM users WHERE id", perID([]string{"id", "name"}, func(id int64) []driver.Value {
+		return []driver.Value{id, fmt.Sprintf("user%d", id)}
+	}))
+	d.onQuery("SELECT * FROM themes WHERE user_id", perID([]string{"id", "user_id", "dark_mode"}, func(id int64) []driver.Value {
+		return []driver.Value{id, id, false}
+	}))
+	d.onQuery("SELECT * FROM livecomments WHERE id", perID([]string{"id", "user_id", "livestream_id", "comment"}, func(id int64) []driver.Value {
+		return []driver.Value{id, id%fakeFillUserCount + 1, int64(1), "comment"}
+	}))
+	d.onQuery("SELECT * FROM livestreams WHERE id", perID([]string{"id", "user_id", "title"}, func(id int64) []driver.Value {
+		return []driver.Value{id, int64(1), "title"}
+	}))
+	// それ以外 (タグ、公開設定など) は0行を返す
+	d.onQuery("", func(string, []driver.Value) (driver.Rows, error) { return &fakeRows{}, nil })
+	return d
+}
+
+func useFakeFillDB(tb testing.TB) *fakeDB {
+	d := newFakeFillDB()
+	useFakeDB(tb, d)
+	// テーマとアイコンのハッシュ、バッジ数はキャッシュ済みの状態で比べる
+	iconHashCache.CleanupAll()
+	themeCache.CleanupAll()
+	badgeCountCache.CleanupAll()
+	for id := int64(1); id <= fakeFillUserCount; id++ {
+		iconHashCache.Set(id, "hash", time.Hour)
+		themeCache.Set(id, ThemeModel{ID: id, UserID: id}, time.Hour)
+		badgeCountCache.Set(id, 0, time.Hour)
+	}
+	tb.Cleanup(func() {
+		iconHashCache.CleanupAll()
+		themeCache.CleanupAll()
+		badgeCountCache.CleanupAll()
+	})
+	return d
+}
+
+func newFakeReportModels(n int) []LivecommentReportModel {
+	reportModels := make([]LivecommentReportModel, n)
+	for i := range reportModels {
+		reportModels[i] = LivecommentReportModel{
+			ID:            int64(i + 1),
+			UserID:        int64(i%fakeFillUserCount + 1),
+			LivestreamID:  1,
+			LivecommentID: int64(i + 1),
+		}
+	}
+	return reportModels
+}
+
+func TestFillLivecommentReportsResponseWithoutTx(t *testing.T) {
+	d := useFakeFillDB(t)
+	ctx := context.Background()
+
+	var counts []int64
+	for _, n := range []int{1, 10, 100} {
+		before := int64(d.queryCount())
+		reports, err := fillLivecommentReportsResponseWithoutTx(ctx, newFakeReportModels(n))
+		if err != nil {
+			t.Fatalf("n=%d: unexpected error: %v", n, err)
+		}
+		counts = append(counts, int64(d.queryCount())-before)
+
+		if len(reports) != n {
+			t.Fatalf("n=%d: len(reports) = %d, want %d", n, len(reports), n)
+		}
+		for i, report := range reports {
+			if report.ID != int64(i+1) {
+				t.Errorf("n=%d: reports[%d].ID = %d, want %d", n, i, report.ID, i+1)
+			}
+			if want := int64(i%fakeFillUserCount + 1); report.Reporter.ID != want {
+				t.Errorf("n=%d: reports[%d].Reporter.ID = %d, want %d", n, i, report.Reporter.ID, want)
+			}
+			if report.Livecomment.ID != int64(i+1) || report.Livecomment.User.ID == 0 || report.Livecomment.Livestream.ID != 1 {
+				t.Errorf("n=%d: reports[%d].Livecomment is not filled: %+v", n, i, report.Livecomment)
+			}
+		}
+	}
+
+	// 報告件数によらずクエリ数は一定
+	for i := range counts {
+		if counts[i] != counts[0] {
+			t.Errorf("query count must not depend on the number of reports: %v", counts)
+			break
+		}
+	}
+}
+
+func TestFillLivecommentReportsResponseWithoutTx_QueriesEachTableOnce(t *testing.T) {
+	d := useFakeFillDB(t)
+
+	reports, err := fillLivecommentReportsResponseWithoutTx(context.Background(), newFakeReportModels(50))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reports) != 50 {
+		t.Fatalf("len(reports) = %d, want 50", len(reports))
+	}
+
+	// ライブコメントと配信はそれぞれIN句1回で取得する
+	for _, prefix := range []string{
+		"SELECT * FROM livecomments WHERE id IN (",
+		"SELECT * FROM livestreams WHERE id IN (",
+	} {
+		if n := d.queriesWithPrefix(prefix); n != 1 {
+			t.Errorf("%q was issued %d times, want 1", prefix, n)
+		}
+	}
+	// ユーザは報告者とライブコメントの投稿者をまとめて1回、配信者を1回取得する
+	if n := d.queriesWithPrefix("SELECT * FROM users WHERE id IN ("); n != 2 {
+		t.Errorf("users were fetched with IN %d times, want 2", n)
+	}
+	for _, prefix := range []string{
+		"SELECT * FROM users WHERE id = ",
+		"SELECT * FROM livecomments WHERE id = ",
+		"SELECT * FROM livestreams WHERE id = ",
+	} {
+		if n := d.queriesWithPrefix(prefix); n != 0 {
+			t.Errorf("%q was issued %d times, want 0", prefix, n)
+		}
+	}
+}
+
+func TestFillHelpers_DeadlineExceeded(t *testing.T) {
+	const queryLatency = 20 * time.Millisecond
+	livecommentModel := LivecommentModel{ID: 1, UserID: 2, LivestreamID: 1, Comment: "comment"}
+	livestreamModel := LivestreamModel{ID: 1, UserID: 1, Title: "title"}
+
+	tests := []struct {
+		name string
+		fill func(ctx context.Context, tx *sqlx.Tx) error
+	}{
+		{name: "fillLivecommentResponse", fill: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := fillLivecommentResponse(ctx, tx, livecommentModel)
+			return err
+		}},
+		{name: "fillLivecommentResponseWithoutTx", fill: func(ctx context.Context, _ *sqlx.Tx) error {
+			_, err := fillLivecommentResponseWithoutTx(ctx, livecommentModel)
+			return err
+		}},
+		{name: "fillLivecommentReportResponseWithoutTx", fill: func(ctx context.Context, _ *sqlx.Tx) error {
+			_, err := fillLivecommentReportResponseWithoutTx(ctx, LivecommentReportModel{ID: 1, UserID: 2, LivestreamID: 1, LivecommentID: 1})
+			return err
+		}},
+		{name: "fillLivestreamResponse", fill: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := fillLivestreamResponse(ctx, tx, livestreamModel)
+			return err
+		}},
+		{name: "fillLivestreamsResponseWithoutTx", fill: func(ctx context.Context, _ *sqlx.Tx) error {
+			_, err := fillLivestreamsResponseWithoutTx(ctx, []LivestreamModel{livestreamModel})
+			return err
+		}},
+		{name: "fillReactionResponse", fill: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := fillReactionResponse(ctx, tx, ReactionModel{ID: 1, UserID: 2, LivestreamID: 1, EmojiName: "chair"})
+			return err
+		}},
+		{name: "fillUserResponseWithoutTx", fill: func(ctx context.Context, _ *sqlx.Tx) error {
+			_, err := fillUserResponseWithoutTx(ctx, UserModel{ID: 2, Name: "user2"}, 1)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &fakeDB{}
+			// 1本目のクエリの間に期限が切れるよう、全クエリを遅くする
+			d.onQuery("", func(string, []driver.Value) (driver.Rows, error) {
+				time.Sleep(queryLatency)
+				return &fakeRows{}, nil
+			})
+			useFakeDB(t, d)
+			tx, err := dbConn.BeginTxx(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			// 呼び出し元の期限がFillResponseTimeoutより短ければ、そちらが優先される
+			ctx, cancel := context.WithTimeout(context.Background(), queryLatency/2)
+			defer cancel()
+			start := time.Now()
+			err = tt.fill(ctx, tx)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+			}
+			if elapsed := time.Since(start); elapsed >= FillResponseTimeout {
+				t.Errorf("fill took %s, want to give up before %s", elapsed, FillResponseTimeout)
+			}
+		})
+	}
+}
+
+func TestFillLivecommentReportsResponseWithoutTx_Empty(t *testing.T) {
+	d := useFakeFillDB(t)
+
+	reports, err := fillLivecommentReportsResponseWithoutTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reports == nil || len(reports) != 0 {
+		t.Errorf("reports = %#v, want empty slice", reports)
+	}
+	if q := int64(d.queryCount()); q != 0 {
+		t.Errorf("queries = %d, want 0", q)
+	}
+}
+
+func BenchmarkFillLivecommentReports(b *testing.B) {
+	const reportCount = 100
+	reportModels := newFakeReportModels(reportCount)
+	ctx := context.Background()
+
+	b.Run("PerReport", func(b *testing.B) {
+		d := useFakeFillDB(b)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, m := range reportModels {
+				if _, err := fillLivecommentReportResponseWithoutTx(ctx, m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		b.ReportMetric(float64(int64(d.queryCount()))/float64(b.N), "queries/op")
+	})
+	b.Run("Batch", func(b *testing.B) {
+		d := useFakeFillDB(b)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := fillLivecommentReportsResponseWithoutTx(ctx, reportModels); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(int64(d.queryCount()))/float64(b.N), "queries/op")
+	})
+}
+
+func TestFormatTip(t *testing.T) {
+	tests := []struct {
+		tip  int64
+		want string
+	}{
+		{tip: 0, want: ""},
+		{tip: 1, want: "¥1"},
+		{tip: 999, want: "¥999"},
+		{tip: 1000, want: "¥1,000"},
+		{tip: 1000000, want: "¥1,000,000"},
+		{tip: -1, want: ""},
+		{tip: -1000, want: ""},
+	}
+	for _, tt := range tests {
+		if got := formatTip(tt.tip); got != tt.want {
+			t.Errorf("formatTip(%d) = %q, want %q", tt.tip, got, tt.want)
+		}
+	}
+}
+
+// newFakeLivecommentPageDB は、ID 1〜countのライブコメントを持ち
+// "WHERE livestream_id = ? [AND id < ?] ORDER BY id DESC LIMIT ?" だけを解釈するfakeDBを作る
+func newFakeLivecommentPageDB(count int64) *fakeDB {
+	d := &fakeDB{}
+	d.onQuery("SELECT * FROM livecomments WHERE livestream_id = ?", func(query string, args []driver.Value) (driver.Rows, error) {
+		cursor := count + 1
+		if strings.Contains(query, "AND id < ?") {
+			cursor = args[1].(int64)
+		}
+		limit := args[len(args)-1].(int64)
+
+		rows := &fakeRows{columns: []string{"id", "user_id", "livestream_id", "comment"}}
+		for id := min(cursor-1, count); id >= 1 && int64(len(rows.values)) < limit; id-- {
+			rows.values = append(rows.values, []driver.Value{id, int64(1), args[0], "comment"})
+		}
+		return rows, nil
+	})
+	return d
+}
+
+func TestGetLivecommentModelsPage(t *testing.T) {
+	useFakeDB(t, newFakeLivecommentPageDB(45))
+	ctx := context.Background()
+
+	// cursorをたどると、重複も欠けもなく新しい順に全件を取得できる
+	var (
+		cursor int64
+		seen   []int64
+		pages  []int
+	)
+	for {
+		models, next, err := getLivecommentModelsPage(ctx, 1, cursor, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, len(models))
+		for _, m := range models {
+			seen = append(seen, m.ID)
+		}
+		if next == "" {
+			break
+		}
+		if want := fmt.Sprint(models[len(models)-1].ID); next != want {
+			t.Fatalf("next cursor = %q, want %q", next, want)
+		}
+		if _, err := fmt.Sscan(next, &cursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fmt.Sprint(pages) != "[20 20 5]" {
+		t.Errorf("page sizes = %v, want [20 20 5]", pages)
+	}
+	if len(seen) != 45 {
+		t.Fatalf("got %d livecomments, want 45", len(seen))
+	}
+	for i, id := range seen {
+		if want := int64(45 - i); id != want {
+			t.Fatalf("livecomments[%d].ID = %d, want %d", i, id, want)
+		}
+	}
+
+	// 件数がちょうどlimitの倍数でも、最後のページのcursorは空になる
+	models, next, err := getLivecommentModelsPage(ctx, 1, 21, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 20 || next != "" {
+		t.Errorf("last full page: len = %d, next = %q, want 20 and empty", len(models), next)
+	}
+
+	models, next, err = getLivecommentModelsPage(ctx, 1, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 0 || next != "" {
+		t.Errorf("past the end: len = %d, next = %q, want 0 and empty", len(models), next)
+	}
+}
+
+// fakeLivecommentDeleteDB は、配信の所有者とライブコメント・報告だけを持つfakeDB
+// トランザクションはコミットされたときだけ反映する
+type fakeLivecommentDeleteDB struct {
+	*fakeDB
+
+	ownerID int64
+	// ライブコメントID → 配信ID
+	livecomments map[int64]int64
+	// 報告ID → ライブコメントID
+	reports map[int64]int64
+	audits  []fakeStatement
+
+	// トランザクション内で削除したライブコメントID・報告を削除したライブコメントIDと、書き込んだ監査ログ
+	pendingDeletes       []int64
+	pendingReportDeletes []int64
+	pendingAudits        []fakeStatement
+}
+
+func useFakeLivecommentDeleteDB(tb testing.TB, d *fakeLivecommentDeleteDB) {
+	rollback := func() error {
+		d.pendingDeletes = nil
+		d.pendingReportDeletes = nil
+		d.pendingAudits = nil
+		return nil
+	}
+	d.fakeDB = &fakeDB{
+		onCommit: func() error {
+			for _, id := range d.pendingDeletes {
+				delete(d.livecomments, id)
+			}
+			for _, id := range d.pendingReportDeletes {
+				for reportID, livecommentID := range d.reports {
+					if livecommentID == id {
+						delete(d.reports, reportID)
+					}
+				}
+			}
+			d.audits = append(d.audits, d.pendingAudits...)
+			return rollback()
+		},
+		onRollback: rollback,
+	}
+	d.onQuery("SELECT * FROM livestreams WHERE id = ?", func(_ string, args []driver.Value) (driver.Rows, error) {
+		return &fakeRows{columns: []string{"id", "user_id"}, values: [][]driver.Value{{args[0], d.ownerID}}}, nil
+	})
+	d.onExec("DELETE FROM livecomments WHERE id = ? AND livestream_id = ?", func(_ string, args []driver.Value) (driver.Result, error) {
+		id := args[0].(int64)
+		if livestreamID, ok := d.livecomments[id]; !ok || livestreamID != args[1].(int64) {
+			return driver.RowsAffected(0), nil
+		}
+		d.pendingDeletes = append(d.pendingDeletes, id)
+		return driver.RowsAffected(1), nil
+	})
+	d.onExec("DELETE FROM livecomment_reports WHERE livecomment_id = ?", func(_ string, args []driver.Value) (driver.Result, error) {
+		d.pendingReportDeletes = append(d.pendingReportDeletes, args[0].(int64))
+		return driver.RowsAffected(1), nil
+	})
+	d.onExec("INSERT INTO audit_log", func(query string, args []driver.Value) (driver.Result, error) {
+		d.pendingAudits = append(d.pendingAudits, fakeStatement{query: query, args: args})
+		return driver.RowsAffected(1), nil
+	})
+	d.onExec("", fakeExecOK)
+	useFakeDB(tb, d.fakeDB)
+}
+
+func TestDeleteLivecommentHandler(t *testing.T) {
+	const (
+		ownerID     = int64(1)
+		commenterID = int64(2)
+	)
+	tests := []struct {
+		name       string
+		path       string
+		userID     int64
+		wantStatus int
+	}{
+		{name: "by commenter", path: "/api/livestream/10/livecomment/100", userID: commenterID, wantStatus: http.StatusForbidden},
+		{name: "livecomment in another livestream", path: "/api/livestream/10/livecomment/200", userID: ownerID, wantStatus: http.StatusNotFound},
+		{name: "nonexistent livecomment", path: "/api/livestream/10/livecomment/999", userID: ownerID, wantStatus: http.StatusNotFound},
+		{name: "by owner", path: "/api/livestream/10/livecomment/100", userID: ownerID, wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &fakeLivecommentDeleteDB{
+				ownerID:      ownerID,
+				livecomments: map[int64]int64{100: 10, 101: 10, 200: 20},
+				reports:      map[int64]int64{1: 100, 2: 100, 3: 101},
+			}
+			useFakeLivecommentDeleteDB(t, d)
+			useSessionVersion(t, tt.userID, 0)
+			userStatsCache.Set("owner", ownerID, UserStatistics{}, time.Hour)
+			t.Cleanup(userStatsCache.CleanupAll)
+
+			e := echo.New()
+			e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+			e.DELETE("/api/livestream/:livestream_id/livecomment/:livecomment_id", func(c echo.Context) error {
+				// ログイン済みのセッションとして扱う
+				sess, _ := session.Get(defaultSessionIDKey, c)
+				sess.Values[defaultUserIDKey] = tt.userID
+				sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+				return deleteLivecommentHandler(c)
+			})
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			if tt.wantStatus != http.StatusNoContent {
+				if len(d.livecomments) != 3 || len(d.reports) != 3 || len(d.audits) != 0 {
+					t.Errorf("rejected request changed data: livecomments = %v, reports = %v, audits = %d", d.livecomments, d.reports, len(d.audits))
+				}
+				return
+			}
+
+			// 対象のライブコメントとその報告だけが消える
+			if _, ok := d.livecomments[100]; ok {
+				t.Error("livecomment 100 is not deleted")
+			}
+			if len(d.livecomments) != 2 {
+				t.Errorf("livecomments = %v, want 101 and 200 to remain", d.livecomments)
+			}
+			if len(d.reports) != 1 || d.reports[3] != 101 {
+				t.Errorf("reports = %v, want only report 3 to remain", d.reports)
+			}
+
+			// 配信者のユーザ統計のチップ合計が変わるので捨てる
+			if _, ok := userStatsCache.Get("owner"); ok {
+				t.Error("user statistics of the owner must be invalidated")
+			}
+
+			if len(d.audits) != 1 {
+				t.Fatalf("audits = %d, want 1", len(d.audits))
+			}
+			// user_id, action, target_id, metadata, created_at の順
+			want := []driver.Value{ownerID, AuditActionDeleteLivecomment, int64(100), `{"livestream_id":10}`}
+			for i := range want {
+				if d.audits[0].args[i] != want[i] {
+					t.Errorf("audit args[%d] = %v, want %v", i, d.audits[0].args[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+// fakeNGWordDB は、配信の所有者とNGワードだけを持つfakeDB
+type fakeNGWordDB struct {
+	*fakeDB
+
+	ownerID int64
+	ngWords []NGWord
+
+	inserts int
+}
+
+func useFakeNGWordDB(tb testing.TB, d *fakeNGWordDB) {
+	d.fakeDB = &fakeDB{}
+	d.onQuery("SELECT user_id FROM livestreams WHERE id = ?", func(string, []driver.Value) (driver.Rows, error) {
+		return fakeValue("user_id", d.ownerID), nil
+	})
+	d.onQuery("SELECT * FROM livestreams WHERE id = ?", func(_ string, args []driver.Value) (driver.Rows, error) {
+		return &fakeRows{columns: []string{"id", "user_id"}, values: [][]driver.Value{{args[0], d.ownerID}}}, nil
+	})
+	d.onQuery("SELECT COUNT(*) FROM livestream_moderators", func(string, []driver.Value) (driver.Rows, error) {
+		return fakeValue("COUNT(*)", int64(0)), nil
+	})
+	d.onQuery("SELECT word FROM ng_words WHERE livestream_id = ? AND word IN (", func(_ string, args []driver.Value) (driver.Rows, error) {
+		rows := &fakeRows{columns: []string{"word"}}
+		for _, w := range d.ngWords {
+			for _, arg := range args[1:] {
+				if w.LivestreamID == args[0].(int64) && w.Word == arg.(string) {
+					rows.values = append(rows.values, []driver.Value{w.Word})
+				}
+			}
+		}
+		return rows, nil
+	})
+	d.onQuery("SELECT * FROM ng_words WHERE user_id = ? AND livestream_id = ?", func(_ string, args []driver.Value) (driver.Rows, error) {
+		rows := &fakeRows{columns: []string{"id", "user_id", "livestream_id", "word", "created_at"}}
+		for _, w := range d.ngWords {
+			if w.UserID == args[0].(int64) && w.LivestreamID == args[1].(int64) {
+				rows.values = append(rows.values, []driver.Value{w.ID, w.UserID, w.LivestreamID, w.Word, w.CreatedAt})
+			}
+		}
+		return rows, nil
+	})
+	d.onExec("INSERT INTO ng_words (user_id, livestream_id, word, created_at) VALUES", func(_ string, args []driver.Value) (driver.Result, error) {
+		d.inserts++
+		// 1行あたり4つの引数が並ぶ
+		for i := 0; i+3 < len(args); i += 4 {
+			d.ngWords = append(d.ngWords, NGWord{
+				ID:           int64(len(d.ngWords) + 1),
+				UserID:       args[i].(int64),
+				LivestreamID: args[i+1].(int64),
+				Word:         args[i+2].(string),
+				CreatedAt:    args[i+3].(int64),
+			})
+		}
+		return driver.RowsAffected(len(args) / 4), nil
+	})
+	d.onExec("DELETE FROM ng_words WHERE id = ? AND livestream_id = ?", func(_ string, args []driver.Value) (driver.Result, error) {
+		n := len(d.ngWords)
+		d.ngWords = slices.DeleteFunc(d.ngWords, func(w NGWord) bool {
+			return w.ID == args[0].(int64) && w.LivestreamID == args[1].(int64)
+		})
+		return driver.RowsAffected(n - len(d.ngWords)), nil
+	})
+	useFakeDB(tb, d.fakeDB)
+}
+
+func TestNGWordHandlers(t *testing.T) {
+	const (
+		ownerID = int64(1)
+		otherID = int64(2)
+	)
+	d := &fakeNGWordDB{
+		ownerID: ownerID,
+		ngWords: []NGWord{
+			{ID: 1, UserID: ownerID, LivestreamID: 10, Word: "spam", CreatedAt: 100},
+			{ID: 2, UserID: ownerID, LivestreamID: 10, Word: "scam", CreatedAt: 200},
+			{ID: 3, UserID: ownerID, LivestreamID: 20, Word: "other", CreatedAt: 300},
+		},
+	}
+	useFakeNGWordDB(t, d)
+	useSessionVersion(t, ownerID, 0)
+	useSessionVersion(t, otherID, 0)
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	var loginUserID int64
+	withLogin := func(h echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// ログイン済みのセッションとして扱う
+			sess, _ := session.Get(defaultSessionIDKey, c)
+			sess.Values[defaultUserIDKey] = loginUserID
+			sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+			return h(c)
+		}
+	}
+	e.GET("/api/livestream/:livestream_id/ngwords", withLogin(getNGWordsHandler))
+	e.DELETE("/api/livestream/:livestream_id/ngword/:ngword_id", withLogin(deleteNGWordHandler))
+	do := func(userID int64, method, path string) *httptest.ResponseRecorder {
+		loginUserID = userID
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+	// 並び順はクエリのORDER BYに任せるので、ワードの集合だけを比べる
+	list := func() []string {
+		t.Helper()
+		rec := do(ownerID, http.MethodGet, "/api/livestream/10/ngwords")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var ngWords []NGWord
+		if err := json.NewDecoder(rec.Body).Decode(&ngWords); err != nil {
+			t.Fatal(err)
+		}
+		words := make([]string, len(ngWords))
+		for i := range ngWords {
+			words[i] = ngWords[i].Word
+		}
+		slices.Sort(words)
+		return words
+	}
+
+	if got := list(); !slices.Equal(got, []string{"scam", "spam"}) {
+		t.Errorf("NG words = %v, want [scam spam]", got)
+	}
+
+	// 配信者以外は一覧も削除もできない
+	if rec := do(otherID, http.MethodGet, "/api/livestream/10/ngwords"); rec.Code != http.StatusForbidden {
+		t.Errorf("list by non-owner: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := do(otherID, http.MethodDelete, "/api/livestream/10/ngword/1"); rec.Code != http.StatusForbidden {
+		t.Errorf("delete by non-owner: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	// 存在しないNGワードや、別の配信のNGワードは404
+	if rec := do(ownerID, http.MethodDelete, "/api/livestream/10/ngword/999"); rec.Code != http.StatusNotFound {
+		t.Errorf("delete missing word: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(ownerID, http.MethodDelete, "/api/livestream/10/ngword/3"); rec.Code != http.StatusNotFound {
+		t.Errorf("delete word of another livestream: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if rec := do(ownerID, http.MethodDelete, "/api/livestream/10/ngword/1"); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body.String())
+	}
+	if got := list(); !slices.Equal(got, []string{"scam"}) {
+		t.Errorf("NG words after delete = %v, want [scam]", got)
+	}
+	if len(d.ngWords) != 2 {
+		t.Errorf("NG words in DB = %d, want 2", len(d.ngWords))
+	}
+}
+
+func TestBulkModerateHandler(t *testing.T) {
+	const (
+		ownerID = int64(1)
+		otherID = int64(2)
+	)
+	d := &fakeNGWordDB{
+		ownerID: ownerID,
+		ngWords: []NGWord{
+			{ID: 1, UserID: ownerID, LivestreamID: 10, Word: "spam"},
+			{ID: 2, UserID: ownerID, LivestreamID: 20, Word: "scam"},
+		},
+	}
+	useFakeNGWordDB(t, d)
+	useSessionVersion(t, ownerID, 0)
+	useSessionVersion(t, otherID, 0)
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	var loginUserID int64
+	e.POST("/api/livestream/:livestream_id/ngwords/bulk", func(c echo.Context) error {
+		// ログイン済みのセッションとして扱う
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultUserIDKey] = loginUserID
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+		return bulkModerateHandler(c)
+	})
+	post := func(userID int64, words []string) *httptest.ResponseRecorder {
+		loginUserID = userID
+		body, err := json.Marshal(BulkModerateRequest{Words: words})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/livestream/10/ngwords/bulk", strings.NewReader(string(body))))
+		return rec
+	}
+	wordsOf := func(livestreamID int64) []string {
+		var words []string
+		for _, w := range d.ngWords {
+			if w.LivestreamID == livestreamID {
+				words = append(words, w.Word)
+			}
+		}
+		slices.Sort(words)
+		return words
+	}
+
+	// リクエスト内の重複と登録済みのNGワードは読み飛ばし、1回のINSERTで登録する
+	// 別の配信に登録済みのNGワードは、この配信には登録されていないものとして扱う
+	rec := post(ownerID, []string{"foo", "spam", "bar", "foo", "scam"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	var resp BulkModerateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp != (BulkModerateResponse{InsertedCount: 3, SkippedCount: 2}) {
+		t.Errorf("response = %+v, want inserted 3 and skipped 2", resp)
+	}
+	if d.inserts != 1 {
+		t.Errorf("INSERT statements = %d, want 1", d.inserts)
+	}
+	if got := wordsOf(10); !slices.Equal(got, []string{"bar", "foo", "scam", "spam"}) {
+		t.Errorf("NG words = %v, want [bar foo scam spam]", got)
+	}
+
+	// 同じリストをもう一度登録しても増えない
+	rec = post(ownerID, []string{"foo", "bar"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("second import: status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	resp = BulkModerateResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp != (BulkModerateResponse{InsertedCount: 0, SkippedCount: 2}) {
+		t.Errorf("second import: response = %+v, want inserted 0 and skipped 2", resp)
+	}
+	if d.inserts != 1 {
+		t.Errorf("second import issued an INSERT")
+	}
+
+	// 件数の上限
+	words := make([]string, maxBulkModerateWords+1)
+	for i := range words {
+		words[i] = fmt.Sprintf("word%d", i)
+	}
+	if rec := post(ownerID, words); rec.Code != http.StatusBadRequest {
+		t.Errorf("%d words: status = %d, want %d", len(words), rec.Code, http.StatusBadRequest)
+	}
+	if rec := post(ownerID, words[:maxBulkModerateWords]); rec.Code != http.StatusCreated {
+		t.Errorf("%d words: status = %d, want %d: %s", maxBulkModerateWords, rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if rec := post(ownerID, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("no words: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// 配信者でもモデレーターでもなければ登録できない
+	before := len(d.ngWords)
+	if rec := post(otherID, []string{"baz"}); rec.Code != http.StatusForbidden {
+		t.Errorf("by non-owner: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if len(d.ngWords) != before {
+		t.Error("rejected import inserted NG words")
+	}
+}
@@ -2,19 +2,37 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/goccy/go-json"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 )
 
+// サムネイルも配信URLもない配信に使うサムネイルURL
+var defaultThumbnailURL = ""
+
+func init() {
+	if v, ok := os.LookupEnv("DEFAULT_THUMBNAIL_URL"); ok {
+		defaultThumbnailURL = v
+	}
+}
+
 type ReserveLivestreamRequest struct {
 	Tags         []int64 `json:"tags"`
 	Title        string  `json:"title"`
@@ -23,14 +41,39 @@ type ReserveLivestreamRequest struct {
 	ThumbnailUrl string  `json:"thumbnail_url"`
 	StartAt      int64   `json:"start_at"`
 	EndAt        int64   `json:"end_at"`
+	// MaxViewers は、同時視聴者数の上限 (0は無制限)
+	MaxViewers int64 `json:"max_viewers"`
+}
+
+const (
+	MaxTitleLength       = 255
+	MaxDescriptionLength = 2000
+	// playlist_url, thumbnail_urlのカラム長
+	MaxURLLength = 255
+)
+
+// 配信のメタデータ更新リクエスト
+// nilのフィールドは更新しない。タグ、配信期間、配信者は変更できない
+type PatchLivestreamMetadataRequest struct {
+	Title        *string `json:"title"`
+	Description  *string `json:"description"`
+	PlaylistUrl  *string `json:"playlist_url"`
+	ThumbnailUrl *string `json:"thumbnail_url"`
 }
 
 type LivestreamViewerModel struct {
 	UserID       int64 `db:"user_id" json:"user_id"`
 	LivestreamID int64 `db:"livestream_id" json:"livestream_id"`
 	CreatedAt    int64 `db:"created_at" json:"created_at"`
+	LastSeenAt   int64 `db:"last_seen_at" json:"last_seen_at"`
 }
 
+// この秒数以内に入室またはハートビートがあった視聴者を視聴中とみなす
+const activeViewerWindowSeconds = 30
+
+// 他のサーバでの入退室が、配信の視聴者数に反映されるまでの時間
+const viewersCountCacheTTL = 5 * time.Second
+
 type LivestreamModel struct {
 	ID           int64  `db:"id" json:"id"`
 	UserID       int64  `db:"user_id" json:"user_id"`
@@ -40,6 +83,10 @@ type LivestreamModel struct {
 	ThumbnailUrl string `db:"thumbnail_url" json:"thumbnail_url"`
 	StartAt      int64  `db:"start_at" json:"start_at"`
 	EndAt        int64  `db:"end_at" json:"end_at"`
+	// PinnedLivecommentID は、配信者がピン留めしたライブコメントのID
+	PinnedLivecommentID sql.NullInt64 `db:"pinned_livecomment_id" json:"pinned_livecomment_id"`
+	// MaxViewers は、同時視聴者数の上限 (0は無制限)
+	MaxViewers int64 `db:"max_viewers" json:"max_viewers"`
 }
 
 type Livestream struct {
@@ -52,6 +99,31 @@ type Livestream struct {
 	Tags         []Tag  `json:"tags"`
 	StartAt      int64  `json:"start_at"`
 	EndAt        int64  `json:"end_at"`
+	MaxViewers   int64  `json:"max_viewers"`
+	// Status は、レスポンス生成時点での配信状況 (scheduled, live, ended)
+	Status string `json:"status"`
+	// TotalTip は、配信に付いたチップの合計
+	// NOTE: 常にレスポンスに含める。配信1件の取得ではSUMの集計クエリが1本、
+	// 一覧取得 (fillLivestreamsResponseWithoutTx) では対象の配信をまとめてGROUP BYした1本が増えるが、
+	// livecommentsにはlivestream_idのインデックスがあるので、?fields=による出し分けより単純さを優先した
+	TotalTip int64 `json:"total_tip"`
+	// ViewersCount は、配信に入室中の視聴者数
+	// 退室した視聴者と、activeViewerWindowSeconds以内に入室・ハートビートのない視聴者は含まない
+	ViewersCount int64 `json:"viewers_count"`
+	// IsModerator は、リクエストしたユーザが共同モデレーターであるか (配信詳細取得時のみ)
+	IsModerator bool `json:"is_moderator"`
+	// PinnedLivecomment は、ピン留めされたライブコメント (配信単体の取得時のみ)
+	PinnedLivecomment *Livecomment `json:"pinned_livecomment,omitempty"`
+	// ActiveAnnouncement は、有効期限内で最新の配信者アナウンス (配信詳細取得時のみ)
+	ActiveAnnouncement *Announcement `json:"active_announcement,omitempty"`
+}
+
+type PutLivestreamPinRequest struct {
+	LivecommentID int64 `json:"livecomment_id"`
+}
+
+type PostLivestreamTagRequest struct {
+	TagID int64 `json:"tag_id"`
 }
 
 type LivestreamTagModel struct {
@@ -78,6 +150,88 @@ type ReservationSlotModel struct {
 	EndAt   int64 `db:"end_at" json:"end_at"`
 }
 
+// reservationSlotsETag は、予約枠の残数のハッシュ (ETag) を返す
+// 予約枠ごとに start_at, end_at, slot を開始時刻順に連結したもののSHA-256
+func reservationSlotsETag(slots ReservationSlotModels) string {
+	sorted := make(ReservationSlotModels, len(slots))
+	copy(sorted, slots)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].StartAt < sorted[j].StartAt })
+
+	h := sha256.New()
+	for _, slot := range sorted {
+		fmt.Fprintf(h, "%d%d%d", slot.StartAt, slot.EndAt, slot.Slot)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// getReservationSlotsInRange は、クエリパラメータのstart_atからend_atまでに収まる予約枠を開始時刻順に返す
+func getReservationSlotsInRange(c echo.Context) (ReservationSlotModels, error) {
+	ctx := c.Request().Context()
+
+	startAt, err := strconv.ParseInt(c.QueryParam("start_at"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "start_at query parameter must be integer")
+	}
+	endAt, err := strconv.ParseInt(c.QueryParam("end_at"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "end_at query parameter must be integer")
+	}
+	if startAt >= endAt {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "start_at must be before end_at")
+	}
+
+	slots := ReservationSlotModels{}
+	if err := dbConn.SelectContext(ctx, &slots, queryWithIndexHint("SELECT * FROM reservation_slots", "idx_start_at_end_at")+" WHERE start_at >= ? AND end_at <= ? ORDER BY start_at", startAt, endAt); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get reservation_slots: "+err.Error())
+	}
+	return slots, nil
+}
+
+// 予約枠空き状況取得API
+// GET /api/livestream/reservation/slots
+// レスポンスのETagを予約APIのIf-Matchに指定すると、その間に予約枠が消費されていた場合は412を返す
+func getReservationSlotsHandler(c echo.Context) error {
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	slots, err := getReservationSlotsInRange(c)
+	if err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	c.Response().Header().Set("ETag", strconv.Quote(reservationSlotsETag(slots)))
+	return c.JSON(http.StatusOK, slots)
+}
+
+// SlotResponse は、予約枠と予約可能かどうか
+type SlotResponse struct {
+	ReservationSlotModel
+	Available bool `json:"available"`
+}
+
+// 予約枠空き状況プレビューAPI (ログイン不要)
+// GET /api/slots
+// 予約期間外を指定した場合は空配列を返す
+func getSlotsHandler(c echo.Context) error {
+	slots, err := getReservationSlotsInRange(c)
+	if err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	resp := make([]SlotResponse, len(slots))
+	for i, slot := range slots {
+		resp[i] = SlotResponse{
+			ReservationSlotModel: slot,
+			Available:            slot.Slot > 0,
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
 func reserveLivestreamHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 	defer c.Request().Body.Close()
@@ -97,12 +251,6 @@ func reserveLivestreamHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
-	}
-	defer tx.Rollback()
-
 	// 2023/11/25 10:00からの１年間の期間内であるかチェック
 	var (
 		termStartAt    = time.Date(2023, 11, 25, 1, 0, 0, 0, time.UTC)
@@ -113,233 +261,956 @@ func reserveLivestreamHandler(c echo.Context) error {
 	if (reserveStartAt.Equal(termEndAt) || reserveStartAt.After(termEndAt)) || (reserveEndAt.Equal(termStartAt) || reserveEndAt.Before(termStartAt)) {
 		return echo.NewHTTPError(http.StatusBadRequest, "bad reservation time range")
 	}
+	if req.MaxViewers < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "max_viewers must not be negative")
+	}
+	ifMatch := c.Request().Header.Get("If-Match")
+
+	livestream, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (Livestream, error) {
+		// 予約枠をみて、予約が可能か調べる
+		// NOTE: 並列な予約のoverbooking防止にFOR UPDATEが必要
+		var slots ReservationSlotModels
+		if err := tx.SelectContext(ctx, &slots, queryWithIndexHint("SELECT * FROM reservation_slots", "idx_start_at_end_at")+" WHERE start_at >= ? AND end_at <= ? FOR UPDATE", req.StartAt, req.EndAt); err != nil {
+			loggerFromContext(ctx).Warn("予約枠一覧取得でエラー発生", "error", err)
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get reservation_slots: "+err.Error()).SetInternal(err)
+		}
+		// If-Matchが指定された場合は、空き状況を取得した時から予約枠の残数が変わっていない場合のみ予約する
+		if ifMatch != "" && !etagMatches(ifMatch, reservationSlotsETag(slots)) {
+			return Livestream{}, echo.NewHTTPError(http.StatusPreconditionFailed, "reservation slots have been modified")
+		}
+		for _, slot := range slots {
+			count := slots.GetSlotCount(slot)
+			loggerFromContext(ctx).Info("予約枠の残数", "start_at", slot.StartAt, "end_at", slot.EndAt, "slot", slot.Slot)
+			if count < 1 {
+				return Livestream{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("予約期間 %d ~ %dに対して、予約区間 %d ~ %dが予約できません", termStartAt.Unix(), termEndAt.Unix(), req.StartAt, req.EndAt))
+			}
+		}
+
+		var (
+			livestreamModel = &LivestreamModel{
+				UserID:       int64(userID),
+				Title:        req.Title,
+				Description:  req.Description,
+				PlaylistUrl:  req.PlaylistUrl,
+				ThumbnailUrl: req.ThumbnailUrl,
+				StartAt:      req.StartAt,
+				EndAt:        req.EndAt,
+				MaxViewers:   req.MaxViewers,
+			}
+		)
+
+		rs, err := tx.ExecContext(ctx, queryWithIndexHint("UPDATE reservation_slots", "idx_start_at_end_at")+" SET slot = slot - 1 WHERE start_at >= ? AND end_at <= ?", req.StartAt, req.EndAt)
+		if err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to update reservation_slot: "+err.Error()).SetInternal(err)
+		}
+		// 予約枠を1つも消費しないまま配信が作られないようにする
+		if rows, err := rs.RowsAffected(); err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get affected rows: "+err.Error())
+		} else if rows == 0 {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "no reservation slots found for the given time range")
+		}
+
+		rs, err = tx.NamedExecContext(ctx, "INSERT INTO livestreams (user_id, title, description, playlist_url, thumbnail_url, start_at, end_at, max_viewers) VALUES(:user_id, :title, :description, :playlist_url, :thumbnail_url, :start_at, :end_at, :max_viewers)", livestreamModel)
+		if err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream: "+err.Error()).SetInternal(err)
+		}
 
-	// 予約枠をみて、予約が可能か調べる
-	// NOTE: 並列な予約のoverbooking防止にFOR UPDATEが必要
-	var slots ReservationSlotModels
-	if err := tx.SelectContext(ctx, &slots, "SELECT * FROM reservation_slots WHERE start_at >= ? AND end_at <= ? FOR UPDATE", req.StartAt, req.EndAt); err != nil {
-		c.Logger().Warnf("予約枠一覧取得でエラー発生: %+v", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reservation_slots: "+err.Error())
+		livestreamID, err := rs.LastInsertId()
+		if err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted livestream id: "+err.Error())
+		}
+		livestreamModel.ID = livestreamID
+
+		// タグ追加
+		if err := insertLivestreamTags(ctx, tx, livestreamID, req.Tags); err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream tag: "+err.Error()).SetInternal(err)
+		}
+
+		livestream, err := fillLivestreamResponse(ctx, tx, *livestreamModel)
+		if err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error()).SetInternal(err)
+		}
+		return livestream, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+
+	// 古い配信者のDNSレコードはCleanupStaleDNSRecordsで削除されている可能性があるので再登録する
+	records.Store(sess.Values[defaultUsernameKey].(string)+".u.isucon.local.", powerDNSSubdomainAddress)
+
+	return c.JSON(http.StatusCreated, livestream)
+}
+
+// insertLivestreamTags は、配信のタグを1回のINSERTでまとめて追加する
+func insertLivestreamTags(ctx context.Context, tx *sqlx.Tx, livestreamID int64, tagIDs []int64) error {
+	// 空のVALUESは構文エラーになる
+	if len(tagIDs) == 0 {
+		return nil
 	}
-	for _, slot := range slots {
-		count := slots.GetSlotCount(slot)
-		c.Logger().Infof("%d ~ %d予約枠の残数 = %d\n", slot.StartAt, slot.EndAt, slot.Slot)
-		if count < 1 {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("予約期間 %d ~ %dに対して、予約区間 %d ~ %dが予約できません", termStartAt.Unix(), termEndAt.Unix(), req.StartAt, req.EndAt))
+	tagModels := make([]LivestreamTagModel, len(tagIDs))
+	for i, tagID := range tagIDs {
+		tagModels[i] = LivestreamTagModel{
+			LivestreamID: livestreamID,
+			TagID:        tagID,
 		}
 	}
+	_, err := tx.NamedExecContext(ctx, "INSERT INTO livestream_tags (livestream_id, tag_id) VALUES (:livestream_id, :tag_id)", tagModels)
+	return err
+}
 
-	var (
-		livestreamModel = &LivestreamModel{
-			UserID:       int64(userID),
-			Title:        req.Title,
-			Description:  req.Description,
-			PlaylistUrl:  req.PlaylistUrl,
-			ThumbnailUrl: req.ThumbnailUrl,
-			StartAt:      req.StartAt,
-			EndAt:        req.EndAt,
+func searchLivestreamsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	// tagは複数指定でき、tag_mode=andの場合は全てのタグを持つ配信、それ以外はいずれかのタグを持つ配信に絞り込む
+	var keyTagNames []string
+	for _, name := range c.QueryParams()["tag"] {
+		if name != "" {
+			keyTagNames = append(keyTagNames, name)
 		}
+	}
+	var matchAllTags bool
+	switch c.QueryParam("tag_mode") {
+	case "", "or":
+	case "and":
+		matchAllTags = true
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "tag_mode query parameter must be 'and' or 'or'")
+	}
+
+	// 配信者・配信開始時刻による絞り込み
+	var (
+		filterConds []string
+		filterArgs  []interface{}
+		startAfter  int64
+		startBefore int64
 	)
+	if v := c.QueryParam("user_ids"); v != "" {
+		userIDs, err := parseSearchUserIDs(v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		filterConds = append(filterConds, "user_id IN (?)")
+		filterArgs = append(filterArgs, userIDs)
+	}
+	if v := c.QueryParam("start_after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "start_after query parameter must be integer")
+		}
+		startAfter = n
+		filterConds = append(filterConds, "start_at > ?")
+		filterArgs = append(filterArgs, startAfter)
+	}
+	if v := c.QueryParam("start_before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "start_before query parameter must be integer")
+		}
+		startBefore = n
+		filterConds = append(filterConds, "start_at < ?")
+		filterArgs = append(filterArgs, startBefore)
+	}
+	if c.QueryParam("start_after") != "" && c.QueryParam("start_before") != "" && startAfter >= startBefore {
+		return echo.NewHTTPError(http.StatusBadRequest, "start_after must be less than start_before")
+	}
+	if v := c.QueryParam("status"); v != "" {
+		cond, args, err := livestreamStatusCond(v, time.Now().Unix())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		filterConds = append(filterConds, cond)
+		filterArgs = append(filterArgs, args...)
+	}
+
+	// タイトル・説明文による検索 (指定時は関連度順に並べる)
+	// keywordはqの別名
+	keyword := c.QueryParam("q")
+	if keyword == "" {
+		keyword = c.QueryParam("keyword")
+	}
+
+	var keyTaggedLivestreamIDs []int64
+	if len(keyTagNames) > 0 {
+		// タグによる取得
+		livestreamIDs, err := getTaggedLivestreamIDs(ctx, keyTagNames, matchAllTags)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get keyTaggedLivestreams: "+err.Error())
+		}
+		if len(livestreamIDs) == 0 {
+			return c.JSON(http.StatusOK, []Livestream{})
+		}
+		keyTaggedLivestreamIDs = livestreamIDs
+	}
+
+	// 件数の制限はタグ指定がない場合のみ
+	var limitClause string
+	if keyTaggedLivestreamIDs == nil && c.QueryParam("limit") != "" {
+		limit, err := strconv.Atoi(c.QueryParam("limit"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be integer")
+		}
+		limitClause = fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	search := func(fullText bool) ([]LivestreamModel, error) {
+		conds := append([]string{}, filterConds...)
+		args := append([]interface{}{}, filterArgs...)
+		orderBy := "id DESC"
+		var orderArgs []interface{}
+		if keyword != "" {
+			textSearch := newLivestreamTextSearch(keyword, fullText)
+			conds = append(conds, textSearch.cond)
+			args = append(args, textSearch.condArgs...)
+			orderBy = textSearch.orderBy
+			orderArgs = textSearch.orderArgs
+		}
+
+		query := "SELECT * FROM livestreams"
+		if keyTaggedLivestreamIDs != nil {
+			query = queryWithIndexHint(query, "PRIMARY")
+			conds = append([]string{"id IN (?)"}, conds...)
+			args = append([]interface{}{keyTaggedLivestreamIDs}, args...)
+		}
+		if len(conds) > 0 {
+			query += " WHERE " + strings.Join(conds, " AND ")
+		}
+		query += " ORDER BY " + orderBy + limitClause
+
+		query, params, err := sqlx.In(query, append(args, orderArgs...)...)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to construct IN query: "+err.Error())
+		}
+		var livestreamModels []LivestreamModel
+		if err := dbConn.SelectContext(ctx, &livestreamModels, query, params...); err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error()).SetInternal(err)
+		}
+		return livestreamModels, nil
+	}
+
+	fullText := livestreamFullTextSearchAvailable.Load()
+	livestreamModels, err := search(fullText)
+	if err != nil && fullText && keyword != "" && isFullTextIndexMissingError(err) {
+		// 起動後にインデックスが削除された場合は、以降LIKEによる検索に切り替える
+		livestreamFullTextSearchAvailable.Store(false)
+		livestreamModels, err = search(false)
+	}
+	if err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreams, err := fillLivestreamsResponseWithoutTx(ctx, livestreamModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestreams: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, livestreams)
+}
+
+// mysqlErrFTMatchingKeyNotFound は、MATCHの対象列にFULLTEXTインデックスがない場合のエラー番号 (ER_FT_MATCHING_KEY_NOT_FOUND)
+const mysqlErrFTMatchingKeyNotFound = 1191
+
+func isFullTextIndexMissingError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrFTMatchingKeyNotFound
+}
+
+const (
+	LivestreamStatusScheduled = "scheduled"
+	LivestreamStatusLive      = "live"
+	LivestreamStatusEnded     = "ended"
+)
+
+// livestreamStatus は、時刻nowでの配信状況を返す
+// 配信中は start_at <= now < end_at (ユーザ統計の配信中の配信数と同じ)
+func livestreamStatus(startAt, endAt, now int64) string {
+	switch {
+	case now < startAt:
+		return LivestreamStatusScheduled
+	case now < endAt:
+		return LivestreamStatusLive
+	default:
+		return LivestreamStatusEnded
+	}
+}
+
+// livestreamStatusCond は、配信状況statusで絞り込む条件と引数を返す
+func livestreamStatusCond(status string, now int64) (string, []interface{}, error) {
+	switch status {
+	case LivestreamStatusScheduled:
+		return "start_at > ?", []interface{}{now}, nil
+	case LivestreamStatusLive:
+		return "start_at <= ? AND end_at > ?", []interface{}{now, now}, nil
+	case LivestreamStatusEnded:
+		return "end_at <= ?", []interface{}{now}, nil
+	}
+	return "", nil, fmt.Errorf("status query parameter must be one of %s, %s, %s", LivestreamStatusScheduled, LivestreamStatusLive, LivestreamStatusEnded)
+}
+
+// getTaggedLivestreamIDs は、tagNamesのタグが付いた配信のIDを新しい順に返す
+// matchAllがtrueの場合は全てのタグを持つ配信、falseの場合はいずれかのタグを持つ配信を返す
+func getTaggedLivestreamIDs(ctx context.Context, tagNames []string, matchAll bool) ([]int64, error) {
+	query, params, err := sqlx.In("SELECT id FROM tags WHERE name IN (?)", tagNames)
+	if err != nil {
+		return nil, err
+	}
+	var tagIDList []int64
+	if err := dbConn.SelectContext(ctx, &tagIDList, query, params...); err != nil {
+		return nil, err
+	}
+	if len(tagIDList) == 0 {
+		return nil, nil
+	}
+
+	var livestreamIDs []int64
+	if matchAll {
+		// 存在しないタグが含まれる場合、全てのタグを持つ配信はない
+		distinctNames := make(map[string]struct{}, len(tagNames))
+		for _, name := range tagNames {
+			distinctNames[name] = struct{}{}
+		}
+		if len(tagIDList) < len(distinctNames) {
+			return nil, nil
+		}
+		query, params, err = sqlx.In("SELECT livestream_id FROM livestream_tags WHERE tag_id IN (?) GROUP BY livestream_id HAVING COUNT(DISTINCT tag_id) = ? ORDER BY livestream_id DESC", tagIDList, len(tagIDList))
+	} else {
+		query, params, err = sqlx.In("SELECT DISTINCT livestream_id FROM livestream_tags WHERE tag_id IN (?) ORDER BY livestream_id DESC", tagIDList)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := dbConn.SelectContext(ctx, &livestreamIDs, query, params...); err != nil {
+		return nil, err
+	}
+	return livestreamIDs, nil
+}
+
+// 配信検索で一度に指定できる配信者数の上限
+const maxSearchUserIDs = 100
+
+// parseSearchUserIDs は、カンマ区切りのユーザIDを解釈する
+func parseSearchUserIDs(v string) ([]int64, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) > maxSearchUserIDs {
+		return nil, fmt.Errorf("user_ids query parameter must contain at most %d ids", maxSearchUserIDs)
+	}
+	userIDs := make([]int64, len(parts))
+	for i, part := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || id <= 0 {
+			return nil, errors.New("user_ids query parameter must be comma-separated positive integers")
+		}
+		userIDs[i] = id
+	}
+	return userIDs, nil
+}
+
+// livestreamFullTextSearchAvailable は、配信の全文検索用インデックスが存在するか
+// 起動時と初期化時にスキーマを確認して更新する
+// init.sql以前のスキーマで作成したDBでは、以下でインデックスを追加すると全文検索が使われる
+//
+//	ALTER TABLE livestreams ADD FULLTEXT INDEX ft_livestreams_search (title, description) WITH PARSER ngram;
+var livestreamFullTextSearchAvailable atomic.Bool
+
+// detectLivestreamFullTextIndex は、livestreamsにFULLTEXTインデックスが存在するかをinformation_schemaから調べる
+func detectLivestreamFullTextIndex(ctx context.Context, db *sqlx.DB) (bool, error) {
+	var count int
+	if err := db.GetContext(ctx, &count, "SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'livestreams' AND INDEX_NAME = 'ft_livestreams_search' AND INDEX_TYPE = 'FULLTEXT'"); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// livestreamTextSearch は、配信のタイトル・説明文による検索条件と並び順
+type livestreamTextSearch struct {
+	cond      string
+	condArgs  []interface{}
+	orderBy   string
+	orderArgs []interface{}
+}
+
+// newLivestreamTextSearch は、全文検索が使える場合はMATCH ... AGAINSTで関連度順に、
+// 使えない場合はLIKEによる部分一致で新しい順に検索する
+// 検索語に演算子が含まれていても構文エラーにならないよう、全文検索にはbooleanModeQueryで組み立てたクエリを渡す
+func newLivestreamTextSearch(q string, fullText bool) livestreamTextSearch {
+	if against := booleanModeQuery(q); fullText && against != "" {
+		return livestreamTextSearch{
+			cond:      "MATCH(title, description) AGAINST(? IN BOOLEAN MODE)",
+			condArgs:  []interface{}{against},
+			orderBy:   "MATCH(title, description) AGAINST(? IN BOOLEAN MODE) DESC, id DESC",
+			orderArgs: []interface{}{against},
+		}
+	}
+	return livestreamTextSearch{
+		cond:     "(title LIKE CONCAT('%', ?, '%') OR description LIKE CONCAT('%', ?, '%'))",
+		condArgs: []interface{}{q, q},
+		orderBy:  "id DESC",
+	}
+}
+
+// booleanModeOperators は、IN BOOLEAN MODEで演算子として解釈される文字
+const booleanModeOperators = `+-<>()~*"@`
+
+// booleanModeQuery は、検索語を空白で区切り、演算子を取り除いた各語をフレーズとして引用符で囲む
+// 語が残らない場合は空文字を返すので、呼び出し側でLIKEにフォールバックする
+func booleanModeQuery(q string) string {
+	var terms []string
+	for _, word := range strings.Fields(q) {
+		word = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(booleanModeOperators, r) {
+				return -1
+			}
+			return r
+		}, word)
+		if word != "" {
+			terms = append(terms, `"`+word+`"`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+func getMyLivestreamsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var livestreamModels []LivestreamModel
+	if err := dbConn.SelectContext(ctx, &livestreamModels, "SELECT * FROM livestreams WHERE user_id = ?", userID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
+	}
+	livestreams, err := fillLivestreamsResponseWithoutTx(ctx, livestreamModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestreams: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, livestreams)
+}
+
+func getUserLivestreamsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	if err := verifyUserSession(c); err != nil {
+		return err
+	}
+
+	username := c.Param("username")
+
+	var user UserModel
+	if err := dbConn.GetContext(ctx, &user, "SELECT * FROM users WHERE name = ?", username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		} else {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
+		}
+	}
+
+	var livestreamModels []LivestreamModel
+	if err := dbConn.SelectContext(ctx, &livestreamModels, "SELECT * FROM livestreams WHERE user_id = ?", user.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
+	}
+	livestreams, err := fillLivestreamsResponseWithoutTx(ctx, livestreamModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestreams: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, livestreams)
+}
+
+// viewerテーブルの廃止
+func enterLivestreamHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id must be integer")
+	}
+
+	now := time.Now().Unix()
+	viewer := LivestreamViewerModel{
+		UserID:       int64(userID),
+		LivestreamID: int64(livestreamID),
+		CreatedAt:    now,
+		LastSeenAt:   now,
+	}
+
+	ownerID, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (int64, error) {
+		var livestream struct {
+			UserID     int64 `db:"user_id"`
+			MaxViewers int64 `db:"max_viewers"`
+		}
+		if err := tx.GetContext(ctx, &livestream, "SELECT user_id, max_viewers FROM livestreams WHERE id = ?", livestreamID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+			}
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error()).SetInternal(err)
+		}
+
+		if livestream.MaxViewers == 0 {
+			// 再入室の場合は最終視聴時刻のみ更新する
+			if _, err := tx.NamedExecContext(ctx, "INSERT INTO livestream_viewers_history (user_id, livestream_id, created_at, last_seen_at) VALUES(:user_id, :livestream_id, :created_at, :last_seen_at) ON DUPLICATE KEY UPDATE last_seen_at = VALUES(last_seen_at)", viewer); err != nil {
+				return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream_view_history: "+err.Error()).SetInternal(err)
+			}
+			return livestream.UserID, nil
+		}
+
+		// NOTE: 配信の行をロックせず、視聴者数の確認と入室を1つの文で行う
+		// 並列な入室はlivestream_viewers_historyの共有ロックでデッドロックになり、WithTransactionの再実行で数え直すので上限を超えない
+		// 再入室は視聴者数を増やさないので、自分以外の視聴者を数える
+		rs, err := tx.ExecContext(ctx, `INSERT INTO livestream_viewers_history (user_id, livestream_id, created_at, last_seen_at)
+	SELECT ?, ?, ?, ? FROM DUAL
+	WHERE (SELECT COUNT(*) FROM livestream_viewers_history WHERE livestream_id = ? AND user_id != ?) < ?
+	ON DUPLICATE KEY UPDATE last_seen_at = VALUES(last_seen_at)`,
+			viewer.UserID, viewer.LivestreamID, viewer.CreatedAt, viewer.LastSeenAt, viewer.LivestreamID, viewer.UserID, livestream.MaxViewers)
+		if err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream_view_history: "+err.Error()).SetInternal(err)
+		}
+		affected, err := rs.RowsAffected()
+		if err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get affected rows: "+err.Error()).SetInternal(err)
+		}
+		// 再入室で最終視聴時刻が変わらなかった場合も0になるので、入室済みかどうかで区別する
+		if affected == 0 {
+			var entered int64
+			if err := tx.GetContext(ctx, &entered, "SELECT COUNT(*) FROM livestream_viewers_history WHERE livestream_id = ? AND user_id = ?", livestreamID, userID); err != nil {
+				return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to count livestream viewers: "+err.Error()).SetInternal(err)
+			}
+			if entered == 0 {
+				return 0, echo.NewHTTPError(http.StatusTooManyRequests, "livestream is at capacity")
+			}
+		}
+		return livestream.UserID, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+	invalidateLivestreamActivityCaches(int64(livestreamID), ownerID)
+	viewersCountCache.Delete(int64(livestreamID))
+
+	return c.NoContent(http.StatusOK)
+}
+
+func exitLivestreamHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	ownerID, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (int64, error) {
+		var ownerID int64
+		if err := tx.GetContext(ctx, &ownerID, "SELECT user_id FROM livestreams WHERE id = ?", livestreamID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+			}
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error()).SetInternal(err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM livestream_viewers_history WHERE user_id = ? AND livestream_id = ?", userID, livestreamID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livestream_view_history: "+err.Error()).SetInternal(err)
+		}
+		return ownerID, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+	invalidateLivestreamActivityCaches(int64(livestreamID), ownerID)
+	viewersCountCache.Delete(int64(livestreamID))
 
-	if _, err := tx.ExecContext(ctx, "UPDATE reservation_slots SET slot = slot - 1 WHERE start_at >= ? AND end_at <= ?", req.StartAt, req.EndAt); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update reservation_slot: "+err.Error())
+	return c.NoContent(http.StatusOK)
+}
+
+// 配信メタデータ更新API (配信者のみ)
+// PATCH /api/livestream/:livestream_id
+func patchLivestreamHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	rs, err := tx.NamedExecContext(ctx, "INSERT INTO livestreams (user_id, title, description, playlist_url, thumbnail_url, start_at, end_at) VALUES(:user_id, :title, :description, :playlist_url, :thumbnail_url, :start_at, :end_at)", livestreamModel)
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PatchLivestreamMetadataRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if req.Title != nil && utf8.RuneCountInString(*req.Title) > MaxTitleLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("title must be at most %d characters", MaxTitleLength))
+	}
+	if req.Description != nil && utf8.RuneCountInString(*req.Description) > MaxDescriptionLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("description must be at most %d characters", MaxDescriptionLength))
+	}
+	if req.PlaylistUrl != nil && utf8.RuneCountInString(*req.PlaylistUrl) > MaxURLLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("playlist_url must be at most %d characters", MaxURLLength))
+	}
+	if req.ThumbnailUrl != nil && utf8.RuneCountInString(*req.ThumbnailUrl) > MaxURLLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("thumbnail_url must be at most %d characters", MaxURLLength))
+	}
+
+	livestream, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (Livestream, error) {
+		livestreamModel, err := lockOwnLivestream(ctx, tx, int64(livestreamID), userID)
+		if err != nil {
+			return Livestream{}, err
+		}
+
+		if req.Title != nil {
+			livestreamModel.Title = *req.Title
+		}
+		if req.Description != nil {
+			livestreamModel.Description = *req.Description
+		}
+		if req.PlaylistUrl != nil {
+			livestreamModel.PlaylistUrl = *req.PlaylistUrl
+		}
+		if req.ThumbnailUrl != nil {
+			livestreamModel.ThumbnailUrl = *req.ThumbnailUrl
+		}
+
+		if _, err := tx.NamedExecContext(ctx, "UPDATE livestreams SET title = :title, description = :description, playlist_url = :playlist_url, thumbnail_url = :thumbnail_url WHERE id = :id", livestreamModel); err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to update livestream: "+err.Error()).SetInternal(err)
+		}
+
+		livestream, err := fillLivestreamResponse(ctx, tx, livestreamModel)
+		if err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error()).SetInternal(err)
+		}
+		return livestream, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, livestream)
+}
+
+// livestreamOwnedTables は、livestream_idで配信に紐づき、配信の取り消し時に合わせて消すテーブル
+var livestreamOwnedTables = []string{
+	"livestream_tags",
+	"livestream_moderators",
+	"co_stream_requests",
+	"tip_webhooks",
+	"livestream_announcements",
+	"livecomment_drafts",
+	"stream_clips",
+	"ng_words",
+}
+
+// ライブ配信予約取消API (配信者のみ)
+// DELETE /api/livestream/:livestream_id
+// 配信開始前の予約のみ取り消せる。消費していた予約枠は同じトランザクションで戻す
+func deleteLivestreamHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	_, err = WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (struct{}, error) {
+		livestreamModel, err := lockOwnLivestream(ctx, tx, int64(livestreamID), userID)
+		if err != nil {
+			return struct{}{}, err
+		}
+		if time.Now().Unix() >= livestreamModel.StartAt {
+			return struct{}{}, echo.NewHTTPError(http.StatusBadRequest, "cannot cancel a livestream that has already started")
+		}
+
+		// 配信開始前でも付与できる設定やリクエストは、配信と一緒に消す
+		for _, table := range livestreamOwnedTables {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE livestream_id = ?", livestreamModel.ID); err != nil {
+				return struct{}{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete "+table+": "+err.Error()).SetInternal(err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM livestreams WHERE id = ?", livestreamModel.ID); err != nil {
+			return struct{}{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livestream: "+err.Error()).SetInternal(err)
+		}
+		if _, err := tx.ExecContext(ctx, queryWithIndexHint("UPDATE reservation_slots", "idx_start_at_end_at")+" SET slot = slot + 1 WHERE start_at >= ? AND end_at <= ?", livestreamModel.StartAt, livestreamModel.EndAt); err != nil {
+			return struct{}{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to restore reservation_slot: "+err.Error()).SetInternal(err)
+		}
+		return struct{}{}, nil
+	})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream: "+err.Error())
+		return txHTTPError(err)
 	}
+	invalidateLivestreamActivityCaches(int64(livestreamID), userID)
+	// 消した配信のタグは人気タグの配信数に含まれている
+	popularTagsCache.CleanupAll()
 
-	livestreamID, err := rs.LastInsertId()
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted livestream id: "+err.Error())
-	}
-	livestreamModel.ID = livestreamID
+	return c.NoContent(http.StatusNoContent)
+}
 
-	// タグ追加
-	for _, tagID := range req.Tags {
-		if _, err := tx.NamedExecContext(ctx, "INSERT INTO livestream_tags (livestream_id, tag_id) VALUES (:livestream_id, :tag_id)", &LivestreamTagModel{
-			LivestreamID: livestreamID,
-			TagID:        tagID,
-		}); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream tag: "+err.Error())
-		}
-	}
+// ライブコメントピン留めAPI
+// PUT /api/livestream/:livestream_id/pin
+func putLivestreamPinHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
 
-	livestream, err := fillLivestreamResponse(ctx, tx, *livestreamModel)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	return c.JSON(http.StatusCreated, livestream)
-}
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
 
-func searchLivestreamsHandler(c echo.Context) error {
-	ctx := c.Request().Context()
-	keyTagName := c.QueryParam("tag")
+	var req *PutLivestreamPinRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
 
-	var livestreamModels []LivestreamModel
-	if c.QueryParam("tag") != "" {
-		// タグによる取得
-		var tagIDList []int
-		if err := dbConn.SelectContext(ctx, &tagIDList, "SELECT id FROM tags WHERE name = ?", keyTagName); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get tags: "+err.Error())
+	livestream, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (Livestream, error) {
+		livestreamModel, err := lockOwnLivestream(ctx, tx, int64(livestreamID), userID)
+		if err != nil {
+			return Livestream{}, err
 		}
 
-		if len(tagIDList) > 0 {
-			var keyTaggedLivestreams []LivestreamTagModel
-			query, params, err := sqlx.In("SELECT * FROM livestream_tags WHERE tag_id IN (?) ORDER BY livestream_id DESC", tagIDList)
-			if err != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError, "failed to construct IN query: "+err.Error())
-			}
-			if err := dbConn.SelectContext(ctx, &keyTaggedLivestreams, query, params...); err != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError, "failed to get keyTaggedLivestreams: "+err.Error())
-			}
-
-			if len(keyTaggedLivestreams) > 0 {
-				livestreamIDs := make([]int64, len(keyTaggedLivestreams))
-				for i := range keyTaggedLivestreams {
-					livestreamIDs[i] = keyTaggedLivestreams[i].LivestreamID
-				}
-				query, params, err := sqlx.In("SELECT * FROM livestreams WHERE id IN (?) ORDER BY id DESC", livestreamIDs)
-				if err != nil {
-					return echo.NewHTTPError(http.StatusInternalServerError, "failed to construct IN query: "+err.Error())
-				}
-				if err := dbConn.SelectContext(ctx, &livestreamModels, query, params...); err != nil {
-					return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
-				}
-			}
+		// 他の配信のライブコメントはピン留めできない
+		var count int64
+		if err := tx.GetContext(ctx, &count, "SELECT COUNT(*) FROM livecomments WHERE id = ? AND livestream_id = ?", req.LivecommentID, livestreamID); err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomment: "+err.Error()).SetInternal(err)
 		}
-	} else {
-		// 検索条件なし
-		query := `SELECT * FROM livestreams ORDER BY id DESC`
-		if c.QueryParam("limit") != "" {
-			limit, err := strconv.Atoi(c.QueryParam("limit"))
-			if err != nil {
-				return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be integer")
-			}
-			query += fmt.Sprintf(" LIMIT %d", limit)
+		if count == 0 {
+			return Livestream{}, echo.NewHTTPError(http.StatusNotFound, "livecomment not found in the livestream")
 		}
 
-		if err := dbConn.SelectContext(ctx, &livestreamModels, query); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
+		if _, err := tx.ExecContext(ctx, "UPDATE livestreams SET pinned_livecomment_id = ? WHERE id = ?", req.LivecommentID, livestreamID); err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to pin livecomment: "+err.Error()).SetInternal(err)
 		}
-	}
+		livestreamModel.PinnedLivecommentID = sql.NullInt64{Int64: req.LivecommentID, Valid: true}
 
-	livestreams, err := fillLivestreamsResponseWithoutTx(ctx, livestreamModels)
+		livestream, err := fillLivestreamResponse(ctx, tx, livestreamModel)
+		if err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error()).SetInternal(err)
+		}
+		return livestream, nil
+	})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestreams: "+err.Error())
+		return txHTTPError(err)
 	}
 
-	return c.JSON(http.StatusOK, livestreams)
+	return c.JSON(http.StatusOK, livestream)
 }
 
-func getMyLivestreamsHandler(c echo.Context) error {
+// ライブコメントピン留め解除API
+// DELETE /api/livestream/:livestream_id/pin
+func deleteLivestreamPinHandler(c echo.Context) error {
 	ctx := c.Request().Context()
+
 	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
 		return err
 	}
 
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
 	// error already checked
 	sess, _ := session.Get(defaultSessionIDKey, c)
 	// existence already checked
 	userID := sess.Values[defaultUserIDKey].(int64)
 
-	var livestreamModels []*LivestreamModel
-	if err := dbConn.SelectContext(ctx, &livestreamModels, "SELECT * FROM livestreams WHERE user_id = ?", userID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
-	}
-	livestreams := make([]Livestream, len(livestreamModels))
-	for i := range livestreamModels {
-		livestream, err := fillLivestreamResponseWithoutTx(ctx, *livestreamModels[i])
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
+	if _, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (struct{}, error) {
+		if _, err := lockOwnLivestream(ctx, tx, int64(livestreamID), userID); err != nil {
+			return struct{}{}, err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE livestreams SET pinned_livecomment_id = NULL WHERE id = ?", livestreamID); err != nil {
+			return struct{}{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to unpin livecomment: "+err.Error()).SetInternal(err)
 		}
-		livestreams[i] = livestream
+		return struct{}{}, nil
+	}); err != nil {
+		return txHTTPError(err)
 	}
 
-	return c.JSON(http.StatusOK, livestreams)
+	return c.NoContent(http.StatusNoContent)
 }
 
-func getUserLivestreamsHandler(c echo.Context) error {
+// 配信タグ追加API
+// POST /api/livestream/:livestream_id/tags
+func addLivestreamTagHandler(c echo.Context) error {
 	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
 	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
 		return err
 	}
 
-	username := c.Param("username")
-
-	var user UserModel
-	if err := dbConn.GetContext(ctx, &user, "SELECT * FROM users WHERE name = ?", username); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return echo.NewHTTPError(http.StatusNotFound, "user not found")
-		} else {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
-		}
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	var livestreamModels []*LivestreamModel
-	if err := dbConn.SelectContext(ctx, &livestreamModels, "SELECT * FROM livestreams WHERE user_id = ?", user.ID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PostLivestreamTagRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
 	}
-	livestreams := make([]Livestream, len(livestreamModels))
-	for i := range livestreamModels {
-		livestream, err := fillLivestreamResponseWithoutTx(ctx, *livestreamModels[i])
+
+	livestream, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (Livestream, error) {
+		livestreamModel, err := lockOwnLivestream(ctx, tx, int64(livestreamID), userID)
+		if err != nil {
+			return Livestream{}, err
+		}
+
+		var tagCount int64
+		if err := tx.GetContext(ctx, &tagCount, "SELECT COUNT(*) FROM tags WHERE id = ?", req.TagID); err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get tag: "+err.Error()).SetInternal(err)
+		}
+		if tagCount == 0 {
+			return Livestream{}, echo.NewHTTPError(http.StatusNotFound, "tag not found")
+		}
+
+		// 付与済みのタグは重複して登録しない
+		var taggedCount int64
+		if err := tx.GetContext(ctx, &taggedCount, "SELECT COUNT(*) FROM livestream_tags WHERE livestream_id = ? AND tag_id = ?", livestreamID, req.TagID); err != nil {
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream tag: "+err.Error()).SetInternal(err)
+		}
+		if taggedCount == 0 {
+			if err := insertLivestreamTags(ctx, tx, livestreamModel.ID, []int64{req.TagID}); err != nil {
+				return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream tag: "+err.Error()).SetInternal(err)
+			}
+		}
+
+		livestream, err := fillLivestreamResponse(ctx, tx, livestreamModel)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
+			return Livestream{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error()).SetInternal(err)
 		}
-		livestreams[i] = livestream
+		return livestream, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
 	}
+	livestreamStatsCache.Delete(int64(livestreamID))
 
-	return c.JSON(http.StatusOK, livestreams)
+	return c.JSON(http.StatusOK, livestream)
 }
 
-// viewerテーブルの廃止
-func enterLivestreamHandler(c echo.Context) error {
+// 配信タグ削除API
+// DELETE /api/livestream/:livestream_id/tags/:tag_id
+func removeLivestreamTagHandler(c echo.Context) error {
 	ctx := c.Request().Context()
+
 	if err := verifyUserSession(c); err != nil {
 		// echo.NewHTTPErrorが返っているのでそのまま出力
 		return err
 	}
 
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+	tagID, err := strconv.ParseInt(c.Param("tag_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "tag_id in path must be integer")
+	}
+
 	// error already checked
 	sess, _ := session.Get(defaultSessionIDKey, c)
 	// existence already checked
 	userID := sess.Values[defaultUserIDKey].(int64)
 
-	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
-	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id must be integer")
-	}
+	_, err = WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (struct{}, error) {
+		if _, err := lockOwnLivestream(ctx, tx, int64(livestreamID), userID); err != nil {
+			return struct{}{}, err
+		}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+		rs, err := tx.ExecContext(ctx, "DELETE FROM livestream_tags WHERE livestream_id = ? AND tag_id = ?", livestreamID, tagID)
+		if err != nil {
+			return struct{}{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livestream tag: "+err.Error()).SetInternal(err)
+		}
+		n, err := rs.RowsAffected()
+		if err != nil {
+			return struct{}{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get affected rows: "+err.Error()).SetInternal(err)
+		}
+		if n == 0 {
+			return struct{}{}, echo.NewHTTPError(http.StatusNotFound, "tag not found in the livestream")
+		}
+		return struct{}{}, nil
+	})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+		return txHTTPError(err)
 	}
-	defer tx.Rollback()
+	livestreamStatsCache.Delete(int64(livestreamID))
 
-	viewer := LivestreamViewerModel{
-		UserID:       int64(userID),
-		LivestreamID: int64(livestreamID),
-		CreatedAt:    time.Now().Unix(),
-	}
+	return c.NoContent(http.StatusNoContent)
+}
 
-	if _, err := tx.NamedExecContext(ctx, "INSERT INTO livestream_viewers_history (user_id, livestream_id, created_at) VALUES(:user_id, :livestream_id, :created_at)", viewer); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert livestream_view_history: "+err.Error())
+// lockOwnLivestream は、配信を更新のためにロックして取得する
+// 配信者本人でなければ403を返す
+func lockOwnLivestream(ctx context.Context, tx *sqlx.Tx, livestreamID, userID int64) (LivestreamModel, error) {
+	var livestreamModel LivestreamModel
+	if err := tx.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ? FOR UPDATE", livestreamID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return LivestreamModel{}, echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		}
+		return LivestreamModel{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error()).SetInternal(err)
 	}
-
-	if err := tx.Commit(); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	if livestreamModel.UserID != userID {
+		return LivestreamModel{}, echo.NewHTTPError(http.StatusForbidden, "only the owner of the livestream can update it")
 	}
-
-	return c.NoContent(http.StatusOK)
+	return livestreamModel, nil
 }
 
-func exitLivestreamHandler(c echo.Context) error {
+// 視聴継続API
+// POST /api/livestream/:livestream_id/heartbeat
+func heartbeatLivestreamHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 	if err := verifyUserSession(c); err != nil {
 		// echo.NewHTTPErrorが返っているのでそのまま出力
@@ -356,18 +1227,16 @@ func exitLivestreamHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	var count int64
+	if err := dbConn.GetContext(ctx, &count, "SELECT COUNT(*) FROM livestream_viewers_history WHERE user_id = ? AND livestream_id = ?", userID, livestreamID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream_view_history: "+err.Error())
 	}
-	defer tx.Rollback()
-
-	if _, err := tx.ExecContext(ctx, "DELETE FROM livestream_viewers_history WHERE user_id = ? AND livestream_id = ?", userID, livestreamID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete livestream_view_history: "+err.Error())
+	if count == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "not viewing the livestream")
 	}
 
-	if err := tx.Commit(); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	if _, err := dbConn.ExecContext(ctx, "UPDATE livestream_viewers_history SET last_seen_at = ? WHERE user_id = ? AND livestream_id = ?", time.Now().Unix(), userID, livestreamID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update livestream_view_history: "+err.Error())
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -399,6 +1268,23 @@ func getLivestreamHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
 	}
 
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	isModerator, err := isLivestreamModerator(ctx, dbConn, livestreamModel.ID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderators: "+err.Error())
+	}
+	livestream.IsModerator = isModerator
+
+	activeAnnouncement, err := getActiveAnnouncement(ctx, dbConn, livestreamModel.ID, time.Now())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get active announcement: "+err.Error())
+	}
+	livestream.ActiveAnnouncement = activeAnnouncement
+
 	return c.JSON(http.StatusOK, livestream)
 }
 
@@ -425,32 +1311,98 @@ func getLivecommentReportsHandler(c echo.Context) error {
 	userID := sess.Values[defaultUserIDKey].(int64)
 
 	if livestreamModel.UserID != userID {
-		return echo.NewHTTPError(http.StatusForbidden, "can't get other streamer's livecomment reports")
+		isModerator, err := isLivestreamModerator(ctx, dbConn, livestreamModel.ID, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderators: "+err.Error())
+		}
+		if !isModerator {
+			return echo.NewHTTPError(http.StatusForbidden, "can't get other streamer's livecomment reports")
+		}
 	}
 
-	var reportModels []*LivecommentReportModel
+	var reportModels []LivecommentReportModel
 	if err := dbConn.SelectContext(ctx, &reportModels, "SELECT * FROM livecomment_reports WHERE livestream_id = ?", livestreamID); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomment reports: "+err.Error())
 	}
 
-	reports := make([]LivecommentReport, len(reportModels))
-	for i := range reportModels {
-		report, err := fillLivecommentReportResponseWithoutTx(ctx, *reportModels[i])
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment report: "+err.Error())
-		}
-		reports[i] = report
+	reports, err := fillLivecommentReportsResponseWithoutTx(ctx, reportModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livecomment reports: "+err.Error())
 	}
 
 	return c.JSON(http.StatusOK, reports)
 }
 
+var viewersCountCache = &ViewersCountCache{}
+
+type viewersCountEntry struct {
+	value      int64
+	expiration time.Time
+}
+
+// ViewersCountCache は、配信ごとの視聴者数を保持する
+// このサーバでの入退室では破棄するので、他のサーバでの入退室だけがTTLの間遅れて反映される
+type ViewersCountCache struct {
+	data sync.Map
+}
+
+func (m *ViewersCountCache) Set(livestreamID int64, count int64, ttl time.Duration) {
+	m.data.Store(livestreamID, viewersCountEntry{
+		value:      count,
+		expiration: time.Now().Add(jitteredTTL(ttl)),
+	})
+}
+
+func (m *ViewersCountCache) Get(livestreamID int64) (int64, bool) {
+	v, ok := m.data.Load(livestreamID)
+	if !ok {
+		return 0, false
+	}
+
+	e := v.(viewersCountEntry)
+	if time.Now().After(e.expiration) {
+		m.data.Delete(livestreamID)
+		return 0, false
+	}
+	return e.value, true
+}
+
+func (m *ViewersCountCache) Delete(livestreamID int64) {
+	m.data.Delete(livestreamID)
+}
+
+func (m *ViewersCountCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+}
+
+// getViewersCount は、配信の視聴者数を返す
+// 単体の配信を返すたびに数え直さないよう、viewersCountCacheにあればそれを使う
+func getViewersCount(ctx context.Context, q sqlx.QueryerContext, livestreamID int64) (int64, error) {
+	if count, ok := viewersCountCache.Get(livestreamID); ok {
+		return count, nil
+	}
+
+	var count int64
+	if err := sqlx.GetContext(ctx, q, &count, "SELECT COUNT(*) FROM livestream_viewers_history WHERE livestream_id = ? AND last_seen_at >= ?", livestreamID, time.Now().Unix()-activeViewerWindowSeconds); err != nil {
+		return 0, err
+	}
+	viewersCountCache.Set(livestreamID, count, viewersCountCacheTTL)
+
+	return count, nil
+}
+
 func fillLivestreamResponse(ctx context.Context, tx *sqlx.Tx, livestreamModel LivestreamModel) (Livestream, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	ownerModel := UserModel{}
 	if err := tx.GetContext(ctx, &ownerModel, "SELECT * FROM users WHERE id = ?", livestreamModel.UserID); err != nil {
 		return Livestream{}, err
 	}
-	owner, err := fillUserResponse(ctx, tx, ownerModel)
+	owner, err := fillUserResponse(ctx, tx, ownerModel, noViewerID)
 	if err != nil {
 		return Livestream{}, err
 	}
@@ -460,6 +1412,16 @@ func fillLivestreamResponse(ctx context.Context, tx *sqlx.Tx, livestreamModel Li
 		return Livestream{}, err
 	}
 
+	var totalTip int64
+	if err := tx.GetContext(ctx, &totalTip, "SELECT IFNULL(SUM(tip), 0) FROM livecomments WHERE livestream_id = ?", livestreamModel.ID); err != nil {
+		return Livestream{}, err
+	}
+
+	viewersCount, err := getViewersCount(ctx, tx, livestreamModel.ID)
+	if err != nil {
+		return Livestream{}, err
+	}
+
 	livestream := Livestream{
 		ID:           livestreamModel.ID,
 		Owner:        owner,
@@ -467,9 +1429,13 @@ func fillLivestreamResponse(ctx context.Context, tx *sqlx.Tx, livestreamModel Li
 		Tags:         []Tag{},
 		Description:  livestreamModel.Description,
 		PlaylistUrl:  livestreamModel.PlaylistUrl,
-		ThumbnailUrl: livestreamModel.ThumbnailUrl,
+		ThumbnailUrl: resolveThumbnailURL(livestreamModel.PlaylistUrl, livestreamModel.ThumbnailUrl),
 		StartAt:      livestreamModel.StartAt,
 		EndAt:        livestreamModel.EndAt,
+		MaxViewers:   livestreamModel.MaxViewers,
+		Status:       livestreamStatus(livestreamModel.StartAt, livestreamModel.EndAt, time.Now().Unix()),
+		TotalTip:     totalTip,
+		ViewersCount: viewersCount,
 	}
 
 	if len(livestreamTagModels) > 0 {
@@ -494,15 +1460,46 @@ func fillLivestreamResponse(ctx context.Context, tx *sqlx.Tx, livestreamModel Li
 		}
 	}
 
+	if livestreamModel.PinnedLivecommentID.Valid {
+		livecommentModel := LivecommentModel{}
+		err := tx.GetContext(ctx, &livecommentModel, "SELECT * FROM livecomments WHERE id = ?", livestreamModel.PinnedLivecommentID.Int64)
+		// モデレーションで削除されたライブコメントはピン留めされていないものとして扱う
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return Livestream{}, err
+		}
+		if err == nil {
+			commenterModel := UserModel{}
+			if err := tx.GetContext(ctx, &commenterModel, "SELECT * FROM users WHERE id = ?", livecommentModel.UserID); err != nil {
+				return Livestream{}, err
+			}
+			commenter, err := fillUserResponse(ctx, tx, commenterModel, noViewerID)
+			if err != nil {
+				return Livestream{}, err
+			}
+			livestream.PinnedLivecomment = &Livecomment{
+				ID:           livecommentModel.ID,
+				User:         commenter,
+				Livestream:   livestream,
+				Comment:      livecommentModel.Comment,
+				Tip:          livecommentModel.Tip,
+				TipFormatted: formatTip(livecommentModel.Tip),
+				CreatedAt:    livecommentModel.CreatedAt,
+			}
+		}
+	}
+
 	return livestream, nil
 }
 
 func fillLivestreamResponseWithoutTx(ctx context.Context, livestreamModel LivestreamModel) (Livestream, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	ownerModel := UserModel{}
 	if err := dbConn.GetContext(ctx, &ownerModel, "SELECT * FROM users WHERE id = ?", livestreamModel.UserID); err != nil {
 		return Livestream{}, err
 	}
-	owner, err := fillUserResponseWithoutTx(ctx, ownerModel)
+	owner, err := fillUserResponseWithoutTx(ctx, ownerModel, noViewerID)
 	if err != nil {
 		return Livestream{}, err
 	}
@@ -512,6 +1509,16 @@ func fillLivestreamResponseWithoutTx(ctx context.Context, livestreamModel Livest
 		return Livestream{}, err
 	}
 
+	var totalTip int64
+	if err := dbConn.GetContext(ctx, &totalTip, "SELECT IFNULL(SUM(tip), 0) FROM livecomments WHERE livestream_id = ?", livestreamModel.ID); err != nil {
+		return Livestream{}, err
+	}
+
+	viewersCount, err := getViewersCount(ctx, dbConn, livestreamModel.ID)
+	if err != nil {
+		return Livestream{}, err
+	}
+
 	livestream := Livestream{
 		ID:           livestreamModel.ID,
 		Owner:        owner,
@@ -519,9 +1526,13 @@ func fillLivestreamResponseWithoutTx(ctx context.Context, livestreamModel Livest
 		Tags:         []Tag{},
 		Description:  livestreamModel.Description,
 		PlaylistUrl:  livestreamModel.PlaylistUrl,
-		ThumbnailUrl: livestreamModel.ThumbnailUrl,
+		ThumbnailUrl: resolveThumbnailURL(livestreamModel.PlaylistUrl, livestreamModel.ThumbnailUrl),
 		StartAt:      livestreamModel.StartAt,
 		EndAt:        livestreamModel.EndAt,
+		MaxViewers:   livestreamModel.MaxViewers,
+		Status:       livestreamStatus(livestreamModel.StartAt, livestreamModel.EndAt, time.Now().Unix()),
+		TotalTip:     totalTip,
+		ViewersCount: viewersCount,
 	}
 
 	if len(livestreamTagModels) > 0 {
@@ -546,10 +1557,41 @@ func fillLivestreamResponseWithoutTx(ctx context.Context, livestreamModel Livest
 		}
 	}
 
+	if livestreamModel.PinnedLivecommentID.Valid {
+		livecommentModel := LivecommentModel{}
+		err := dbConn.GetContext(ctx, &livecommentModel, "SELECT * FROM livecomments WHERE id = ?", livestreamModel.PinnedLivecommentID.Int64)
+		// モデレーションで削除されたライブコメントはピン留めされていないものとして扱う
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return Livestream{}, err
+		}
+		if err == nil {
+			commenterModel := UserModel{}
+			if err := dbConn.GetContext(ctx, &commenterModel, "SELECT * FROM users WHERE id = ?", livecommentModel.UserID); err != nil {
+				return Livestream{}, err
+			}
+			commenter, err := fillUserResponseWithoutTx(ctx, commenterModel, noViewerID)
+			if err != nil {
+				return Livestream{}, err
+			}
+			livestream.PinnedLivecomment = &Livecomment{
+				ID:           livecommentModel.ID,
+				User:         commenter,
+				Livestream:   livestream,
+				Comment:      livecommentModel.Comment,
+				Tip:          livecommentModel.Tip,
+				TipFormatted: formatTip(livecommentModel.Tip),
+				CreatedAt:    livecommentModel.CreatedAt,
+			}
+		}
+	}
+
 	return livestream, nil
 }
 
 func fillLivestreamsResponse(ctx context.Context, tx *sqlx.Tx, livestreamModels []LivestreamModel) ([]Livestream, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	if len(livestreamModels) == 0 {
 		return []Livestream{}, nil
 	}
@@ -599,6 +1641,41 @@ func fillLivestreamsResponse(ctx context.Context, tx *sqlx.Tx, livestreamModels
 		})
 	}
 
+	sql, params, err = sqlx.In(`SELECT livestream_id, IFNULL(SUM(tip), 0) AS total_tip FROM livecomments WHERE livestream_id IN (?) GROUP BY livestream_id`, livestreamIDs)
+	if err != nil {
+		return nil, err
+	}
+	type LivestreamTotalTip struct {
+		LivestreamID int64 `db:"livestream_id"`
+		TotalTip     int64 `db:"total_tip"`
+	}
+	totalTipModels := []LivestreamTotalTip{}
+	if err := tx.SelectContext(ctx, &totalTipModels, sql, params...); err != nil {
+		return nil, err
+	}
+	totalTipMap := make(map[int64]int64, len(totalTipModels))
+	for i := range totalTipModels {
+		totalTipMap[totalTipModels[i].LivestreamID] = totalTipModels[i].TotalTip
+	}
+
+	sql, params, err = sqlx.In(`SELECT livestream_id, COUNT(*) AS viewers_count FROM livestream_viewers_history WHERE livestream_id IN (?) AND last_seen_at >= ? GROUP BY livestream_id`, livestreamIDs, time.Now().Unix()-activeViewerWindowSeconds)
+	if err != nil {
+		return nil, err
+	}
+	type LivestreamViewersCount struct {
+		LivestreamID int64 `db:"livestream_id"`
+		ViewersCount int64 `db:"viewers_count"`
+	}
+	viewersCountModels := []LivestreamViewersCount{}
+	if err := tx.SelectContext(ctx, &viewersCountModels, sql, params...); err != nil {
+		return nil, err
+	}
+	viewersCountMap := make(map[int64]int64, len(viewersCountModels))
+	for i := range viewersCountModels {
+		viewersCountMap[viewersCountModels[i].LivestreamID] = viewersCountModels[i].ViewersCount
+	}
+
+	now := time.Now().Unix()
 	livestreams := make([]Livestream, len(livestreamModels))
 	for i := range livestreamModels {
 		owner, ok := ownersMap[livestreamModels[i].UserID]
@@ -612,9 +1689,13 @@ func fillLivestreamsResponse(ctx context.Context, tx *sqlx.Tx, livestreamModels
 			Tags:         livestreamTagMap[livestreamModels[i].ID],
 			Description:  livestreamModels[i].Description,
 			PlaylistUrl:  livestreamModels[i].PlaylistUrl,
-			ThumbnailUrl: livestreamModels[i].ThumbnailUrl,
+			ThumbnailUrl: resolveThumbnailURL(livestreamModels[i].PlaylistUrl, livestreamModels[i].ThumbnailUrl),
 			StartAt:      livestreamModels[i].StartAt,
 			EndAt:        livestreamModels[i].EndAt,
+			MaxViewers:   livestreamModels[i].MaxViewers,
+			Status:       livestreamStatus(livestreamModels[i].StartAt, livestreamModels[i].EndAt, now),
+			TotalTip:     totalTipMap[livestreamModels[i].ID],
+			ViewersCount: viewersCountMap[livestreamModels[i].ID],
 		}
 		if len(livestreams[i].Tags) == 0 {
 			livestreams[i].Tags = []Tag{}
@@ -624,6 +1705,9 @@ func fillLivestreamsResponse(ctx context.Context, tx *sqlx.Tx, livestreamModels
 }
 
 func fillLivestreamsResponseWithoutTx(ctx context.Context, livestreamModels []LivestreamModel) ([]Livestream, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	if len(livestreamModels) == 0 {
 		return []Livestream{}, nil
 	}
@@ -673,6 +1757,41 @@ func fillLivestreamsResponseWithoutTx(ctx context.Context, livestreamModels []Li
 		})
 	}
 
+	sql, params, err = sqlx.In(`SELECT livestream_id, IFNULL(SUM(tip), 0) AS total_tip FROM livecomments WHERE livestream_id IN (?) GROUP BY livestream_id`, livestreamIDs)
+	if err != nil {
+		return nil, err
+	}
+	type LivestreamTotalTip struct {
+		LivestreamID int64 `db:"livestream_id"`
+		TotalTip     int64 `db:"total_tip"`
+	}
+	totalTipModels := []LivestreamTotalTip{}
+	if err := dbConn.SelectContext(ctx, &totalTipModels, sql, params...); err != nil {
+		return nil, err
+	}
+	totalTipMap := make(map[int64]int64, len(totalTipModels))
+	for i := range totalTipModels {
+		totalTipMap[totalTipModels[i].LivestreamID] = totalTipModels[i].TotalTip
+	}
+
+	sql, params, err = sqlx.In(`SELECT livestream_id, COUNT(*) AS viewers_count FROM livestream_viewers_history WHERE livestream_id IN (?) AND last_seen_at >= ? GROUP BY livestream_id`, livestreamIDs, time.Now().Unix()-activeViewerWindowSeconds)
+	if err != nil {
+		return nil, err
+	}
+	type LivestreamViewersCount struct {
+		LivestreamID int64 `db:"livestream_id"`
+		ViewersCount int64 `db:"viewers_count"`
+	}
+	viewersCountModels := []LivestreamViewersCount{}
+	if err := dbConn.SelectContext(ctx, &viewersCountModels, sql, params...); err != nil {
+		return nil, err
+	}
+	viewersCountMap := make(map[int64]int64, len(viewersCountModels))
+	for i := range viewersCountModels {
+		viewersCountMap[viewersCountModels[i].LivestreamID] = viewersCountModels[i].ViewersCount
+	}
+
+	now := time.Now().Unix()
 	livestreams := make([]Livestream, len(livestreamModels))
 	for i := range livestreamModels {
 		owner, ok := ownersMap[livestreamModels[i].UserID]
@@ -686,9 +1805,13 @@ func fillLivestreamsResponseWithoutTx(ctx context.Context, livestreamModels []Li
 			Tags:         livestreamTagMap[livestreamModels[i].ID],
 			Description:  livestreamModels[i].Description,
 			PlaylistUrl:  livestreamModels[i].PlaylistUrl,
-			ThumbnailUrl: livestreamModels[i].ThumbnailUrl,
+			ThumbnailUrl: resolveThumbnailURL(livestreamModels[i].PlaylistUrl, livestreamModels[i].ThumbnailUrl),
 			StartAt:      livestreamModels[i].StartAt,
 			EndAt:        livestreamModels[i].EndAt,
+			MaxViewers:   livestreamModels[i].MaxViewers,
+			Status:       livestreamStatus(livestreamModels[i].StartAt, livestreamModels[i].EndAt, now),
+			TotalTip:     totalTipMap[livestreamModels[i].ID],
+			ViewersCount: viewersCountMap[livestreamModels[i].ID],
 		}
 		if len(livestreams[i].Tags) == 0 {
 			livestreams[i].Tags = []Tag{}
@@ -696,3 +1819,22 @@ func fillLivestreamsResponseWithoutTx(ctx context.Context, livestreamModels []Li
 	}
 	return livestreams, nil
 }
+
+// resolveThumbnailURL は、サムネイルURLが未設定の場合に配信URLのドメインからデフォルトのサムネイルURLを組み立てる
+// 配信URLからドメインが得られない場合はDEFAULT_THUMBNAIL_URLを使う
+func resolveThumbnailURL(playlistURL, thumbnailURL string) string {
+	if thumbnailURL != "" {
+		return thumbnailURL
+	}
+	u, err := url.Parse(playlistURL)
+	if err != nil || u.Host == "" {
+		return defaultThumbnailURL
+	}
+	return "https://" + u.Host + "/default-thumbnail.jpg"
+}
+
+// queryWithIndexHint は、テーブル参照までのクエリにUSE INDEXヒントを付け足す
+// ベンチマーク中のテーブルが小さい時にオプティマイザがフルスキャンを選ばないようにするために使う
+func queryWithIndexHint(base, hint string) string {
+	return base + " USE INDEX (" + hint + ")"
+}
@@ -0,0 +1,750 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+func TestResolveThumbnailURL(t *testing.T) {
+	orig := defaultThumbnailURL
+	defaultThumbnailURL = "https://media.example.com/noimage.jpg"
+	t.Cleanup(func() { defaultThumbnailURL = orig })
+
+	tests := []struct {
+		name         string
+		playlistURL  string
+		thumbnailURL string
+		want         string
+	}{
+		{
+			name:         "both set",
+			playlistURL:  "https://media.xiii.isucon.dev/api/4/playlist.m3u8",
+			thumbnailURL: "https://media.xiii.isucon.dev/isucon12_final.webp",
+			want:         "https://media.xiii.isucon.dev/isucon12_final.webp",
+		},
+		{
+			name:         "thumbnail only",
+			playlistURL:  "",
+			thumbnailURL: "https://media.xiii.isucon.dev/isucon12_final.webp",
+			want:         "https://media.xiii.isucon.dev/isucon12_final.webp",
+		},
+		{
+			name:         "playlist only",
+			playlistURL:  "https://media.xiii.isucon.dev/api/4/playlist.m3u8",
+			thumbnailURL: "",
+			want:         "https://media.xiii.isucon.dev/default-thumbnail.jpg",
+		},
+		{
+			name:         "playlist with port",
+			playlistURL:  "http://localhost:8080/playlist.m3u8",
+			thumbnailURL: "",
+			want:         "https://localhost:8080/default-thumbnail.jpg",
+		},
+		{
+			name:         "both empty",
+			playlistURL:  "",
+			thumbnailURL: "",
+			want:         "https://media.example.com/noimage.jpg",
+		},
+		{
+			name:         "playlist without host",
+			playlistURL:  "playlist.m3u8",
+			thumbnailURL: "",
+			want:         "https://media.example.com/noimage.jpg",
+		},
+		{
+			name:         "invalid playlist",
+			playlistURL:  "://invalid",
+			thumbnailURL: "",
+			want:         "https://media.example.com/noimage.jpg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveThumbnailURL(tt.playlistURL, tt.thumbnailURL); got != tt.want {
+				t.Errorf("resolveThumbnailURL(%q, %q) = %q, want %q", tt.playlistURL, tt.thumbnailURL, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryWithIndexHint(t *testing.T) {
+	got := queryWithIndexHint("SELECT * FROM reservation_slots", "idx_start_at_end_at") + " WHERE start_at >= ? AND end_at <= ?"
+	want := "SELECT * FROM reservation_slots USE INDEX (idx_start_at_end_at) WHERE start_at >= ? AND end_at <= ?"
+	if got != want {
+		t.Errorf("queryWithIndexHint() = %q, want %q", got, want)
+	}
+}
+
+func TestParseSearchUserIDs(t *testing.T) {
+	got, err := parseSearchUserIDs("1, 2,3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []int64{1, 2, 3}; !slices.Equal(got, want) {
+		t.Errorf("parseSearchUserIDs = %v, want %v", got, want)
+	}
+
+	tooMany := make([]string, maxSearchUserIDs+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i + 1)
+	}
+	for _, v := range []string{"0", "-1", "1,a", "1,,2", strings.Join(tooMany, ",")} {
+		if _, err := parseSearchUserIDs(v); err == nil {
+			t.Errorf("parseSearchUserIDs(%.20q) succeeded, want error", v)
+		}
+	}
+}
+
+func TestNewLivestreamTextSearch(t *testing.T) {
+	fullText := newLivestreamTextSearch("isucon", true)
+	if !strings.Contains(fullText.cond, "MATCH(title, description)") || !strings.HasPrefix(fullText.orderBy, "MATCH(title, description)") {
+		t.Errorf("fulltext search = %+v, want MATCH predicate ordered by relevance", fullText)
+	}
+	if len(fullText.condArgs) != 1 || len(fullText.orderArgs) != 1 {
+		t.Errorf("fulltext search args = %v, %v, want one placeholder each", fullText.condArgs, fullText.orderArgs)
+	}
+
+	// 演算子だけの検索語は全文検索の構文エラーになるのでLIKEで探す
+	if operatorsOnly := newLivestreamTextSearch("+-", true); !strings.Contains(operatorsOnly.cond, "LIKE") {
+		t.Errorf("search for operators only = %+v, want LIKE predicate", operatorsOnly)
+	}
+	if unbalanced := newLivestreamTextSearch(`"foo`, true); unbalanced.condArgs[0] != `"foo"` {
+		t.Errorf("fulltext search arg for unbalanced quote = %v, want %q", unbalanced.condArgs[0], `"foo"`)
+	}
+
+	like := newLivestreamTextSearch("isucon", false)
+	if !strings.Contains(like.cond, "LIKE") || like.orderBy != "id DESC" {
+		t.Errorf("like search = %+v, want LIKE predicate ordered by id", like)
+	}
+	if strings.Count(like.cond, "?") != len(like.condArgs) || len(like.orderArgs) != 0 {
+		t.Errorf("like search args = %v, %v, do not match placeholders", like.condArgs, like.orderArgs)
+	}
+}
+
+func TestBooleanModeQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{q: "isucon", want: `"isucon"`},
+		{q: "isucon  live", want: `"isucon" "live"`},
+		{q: `"foo`, want: `"foo"`},
+		{q: "+-", want: ""},
+		{q: "+isucon -live*", want: `"isucon" "live"`},
+		{q: "(a) ~b <c> @d", want: `"a" "b" "c" "d"`},
+		{q: "   ", want: ""},
+	}
+	for _, tt := range tests {
+		if got := booleanModeQuery(tt.q); got != tt.want {
+			t.Errorf("booleanModeQuery(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+}
+
+// 全文検索とLIKEの検索クエリを比較する (DBに接続できない場合はスキップする)
+func BenchmarkSearchLivestreams_FullText(b *testing.B) {
+	benchmarkSearchLivestreams(b, true)
+}
+
+func BenchmarkSearchLivestreams_Like(b *testing.B) {
+	benchmarkSearchLivestreams(b, false)
+}
+
+func benchmarkSearchLivestreams(b *testing.B, fullText bool) {
+	ctx := context.Background()
+
+	db, err := connectDB(echo.New().Logger)
+	if err != nil {
+		b.Skipf("database is not available: %v", err)
+	}
+	defer db.Close()
+
+	if fullText {
+		ok, err := detectLivestreamFullTextIndex(ctx, db)
+		if err != nil || !ok {
+			b.Skip("fulltext index is not available")
+		}
+	}
+
+	search := newLivestreamTextSearch("ISUCON", fullText)
+	query := "SELECT * FROM livestreams WHERE " + search.cond + " ORDER BY " + search.orderBy + " LIMIT 50"
+	args := append(search.condArgs, search.orderArgs...)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var livestreamModels []LivestreamModel
+		if err := db.SelectContext(ctx, &livestreamModels, query, args...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestIsFullTextIndexMissingError(t *testing.T) {
+	missing := &mysql.MySQLError{Number: mysqlErrFTMatchingKeyNotFound, Message: "Can't find FULLTEXT index matching the column list"}
+	if !isFullTextIndexMissingError(missing) {
+		t.Error("ER_FT_MATCHING_KEY_NOT_FOUND must be detected")
+	}
+	// ハンドラではecho.HTTPErrorに包んで返す
+	if !isFullTextIndexMissingError(echo.NewHTTPError(http.StatusInternalServerError).SetInternal(missing)) {
+		t.Error("wrapped ER_FT_MATCHING_KEY_NOT_FOUND must be detected")
+	}
+	if isFullTextIndexMissingError(&mysql.MySQLError{Number: 1064, Message: "syntax error"}) {
+		t.Error("other MySQL errors must not be treated as a missing FULLTEXT index")
+	}
+}
+
+func TestLivestreamStatus(t *testing.T) {
+	const startAt, endAt = 1000, 2000
+	tests := []struct {
+		now  int64
+		want string
+	}{
+		{now: startAt - 1, want: LivestreamStatusScheduled},
+		{now: startAt, want: LivestreamStatusLive},
+		{now: endAt - 1, want: LivestreamStatusLive},
+		{now: endAt, want: LivestreamStatusEnded},
+		{now: endAt + 1, want: LivestreamStatusEnded},
+	}
+	for _, tt := range tests {
+		if got := livestreamStatus(startAt, endAt, tt.now); got != tt.want {
+			t.Errorf("livestreamStatus(%d, %d, %d) = %s, want %s", startAt, endAt, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestLivestreamStatusCond(t *testing.T) {
+	const now = 1500
+	for _, status := range []string{LivestreamStatusScheduled, LivestreamStatusLive, LivestreamStatusEnded} {
+		cond, args, err := livestreamStatusCond(status, now)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", status, err)
+		}
+		if strings.Count(cond, "?") != len(args) {
+			t.Errorf("%s: cond %q has %d placeholders, but %d args", status, cond, strings.Count(cond, "?"), len(args))
+		}
+		// 絞り込み条件とレスポンスのstatusが一致すること
+		for _, l := range []struct{ startAt, endAt int64 }{{1000, 1400}, {1000, 1500}, {1000, 2000}, {1500, 2000}, {1600, 2000}} {
+			if want := livestreamStatus(l.startAt, l.endAt, now) == status; evalLivestreamStatusCond(cond, args, l.startAt, l.endAt) != want {
+				t.Errorf("%s: livestream %d-%d matched = %v, want %v", status, l.startAt, l.endAt, !want, want)
+			}
+		}
+	}
+
+	if _, _, err := livestreamStatusCond("unknown", now); err == nil {
+		t.Error("unknown status must be rejected")
+	}
+}
+
+// evalLivestreamStatusCond は、livestreamStatusCondの条件を配信1件に対して評価する
+func evalLivestreamStatusCond(cond string, args []interface{}, startAt, endAt int64) bool {
+	matched := true
+	for i, term := range strings.Split(cond, " AND ") {
+		v := args[i].(int64)
+		switch term {
+		case "start_at > ?":
+			matched = matched && startAt > v
+		case "start_at <= ?":
+			matched = matched && startAt <= v
+		case "end_at > ?":
+			matched = matched && endAt > v
+		case "end_at <= ?":
+			matched = matched && endAt <= v
+		default:
+			panic("unexpected condition: " + term)
+		}
+	}
+	return matched
+}
+
+func TestReservationSlotsETag(t *testing.T) {
+	slot := ReservationSlotModel{ID: 1, Slot: 5, StartAt: 1711900800, EndAt: 1711904400}
+
+	// 1枠の場合は SHA2(CONCAT(start_at, end_at, slot), 256) と一致する
+	want := fmt.Sprintf("%x", sha256.Sum256([]byte("171190080017119044005")))
+	if got := reservationSlotsETag(ReservationSlotModels{slot}); got != want {
+		t.Errorf("reservationSlotsETag() = %s, want %s", got, want)
+	}
+
+	next := ReservationSlotModel{ID: 2, Slot: 3, StartAt: 1711904400, EndAt: 1711908000}
+	if reservationSlotsETag(ReservationSlotModels{slot, next}) != reservationSlotsETag(ReservationSlotModels{next, slot}) {
+		t.Error("ETag must not depend on the order of slots")
+	}
+
+	// 予約で残数が減るとETagが変わる
+	reserved := slot
+	reserved.Slot--
+	if reservationSlotsETag(ReservationSlotModels{slot}) == reservationSlotsETag(ReservationSlotModels{reserved}) {
+		t.Error("ETag must change when the slot count changes")
+	}
+}
+
+func TestInsertLivestreamTags_SingleInsert(t *testing.T) {
+	d := newFakeTxDB()
+	db := d.open(t)
+
+	tagIDs := []int64{1, 2, 3, 4, 5}
+	_, err := WithTransaction(context.Background(), db, nil, func(tx *sqlx.Tx) (struct{}, error) {
+		return struct{}{}, insertLivestreamTags(context.Background(), tx, 10, tagIDs)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	execs := d.execs()
+	if len(execs) != 1 {
+		t.Fatalf("execs = %d, want 1: %v", len(execs), execs)
+	}
+	if n := strings.Count(execs[0].query, "(?, ?)"); n != len(tagIDs) {
+		t.Errorf("values in INSERT = %d, want %d: %s", n, len(tagIDs), execs[0].query)
+	}
+	args := execs[0].args
+	if len(args) != len(tagIDs)*2 {
+		t.Fatalf("args = %d, want %d", len(args), len(tagIDs)*2)
+	}
+	for i, tagID := range tagIDs {
+		if args[i*2] != int64(10) || args[i*2+1] != tagID {
+			t.Errorf("values[%d] = (%v, %v), want (10, %d)", i, args[i*2], args[i*2+1], tagID)
+		}
+	}
+}
+
+func TestInsertLivestreamTags_Empty(t *testing.T) {
+	d := newFakeTxDB()
+	db := d.open(t)
+
+	_, err := WithTransaction(context.Background(), db, nil, func(tx *sqlx.Tx) (struct{}, error) {
+		return struct{}{}, insertLivestreamTags(context.Background(), tx, 10, nil)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if execs := d.execQueries(); len(execs) != 0 {
+		t.Errorf("execs = %v, want none", execs)
+	}
+}
+
+// useFakeTagSearchDB は、タグ検索のクエリをtags (タグ名 -> タグID) とlivestreamTags (配信ID -> タグID) から計算して返すfakeDBに差し替える
+func useFakeTagSearchDB(t *testing.T) {
+	tags := map[string]int64{"gaming": 1, "music": 2, "talk": 3}
+	livestreamTags := map[int64][]int64{
+		10: {1},
+		11: {2},
+		12: {1, 2},
+		13: {3},
+	}
+
+	d := &fakeDB{}
+	d.onQuery("SELECT id FROM tags WHERE name IN", func(_ string, args []driver.Value) (driver.Rows, error) {
+		rows := &fakeRows{columns: []string{"id"}}
+		for _, arg := range args {
+			if id, ok := tags[arg.(string)]; ok {
+				rows.values = append(rows.values, []driver.Value{id})
+			}
+		}
+		return rows, nil
+	})
+	d.onQuery("SELECT", func(query string, args []driver.Value) (driver.Rows, error) {
+		if !strings.Contains(query, "FROM livestream_tags WHERE tag_id IN") {
+			return nil, errors.New("fakeTagSearchDB: unexpected query: " + query)
+		}
+		// HAVINGがある場合、最後の引数は一致すべきタグ数
+		tagArgs, having := args, strings.Contains(query, "HAVING COUNT(DISTINCT tag_id) = ?")
+		if having {
+			tagArgs = args[:len(args)-1]
+		}
+		rows := &fakeRows{columns: []string{"livestream_id"}}
+		for _, livestreamID := range slices.Backward(slices.Sorted(maps.Keys(livestreamTags))) {
+			matched := 0
+			for _, arg := range tagArgs {
+				if slices.Contains(livestreamTags[livestreamID], arg.(int64)) {
+					matched++
+				}
+			}
+			if (having && int64(matched) == args[len(args)-1].(int64)) || (!having && matched > 0) {
+				rows.values = append(rows.values, []driver.Value{livestreamID})
+			}
+		}
+		return rows, nil
+	})
+	useFakeDB(t, d)
+}
+
+func TestGetTaggedLivestreamIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		tagNames []string
+		matchAll bool
+		want     []int64
+	}{
+		{name: "single tag", tagNames: []string{"gaming"}, want: []int64{12, 10}},
+		{name: "or", tagNames: []string{"gaming", "music"}, want: []int64{12, 11, 10}},
+		{name: "and", tagNames: []string{"gaming", "music"}, matchAll: true, want: []int64{12}},
+		{name: "and with duplicated tag", tagNames: []string{"gaming", "music", "gaming"}, matchAll: true, want: []int64{12}},
+		{name: "or with unknown tag", tagNames: []string{"gaming", "unknown"}, want: []int64{12, 10}},
+		// 存在しないタグを全て持つ配信はない
+		{name: "and with unknown tag", tagNames: []string{"gaming", "unknown"}, matchAll: true, want: nil},
+		{name: "unknown tag", tagNames: []string{"unknown"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeTagSearchDB(t)
+			got, err := getTaggedLivestreamIDs(context.Background(), tt.tagNames, tt.matchAll)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("getTaggedLivestreamIDs(%v, %v) = %v, want %v", tt.tagNames, tt.matchAll, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeLivestreamTagDB は、配信1件とタグの付与状況だけを持つfakeDB
+type fakeLivestreamTagDB struct {
+	*fakeDB
+
+	ownerID int64
+	// 存在するタグID
+	tags []int64
+	// 配信に付与済みのタグID
+	livestreamTags []int64
+}
+
+func useFakeLivestreamTagDB(tb testing.TB, d *fakeLivestreamTagDB) {
+	count := func(ok bool) (driver.Rows, error) {
+		n := int64(0)
+		if ok {
+			n = 1
+		}
+		return fakeValue("COUNT(*)", n), nil
+	}
+	d.fakeDB = &fakeDB{}
+	d.onQuery("SELECT * FROM livestreams WHERE id = ?", func(_ string, args []driver.Value) (driver.Rows, error) {
+		return &fakeRows{columns: []string{"id", "user_id"}, values: [][]driver.Value{{args[0], d.ownerID}}}, nil
+	})
+	d.onQuery("SELECT COUNT(*) FROM tags WHERE id = ?", func(_ string, args []driver.Value) (driver.Rows, error) {
+		return count(slices.Contains(d.tags, args[0].(int64)))
+	})
+	d.onQuery("SELECT COUNT(*) FROM livestream_tags WHERE livestream_id = ? AND tag_id = ?", func(_ string, args []driver.Value) (driver.Rows, error) {
+		return count(slices.Contains(d.livestreamTags, args[1].(int64)))
+	})
+	d.onExec("DELETE FROM livestream_tags", func(_ string, args []driver.Value) (driver.Result, error) {
+		tagID := args[1].(int64)
+		if !slices.Contains(d.livestreamTags, tagID) {
+			return driver.RowsAffected(0), nil
+		}
+		d.livestreamTags = slices.DeleteFunc(d.livestreamTags, func(id int64) bool { return id == tagID })
+		return driver.RowsAffected(1), nil
+	})
+	d.onExec("", fakeExecOK)
+	useFakeDB(tb, d.fakeDB)
+}
+
+func TestLivestreamTagHandlers(t *testing.T) {
+	const ownerID = int64(1)
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		userID     int64
+		wantStatus int
+	}{
+		{name: "add by non-owner", method: http.MethodPost, path: "/api/livestream/10/tags", body: `{"tag_id":1}`, userID: 2, wantStatus: http.StatusForbidden},
+		{name: "add nonexistent tag", method: http.MethodPost, path: "/api/livestream/10/tags", body: `{"tag_id":999}`, userID: ownerID, wantStatus: http.StatusNotFound},
+		{name: "remove by non-owner", method: http.MethodDelete, path: "/api/livestream/10/tags/1", userID: 2, wantStatus: http.StatusForbidden},
+		{name: "remove nonexistent tag", method: http.MethodDelete, path: "/api/livestream/10/tags/999", userID: ownerID, wantStatus: http.StatusNotFound},
+		{name: "remove", method: http.MethodDelete, path: "/api/livestream/10/tags/1", userID: ownerID, wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &fakeLivestreamTagDB{ownerID: ownerID, tags: []int64{1, 2}, livestreamTags: []int64{1}}
+			useFakeLivestreamTagDB(t, d)
+			useSessionVersion(t, tt.userID, 0)
+
+			e := echo.New()
+			e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+			withLogin := func(h echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					// ログイン済みのセッションとして扱う
+					sess, _ := session.Get(defaultSessionIDKey, c)
+					sess.Values[defaultUserIDKey] = tt.userID
+					sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+					return h(c)
+				}
+			}
+			e.POST("/api/livestream/:livestream_id/tags", withLogin(addLivestreamTagHandler))
+			e.DELETE("/api/livestream/:livestream_id/tags/:tag_id", withLogin(removeLivestreamTagHandler))
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusNoContent && slices.Contains(d.livestreamTags, 1) {
+				t.Error("tag 1 is still attached to the livestream")
+			}
+			if tt.wantStatus != http.StatusNoContent && !slices.Contains(d.livestreamTags, 1) {
+				t.Error("rejected request removed the tag")
+			}
+		})
+	}
+}
+
+// useFakeLivestreamFillDB は、ownerIDの配信者の配信を単体で返すのに必要なクエリだけに答えるfakeDBを使う
+// 配信者は自己紹介を非公開にしている
+func useFakeLivestreamFillDB(t *testing.T, ownerID int64) *fakeDB {
+	d := &fakeDB{}
+	d.onQuery("SELECT * FROM users WHERE id = ?", func(string, []driver.Value) (driver.Rows, error) {
+		return &fakeRows{
+			columns: []string{"id", "name", "display_name", "description"},
+			values:  [][]driver.Value{{ownerID, "alice", "Alice", "secret description"}},
+		}, nil
+	})
+	d.onQuery("SELECT * FROM user_privacy WHERE user_id = ?", func(string, []driver.Value) (driver.Rows, error) {
+		return &fakeRows{
+			columns: []string{"user_id", "show_description", "show_display_name", "show_on_leaderboard"},
+			values:  [][]driver.Value{{ownerID, false, true, true}},
+		}, nil
+	})
+	d.onQuery("SELECT COUNT(*)", func(string, []driver.Value) (driver.Rows, error) { return fakeValue("COUNT(*)", int64(0)), nil })
+	d.onQuery("SELECT IFNULL(SUM(tip), 0)", func(string, []driver.Value) (driver.Rows, error) { return fakeValue("v", int64(0)), nil })
+	d.onQuery("SELECT * FROM livestream_tags", func(string, []driver.Value) (driver.Rows, error) { return &fakeRows{}, nil })
+	useFakeDB(t, d)
+	themeCache.Set(ownerID, ThemeModel{ID: ownerID, UserID: ownerID}, time.Hour)
+	iconHashCache.Set(ownerID, "hash", time.Hour)
+	viewersCountCache.CleanupAll()
+	t.Cleanup(func() {
+		themeCache.Delete(ownerID)
+		iconHashCache.Delete(ownerID)
+		viewersCountCache.CleanupAll()
+	})
+
+	return d
+}
+
+func TestFillLivestreamResponseWithoutTx_OwnerPrivacy(t *testing.T) {
+	const ownerID = int64(1)
+	useFakeLivestreamFillDB(t, ownerID)
+
+	livestream, err := fillLivestreamResponseWithoutTx(context.Background(), LivestreamModel{ID: 10, UserID: ownerID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if livestream.Owner.Description != "" || livestream.Owner.DisplayName != "Alice" {
+		t.Errorf("owner = %+v, want the description hidden and the display name shown", livestream.Owner)
+	}
+
+	// 本人には公開設定を適用しない
+	owner, err := fillUserResponseWithoutTx(context.Background(), UserModel{ID: ownerID, DisplayName: "Alice", Description: "secret description"}, ownerID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if owner.Description != "secret description" {
+		t.Errorf("description for the owner = %q, want it shown", owner.Description)
+	}
+}
+
+func TestFillLivestreamResponseWithoutTx_CachesViewersCount(t *testing.T) {
+	const livestreamID = int64(10)
+	d := useFakeLivestreamFillDB(t, 1)
+
+	for i := 0; i < 2; i++ {
+		if _, err := fillLivestreamResponseWithoutTx(context.Background(), LivestreamModel{ID: livestreamID, UserID: 1}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := d.queriesWithPrefix("SELECT COUNT(*) FROM livestream_viewers_history"); n != 1 {
+		t.Errorf("viewers count queries = %d, want 1", n)
+	}
+
+	// 入退室でキャッシュを破棄すると数え直す
+	viewersCountCache.Delete(livestreamID)
+	if _, err := fillLivestreamResponseWithoutTx(context.Background(), LivestreamModel{ID: livestreamID, UserID: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := d.queriesWithPrefix("SELECT COUNT(*) FROM livestream_viewers_history"); n != 2 {
+		t.Errorf("viewers count queries = %d, want 2", n)
+	}
+}
+
+func TestGetViewersCount_ActiveWindow(t *testing.T) {
+	const livestreamID = int64(10)
+	var since int64
+	d := &fakeDB{}
+	d.onQuery("SELECT COUNT(*) FROM livestream_viewers_history", func(_ string, args []driver.Value) (driver.Rows, error) {
+		if len(args) != 2 {
+			t.Fatalf("args = %v, want livestream_id and last_seen_at", args)
+		}
+		since = args[1].(int64)
+		return fakeValue("COUNT(*)", int64(3)), nil
+	})
+	viewersCountCache.CleanupAll()
+	t.Cleanup(viewersCountCache.CleanupAll)
+
+	before := time.Now().Unix()
+	count, err := getViewersCount(context.Background(), d.open(t), livestreamID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("count = %d, want 3", count)
+	}
+	// 最終視聴時刻がactiveViewerWindowSecondsより古い視聴者は数えない
+	if since < before-activeViewerWindowSeconds || since > time.Now().Unix()-activeViewerWindowSeconds {
+		t.Errorf("last_seen_at lower bound = %d, want now - %d", since, activeViewerWindowSeconds)
+	}
+}
+
+func TestEnterLivestreamHandler_Capacity(t *testing.T) {
+	const (
+		livestreamID = int64(10)
+		maxViewers   = int64(2)
+	)
+	tests := []struct {
+		name       string
+		viewers    []int64
+		userID     int64
+		wantStatus int
+	}{
+		{name: "under capacity", viewers: []int64{2}, userID: 3, wantStatus: http.StatusOK},
+		{name: "at capacity", viewers: []int64{2, 4}, userID: 3, wantStatus: http.StatusTooManyRequests},
+		// 再入室は視聴者数を増やさない
+		{name: "reenter at capacity", viewers: []int64{2, 3}, userID: 3, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viewers := map[int64]bool{}
+			for _, id := range tt.viewers {
+				viewers[id] = true
+			}
+			d := &fakeDB{}
+			d.onQuery("SELECT user_id, max_viewers FROM livestreams", func(string, []driver.Value) (driver.Rows, error) {
+				return &fakeRows{columns: []string{"user_id", "max_viewers"}, values: [][]driver.Value{{int64(1), maxViewers}}}, nil
+			})
+			d.onQuery("SELECT COUNT(*) FROM livestream_viewers_history WHERE livestream_id = ? AND user_id = ?", func(_ string, args []driver.Value) (driver.Rows, error) {
+				if viewers[args[1].(int64)] {
+					return fakeValue("COUNT(*)", int64(1)), nil
+				}
+				return fakeValue("COUNT(*)", int64(0)), nil
+			})
+			// 自分以外の視聴者が上限未満の場合だけ入室する
+			d.onExec("INSERT INTO livestream_viewers_history", func(_ string, args []driver.Value) (driver.Result, error) {
+				userID, limit := args[0].(int64), args[6].(int64)
+				others := int64(0)
+				for id := range viewers {
+					if id != userID {
+						others++
+					}
+				}
+				if others >= limit {
+					return driver.RowsAffected(0), nil
+				}
+				if viewers[userID] {
+					return driver.RowsAffected(2), nil
+				}
+				viewers[userID] = true
+				return driver.RowsAffected(1), nil
+			})
+			useFakeDB(t, d)
+			useSessionVersion(t, tt.userID, 0)
+
+			e := echo.New()
+			e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+			e.POST("/api/livestream/:livestream_id/enter", func(c echo.Context) error {
+				// ログイン済みのセッションとして扱う
+				sess, _ := session.Get(defaultSessionIDKey, c)
+				sess.Values[defaultUserIDKey] = tt.userID
+				sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+				return enterLivestreamHandler(c)
+			})
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/livestream/%d/enter", livestreamID), nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			// 配信の行はロックしない
+			for _, q := range d.queries() {
+				if strings.Contains(q, "FOR UPDATE") {
+					t.Errorf("livestream row must not be locked: %s", q)
+				}
+			}
+			if tt.wantStatus == http.StatusOK && !viewers[tt.userID] {
+				t.Error("viewer was not recorded")
+			}
+		})
+	}
+}
+
+func TestDeleteLivestreamHandler(t *testing.T) {
+	const (
+		ownerID      = int64(1)
+		livestreamID = int64(10)
+	)
+	d := &fakeDB{}
+	d.onQuery("SELECT * FROM livestreams WHERE id = ? FOR UPDATE", func(string, []driver.Value) (driver.Rows, error) {
+		startAt := time.Now().Add(time.Hour).Unix()
+		return &fakeRows{
+			columns: []string{"id", "user_id", "start_at", "end_at"},
+			values:  [][]driver.Value{{livestreamID, ownerID, startAt, startAt + 3600}},
+		}, nil
+	})
+	d.onExec("", fakeExecOK)
+	useFakeDB(t, d)
+	useSessionVersion(t, ownerID, 0)
+	useLivestreamStatsCache(t)
+	livestreamStatsCache.Set(livestreamID, LivestreamStatistics{Rank: 1}, 0, time.Hour)
+	popularTagsCache.Set([]PopularTag{{Tag: Tag{ID: 1, Name: "game"}, LivestreamCount: 1}}, time.Hour)
+	t.Cleanup(popularTagsCache.CleanupAll)
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	e.DELETE("/api/livestream/:livestream_id", func(c echo.Context) error {
+		// ログイン済みのセッションとして扱う
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultUserIDKey] = ownerID
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+		return deleteLivestreamHandler(c)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/livestream/10", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body.String())
+	}
+
+	// 配信に紐づく行は、配信と同じトランザクションで消す
+	for _, table := range livestreamOwnedTables {
+		if n := d.queriesWithPrefix("DELETE FROM " + table + " WHERE livestream_id = ?"); n != 1 {
+			t.Errorf("rows in %s were deleted %d times, want 1", table, n)
+		}
+	}
+	if d.commits != 1 {
+		t.Errorf("commits = %d, want 1", d.commits)
+	}
+	if _, _, ok := livestreamStatsCache.Get(livestreamID); ok {
+		t.Error("statistics of the deleted livestream are still cached")
+	}
+	if _, ok := popularTagsCache.Get(); ok {
+		t.Error("popular tags are still cached after the livestream was deleted")
+	}
+}
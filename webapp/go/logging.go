@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+// requestLogger は、リクエストごとのログをJSONで標準出力に書き出す
+var requestLogger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+type loggerContextKey struct{}
+
+// withLogger は、ロガーを紐づけたコンテキストを返す
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// loggerFromContext は、structuredLogMiddlewareがリクエストに紐づけたロガーを返す
+// 紐づいていない場合はslog.Default()を返す
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// structuredLogMiddleware は、リクエストごとに1行のJSONログを出力する
+// X-Request-Idがなければ生成してレスポンスにも付与し、request_id付きのロガーをコンテキストに載せる
+func structuredLogMiddleware(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			requestID := c.Request().Header.Get(echo.HeaderXRequestID)
+			if requestID == "" {
+				requestID = uuid.NewString()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, requestID)
+
+			reqLogger := logger.With("request_id", requestID)
+			c.SetRequest(c.Request().WithContext(withLogger(c.Request().Context(), reqLogger)))
+
+			err := next(c)
+
+			attrs := []any{
+				"method", c.Request().Method,
+				"path", c.Request().URL.Path,
+				"status", responseStatus(c, err),
+				"latency_ms", durationMilliseconds(time.Since(start)),
+			}
+			// セッションミドルウェアを通ったリクエストのみ、ログインユーザを記録する
+			if sess, sessErr := session.Get(defaultSessionIDKey, c); sessErr == nil {
+				if userID, ok := sess.Values[defaultUserIDKey].(int64); ok {
+					attrs = append(attrs, "user_id", userID)
+				}
+			}
+			if err != nil {
+				attrs = append(attrs, "error", err.Error())
+			}
+			reqLogger.Info("request", attrs...)
+
+			return err
+		}
+	}
+}
+
+// responseStatus は、ハンドラの戻り値を踏まえてクライアントに返すステータスコードを求める
+// エラーはまだレスポンスに書かれていないので、echo.HTTPErrorのコードか500を返す
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code
+	}
+	return http.StatusInternalServerError
+}
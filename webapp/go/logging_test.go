@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+func TestStructuredLogMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	e := echo.New()
+	e.Use(structuredLogMiddleware(logger))
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	e.GET("/api/livestream/:livestream_id", func(c echo.Context) error {
+		// ログイン済みのセッションとして扱う
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultUserIDKey] = int64(1)
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+
+		loggerFromContext(c.Request().Context()).Info("inside handler")
+		return echo.NewHTTPError(http.StatusNotFound, "not found livestream")
+	})
+
+	for _, requestID := range []string{"", "given-request-id"} {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/api/livestream/1", nil)
+		if requestID != "" {
+			req.Header.Set(echo.HeaderXRequestID, requestID)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		gotID := rec.Header().Get(echo.HeaderXRequestID)
+		if gotID == "" || (requestID != "" && gotID != requestID) {
+			t.Fatalf("X-Request-Id = %q, want %q or a generated id", gotID, requestID)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("got %d log lines, want 2:\n%s", len(lines), buf.String())
+		}
+		var inside, request map[string]any
+		if err := json.Unmarshal([]byte(lines[0]), &inside); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(lines[1]), &request); err != nil {
+			t.Fatal(err)
+		}
+		if inside["request_id"] != gotID {
+			t.Errorf("handler log request_id = %v, want %q", inside["request_id"], gotID)
+		}
+
+		want := map[string]any{
+			"request_id": gotID,
+			"method":     http.MethodGet,
+			"path":       "/api/livestream/1",
+			"status":     float64(http.StatusNotFound),
+			"user_id":    float64(1),
+		}
+		for k, v := range want {
+			if request[k] != v {
+				t.Errorf("request log %s = %v, want %v", k, request[k], v)
+			}
+		}
+		if _, ok := request["latency_ms"]; !ok {
+			t.Error("request log has no latency_ms")
+		}
+		if errMsg, _ := request["error"].(string); !strings.Contains(errMsg, "not found livestream") {
+			t.Errorf("request log error = %v, want the handler error", request["error"])
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+// Prometheusのテキスト形式でメトリクスを公開する
+// client_golangには依存せず、必要なカウンタ・ヒストグラム・ゲージだけを自前で持つ
+
+const dbStatsInterval = 5 * time.Second
+
+// prometheus.DefBucketsと同じバケット (秒)
+var requestDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var httpMetrics = NewHTTPMetrics()
+
+// DBコネクションプールの状態 (runDBStatsCollectorが更新する)
+var (
+	dbOpenConnections atomic.Int64
+	dbInUse           atomic.Int64
+	dbIdle            atomic.Int64
+)
+
+type requestCountKey struct {
+	method string
+	path   string
+	status int
+}
+
+type requestDurationKey struct {
+	method string
+	path   string
+}
+
+type durationHistogram struct {
+	// バケットごとの累積ではない件数 (最後の要素は+Inf)
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HTTPMetrics は、リクエスト数とレスポンスタイムのヒストグラムをルートごとに保持する
+type HTTPMetrics struct {
+	mu        sync.Mutex
+	requests  map[requestCountKey]uint64
+	durations map[requestDurationKey]*durationHistogram
+}
+
+func NewHTTPMetrics() *HTTPMetrics {
+	return &HTTPMetrics{
+		requests:  make(map[requestCountKey]uint64),
+		durations: make(map[requestDurationKey]*durationHistogram),
+	}
+}
+
+func (m *HTTPMetrics) Observe(method, path string, status int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestCountKey{method: method, path: path, status: status}]++
+
+	key := requestDurationKey{method: method, path: path}
+	h, ok := m.durations[key]
+	if !ok {
+		h = &durationHistogram{counts: make([]uint64, len(requestDurationBuckets)+1)}
+		m.durations[key] = h
+	}
+	seconds := d.Seconds()
+	i, _ := slices.BinarySearch(requestDurationBuckets, seconds)
+	h.counts[i]++
+	h.sum += seconds
+	h.count++
+}
+
+// RequestCount は、http_requests_totalの値を返す
+func (m *HTTPMetrics) RequestCount(method, path string, status int) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests[requestCountKey{method: method, path: path, status: status}]
+}
+
+// WriteTo は、メトリクスをPrometheusのテキスト形式で書き出す
+func (m *HTTPMetrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	m.mu.Lock()
+	requestKeys := make([]requestCountKey, 0, len(m.requests))
+	for k := range m.requests {
+		requestKeys = append(requestKeys, k)
+	}
+	slices.SortFunc(requestKeys, func(a, b requestCountKey) int {
+		return cmp.Or(strings.Compare(a.path, b.path), strings.Compare(a.method, b.method), cmp.Compare(a.status, b.status))
+	})
+	b.WriteString("# HELP http_requests_total Total number of HTTP requests.\n")
+	b.WriteString("# TYPE http_requests_total counter\n")
+	for _, k := range requestKeys {
+		fmt.Fprintf(&b, "http_requests_total{method=%q,path=%q,status=\"%d\"} %d\n", k.method, k.path, k.status, m.requests[k])
+	}
+
+	durationKeys := make([]requestDurationKey, 0, len(m.durations))
+	for k := range m.durations {
+		durationKeys = append(durationKeys, k)
+	}
+	slices.SortFunc(durationKeys, func(a, b requestDurationKey) int {
+		return cmp.Or(strings.Compare(a.path, b.path), strings.Compare(a.method, b.method))
+	})
+	b.WriteString("# HELP http_request_duration_seconds HTTP request latencies in seconds.\n")
+	b.WriteString("# TYPE http_request_duration_seconds histogram\n")
+	for _, k := range durationKeys {
+		h := m.durations[k]
+		var cumulative uint64
+		for i, le := range requestDurationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "http_request_duration_seconds_bucket{method=%q,path=%q,le=%q} %d\n", k.method, k.path, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(&b, "http_request_duration_seconds_bucket{method=%q,path=%q,le=\"+Inf\"} %d\n", k.method, k.path, h.count)
+		fmt.Fprintf(&b, "http_request_duration_seconds_sum{method=%q,path=%q} %s\n", k.method, k.path, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "http_request_duration_seconds_count{method=%q,path=%q} %d\n", k.method, k.path, h.count)
+	}
+	m.mu.Unlock()
+
+	for _, g := range []struct {
+		name  string
+		help  string
+		value int64
+	}{
+		{name: "db_open_connections", help: "Number of established connections to the database.", value: dbOpenConnections.Load()},
+		{name: "db_in_use", help: "Number of connections currently in use.", value: dbInUse.Load()},
+		{name: "db_idle", help: "Number of idle connections.", value: dbIdle.Load()},
+	} {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.name, g.help, g.name, g.name, g.value)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// normalizeMetricsPath は、ルートのパスパラメータ (:livestream_id) を{livestream_id}に置き換える
+func normalizeMetricsPath(route string) string {
+	segments := strings.Split(route, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// MetricsMiddleware は、ルート (c.Path()) ごとにリクエスト数とレスポンスタイムを記録する
+// どのルートにもマッチしなかったリクエストは、ラベルが増え続けないよう記録しない
+func MetricsMiddleware(m *HTTPMetrics) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			route := c.Path()
+			if route == "" {
+				return err
+			}
+
+			m.Observe(c.Request().Method, normalizeMetricsPath(route), responseStatus(c, err), time.Since(start))
+			return err
+		}
+	}
+}
+
+// runDBStatsCollector は、定期的にDBコネクションプールの状態をゲージに反映する
+func runDBStatsCollector(db *sqlx.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		stats := db.Stats()
+		dbOpenConnections.Store(int64(stats.OpenConnections))
+		dbInUse.Store(int64(stats.InUse))
+		dbIdle.Store(int64(stats.Idle))
+	}
+}
+
+// メトリクス取得API (Prometheus形式)
+// GET /metrics
+func getPrometheusMetricsHandler(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	_, err := httpMetrics.WriteTo(c.Response())
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestNormalizeMetricsPath(t *testing.T) {
+	tests := map[string]string{
+		"/api/tag":                       "/api/tag",
+		"/api/livestream/:livestream_id": "/api/livestream/{livestream_id}",
+		"/api/livestream/:livestream_id/moderators/:user_id": "/api/livestream/{livestream_id}/moderators/{user_id}",
+	}
+	for route, want := range tests {
+		if got := normalizeMetricsPath(route); got != want {
+			t.Errorf("normalizeMetricsPath(%q) = %q, want %q", route, got, want)
+		}
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	m := NewHTTPMetrics()
+	e := echo.New()
+	e.Use(MetricsMiddleware(m))
+	e.GET("/api/livestream/:livestream_id", func(c echo.Context) error {
+		if c.Param("livestream_id") == "0" {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	// 配信IDが違っても同じラベルに集計される
+	for i := 1; i <= 10; i++ {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/livestream/"+strconv.Itoa(i), nil))
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/livestream/0", nil))
+
+	const path = "/api/livestream/{livestream_id}"
+	if n := m.RequestCount(http.MethodGet, path, http.StatusOK); n != 10 {
+		t.Errorf("http_requests_total{status=200} = %d, want 10", n)
+	}
+	if n := m.RequestCount(http.MethodGet, path, http.StatusNotFound); n != 1 {
+		t.Errorf("http_requests_total{status=404} = %d, want 1", n)
+	}
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		`http_requests_total{method="GET",path="/api/livestream/{livestream_id}",status="200"} 10`,
+		`http_request_duration_seconds_count{method="GET",path="/api/livestream/{livestream_id}"} 11`,
+		`http_request_duration_seconds_bucket{method="GET",path="/api/livestream/{livestream_id}",le="+Inf"} 11`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, b.String())
+		}
+	}
+}
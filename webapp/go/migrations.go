@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	echolog "github.com/labstack/gommon/log"
+)
+
+// Migration は、既存環境に適用するスキーマ変更
+// SQLは1文のみ (MySQLドライバでは複数文を一度に実行できないため)
+type Migration struct {
+	Version int
+	SQL     string
+}
+
+// migrations は、Versionの昇順に並べること
+// 新規環境ではinitdb.d/10_schema.sqlで作成済みなので、10_schema.sqlのschema_migrationsにも適用済みとして追加すること
+// カラムを変更した場合は、schema.goのexpectedSchemaも更新すること
+// 各マイグレーションは初期スキーマ (10_schema.sqlの初版) に順に適用できること (TestMigrations_ReplayOnBaselineSchema)
+var migrations = []Migration{
+	// usersにアイコン画像のハッシュを追加し、登録済みのアイコンから埋める
+	{
+		Version: 1,
+		SQL:     "ALTER TABLE `users` ADD COLUMN `icon_hash` VARCHAR(64) DEFAULT NULL",
+	},
+	{
+		Version: 2,
+		SQL:     "UPDATE `users` u INNER JOIN `icons` i ON i.`user_id` = u.`id` SET u.`icon_hash` = SHA2(i.`image`, 256)",
+	},
+	{
+		Version: 3,
+		SQL:     "ALTER TABLE `users` ADD COLUMN `force_keep_dns` BOOLEAN NOT NULL DEFAULT false",
+	},
+	{
+		Version: 4,
+		SQL:     "ALTER TABLE `users` ADD COLUMN `updated_at` BIGINT NOT NULL DEFAULT 0",
+	},
+	{
+		Version: 5,
+		SQL:     "ALTER TABLE `users` ADD COLUMN `created_at` BIGINT NOT NULL DEFAULT 0",
+	},
+	// livestreams・reactions・livestream_viewers_historyはinit.sqlで作り直されるので、既に列がある場合がある
+	{
+		Version: 6,
+		SQL:     "ALTER TABLE `livestreams` ADD COLUMN `pinned_livecomment_id` BIGINT NULL",
+	},
+	{
+		Version: 7,
+		SQL:     "ALTER TABLE `livestreams` ADD COLUMN `max_viewers` INT NOT NULL DEFAULT 0",
+	},
+	{
+		Version: 8,
+		SQL:     "ALTER TABLE `reactions` ADD COLUMN `emoji_name_normalized` VARCHAR(255) COLLATE utf8mb4_bin GENERATED ALWAYS AS (LOWER(`emoji_name`)) STORED AFTER `emoji_name`",
+	},
+	{
+		Version: 9,
+		SQL:     "ALTER TABLE `livestream_viewers_history` ADD COLUMN `last_seen_at` BIGINT NOT NULL DEFAULT 0",
+	},
+	// LivestreamModel.MaxViewersに合わせてBIGINTにする
+	{
+		Version: 10,
+		SQL:     "ALTER TABLE `livestreams` MODIFY COLUMN `max_viewers` BIGINT NOT NULL DEFAULT 0",
+	},
+}
+
+// mysqlErrDupFieldName は、追加しようとした列が既にある場合のエラー番号 (ER_DUP_FIELDNAME)
+const mysqlErrDupFieldName = 1060
+
+func isDuplicateColumnError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDupFieldName
+}
+
+// runMigrateOnly は、--migrate-onlyで起動された時にマイグレーションだけを適用し、終了コードを返す
+func runMigrateOnly() int {
+	logger := echolog.New("migrate")
+
+	conn, err := connectDB(logger)
+	if err != nil {
+		logger.Errorf("failed to connect db: %v", err)
+		return 1
+	}
+	defer conn.Close()
+
+	applied, err := applyMigrations(context.Background(), conn, migrations)
+	if err != nil {
+		logger.Errorf("failed to apply migrations: %v", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stdout, "applied %d migration(s)\n", applied)
+	return 0
+}
+
+// applyMigrations は、未適用のマイグレーションをVersionの昇順に1つずつトランザクションで適用し、適用した数を返す
+// 適用済みの最新より古いVersionが未適用で残っている場合は、順序が崩れるので適用せずにエラーを返す
+// NOTE: MySQLではDDLは暗黙的にコミットされるので、DDLの失敗時にはschema_migrationsへの記録だけがロールバックされる
+func applyMigrations(ctx context.Context, db *sqlx.DB, migrations []Migration) (int, error) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			return 0, fmt.Errorf("migrations must be sorted by version without duplicates: %d after %d", migrations[i].Version, migrations[i-1].Version)
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `schema_migrations` (`version` INT NOT NULL PRIMARY KEY, `applied_at` BIGINT NOT NULL) ENGINE=InnoDB"); err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var versions []int
+	if err := db.SelectContext(ctx, &versions, "SELECT version FROM schema_migrations"); err != nil {
+		return 0, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	appliedVersions := make(map[int]struct{}, len(versions))
+	latest := 0
+	for _, v := range versions {
+		appliedVersions[v] = struct{}{}
+		latest = max(latest, v)
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if _, ok := appliedVersions[m.Version]; ok {
+			continue
+		}
+		if m.Version < latest {
+			return 0, fmt.Errorf("migration %d is older than the latest applied migration %d", m.Version, latest)
+		}
+		pending = append(pending, m)
+	}
+
+	for i, m := range pending {
+		if err := applyMigration(ctx, db, m); err != nil {
+			return i, fmt.Errorf("failed to apply migration %d: %w", m.Version, err)
+		}
+	}
+	return len(pending), nil
+}
+
+// applyMigration は、1つのマイグレーションを適用してschema_migrationsに記録する
+// 追加する列が既にある場合 (init.sqlで作り直したテーブルなど) は、適用済みとして記録だけする
+func applyMigration(ctx context.Context, db *sqlx.DB, m Migration) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil && !isDuplicateColumnError(err) {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", m.Version, time.Now().Unix()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeMigrationDB は、schema_migrationsを模したfakeDB
+// マイグレーションのSQLは実行せず、実行した順に記録する
+type fakeMigrationDB struct {
+	*fakeDB
+
+	applied []int64
+	// コミットされるまでschema_migrationsには反映しない
+	pending []int64
+	// このSQLの実行は失敗する
+	failSQL string
+
+	executed []string
+}
+
+func newFakeMigrationDB(t *testing.T, d *fakeMigrationDB) *sqlx.DB {
+	d.fakeDB = &fakeDB{
+		onCommit: func() error {
+			d.applied = append(d.applied, d.pending...)
+			d.pending = nil
+			return nil
+		},
+		onRollback: func() error {
+			d.pending = nil
+			return nil
+		},
+	}
+	d.onQuery("SELECT version FROM schema_migrations", func(string, []driver.Value) (driver.Rows, error) {
+		rows := &fakeRows{columns: []string{"version"}}
+		for _, v := range d.applied {
+			rows.values = append(rows.values, []driver.Value{v})
+		}
+		return rows, nil
+	})
+	d.onExec("CREATE TABLE IF NOT EXISTS `schema_migrations`", fakeExecOK)
+	d.onExec("INSERT INTO schema_migrations", func(_ string, args []driver.Value) (driver.Result, error) {
+		d.pending = append(d.pending, args[0].(int64))
+		return driver.RowsAffected(1), nil
+	})
+	d.onExec("", func(query string, _ []driver.Value) (driver.Result, error) {
+		if query == d.failSQL {
+			return nil, errors.New("fakeMigrationDB: failed to execute " + query)
+		}
+		d.executed = append(d.executed, query)
+		return driver.RowsAffected(1), nil
+	})
+	return d.open(t)
+}
+
+var testMigrations = []Migration{
+	{Version: 1, SQL: "CREATE TABLE a (id INT)"},
+	{Version: 2, SQL: "CREATE TABLE b (id INT)"},
+	{Version: 3, SQL: "CREATE TABLE c (id INT)"},
+}
+
+func TestApplyMigrations_Idempotent(t *testing.T) {
+	d := &fakeMigrationDB{}
+	db := newFakeMigrationDB(t, d)
+	ctx := context.Background()
+
+	n, err := applyMigrations(ctx, db, testMigrations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("applied = %d, want 3", n)
+	}
+	want := []string{testMigrations[0].SQL, testMigrations[1].SQL, testMigrations[2].SQL}
+	if strings.Join(d.executed, ";") != strings.Join(want, ";") {
+		t.Errorf("executed = %v, want %v", d.executed, want)
+	}
+
+	// 2回目は何も適用しない
+	n, err = applyMigrations(ctx, db, testMigrations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 0 || len(d.executed) != 3 {
+		t.Errorf("applied = %d, executed = %v, want nothing applied", n, d.executed)
+	}
+}
+
+func TestApplyMigrations_AppliesOnlyPending(t *testing.T) {
+	d := &fakeMigrationDB{applied: []int64{1, 2}}
+	db := newFakeMigrationDB(t, d)
+
+	n, err := applyMigrations(context.Background(), db, testMigrations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 1 || len(d.executed) != 1 || d.executed[0] != testMigrations[2].SQL {
+		t.Errorf("applied = %d, executed = %v, want only version 3", n, d.executed)
+	}
+}
+
+func TestApplyMigrations_RejectOutOfOrder(t *testing.T) {
+	t.Run("pending migration older than applied", func(t *testing.T) {
+		// 2が未適用のまま3が適用済み
+		d := &fakeMigrationDB{applied: []int64{1, 3}}
+		db := newFakeMigrationDB(t, d)
+
+		if _, err := applyMigrations(context.Background(), db, testMigrations); err == nil {
+			t.Fatal("expected error")
+		}
+		if len(d.executed) != 0 {
+			t.Errorf("executed = %v, want nothing", d.executed)
+		}
+	})
+	t.Run("unsorted migrations", func(t *testing.T) {
+		d := &fakeMigrationDB{}
+		db := newFakeMigrationDB(t, d)
+
+		unsorted := []Migration{testMigrations[1], testMigrations[0]}
+		if _, err := applyMigrations(context.Background(), db, unsorted); err == nil {
+			t.Fatal("expected error")
+		}
+		if len(d.executed) != 0 {
+			t.Errorf("executed = %v, want nothing", d.executed)
+		}
+	})
+}
+
+func TestApplyMigrations_StopsAtFailure(t *testing.T) {
+	d := &fakeMigrationDB{failSQL: testMigrations[1].SQL}
+	db := newFakeMigrationDB(t, d)
+
+	n, err := applyMigrations(context.Background(), db, testMigrations)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if n != 1 {
+		t.Errorf("applied = %d, want 1", n)
+	}
+	// 失敗したマイグレーションは記録されず、以降も適用しない
+	if len(d.applied) != 1 || d.applied[0] != 1 {
+		t.Errorf("schema_migrations = %v, want [1]", d.applied)
+	}
+	if len(d.executed) != 1 {
+		t.Errorf("executed = %v, want only version 1", d.executed)
+	}
+}
+
+func TestMigrations_Sorted(t *testing.T) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			t.Errorf("migrations[%d].Version = %d must be greater than %d", i, migrations[i].Version, migrations[i-1].Version)
+		}
+	}
+}
+
+// baselineSchema は、初版の10_schema.sqlのうちexpectedSchemaに含まれるテーブルのカラムと型
+func baselineSchema() map[string]map[string]string {
+	return map[string]map[string]string{
+		"users":                      {"id": "bigint", "name": "varchar", "display_name": "varchar", "password": "varchar", "description": "text"},
+		"icons":                      {"id": "bigint", "user_id": "bigint", "image": "longblob"},
+		"themes":                     {"id": "bigint", "user_id": "bigint", "dark_mode": "tinyint"},
+		"livestreams":                {"id": "bigint", "user_id": "bigint", "title": "varchar", "description": "text", "playlist_url": "varchar", "thumbnail_url": "varchar", "start_at": "bigint", "end_at": "bigint"},
+		"reservation_slots":          {"id": "bigint", "slot": "bigint", "start_at": "bigint", "end_at": "bigint"},
+		"tags":                       {"id": "bigint", "name": "varchar"},
+		"livestream_tags":            {"id": "bigint", "livestream_id": "bigint", "tag_id": "bigint"},
+		"livecomments":               {"id": "bigint", "user_id": "bigint", "livestream_id": "bigint", "comment": "varchar", "tip": "bigint", "created_at": "bigint"},
+		"reactions":                  {"id": "bigint", "user_id": "bigint", "livestream_id": "bigint", "emoji_name": "varchar", "created_at": "bigint"},
+		"livestream_viewers_history": {"id": "bigint", "user_id": "bigint", "livestream_id": "bigint", "created_at": "bigint"},
+	}
+}
+
+var (
+	alterColumnPattern = regexp.MustCompile("^ALTER TABLE `(\\w+)` (ADD|MODIFY) COLUMN `(\\w+)` (\\w+)")
+	afterColumnPattern = regexp.MustCompile("AFTER `(\\w+)`$")
+)
+
+// newFakeAlterDB は、ALTER TABLEによる列の追加・変更をcolumnsに反映し、information_schemaからcolumnsを返すDBを開く
+// 既にある列を追加するとMySQLと同じくER_DUP_FIELDNAMEを返す
+func newFakeAlterDB(t *testing.T, columns map[string]map[string]string) (*sqlx.DB, *[]int64) {
+	var applied []int64
+	d := &fakeDB{}
+	d.onQuery("SELECT version FROM schema_migrations", func(string, []driver.Value) (driver.Rows, error) {
+		return &fakeRows{columns: []string{"version"}}, nil
+	})
+	onSchemaQuery(d, columns)
+	d.onExec("CREATE TABLE IF NOT EXISTS `schema_migrations`", fakeExecOK)
+	d.onExec("INSERT INTO schema_migrations", func(_ string, args []driver.Value) (driver.Result, error) {
+		applied = append(applied, args[0].(int64))
+		return driver.RowsAffected(1), nil
+	})
+	d.onExec("UPDATE ", fakeExecOK)
+	d.onExec("ALTER TABLE ", func(query string, _ []driver.Value) (driver.Result, error) {
+		m := alterColumnPattern.FindStringSubmatch(query)
+		if m == nil {
+			// インデックスの追加などは列に影響しない
+			return driver.RowsAffected(0), nil
+		}
+		table, op, column, dataType := m[1], m[2], m[3], strings.ToLower(m[4])
+		if dataType == "boolean" {
+			dataType = "tinyint"
+		}
+		if columns[table] == nil {
+			return nil, errors.New("fakeAlterDB: table not found: " + table)
+		}
+		_, exists := columns[table][column]
+		switch {
+		case op == "ADD" && exists:
+			return nil, &mysql.MySQLError{Number: mysqlErrDupFieldName, Message: "Duplicate column name '" + column + "'"}
+		case op == "MODIFY" && !exists:
+			return nil, errors.New("fakeAlterDB: column not found: " + table + "." + column)
+		}
+		if after := afterColumnPattern.FindStringSubmatch(query); after != nil {
+			if _, ok := columns[table][after[1]]; !ok {
+				return nil, errors.New("fakeAlterDB: unknown column in AFTER: " + table + "." + after[1])
+			}
+		}
+		columns[table][column] = dataType
+		return driver.RowsAffected(0), nil
+	})
+	return d.open(t), &applied
+}
+
+func TestMigrations_ReplayOnBaselineSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema func() map[string]map[string]string
+	}{
+		{name: "baseline", schema: baselineSchema},
+		{
+			// init.sqlで作り直したテーブルは、マイグレーションで追加する列を既に持つ
+			name: "after init.sql",
+			schema: func() map[string]map[string]string {
+				schema := baselineSchema()
+				schema["livestreams"]["pinned_livecomment_id"] = "bigint"
+				schema["livestreams"]["max_viewers"] = expectedSchema["livestreams"]["max_viewers"]
+				schema["reactions"]["emoji_name_normalized"] = "varchar"
+				schema["livestream_viewers_history"]["last_seen_at"] = "bigint"
+				return schema
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, applied := newFakeAlterDB(t, tt.schema())
+			ctx := context.Background()
+
+			n, err := applyMigrations(ctx, db, migrations)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != len(migrations) || len(*applied) != len(migrations) {
+				t.Errorf("applied = %d, recorded %v, want all %d migrations", n, *applied, len(migrations))
+			}
+			if err := verifyDBSchema(ctx, db); err != nil {
+				t.Errorf("schema after migrations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+type LivestreamModeratorModel struct {
+	LivestreamID int64 `db:"livestream_id"`
+	UserID       int64 `db:"user_id"`
+	GrantedAt    int64 `db:"granted_at"`
+	IsCoStreamer bool  `db:"is_co_streamer"`
+}
+
+type LivestreamModerator struct {
+	User      User  `json:"user"`
+	GrantedAt int64 `json:"granted_at"`
+	// IsCoStreamer は、共同配信リクエストの承認によって追加されたかどうか
+	IsCoStreamer bool `json:"is_co_streamer"`
+}
+
+type PostModeratorRequest struct {
+	UserID int64 `json:"user_id"`
+}
+
+// 共同モデレーター一覧取得API (配信者のみ)
+// GET /api/livestream/:livestream_id/moderators
+func getModeratorsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	if err := verifyLivestreamOwner(ctx, dbConn, int64(livestreamID), userID); err != nil {
+		return err
+	}
+
+	var moderatorModels []LivestreamModeratorModel
+	if err := dbConn.SelectContext(ctx, &moderatorModels, "SELECT * FROM livestream_moderators WHERE livestream_id = ? ORDER BY granted_at ASC", livestreamID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get moderators: "+err.Error())
+	}
+	if len(moderatorModels) == 0 {
+		return c.JSON(http.StatusOK, []LivestreamModerator{})
+	}
+
+	userIDs := make([]int64, len(moderatorModels))
+	for i := range moderatorModels {
+		userIDs[i] = moderatorModels[i].UserID
+	}
+	query, params, err := sqlx.In("SELECT * FROM users WHERE id IN (?)", userIDs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to construct IN query: "+err.Error())
+	}
+	var userModels []UserModel
+	if err := dbConn.SelectContext(ctx, &userModels, query, params...); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get users: "+err.Error())
+	}
+	users, err := fillUsersResponseWithoutTx(ctx, userModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill users: "+err.Error())
+	}
+	userMap := make(map[int64]User, len(users))
+	for i := range users {
+		userMap[users[i].ID] = users[i]
+	}
+
+	moderators := make([]LivestreamModerator, 0, len(moderatorModels))
+	for i := range moderatorModels {
+		user, ok := userMap[moderatorModels[i].UserID]
+		if !ok {
+			continue
+		}
+		moderators = append(moderators, LivestreamModerator{
+			User:         user,
+			GrantedAt:    moderatorModels[i].GrantedAt,
+			IsCoStreamer: moderatorModels[i].IsCoStreamer,
+		})
+	}
+
+	return c.JSON(http.StatusOK, moderators)
+}
+
+// 共同モデレーター追加API (配信者のみ)
+// POST /api/livestream/:livestream_id/moderators
+func postModeratorHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PostModeratorRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if req.UserID == userID {
+		return echo.NewHTTPError(http.StatusBadRequest, "the owner of the livestream can't be a moderator")
+	}
+
+	tx, err := dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := verifyLivestreamOwner(ctx, tx, int64(livestreamID), userID); err != nil {
+		return err
+	}
+
+	userModel := UserModel{}
+	if err := tx.GetContext(ctx, &userModel, "SELECT * FROM users WHERE id = ?", req.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "not found user that has the given id")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
+	}
+
+	moderatorModel := LivestreamModeratorModel{
+		LivestreamID: int64(livestreamID),
+		UserID:       req.UserID,
+		GrantedAt:    time.Now().Unix(),
+	}
+	if _, err := tx.NamedExecContext(ctx, "INSERT INTO livestream_moderators (livestream_id, user_id, granted_at) VALUES (:livestream_id, :user_id, :granted_at) ON DUPLICATE KEY UPDATE granted_at = granted_at", moderatorModel); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert moderator: "+err.Error())
+	}
+	if err := logAudit(ctx, tx, userID, AuditActionGrantModerator, req.UserID, map[string]int64{"livestream_id": int64(livestreamID)}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert audit log: "+err.Error())
+	}
+
+	user, err := fillUserResponse(ctx, tx, userModel, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill user: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, LivestreamModerator{
+		User:      user,
+		GrantedAt: moderatorModel.GrantedAt,
+	})
+}
+
+// 共同モデレーター削除API (配信者のみ)
+// DELETE /api/livestream/:livestream_id/moderators/:user_id
+func deleteModeratorHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+	moderatorUserID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "user_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	tx, err := dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := verifyLivestreamOwner(ctx, tx, int64(livestreamID), userID); err != nil {
+		return err
+	}
+
+	rs, err := tx.ExecContext(ctx, "DELETE FROM livestream_moderators WHERE livestream_id = ? AND user_id = ?", livestreamID, moderatorUserID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete moderator: "+err.Error())
+	}
+	if n, err := rs.RowsAffected(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get affected rows: "+err.Error())
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "not found moderator that has the given user_id")
+	}
+	if err := logAudit(ctx, tx, userID, AuditActionRevokeModerator, int64(moderatorUserID), map[string]int64{"livestream_id": int64(livestreamID)}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert audit log: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// verifyLivestreamOwner は、配信が存在しuserIDの配信者が所有していることを検証する
+// echo.NewHTTPErrorを返すので、呼び出し側ではそのまま返せば良い
+func verifyLivestreamOwner(ctx context.Context, q sqlx.QueryerContext, livestreamID, userID int64) error {
+	var ownerID int64
+	if err := sqlx.GetContext(ctx, q, &ownerID, "SELECT user_id FROM livestreams WHERE id = ?", livestreamID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+	if ownerID != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "only the owner of the livestream can manage moderators")
+	}
+	return nil
+}
+
+// isLivestreamModerator は、userIDのユーザが配信の共同モデレーターであるかを返す
+func isLivestreamModerator(ctx context.Context, q sqlx.QueryerContext, livestreamID, userID int64) (bool, error) {
+	var count int64
+	if err := sqlx.GetContext(ctx, q, &count, "SELECT COUNT(*) FROM livestream_moderators WHERE livestream_id = ? AND user_id = ?", livestreamID, userID); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
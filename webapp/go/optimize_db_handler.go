@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+const optimizeDBTimeout = 5 * time.Minute
+
+// ベンチマークの初期データ投入で統計情報が古くなりやすいテーブル
+var optimizeDBTables = []string{
+	"livestreams",
+	"users",
+	"reactions",
+	"livecomments",
+	"livestream_viewers_history",
+	"reservation_slots",
+}
+
+// OptimizeResult は、統計情報更新の実行結果
+// 実行中はCompletedAtが0
+type OptimizeResult struct {
+	StartedAt      int64    `json:"started_at"`
+	CompletedAt    int64    `json:"completed_at"`
+	TablesAnalyzed []string `json:"tables_analyzed"`
+	Error          string   `json:"error"`
+}
+
+var (
+	// 最後に実行した統計情報更新の結果 (OptimizeResult)
+	optimizeDBResult  atomic.Value
+	optimizeDBRunning atomic.Bool
+)
+
+// analyzeTableResult は、ANALYZE TABLEが返す1行
+type analyzeTableResult struct {
+	Table   string `db:"Table"`
+	Op      string `db:"Op"`
+	MsgType string `db:"Msg_type"`
+	MsgText string `db:"Msg_text"`
+}
+
+// テーブル統計情報更新API (管理者のみ)
+// POST /api/admin/optimize-db
+// 統計情報の更新はバックグラウンドで行い、結果はGET /api/admin/optimize-db/statusで確認する
+func postOptimizeDBHandler(c echo.Context) error {
+	if !optimizeDBRunning.CompareAndSwap(false, true) {
+		return echo.NewHTTPError(http.StatusConflict, "optimize-db is already running")
+	}
+
+	result := OptimizeResult{
+		StartedAt:      time.Now().Unix(),
+		TablesAnalyzed: []string{},
+	}
+	optimizeDBResult.Store(result)
+
+	go func() {
+		defer optimizeDBRunning.Store(false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), optimizeDBTimeout)
+		defer cancel()
+
+		result := runOptimizeDB(ctx, dbConn, optimizeDBTables, result)
+		if result.Error != "" {
+			log.Printf("failed to optimize db: %s", result.Error)
+		}
+		optimizeDBResult.Store(result)
+	}()
+
+	return c.JSON(http.StatusAccepted, result)
+}
+
+// テーブル統計情報更新の状況取得API (管理者のみ)
+// GET /api/admin/optimize-db/status
+func getOptimizeDBStatusHandler(c echo.Context) error {
+	result, ok := optimizeDBResult.Load().(OptimizeResult)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "optimize-db has never been run")
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// runOptimizeDB は、テーブルごとに順にANALYZE TABLEを実行し、完了したテーブルをresultに記録して返す
+// 失敗した時点で残りのテーブルは実行しない
+func runOptimizeDB(ctx context.Context, db *sqlx.DB, tables []string, result OptimizeResult) OptimizeResult {
+	for _, table := range tables {
+		if err := analyzeTable(ctx, db, table); err != nil {
+			result.Error = fmt.Sprintf("failed to analyze %s: %v", table, err)
+			break
+		}
+		result.TablesAnalyzed = append(result.TablesAnalyzed, table)
+	}
+	result.CompletedAt = time.Now().Unix()
+	return result
+}
+
+func analyzeTable(ctx context.Context, db *sqlx.DB, table string) error {
+	var rows []analyzeTableResult
+	if err := db.SelectContext(ctx, &rows, "ANALYZE TABLE `"+table+"`"); err != nil {
+		return err
+	}
+	// テーブルが存在しない場合などはエラーにならず、Msg_typeがerrorの行が返る
+	for _, row := range rows {
+		if strings.EqualFold(row.MsgType, "error") {
+			return errors.New(row.MsgText)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeAnalyzeDB は、ANALYZE TABLEの結果を返し、実行したテーブルを記録するfakeDB
+type fakeAnalyzeDB struct {
+	*fakeDB
+
+	// このテーブルにはMsg_typeがerrorの行を返す
+	failTable string
+
+	analyzed []string
+}
+
+func newFakeAnalyzeDB(t *testing.T, d *fakeAnalyzeDB) *sqlx.DB {
+	d.fakeDB = &fakeDB{}
+	d.onQuery("ANALYZE TABLE ", func(query string, _ []driver.Value) (driver.Rows, error) {
+		table := strings.Trim(strings.TrimPrefix(query, "ANALYZE TABLE "), "`")
+		d.analyzed = append(d.analyzed, table)
+
+		msgType, msgText := "status", "OK"
+		if table == d.failTable {
+			msgType, msgText = "Error", "Table 'isupipe."+table+"' doesn't exist"
+		}
+		return &fakeRows{
+			columns: []string{"Table", "Op", "Msg_type", "Msg_text"},
+			values:  [][]driver.Value{{"isupipe." + table, "analyze", msgType, msgText}},
+		}, nil
+	})
+	return d.open(t)
+}
+
+func TestRunOptimizeDB(t *testing.T) {
+	d := &fakeAnalyzeDB{}
+	db := newFakeAnalyzeDB(t, d)
+
+	result := runOptimizeDB(context.Background(), db, optimizeDBTables, OptimizeResult{StartedAt: 1, TablesAnalyzed: []string{}})
+	if result.Error != "" {
+		t.Fatalf("unexpected error: %s", result.Error)
+	}
+	if !slices.Equal(result.TablesAnalyzed, optimizeDBTables) || !slices.Equal(d.analyzed, optimizeDBTables) {
+		t.Errorf("tables analyzed = %v (executed %v), want %v", result.TablesAnalyzed, d.analyzed, optimizeDBTables)
+	}
+	if result.StartedAt != 1 || result.CompletedAt == 0 {
+		t.Errorf("result = %+v, want StartedAt kept and CompletedAt set", result)
+	}
+}
+
+func TestRunOptimizeDB_StopsOnError(t *testing.T) {
+	d := &fakeAnalyzeDB{failTable: "reactions"}
+	db := newFakeAnalyzeDB(t, d)
+
+	result := runOptimizeDB(context.Background(), db, optimizeDBTables, OptimizeResult{TablesAnalyzed: []string{}})
+	if !strings.Contains(result.Error, "reactions") {
+		t.Errorf("error = %q, want it to mention the failed table", result.Error)
+	}
+	// 失敗したテーブル以降は実行しない
+	if want := []string{"livestreams", "users"}; !slices.Equal(result.TablesAnalyzed, want) {
+		t.Errorf("tables analyzed = %v, want %v", result.TablesAnalyzed, want)
+	}
+	if want := []string{"livestreams", "users", "reactions"}; !slices.Equal(d.analyzed, want) {
+		t.Errorf("executed = %v, want %v", d.analyzed, want)
+	}
+}
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	orig := adminSecret
+	t.Cleanup(func() { adminSecret = orig })
+
+	e := echo.New()
+	e.GET("/api/admin/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, AdminAuthMiddleware())
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		want   int
+	}{
+		{name: "match", secret: "s3cret", header: "s3cret", want: http.StatusOK},
+		{name: "mismatch", secret: "s3cret", header: "wrong", want: http.StatusForbidden},
+		{name: "missing header", secret: "s3cret", header: "", want: http.StatusForbidden},
+		// シークレット未設定の場合、空のヘッダでも通さない
+		{name: "secret not configured", secret: "", header: "", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adminSecret = tt.secret
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/test", nil)
+			if tt.header != "" {
+				req.Header.Set(adminSecretHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
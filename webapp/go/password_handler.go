@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultSessionVersionKey は、ログイン時点のユーザのセッション世代
+// パスワード変更で世代が進むと、それより前に発行したセッションは使えなくなる
+const defaultSessionVersionKey = "SESSION_VERSION"
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// 他のサーバでパスワードが変更された場合も、この時間が経てばDBから読み直して古いセッションを無効にする
+const sessionVersionCacheTTL = 5 * time.Second
+
+var sessionVersions = &SessionVersionCache{}
+
+type sessionVersionEntry struct {
+	value      int64
+	expiration time.Time
+}
+
+// SessionVersionCache は、ユーザIDごとのセッション世代 (user_session_versions) を保持する
+type SessionVersionCache struct {
+	data sync.Map
+}
+
+func (m *SessionVersionCache) Set(key int64, version int64, ttl time.Duration) {
+	m.data.Store(key, sessionVersionEntry{
+		value:      version,
+		expiration: time.Now().Add(ttl),
+	})
+}
+
+func (m *SessionVersionCache) Get(key int64) (int64, bool) {
+	v, ok := m.data.Load(key)
+	if !ok {
+		return 0, false
+	}
+
+	e := v.(sessionVersionEntry)
+	if time.Now().After(e.expiration) {
+		// 有効期限切れの場合は削除
+		m.data.Delete(key)
+		return 0, false
+	}
+	return e.value, true
+}
+
+func (m *SessionVersionCache) Delete(key int64) {
+	m.data.Delete(key)
+}
+
+func (m *SessionVersionCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+}
+
+// getSessionVersion は、ユーザの現在のセッション世代を返す
+// パスワードを一度も変更していないユーザは0
+func getSessionVersion(ctx context.Context, userID int64) (int64, error) {
+	if version, ok := sessionVersions.Get(userID); ok {
+		return version, nil
+	}
+
+	var version int64
+	if err := dbConn.GetContext(ctx, &version, "SELECT version FROM user_session_versions WHERE user_id = ?", userID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	sessionVersions.Set(userID, version, sessionVersionCacheTTL)
+
+	return version, nil
+}
+
+// パスワード変更API
+// POST /api/user/me/password
+// 変更前に発行した他のセッションは無効になる (このリクエストのセッションは引き続き使える)
+func changePasswordHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if req.NewPassword == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "new_password must not be empty")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcryptDefaultCost)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate hashed password: "+err.Error())
+	}
+
+	version, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (int64, error) {
+		var currentPassword string
+		if err := tx.GetContext(ctx, &currentPassword, "SELECT password FROM users WHERE id = ? FOR UPDATE", userID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error()).SetInternal(err)
+		}
+
+		err := bcrypt.CompareHashAndPassword([]byte(currentPassword), []byte(req.OldPassword))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return 0, echo.NewHTTPError(http.StatusUnauthorized, "invalid old password")
+		}
+		if err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to compare hash and password: "+err.Error())
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET password = ? WHERE id = ?", string(hashedPassword), userID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to update password: "+err.Error()).SetInternal(err)
+		}
+
+		// 既存のセッションを無効にするため、セッション世代を進める
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_session_versions (user_id, version) VALUES (?, 1) ON DUPLICATE KEY UPDATE version = version + 1", userID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to update session version: "+err.Error()).SetInternal(err)
+		}
+		var version int64
+		if err := tx.GetContext(ctx, &version, "SELECT version FROM user_session_versions WHERE user_id = ?", userID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get session version: "+err.Error()).SetInternal(err)
+		}
+
+		if err := logAudit(ctx, tx, userID, AuditActionChangePassword, userID, nil); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert audit log: "+err.Error()).SetInternal(err)
+		}
+		return version, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+	sessionVersions.Set(userID, version, sessionVersionCacheTTL)
+
+	sess.Values[defaultSessionVersionKey] = version
+	if err := sess.Save(c.Request(), c.Response()); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save session: "+err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// useSessionVersion は、DBを引かずに済むようユーザのセッション世代をキャッシュに載せる
+func useSessionVersion(tb testing.TB, userID, version int64) {
+	sessionVersions.Set(userID, version, time.Hour)
+	tb.Cleanup(func() {
+		sessionVersions.Delete(userID)
+	})
+}
+
+// fakePasswordDB は、usersのパスワードとuser_session_versionsだけを持つfakeDB
+type fakePasswordDB struct {
+	*fakeDB
+
+	password string
+	version  int64
+}
+
+func useFakePasswordDB(tb testing.TB, d *fakePasswordDB) {
+	d.fakeDB = &fakeDB{}
+	d.onQuery("SELECT password FROM users", func(string, []driver.Value) (driver.Rows, error) {
+		return fakeValue("password", d.password), nil
+	})
+	d.onQuery("SELECT version FROM user_session_versions", func(string, []driver.Value) (driver.Rows, error) {
+		return fakeValue("version", d.version), nil
+	})
+	d.onExec("UPDATE users SET password", func(_ string, args []driver.Value) (driver.Result, error) {
+		d.password = args[0].(string)
+		return driver.RowsAffected(1), nil
+	})
+	d.onExec("INSERT INTO user_session_versions", func(string, []driver.Value) (driver.Result, error) {
+		d.version++
+		return driver.RowsAffected(1), nil
+	})
+	d.onExec("", fakeExecOK)
+	useFakeDB(tb, d.fakeDB)
+}
+
+func TestChangePasswordHandler(t *testing.T) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &fakePasswordDB{password: string(hashed)}
+	useFakePasswordDB(t, d)
+	useSessionVersion(t, 1, 0)
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	e.POST("/login", func(c echo.Context) error {
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultSessionIDKey] = uuid.NewString()
+		sess.Values[defaultUserIDKey] = int64(1)
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+		if err := sess.Save(c.Request(), c.Response()); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	e.POST("/api/user/me/password", changePasswordHandler)
+	e.GET("/me", func(c echo.Context) error {
+		if err := verifyUserSession(c); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	do := func(method, path, cookie, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	login := func() string {
+		rec := do(http.MethodPost, "/login", "", "")
+		cookies := rec.Result().Cookies()
+		if len(cookies) == 0 {
+			t.Fatal("login did not set a session cookie")
+		}
+		return cookies[0].Name + "=" + cookies[0].Value
+	}
+
+	current := login()
+	other := login()
+
+	// 現在のパスワードが違えば変更しない
+	rec := do(http.MethodPost, "/api/user/me/password", current, `{"old_password":"wrong","new_password":"new-password"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong old password: status = %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body.String())
+	}
+	if execs := d.execQueries(); len(execs) != 0 {
+		t.Fatalf("wrong old password issued writes: %v", execs)
+	}
+
+	rec = do(http.MethodPost, "/api/user/me/password", current, `{"old_password":"old-password","new_password":"new-password"}`)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body.String())
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(d.password), []byte("new-password")); err != nil {
+		t.Errorf("stored password does not match the new password: %v", err)
+	}
+	if n := d.queriesWithPrefix("INSERT INTO audit_log "); n != 1 {
+		t.Errorf("audit logs written = %d, want 1", n)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) > 0 {
+		current = cookies[0].Name + "=" + cookies[0].Value
+	}
+
+	// 変更したセッションは使い続けられるが、他のセッションは無効になる
+	if rec := do(http.MethodGet, "/me", current, ""); rec.Code != http.StatusOK {
+		t.Errorf("current session: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := do(http.MethodGet, "/me", other, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("other session: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestGetSessionVersion_ReloadsAfterExpiry(t *testing.T) {
+	// 他のサーバでパスワードが変更され、DB上の世代が進んでいる
+	d := &fakePasswordDB{version: 3}
+	useFakePasswordDB(t, d)
+	sessionVersions.Set(1, 2, -time.Second)
+	t.Cleanup(func() { sessionVersions.Delete(1) })
+
+	version, err := getSessionVersion(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != 3 {
+		t.Errorf("version = %d, want 3", version)
+	}
+	if n := d.queriesWithPrefix("SELECT version FROM user_session_versions"); n != 1 {
+		t.Errorf("queries = %d, want 1", n)
+	}
+}
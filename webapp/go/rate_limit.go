@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ログイン・ユーザ登録の試行回数の上限 (環境変数LOGIN_RATE_LIMIT_MAXで設定する)
+// ベンチマーカーは同じホストから大量にログインするため、未設定の場合は制限しない
+var loginRateLimitMax = 0
+
+// 試行回数を数える期間 (環境変数LOGIN_RATE_LIMIT_WINDOWで変更できる)
+var loginRateLimitWindow = 1 * time.Minute
+
+func init() {
+	if v, ok := os.LookupEnv("LOGIN_RATE_LIMIT_MAX"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("failed to parse environment variable 'LOGIN_RATE_LIMIT_MAX' as positive integer: %s", v)
+		}
+		loginRateLimitMax = n
+	}
+
+	window, err := positiveDurationFromEnv("LOGIN_RATE_LIMIT_WINDOW", loginRateLimitWindow)
+	if err != nil {
+		log.Fatalf("failed to parse environment variable 'LOGIN_RATE_LIMIT_WINDOW' as positive duration: %v", err)
+	}
+	loginRateLimitWindow = window
+}
+
+// ipExtractor は、c.RealIP()でクライアントのIPを取り出す方法
+// nginxが付けるX-Forwarded-Forを、信頼できる送信元 (ループバック・プライベート・リンクローカル) から届いた分だけ辿る
+// 直接届いたリクエストのX-Forwarded-Forは信頼しないので、詐称してレート制限を回避することはできない
+var ipExtractor = echo.ExtractIPFromXFFHeader()
+
+// rateLimiter は、キー (リモートIP) ごとにwindowの間の試行回数を数える
+type rateLimiter struct {
+	maxAttempts int
+	window      time.Duration
+	entries     sync.Map
+}
+
+type rateLimitEntry struct {
+	mu      sync.Mutex
+	count   int
+	resetAt time.Time
+}
+
+func newRateLimiter(maxAttempts int, window time.Duration) *rateLimiter {
+	return &rateLimiter{maxAttempts: maxAttempts, window: window}
+}
+
+// allow は、試行を1回数え、上限以内であればtrueを返す
+// 上限を超えた場合は、次に試行できるまでの時間を返す
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	v, _ := l.entries.LoadOrStore(key, &rateLimitEntry{resetAt: now.Add(l.window)})
+	e := v.(*rateLimitEntry)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !now.Before(e.resetAt) {
+		e.count = 0
+		e.resetAt = now.Add(l.window)
+	}
+	e.count++
+	if e.count > l.maxAttempts {
+		return false, e.resetAt.Sub(now)
+	}
+	return true, 0
+}
+
+// cleanup は、期間が過ぎたエントリを削除する
+func (l *rateLimiter) cleanup(now time.Time) {
+	l.entries.Range(func(key, value interface{}) bool {
+		e := value.(*rateLimitEntry)
+		e.mu.Lock()
+		expired := !now.Before(e.resetAt)
+		e.mu.Unlock()
+		if expired {
+			l.entries.Delete(key)
+		}
+		return true
+	})
+}
+
+func (l *rateLimiter) runCleanup() {
+	ticker := time.NewTicker(l.window)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		l.cleanup(now)
+	}
+}
+
+// rateLimitMiddleware は、同じIPからwindowの間にmaxAttemptsを超えて試行されたリクエストを429で拒否する
+// maxAttemptsが0以下の場合は制限しない
+func rateLimitMiddleware(maxAttempts int, window time.Duration) echo.MiddlewareFunc {
+	if maxAttempts <= 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+
+	limiter := newRateLimiter(maxAttempts, window)
+	go limiter.runCleanup()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if ok, retryAfter := limiter.allow(c.RealIP(), time.Now()); !ok {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "too many attempts")
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	const maxAttempts = 3
+	tests := []struct {
+		name       string
+		attempts   int
+		wantStatus int
+	}{
+		{name: "under limit", attempts: maxAttempts - 1, wantStatus: http.StatusOK},
+		{name: "exactly at limit", attempts: maxAttempts, wantStatus: http.StatusOK},
+		{name: "over limit", attempts: maxAttempts + 1, wantStatus: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			limit := rateLimitMiddleware(maxAttempts, time.Minute)
+			e.POST("/api/login", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, limit)
+			e.POST("/api/register", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, limit)
+
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < tt.attempts; i++ {
+				// ログインとユーザ登録の試行は合わせて数える
+				path := "/api/login"
+				if i%2 == 1 {
+					path = "/api/register"
+				}
+				req := httptest.NewRequest(http.MethodPost, path, nil)
+				req.RemoteAddr = "192.0.2.1:1234"
+				rec = httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status of attempt %d = %d, want %d", tt.attempts, rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests {
+				if got := rec.Header().Get("Retry-After"); got != "60" {
+					t.Errorf("Retry-After = %q, want 60", got)
+				}
+
+				// 他のIPからの試行は制限しない
+				req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+				req.RemoteAddr = "192.0.2.2:1234"
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK {
+					t.Errorf("status from another ip = %d, want %d", rec.Code, http.StatusOK)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiter_WindowExpires(t *testing.T) {
+	l := newRateLimiter(1, time.Minute)
+	now := time.Now()
+
+	if ok, _ := l.allow("192.0.2.1", now); !ok {
+		t.Fatal("first attempt was rejected")
+	}
+	if ok, retryAfter := l.allow("192.0.2.1", now.Add(10*time.Second)); ok || retryAfter != 50*time.Second {
+		t.Fatalf("second attempt = %v, %s, want false, 50s", ok, retryAfter)
+	}
+
+	l.cleanup(now.Add(time.Minute))
+	if _, ok := l.entries.Load("192.0.2.1"); ok {
+		t.Error("expired entry was not cleaned up")
+	}
+	if ok, _ := l.allow("192.0.2.1", now.Add(time.Minute)); !ok {
+		t.Error("attempt after the window was rejected")
+	}
+}
+
+func TestRateLimitMiddleware_IgnoresSpoofedForwardedFor(t *testing.T) {
+	e := echo.New()
+	e.IPExtractor = ipExtractor
+	e.POST("/api/login", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, rateLimitMiddleware(1, time.Minute))
+
+	login := func(remoteAddr, xff string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		req.RemoteAddr = remoteAddr
+		if xff != "" {
+			req.Header.Set(echo.HeaderXForwardedFor, xff)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := login("192.0.2.1:1234", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("status of first attempt = %d, want %d", code, http.StatusOK)
+	}
+	// 直接届いたリクエストのX-Forwarded-Forを変えても、同じIPとして数える
+	if code := login("192.0.2.1:1234", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("status with spoofed X-Forwarded-For = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// nginx (ループバック) 経由のリクエストは、nginxが付けたクライアントのIPで数える
+	if code := login("127.0.0.1:1234", "192.0.2.1, 203.0.113.1"); code != http.StatusOK {
+		t.Errorf("status via proxy = %d, want %d", code, http.StatusOK)
+	}
+	if code := login("127.0.0.1:1234", "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Errorf("status of second attempt via proxy = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
@@ -2,12 +2,18 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/goccy/go-json"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo-contrib/session"
@@ -20,6 +26,8 @@ type ReactionModel struct {
 	UserID       int64  `db:"user_id"`
 	LivestreamID int64  `db:"livestream_id"`
 	CreatedAt    int64  `db:"created_at"`
+	// LOWER(emoji_name)から生成されるカラム (読み取り専用)
+	EmojiNameNormalized string `db:"emoji_name_normalized"`
 }
 
 type Reaction struct {
@@ -34,6 +42,122 @@ type PostReactionRequest struct {
 	EmojiName string `json:"emoji_name"`
 }
 
+// 1ユーザが1配信に対して付けられる絵文字の種類数の上限
+var maxReactionsPerUserPerStream = 10
+
+const reactionEmojiCacheTTL = 30 * time.Second
+
+const reactionSummaryCacheTTL = 5 * time.Second
+
+const (
+	defaultReactionEventsLimit = 50
+	maxReactionEventsLimit     = 100
+)
+
+// 同じユーザが同じ配信に同じ絵文字でリアクションした場合の扱い (環境変数REACTION_DEDUP_MODEで設定する)
+// reactions に UNIQUE KEY (user_id, livestream_id, emoji_name_normalized) を追加した上で有効にする (init.sqlを参照)
+const (
+	// 重複を許す (既定)
+	reactionDedupOff = "off"
+	// 409を返す
+	reactionDedupReject = "reject"
+	// 既存のリアクションを返し、何もしない
+	reactionDedupIgnore = "ignore"
+)
+
+var reactionDedupMode = reactionDedupOff
+
+// MySQLの一意制約違反のエラー番号 (ER_DUP_ENTRY)
+const mysqlErrDupEntry = 1062
+
+func init() {
+	if v, ok := os.LookupEnv("MAX_REACTIONS_PER_USER_PER_STREAM"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("failed to parse environment variable 'MAX_REACTIONS_PER_USER_PER_STREAM' as positive integer: %s", v)
+		}
+		maxReactionsPerUserPerStream = n
+	}
+
+	if v, ok := os.LookupEnv("REACTION_DEDUP_MODE"); ok {
+		switch v {
+		case reactionDedupOff, reactionDedupReject, reactionDedupIgnore:
+			reactionDedupMode = v
+		default:
+			log.Fatalf("environment variable 'REACTION_DEDUP_MODE' must be one of off, reject or ignore: %s", v)
+		}
+	}
+}
+
+var reactionEmojiCache = &ReactionEmojiCache{}
+
+type reactionEmojiKey struct {
+	UserID       int64
+	LivestreamID int64
+}
+
+type reactionEmojiEntry struct {
+	emojis     map[string]struct{}
+	expiration time.Time
+}
+
+// ReactionEmojiCache は、ユーザが配信に付けた絵文字の種類を保持する
+// 保持しているmapは書き換えず、更新時はコピーを作って差し替える
+type ReactionEmojiCache struct {
+	data sync.Map
+}
+
+func (m *ReactionEmojiCache) Set(userID, livestreamID int64, emojis map[string]struct{}, ttl time.Duration) {
+	m.data.Store(reactionEmojiKey{UserID: userID, LivestreamID: livestreamID}, reactionEmojiEntry{
+		emojis:     emojis,
+		expiration: time.Now().Add(jitteredTTL(ttl)),
+	})
+}
+
+func (m *ReactionEmojiCache) Get(userID, livestreamID int64) (map[string]struct{}, bool) {
+	key := reactionEmojiKey{UserID: userID, LivestreamID: livestreamID}
+	v, ok := m.data.Load(key)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(reactionEmojiEntry)
+	if time.Now().After(e.expiration) {
+		m.data.Delete(key)
+		return nil, false
+	}
+	return e.emojis, true
+}
+
+func (m *ReactionEmojiCache) Delete(userID, livestreamID int64) {
+	m.data.Delete(reactionEmojiKey{UserID: userID, LivestreamID: livestreamID})
+}
+
+func (m *ReactionEmojiCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+}
+
+func getReactedEmojis(ctx context.Context, userID, livestreamID int64) (map[string]struct{}, error) {
+	if emojis, ok := reactionEmojiCache.Get(userID, livestreamID); ok {
+		return emojis, nil
+	}
+
+	var emojiNames []string
+	if err := dbConn.SelectContext(ctx, &emojiNames, "SELECT DISTINCT emoji_name_normalized FROM reactions WHERE livestream_id = ? AND user_id = ?", livestreamID, userID); err != nil {
+		return nil, err
+	}
+	emojis := make(map[string]struct{}, len(emojiNames))
+	for _, name := range emojiNames {
+		emojis[name] = struct{}{}
+	}
+	reactionEmojiCache.Set(userID, livestreamID, emojis, reactionEmojiCacheTTL)
+
+	return emojis, nil
+}
+
 func getReactionsHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 
@@ -61,57 +185,180 @@ func getReactionsHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusNotFound, "failed to get reactions")
 	}
 
-	reactionUserIDs := make([]int64, len(reactionModels))
-	for i := range reactionModels {
-		reactionUserIDs[i] = reactionModels[i].UserID
-	}
-
-	if len(reactionUserIDs) == 0 {
+	if len(reactionModels) == 0 {
 		return c.JSON(http.StatusOK, []Reaction{})
 	}
 
-	sql, params, err := sqlx.In(`SELECT * FROM users WHERE id IN (?)`, reactionUserIDs)
-	if err != nil {
-		log.Fatal(err)
+	livestreamModel := LivestreamModel{}
+	if err := dbConn.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", livestreamID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill reaction: "+err.Error())
 	}
-	userModels := []UserModel{}
-	dbConn.SelectContext(ctx, &userModels, sql, params...)
+	livestream, err := fillLivestreamResponseWithoutTx(ctx, livestreamModel)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill reaction: "+err.Error())
 	}
 
-	users, err := fillUsersResponseWithoutTx(ctx, userModels)
+	reactions, err := fillReactionsResponseWithoutTx(ctx, reactionModels, livestream)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill reaction: "+err.Error())
 	}
-	userMap := make(map[int64]User)
-	for i, user := range users {
-		userMap[userModels[i].ID] = user
+
+	return c.JSON(http.StatusOK, reactions)
+}
+
+// リアクション一覧取得API (「誰がリアクションしたか」の表示用)
+// GET /api/livestream/:livestream_id/reactions
+func getReactionEventsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	limit := defaultReactionEventsLimit
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxReactionEventsLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit query parameter must be integer between 1 and %d", maxReactionEventsLimit))
+		}
+	}
+
+	// cursorより小さいIDのリアクションを返す
+	// 次のページは最後のリアクションのIDをcursorに指定して取得する
+	query := "SELECT * FROM reactions WHERE livestream_id = ?"
+	args := []any{livestreamID}
+	if v := c.QueryParam("cursor"); v != "" {
+		cursor, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "cursor query parameter must be integer")
+		}
+		query += " AND id < ?"
+		args = append(args, cursor)
+	}
+	if emoji := c.QueryParam("emoji"); emoji != "" {
+		query += " AND emoji_name = ?"
+		args = append(args, emoji)
 	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
 
 	livestreamModel := LivestreamModel{}
 	if err := dbConn.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", livestreamID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill reaction: "+err.Error())
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+	}
+
+	reactionModels := []ReactionModel{}
+	if err := dbConn.SelectContext(ctx, &reactionModels, query, args...); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reactions: "+err.Error())
+	}
+	if len(reactionModels) == 0 {
+		return c.JSON(http.StatusOK, []Reaction{})
 	}
+
 	livestream, err := fillLivestreamResponseWithoutTx(ctx, livestreamModel)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill reaction: "+err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error())
+	}
+	reactions, err := fillReactionsResponseWithoutTx(ctx, reactionModels, livestream)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill reactions: "+err.Error())
 	}
 
-	reactions := make([]Reaction, len(reactionModels))
-	for i := range reactionModels {
-		user := userMap[reactionModels[i].UserID]
+	return c.JSON(http.StatusOK, reactions)
+}
 
-		reactions[i] = Reaction{
-			ID:         reactionModels[i].ID,
-			EmojiName:  reactionModels[i].EmojiName,
-			User:       user,
-			Livestream: livestream,
-			CreatedAt:  reactionModels[i].CreatedAt,
+// ReactionSummary は、配信に付けられた絵文字ごとのリアクション数
+type ReactionSummary struct {
+	EmojiName string `json:"emoji_name" db:"emoji_name"`
+	Count     int64  `json:"count" db:"count"`
+}
+
+var reactionSummaryCache = &ReactionSummaryCache{}
+
+type reactionSummaryEntry struct {
+	summaries  []ReactionSummary
+	expiration time.Time
+}
+
+// ReactionSummaryCache は、配信ごとの絵文字別リアクション数を保持する
+type ReactionSummaryCache struct {
+	data sync.Map
+}
+
+func (m *ReactionSummaryCache) Set(livestreamID int64, summaries []ReactionSummary, ttl time.Duration) {
+	m.data.Store(livestreamID, reactionSummaryEntry{
+		summaries:  summaries,
+		expiration: time.Now().Add(jitteredTTL(ttl)),
+	})
+}
+
+func (m *ReactionSummaryCache) Get(livestreamID int64) ([]ReactionSummary, bool) {
+	v, ok := m.data.Load(livestreamID)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(reactionSummaryEntry)
+	if time.Now().After(e.expiration) {
+		m.data.Delete(livestreamID)
+		return nil, false
+	}
+	return e.summaries, true
+}
+
+func (m *ReactionSummaryCache) Delete(livestreamID int64) {
+	m.data.Delete(livestreamID)
+}
+
+func (m *ReactionSummaryCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+}
+
+// リアクション集計取得API
+// 埋め込みウィジェットから表示できるよう、ログインは不要
+// GET /api/livestream/:livestream_id/reactions/summary
+func getReactionSummaryHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	livestreamID, err := strconv.ParseInt(c.Param("livestream_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	if summaries, ok := reactionSummaryCache.Get(livestreamID); ok {
+		return c.JSON(http.StatusOK, summaries)
+	}
+
+	// HeartとheartのようなAPIからの表記揺れは同じ絵文字として数える
+	summaries := []ReactionSummary{}
+	query := "SELECT emoji_name_normalized AS emoji_name, COUNT(*) AS count FROM reactions WHERE livestream_id = ? GROUP BY emoji_name_normalized ORDER BY count DESC, emoji_name ASC"
+	if err := dbConn.SelectContext(ctx, &summaries, query, livestreamID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get reaction summary: "+err.Error())
+	}
+	if len(summaries) == 0 {
+		var count int64
+		if err := dbConn.GetContext(ctx, &count, "SELECT COUNT(*) FROM livestreams WHERE id = ?", livestreamID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+		}
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "livestream not found")
 		}
 	}
+	reactionSummaryCache.Set(livestreamID, summaries, reactionSummaryCacheTTL)
 
-	return c.JSON(http.StatusOK, reactions)
+	return c.JSON(http.StatusOK, summaries)
 }
 
 func postReactionHandler(c echo.Context) error {
@@ -135,6 +382,18 @@ func postReactionHandler(c echo.Context) error {
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
 	}
+	// HeartとheartのようなAPIからの表記揺れは同じ絵文字として扱う
+	req.EmojiName = strings.ToLower(req.EmojiName)
+
+	// 同じ配信に付けられる絵文字の種類数を制限する
+	emojis, err := getReactedEmojis(ctx, userID, int64(livestreamID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count reactions: "+err.Error())
+	}
+	_, reacted := emojis[req.EmojiName]
+	if !reacted && len(emojis) >= maxReactionsPerUserPerStream {
+		return echo.NewHTTPError(http.StatusTooManyRequests, "reaction limit reached for this stream")
+	}
 
 	tx, err := dbConn.BeginTxx(ctx, nil)
 	if err != nil {
@@ -142,24 +401,19 @@ func postReactionHandler(c echo.Context) error {
 	}
 	defer tx.Rollback()
 
-	reactionModel := ReactionModel{
+	reactionModel, created, err := insertReaction(ctx, tx, reactionDedupMode, ReactionModel{
 		UserID:       int64(userID),
 		LivestreamID: int64(livestreamID),
 		EmojiName:    req.EmojiName,
 		CreatedAt:    time.Now().Unix(),
+	})
+	if isDuplicateEntryError(err) {
+		return c.JSON(http.StatusConflict, &ErrorResponse{Error: "already reacted with this emoji"})
 	}
-
-	result, err := tx.NamedExecContext(ctx, "INSERT INTO reactions (user_id, livestream_id, emoji_name, created_at) VALUES (:user_id, :livestream_id, :emoji_name, :created_at)", reactionModel)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert reaction: "+err.Error())
 	}
 
-	reactionID, err := result.LastInsertId()
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted reaction id: "+err.Error())
-	}
-	reactionModel.ID = reactionID
-
 	reaction, err := fillReactionResponse(ctx, tx, reactionModel)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill reaction: "+err.Error())
@@ -169,15 +423,159 @@ func postReactionHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
 	}
 
+	// 重複したリアクションは何も変わっていないので、キャッシュの破棄や配信は行わない
+	if !created {
+		return c.JSON(http.StatusOK, reaction)
+	}
+
+	if !reacted {
+		newEmojis := make(map[string]struct{}, len(emojis)+1)
+		for name := range emojis {
+			newEmojis[name] = struct{}{}
+		}
+		newEmojis[req.EmojiName] = struct{}{}
+		reactionEmojiCache.Set(userID, int64(livestreamID), newEmojis, reactionEmojiCacheTTL)
+	}
+	invalidateLivestreamActivityCaches(reaction.Livestream.ID, reaction.Livestream.Owner.ID)
+	reactionBroadcasters.Publish(reaction.Livestream.ID, reaction)
+
 	return c.JSON(http.StatusCreated, reaction)
 }
 
+// リアクション取り消しAPI
+// DELETE /api/livestream/:livestream_id/reaction/:reaction_id
+func deleteReactionHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.ParseInt(c.Param("livestream_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+	reactionID, err := strconv.ParseInt(c.Param("reaction_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "reaction_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	ownerID, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (int64, error) {
+		var reactionModel ReactionModel
+		if err := tx.GetContext(ctx, &reactionModel, "SELECT * FROM reactions WHERE id = ? FOR UPDATE", reactionID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, echo.NewHTTPError(http.StatusNotFound, "reaction not found")
+			}
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get reaction: "+err.Error()).SetInternal(err)
+		}
+		if reactionModel.LivestreamID != livestreamID {
+			return 0, echo.NewHTTPError(http.StatusBadRequest, "reaction does not belong to the livestream")
+		}
+		if reactionModel.UserID != userID {
+			return 0, echo.NewHTTPError(http.StatusForbidden, "only the user who reacted can delete the reaction")
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM reactions WHERE id = ?", reactionID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete reaction: "+err.Error()).SetInternal(err)
+		}
+
+		var ownerID int64
+		if err := tx.GetContext(ctx, &ownerID, "SELECT user_id FROM livestreams WHERE id = ?", livestreamID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error()).SetInternal(err)
+		}
+		return ownerID, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+
+	reactionEmojiCache.Delete(userID, livestreamID)
+	reactionSummaryCache.Delete(livestreamID)
+	invalidateLivestreamActivityCaches(livestreamID, ownerID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// insertReaction は、リアクションを追加して採番したIDを埋めたモデルを返す
+// reactionDedupIgnoreの場合、同じ絵文字のリアクションが既にあれば追加せず、既存のリアクションとcreated=falseを返す
+// reactionDedupRejectの場合、一意制約違反のエラーをそのまま返す
+func insertReaction(ctx context.Context, tx *sqlx.Tx, mode string, reactionModel ReactionModel) (ReactionModel, bool, error) {
+	query := "INSERT INTO reactions (user_id, livestream_id, emoji_name, created_at) VALUES (:user_id, :livestream_id, :emoji_name, :created_at)"
+	if mode == reactionDedupIgnore {
+		// 既存の行は変更せず、LAST_INSERT_ID()で既存のIDを返させる
+		query += " ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)"
+	}
+	result, err := tx.NamedExecContext(ctx, query, reactionModel)
+	if err != nil {
+		return ReactionModel{}, false, err
+	}
+	reactionID, err := result.LastInsertId()
+	if err != nil {
+		return ReactionModel{}, false, err
+	}
+	// 追加した場合は1、既存の行が変更されなかった場合は0になる (ClientFoundRowsを有効にしていないため)
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return ReactionModel{}, false, err
+	}
+	if affected == 0 {
+		var existing ReactionModel
+		if err := tx.GetContext(ctx, &existing, "SELECT * FROM reactions WHERE id = ?", reactionID); err != nil {
+			return ReactionModel{}, false, err
+		}
+		return existing, false, nil
+	}
+
+	reactionModel.ID = reactionID
+	return reactionModel, true, nil
+}
+
+// reactionDedupIndexColumns は、リアクションの重複を防ぐ一意制約の列 (順序どおりにカンマで連結したもの)
+const reactionDedupIndexColumns = "user_id,livestream_id,emoji_name_normalized"
+
+// verifyReactionDedupIndex は、重複を許さないモードで一意制約が張られていることを確かめる
+// 一意制約がないと重複したリアクションがそのまま追加されてしまうので、起動時にエラーにする
+func verifyReactionDedupIndex(ctx context.Context, db *sqlx.DB, mode string) error {
+	if mode == reactionDedupOff {
+		return nil
+	}
+
+	var indexes []struct {
+		Name    string `db:"index_name"`
+		Columns string `db:"columns"`
+	}
+	if err := db.SelectContext(ctx, &indexes, "SELECT INDEX_NAME AS index_name, GROUP_CONCAT(COLUMN_NAME ORDER BY SEQ_IN_INDEX) AS columns FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'reactions' AND NON_UNIQUE = 0 GROUP BY INDEX_NAME"); err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if index.Columns == reactionDedupIndexColumns {
+			return nil
+		}
+	}
+	return fmt.Errorf("REACTION_DEDUP_MODE=%s requires a unique key on reactions (%s); see init.sql", mode, strings.ReplaceAll(reactionDedupIndexColumns, ",", ", "))
+}
+
+// isDuplicateEntryError は、一意制約違反のエラーかを判定する
+func isDuplicateEntryError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDupEntry
+}
+
 func fillReactionResponse(ctx context.Context, tx *sqlx.Tx, reactionModel ReactionModel) (Reaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	userModel := UserModel{}
 	if err := tx.GetContext(ctx, &userModel, "SELECT * FROM users WHERE id = ?", reactionModel.UserID); err != nil {
 		return Reaction{}, err
 	}
-	user, err := fillUserResponse(ctx, tx, userModel)
+	user, err := fillUserResponse(ctx, tx, userModel, noViewerID)
 	if err != nil {
 		return Reaction{}, err
 	}
@@ -201,3 +599,47 @@ func fillReactionResponse(ctx context.Context, tx *sqlx.Tx, reactionModel Reacti
 
 	return reaction, nil
 }
+
+// fillReactionsResponseWithoutTx は、同じ配信に対するリアクションの投稿ユーザをIN句でまとめて取得して埋める
+func fillReactionsResponseWithoutTx(ctx context.Context, reactionModels []ReactionModel, livestream Livestream) ([]Reaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
+	if len(reactionModels) == 0 {
+		return []Reaction{}, nil
+	}
+
+	userIDs := make([]int64, len(reactionModels))
+	for i := range reactionModels {
+		userIDs[i] = reactionModels[i].UserID
+	}
+
+	var userModels []UserModel
+	q, params, err := sqlx.In("SELECT * FROM users WHERE id IN (?)", userIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbConn.SelectContext(ctx, &userModels, q, params...); err != nil {
+		return nil, err
+	}
+	users, err := fillUsersResponseWithoutTx(ctx, userModels)
+	if err != nil {
+		return nil, err
+	}
+	userMap := make(map[int64]User, len(users))
+	for i := range users {
+		userMap[users[i].ID] = users[i]
+	}
+
+	reactions := make([]Reaction, len(reactionModels))
+	for i := range reactionModels {
+		reactions[i] = Reaction{
+			ID:         reactionModels[i].ID,
+			EmojiName:  reactionModels[i].EmojiName,
+			User:       userMap[reactionModels[i].UserID],
+			Livestream: livestream,
+			CreatedAt:  reactionModels[i].CreatedAt,
+		}
+	}
+	return reactions, nil
+}
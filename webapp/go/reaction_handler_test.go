@@ -0,0 +1,441 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/goccy/go-json"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+type fakeReactionKey struct {
+	userID       int64
+	livestreamID int64
+	emojiName    string
+}
+
+// fakeReactionDB は、UNIQUE KEY (user_id, livestream_id, emoji_name) を持つreactionsだけを模したfakeDB
+type fakeReactionDB struct {
+	*fakeDB
+
+	reactions map[fakeReactionKey]ReactionModel
+	nextID    int64
+	// 存在する配信ID
+	livestreamIDs []int64
+	// 配信者のユーザID (全配信で共通)
+	ownerID int64
+}
+
+func useFakeReactionDB(tb testing.TB) *fakeReactionDB {
+	d := &fakeReactionDB{fakeDB: &fakeDB{}, reactions: make(map[fakeReactionKey]ReactionModel), nextID: 1}
+	d.onQuery("SELECT * FROM reactions WHERE id = ?", func(_ string, args []driver.Value) (driver.Rows, error) {
+		rows := &fakeRows{columns: []string{"id", "emoji_name", "user_id", "livestream_id", "created_at"}}
+		for _, r := range d.reactions {
+			if r.ID == args[0].(int64) {
+				rows.values = append(rows.values, []driver.Value{r.ID, r.EmojiName, r.UserID, r.LivestreamID, r.CreatedAt})
+			}
+		}
+		return rows, nil
+	})
+	d.onQuery("SELECT emoji_name_normalized AS emoji_name, COUNT(*) AS count FROM reactions WHERE livestream_id = ?", func(query string, args []driver.Value) (driver.Rows, error) {
+		counts := map[string]int64{}
+		for _, r := range d.reactions {
+			if r.LivestreamID == args[0].(int64) {
+				counts[strings.ToLower(r.EmojiName)]++
+			}
+		}
+		summaries := make([]ReactionSummary, 0, len(counts))
+		for name, n := range counts {
+			summaries = append(summaries, ReactionSummary{EmojiName: name, Count: n})
+		}
+		// クエリで指定された場合だけ並べ替える
+		if strings.Contains(query, "ORDER BY count DESC, emoji_name ASC") {
+			slices.SortFunc(summaries, func(a, b ReactionSummary) int {
+				return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.EmojiName, b.EmojiName))
+			})
+		}
+		rows := &fakeRows{columns: []string{"emoji_name", "count"}}
+		for _, s := range summaries {
+			rows.values = append(rows.values, []driver.Value{s.EmojiName, s.Count})
+		}
+		return rows, nil
+	})
+	d.onQuery("SELECT user_id FROM livestreams WHERE id = ?", func(string, []driver.Value) (driver.Rows, error) {
+		return fakeValue("user_id", d.ownerID), nil
+	})
+	d.onQuery("SELECT COUNT(*) FROM livestreams WHERE id = ?", func(_ string, args []driver.Value) (driver.Rows, error) {
+		n := int64(0)
+		if slices.Contains(d.livestreamIDs, args[0].(int64)) {
+			n = 1
+		}
+		return fakeValue("COUNT(*)", n), nil
+	})
+	d.onExec("DELETE FROM reactions WHERE id = ?", func(_ string, args []driver.Value) (driver.Result, error) {
+		for key, r := range d.reactions {
+			if r.ID == args[0].(int64) {
+				delete(d.reactions, key)
+				return driver.RowsAffected(1), nil
+			}
+		}
+		return driver.RowsAffected(0), nil
+	})
+	d.onExec("INSERT INTO reactions", func(query string, args []driver.Value) (driver.Result, error) {
+		r := ReactionModel{
+			UserID:       args[0].(int64),
+			LivestreamID: args[1].(int64),
+			EmojiName:    args[2].(string),
+			CreatedAt:    args[3].(int64),
+		}
+		key := fakeReactionKey{userID: r.UserID, livestreamID: r.LivestreamID, emojiName: r.EmojiName}
+		if existing, ok := d.reactions[key]; ok {
+			if strings.Contains(query, "ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)") {
+				return fakeResult{lastInsertID: existing.ID, rowsAffected: 0}, nil
+			}
+			return nil, &mysql.MySQLError{Number: mysqlErrDupEntry, Message: "Duplicate entry"}
+		}
+		r.ID = d.nextID
+		d.nextID++
+		d.reactions[key] = r
+		return fakeResult{lastInsertID: r.ID, rowsAffected: 1}, nil
+	})
+	useFakeDB(tb, d.fakeDB)
+	return d
+}
+
+func TestInsertReaction(t *testing.T) {
+	tests := []struct {
+		mode          string
+		wantDuplicate bool
+	}{
+		{mode: reactionDedupReject, wantDuplicate: true},
+		{mode: reactionDedupIgnore, wantDuplicate: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			d := useFakeReactionDB(t)
+			ctx := context.Background()
+			tx, err := dbConn.BeginTxx(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			first, created, err := insertReaction(ctx, tx, tt.mode, ReactionModel{UserID: 1, LivestreamID: 10, EmojiName: "chair", CreatedAt: 100})
+			if err != nil {
+				t.Fatalf("first reaction: %v", err)
+			}
+			if !created || first.ID == 0 {
+				t.Fatalf("first reaction: created = %v, id = %d", created, first.ID)
+			}
+
+			second, created, err := insertReaction(ctx, tx, tt.mode, ReactionModel{UserID: 1, LivestreamID: 10, EmojiName: "chair", CreatedAt: 200})
+			if tt.wantDuplicate {
+				if !isDuplicateEntryError(err) {
+					t.Fatalf("duplicate reaction: err = %v, want duplicate entry error", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("duplicate reaction: %v", err)
+				}
+				// 既存のリアクションがそのまま返る
+				if created || second.ID != first.ID || second.CreatedAt != 100 {
+					t.Errorf("duplicate reaction = %+v (created = %v), want the existing reaction %+v", second, created, first)
+				}
+			}
+			if len(d.reactions) != 1 {
+				t.Errorf("reactions = %d, want 1", len(d.reactions))
+			}
+
+			// 別の絵文字は追加できる
+			if _, created, err := insertReaction(ctx, tx, tt.mode, ReactionModel{UserID: 1, LivestreamID: 10, EmojiName: "tada", CreatedAt: 300}); err != nil || !created {
+				t.Errorf("another emoji: created = %v, err = %v", created, err)
+			}
+		})
+	}
+}
+
+func TestPostReactionHandler_RejectsDuplicate(t *testing.T) {
+	const (
+		userID       = int64(1)
+		livestreamID = int64(10)
+	)
+	d := useFakeReactionDB(t)
+	d.reactions[fakeReactionKey{userID: userID, livestreamID: livestreamID, emojiName: "chair"}] = ReactionModel{ID: 1, UserID: userID, LivestreamID: livestreamID, EmojiName: "chair"}
+	d.nextID = 2
+	useSessionVersion(t, userID, 0)
+
+	origMode := reactionDedupMode
+	reactionDedupMode = reactionDedupReject
+	reactionEmojiCache.Set(userID, livestreamID, map[string]struct{}{"chair": {}}, time.Hour)
+	t.Cleanup(func() {
+		reactionDedupMode = origMode
+		reactionEmojiCache.CleanupAll()
+	})
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	e.POST("/api/livestream/:livestream_id/reaction", func(c echo.Context) error {
+		// ログイン済みのセッションとして扱う
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultUserIDKey] = userID
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+		return postReactionHandler(c)
+	})
+
+	// 表記揺れも同じ絵文字として扱う
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/livestream/10/reaction", strings.NewReader(`{"emoji_name":"Chair"}`)))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "already reacted with this emoji" {
+		t.Errorf("error = %q, want %q", resp.Error, "already reacted with this emoji")
+	}
+	if len(d.reactions) != 1 {
+		t.Errorf("reactions = %d, want 1", len(d.reactions))
+	}
+}
+
+func TestPostReactionHandler_LimitBoundary(t *testing.T) {
+	const (
+		userID       = int64(1)
+		livestreamID = int64(10)
+		limit        = 3
+	)
+	origLimit, origMode := maxReactionsPerUserPerStream, reactionDedupMode
+	maxReactionsPerUserPerStream = limit
+	reactionDedupMode = reactionDedupReject
+	t.Cleanup(func() {
+		maxReactionsPerUserPerStream, reactionDedupMode = origLimit, origMode
+		reactionEmojiCache.CleanupAll()
+	})
+	useSessionVersion(t, userID, 0)
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	e.POST("/api/livestream/:livestream_id/reaction", func(c echo.Context) error {
+		// ログイン済みのセッションとして扱う
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultUserIDKey] = userID
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+		return postReactionHandler(c)
+	})
+
+	tests := []struct {
+		name string
+		// 既に付けている絵文字
+		reacted   []string
+		emojiName string
+		wantLimit bool
+	}{
+		{name: "below limit", reacted: []string{"a", "b"}, emojiName: "c", wantLimit: false},
+		{name: "at limit", reacted: []string{"a", "b", "c"}, emojiName: "d", wantLimit: true},
+		// 既に付けた絵文字は種類数が増えないので上限に達していても制限しない
+		{name: "at limit with reacted emoji", reacted: []string{"a", "b", "c"}, emojiName: "C", wantLimit: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := useFakeReactionDB(t)
+			emojis := make(map[string]struct{}, len(tt.reacted))
+			for _, name := range tt.reacted {
+				d.reactions[fakeReactionKey{userID: userID, livestreamID: livestreamID, emojiName: name}] = ReactionModel{ID: d.nextID, UserID: userID, LivestreamID: livestreamID, EmojiName: name}
+				d.nextID++
+				emojis[name] = struct{}{}
+			}
+			reactionEmojiCache.Set(userID, livestreamID, emojis, time.Hour)
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/livestream/10/reaction", strings.NewReader(`{"emoji_name":"`+tt.emojiName+`"}`)))
+			inserts := d.queriesWithPrefix("INSERT INTO reactions")
+			if !tt.wantLimit {
+				if rec.Code == http.StatusTooManyRequests {
+					t.Fatalf("status = %d, want the reaction to be accepted: %s", rec.Code, rec.Body.String())
+				}
+				if inserts != 1 {
+					t.Errorf("inserts = %d, want 1", inserts)
+				}
+				return
+			}
+
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusTooManyRequests, rec.Body.String())
+			}
+			var resp struct {
+				Message string `json:"message"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Message != "reaction limit reached for this stream" {
+				t.Errorf("message = %q, want %q", resp.Message, "reaction limit reached for this stream")
+			}
+			if inserts != 0 {
+				t.Errorf("inserts = %d, want 0", inserts)
+			}
+		})
+	}
+}
+
+func TestGetReactionSummaryHandler(t *testing.T) {
+	d := useFakeReactionDB(t)
+	d.livestreamIDs = []int64{10, 20}
+	for i, r := range []struct {
+		userID       int64
+		livestreamID int64
+		emojiName    string
+	}{
+		{userID: 1, livestreamID: 10, emojiName: "chair"},
+		{userID: 2, livestreamID: 10, emojiName: "tada"},
+		{userID: 3, livestreamID: 10, emojiName: "tada"},
+		{userID: 4, livestreamID: 10, emojiName: "Tada"},
+		{userID: 1, livestreamID: 10, emojiName: "heart"},
+		{userID: 2, livestreamID: 10, emojiName: "heart"},
+		{userID: 1, livestreamID: 99, emojiName: "chair"},
+	} {
+		key := fakeReactionKey{userID: r.userID, livestreamID: r.livestreamID, emojiName: r.emojiName}
+		d.reactions[key] = ReactionModel{ID: int64(i + 1), UserID: r.userID, LivestreamID: r.livestreamID, EmojiName: r.emojiName}
+	}
+	t.Cleanup(reactionSummaryCache.CleanupAll)
+
+	// セッションCookieなしでアクセスする
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	e.GET("/api/livestream/:livestream_id/reactions/summary", getReactionSummaryHandler)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/api/livestream/10/reactions/summary")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var summaries []ReactionSummary
+	if err := json.NewDecoder(rec.Body).Decode(&summaries); err != nil {
+		t.Fatal(err)
+	}
+	want := []ReactionSummary{
+		{EmojiName: "tada", Count: 3},
+		{EmojiName: "heart", Count: 2},
+		{EmojiName: "chair", Count: 1},
+	}
+	if !slices.Equal(summaries, want) {
+		t.Errorf("summaries = %+v, want %+v", summaries, want)
+	}
+
+	// 2回目はキャッシュから返す
+	if rec := get("/api/livestream/10/reactions/summary"); rec.Code != http.StatusOK {
+		t.Fatalf("cached: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if n := d.queriesWithPrefix("SELECT emoji_name_normalized"); n != 1 {
+		t.Errorf("summary queries = %d, want 1", n)
+	}
+
+	// リアクションのない配信は空配列、存在しない配信は404
+	if rec := get("/api/livestream/20/reactions/summary"); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("no reactions: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if rec := get("/api/livestream/30/reactions/summary"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown livestream: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestDeleteReactionHandler(t *testing.T) {
+	const (
+		reactorID = int64(1)
+		otherID   = int64(2)
+	)
+	d := useFakeReactionDB(t)
+	d.ownerID = 100
+	d.reactions[fakeReactionKey{userID: reactorID, livestreamID: 10, emojiName: "chair"}] = ReactionModel{ID: 1, UserID: reactorID, LivestreamID: 10, EmojiName: "chair"}
+	useSessionVersion(t, reactorID, 0)
+	useSessionVersion(t, otherID, 0)
+	reactionEmojiCache.Set(reactorID, 10, map[string]struct{}{"chair": {}}, time.Hour)
+	t.Cleanup(reactionEmojiCache.CleanupAll)
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	var loginUserID int64
+	e.DELETE("/api/livestream/:livestream_id/reaction/:reaction_id", func(c echo.Context) error {
+		// ログイン済みのセッションとして扱う
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultUserIDKey] = loginUserID
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+		return deleteReactionHandler(c)
+	})
+
+	tests := []struct {
+		name          string
+		path          string
+		userID        int64
+		wantStatus    int
+		wantRemaining int
+	}{
+		{name: "by another user", path: "/api/livestream/10/reaction/1", userID: otherID, wantStatus: http.StatusForbidden, wantRemaining: 1},
+		{name: "livestream mismatch", path: "/api/livestream/20/reaction/1", userID: reactorID, wantStatus: http.StatusBadRequest, wantRemaining: 1},
+		{name: "by the reactor", path: "/api/livestream/10/reaction/1", userID: reactorID, wantStatus: http.StatusNoContent, wantRemaining: 0},
+		{name: "already deleted", path: "/api/livestream/10/reaction/1", userID: reactorID, wantStatus: http.StatusNotFound, wantRemaining: 0},
+	}
+	// 順に実行するので、削除済みのリアクションを再度削除するケースも確かめられる
+	for _, tt := range tests {
+		loginUserID = tt.userID
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, tt.path, nil))
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.wantStatus, rec.Body.String())
+		}
+		if len(d.reactions) != tt.wantRemaining {
+			t.Fatalf("%s: reactions = %d, want %d", tt.name, len(d.reactions), tt.wantRemaining)
+		}
+	}
+
+	// 付けた絵文字の種類のキャッシュも破棄される
+	if _, ok := reactionEmojiCache.Get(reactorID, 10); ok {
+		t.Error("reacted emojis are still cached after deletion")
+	}
+}
+
+func TestVerifyReactionDedupIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		indexes [][]driver.Value
+		wantErr bool
+	}{
+		{name: "off without index", mode: reactionDedupOff, wantErr: false},
+		{name: "reject without index", mode: reactionDedupReject, indexes: [][]driver.Value{{"PRIMARY", "id"}}, wantErr: true},
+		// 大文字小文字を区別する絵文字名の制約では、集計と重複判定が食い違う
+		{name: "ignore with case sensitive index", mode: reactionDedupIgnore, indexes: [][]driver.Value{{"PRIMARY", "id"}, {"uniq", "user_id,livestream_id,emoji_name"}}, wantErr: true},
+		{name: "ignore with index", mode: reactionDedupIgnore, indexes: [][]driver.Value{{"PRIMARY", "id"}, {"uniq", "user_id,livestream_id,emoji_name_normalized"}}, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &fakeDB{}
+			d.onQuery("SELECT INDEX_NAME", func(string, []driver.Value) (driver.Rows, error) {
+				return &fakeRows{columns: []string{"index_name", "columns"}, values: tt.indexes}, nil
+			})
+			err := verifyReactionDedupIndex(context.Background(), d.open(t), tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.mode == reactionDedupOff && d.queryCount() != 0 {
+				t.Error("off mode must not query the schema")
+			}
+		})
+	}
+}
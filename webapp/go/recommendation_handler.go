@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultRecommendedLivestreamsLimit = 10
+	maxRecommendedLivestreamsLimit     = 50
+	// タグを集める対象とする、直近に視聴・リアクションした配信数
+	recommendationHistorySize = 10
+
+	recommendedLivestreamCacheTTL = 60 * time.Second
+
+	// 視聴履歴から集める、直近に視聴した配信のタグ数
+	personalisedRecommendationTagCount = 5
+	personalisedRecommendationLimit    = 10
+
+	personalisedRecommendationCacheTTL = 5 * time.Minute
+)
+
+var (
+	recommendedLivestreamCache      = &RecommendedLivestreamCache{}
+	personalisedRecommendationCache = &RecommendedLivestreamCache{}
+)
+
+type recommendedLivestreamEntry struct {
+	livestreams []Livestream
+	expiration  time.Time
+}
+
+// RecommendedLivestreamCache は、ユーザごとのおすすめ配信を保持する
+// limitによらず最大件数分を保持し、返却時に切り詰める
+type RecommendedLivestreamCache struct {
+	data sync.Map
+}
+
+func (m *RecommendedLivestreamCache) Set(userID int64, livestreams []Livestream, ttl time.Duration) {
+	m.data.Store(userID, recommendedLivestreamEntry{
+		livestreams: livestreams,
+		expiration:  time.Now().Add(jitteredTTL(ttl)),
+	})
+}
+
+func (m *RecommendedLivestreamCache) Get(userID int64) ([]Livestream, bool) {
+	v, ok := m.data.Load(userID)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(recommendedLivestreamEntry)
+	if time.Now().After(e.expiration) {
+		m.data.Delete(userID)
+		return nil, false
+	}
+	return e.livestreams, true
+}
+
+func (m *RecommendedLivestreamCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+}
+
+// おすすめ配信取得API
+// GET /api/livestreams/recommended
+func getRecommendedLivestreamsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	limit := defaultRecommendedLivestreamsLimit
+	if c.QueryParam("limit") != "" {
+		n, err := strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || n <= 0 || n > maxRecommendedLivestreamsLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be integer between 1 and "+strconv.Itoa(maxRecommendedLivestreamsLimit))
+		}
+		limit = n
+	}
+
+	livestreams, ok := recommendedLivestreamCache.Get(userID)
+	if !ok {
+		livestreamModels, err := getRecommendedLivestreams(ctx, dbConn, userID, time.Now().Unix())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get recommended livestreams: "+err.Error())
+		}
+		livestreams, err = fillLivestreamsResponseWithoutTx(ctx, livestreamModels)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestreams: "+err.Error())
+		}
+		recommendedLivestreamCache.Set(userID, livestreams, recommendedLivestreamCacheTTL)
+	}
+
+	if len(livestreams) > limit {
+		livestreams = livestreams[:limit]
+	}
+	return c.JSON(http.StatusOK, livestreams)
+}
+
+// getRecommendedLivestreams は、視聴・リアクション履歴のある配信とタグが重なる、未視聴の配信中・配信予定の配信を
+// リアクション数の多い順に返す
+// 履歴がない、あるいは該当する配信がない場合は、配信中・配信予定の配信をリアクション数の多い順に返す
+func getRecommendedLivestreams(ctx context.Context, q sqlx.QueryerContext, userID int64, now int64) ([]LivestreamModel, error) {
+	// 直近に視聴・リアクションした順の配信ID
+	var historyIDs []int64
+	if err := sqlx.SelectContext(ctx, q, &historyIDs, `
+		SELECT livestream_id FROM (
+			SELECT livestream_id, created_at FROM livestream_viewers_history WHERE user_id = ?
+			UNION ALL
+			SELECT livestream_id, created_at FROM reactions WHERE user_id = ?
+		) h GROUP BY livestream_id ORDER BY MAX(created_at) DESC`, userID, userID); err != nil {
+		return nil, err
+	}
+
+	if len(historyIDs) > 0 {
+		recentIDs := historyIDs[:min(len(historyIDs), recommendationHistorySize)]
+		query, params, err := sqlx.In("SELECT DISTINCT tag_id FROM livestream_tags WHERE livestream_id IN (?)", recentIDs)
+		if err != nil {
+			return nil, err
+		}
+		var tagIDs []int64
+		if err := sqlx.SelectContext(ctx, q, &tagIDs, query, params...); err != nil {
+			return nil, err
+		}
+
+		if len(tagIDs) > 0 {
+			query, params, err := sqlx.In(`
+				SELECT l.* FROM livestreams l
+				LEFT JOIN (SELECT livestream_id, COUNT(*) AS cnt FROM reactions GROUP BY livestream_id) r ON r.livestream_id = l.id
+				WHERE l.end_at > ?
+				AND l.id IN (SELECT livestream_id FROM livestream_tags WHERE tag_id IN (?))
+				AND l.id NOT IN (?)
+				ORDER BY IFNULL(r.cnt, 0) DESC, l.id DESC
+				LIMIT ?`, now, tagIDs, historyIDs, maxRecommendedLivestreamsLimit)
+			if err != nil {
+				return nil, err
+			}
+			var livestreamModels []LivestreamModel
+			if err := sqlx.SelectContext(ctx, q, &livestreamModels, query, params...); err != nil {
+				return nil, err
+			}
+			if len(livestreamModels) > 0 {
+				return livestreamModels, nil
+			}
+		}
+	}
+
+	// 履歴から推薦できない場合は、盛り上がっている配信中・配信予定の配信を返す
+	var livestreamModels []LivestreamModel
+	if err := sqlx.SelectContext(ctx, q, &livestreamModels, `
+		SELECT l.* FROM livestreams l
+		LEFT JOIN (SELECT livestream_id, COUNT(*) AS cnt FROM reactions GROUP BY livestream_id) r ON r.livestream_id = l.id
+		WHERE l.end_at > ?
+		ORDER BY IFNULL(r.cnt, 0) DESC, l.id DESC
+		LIMIT ?`, now, maxRecommendedLivestreamsLimit); err != nil {
+		return nil, err
+	}
+	return livestreamModels, nil
+}
+
+// 視聴履歴に基づくおすすめ配信取得API
+// GET /api/user/me/recommended-streams
+func getPersonalisedRecommendationsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	if livestreams, ok := personalisedRecommendationCache.Get(userID); ok {
+		return c.JSON(http.StatusOK, livestreams)
+	}
+
+	livestreamModels, err := getPersonalisedRecommendations(ctx, dbConn, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get recommended livestreams: "+err.Error())
+	}
+	livestreams, err := fillLivestreamsResponseWithoutTx(ctx, livestreamModels)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestreams: "+err.Error())
+	}
+	personalisedRecommendationCache.Set(userID, livestreams, personalisedRecommendationCacheTTL)
+
+	return c.JSON(http.StatusOK, livestreams)
+}
+
+// getPersonalisedRecommendations は、直近に視聴した配信のタグと重なる数が多い順に、未視聴の配信を返す
+// 視聴履歴がない場合は空を返す
+func getPersonalisedRecommendations(ctx context.Context, q sqlx.QueryerContext, userID int64) ([]LivestreamModel, error) {
+	livestreamModels := []LivestreamModel{}
+
+	var tagIDs []int64
+	if err := sqlx.SelectContext(ctx, q, &tagIDs, `
+		SELECT lt.tag_id FROM livestream_tags lt
+		INNER JOIN livestream_viewers_history h ON h.livestream_id = lt.livestream_id
+		WHERE h.user_id = ?
+		GROUP BY lt.tag_id
+		ORDER BY MAX(h.created_at) DESC, lt.tag_id DESC
+		LIMIT ?`, userID, personalisedRecommendationTagCount); err != nil {
+		return nil, err
+	}
+	if len(tagIDs) == 0 {
+		return livestreamModels, nil
+	}
+
+	// タグが取れた時点で視聴履歴は1件以上ある
+	var watchedIDs []int64
+	if err := sqlx.SelectContext(ctx, q, &watchedIDs, "SELECT livestream_id FROM livestream_viewers_history WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	// タグの重なり順の配信ID
+	query, params, err := sqlx.In(`
+		SELECT lt.livestream_id FROM livestream_tags lt
+		WHERE lt.tag_id IN (?) AND lt.livestream_id NOT IN (?)
+		GROUP BY lt.livestream_id
+		ORDER BY COUNT(*) DESC, lt.livestream_id DESC
+		LIMIT ?`, tagIDs, watchedIDs, personalisedRecommendationLimit)
+	if err != nil {
+		return nil, err
+	}
+	var livestreamIDs []int64
+	if err := sqlx.SelectContext(ctx, q, &livestreamIDs, query, params...); err != nil {
+		return nil, err
+	}
+	if len(livestreamIDs) == 0 {
+		return livestreamModels, nil
+	}
+
+	query, params, err = sqlx.In("SELECT * FROM livestreams WHERE id IN (?)", livestreamIDs)
+	if err != nil {
+		return nil, err
+	}
+	var models []LivestreamModel
+	if err := sqlx.SelectContext(ctx, q, &models, query, params...); err != nil {
+		return nil, err
+	}
+	modelByID := make(map[int64]LivestreamModel, len(models))
+	for _, m := range models {
+		modelByID[m.ID] = m
+	}
+	for _, id := range livestreamIDs {
+		if m, ok := modelByID[id]; ok {
+			livestreamModels = append(livestreamModels, m)
+		}
+	}
+	return livestreamModels, nil
+}
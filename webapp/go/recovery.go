@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/labstack/echo/v4"
+)
+
+const internalErrorCode = "INTERNAL_ERROR"
+
+type InternalErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PanicRecoveryMiddleware は、ハンドラのpanicを回復してスタックトレースをログに出力し、500を返す
+// panicの値やスタックトレースはレスポンスに含めない
+func PanicRecoveryMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				// クライアントとの接続を中断するためのpanicはnet/httpに任せる
+				if e, ok := r.(error); ok && errors.Is(e, http.ErrAbortHandler) {
+					panic(r)
+				}
+
+				slog.Error("panic recovered",
+					"request_id", requestIDOf(c),
+					"method", c.Request().Method,
+					"path", c.Request().URL.Path,
+					"panic", fmt.Sprint(r),
+					"stack", string(debug.Stack()),
+				)
+
+				// 既に書き込みを始めている場合はレスポンスを差し替えられない
+				if c.Response().Committed {
+					err = nil
+					return
+				}
+				err = c.JSON(http.StatusInternalServerError, InternalErrorResponse{
+					Code:    internalErrorCode,
+					Message: "an unexpected error occurred",
+				})
+			}()
+			return next(c)
+		}
+	}
+}
+
+// requestIDOf は、RequestIDミドルウェアが付与したリクエストIDを返す
+func requestIDOf(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
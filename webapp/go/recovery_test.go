@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestPanicRecovery_Returns500(t *testing.T) {
+	const secret = "secret panic value"
+
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	e.Use(PanicRecoveryMiddleware())
+	e.GET("/panic", func(c echo.Context) error {
+		panic(secret)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	body := rec.Body.String()
+	if strings.Contains(body, secret) || strings.Contains(body, "goroutine") {
+		t.Errorf("response body exposes panic details: %s", body)
+	}
+
+	var resp InternalErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response body %q: %v", body, err)
+	}
+	want := InternalErrorResponse{
+		Code:    "INTERNAL_ERROR",
+		Message: "an unexpected error occurred",
+	}
+	if resp != want {
+		t.Errorf("response = %+v, want %+v", resp, want)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// DB劣化中に待たせておけるリクエスト数と、待たせる最大時間
+	requestQueueMaxQueued = 1024
+	requestQueueTimeout   = 3 * time.Second
+	// DBの復旧を確認する間隔
+	requestQueueRetryInterval = 100 * time.Millisecond
+
+	dbHealthCheckInterval = 500 * time.Millisecond
+	dbHealthCheckTimeout  = 1 * time.Second
+)
+
+// dbDegraded は、DBに接続できない状態であればtrue
+var dbDegraded atomic.Bool
+
+// runDBHealthCheck は、定期的にDBへpingしてdbDegradedを更新する
+func runDBHealthCheck(db *sqlx.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), dbHealthCheckTimeout)
+		err := db.PingContext(ctx)
+		cancel()
+
+		degraded := err != nil
+		if dbDegraded.Swap(degraded) != degraded {
+			if degraded {
+				log.Printf("database is degraded: %v", err)
+			} else {
+				log.Printf("database recovered")
+			}
+		}
+	}
+}
+
+// RequestQueueMiddleware は、DBが劣化している間リクエストを即座に失敗させず、復旧するまで待たせる
+// 待機中のリクエストがmaxQueuedを超えた場合や、timeoutまでに復旧しなかった場合は503を返す
+func RequestQueueMiddleware(maxQueued int, timeout time.Duration) echo.MiddlewareFunc {
+	queue := make(chan struct{}, maxQueued)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !dbDegraded.Load() {
+				return next(c)
+			}
+
+			select {
+			case queue <- struct{}{}:
+			default:
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "too many requests are waiting for database recovery")
+			}
+			defer func() { <-queue }()
+
+			ctx := c.Request().Context()
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			ticker := time.NewTicker(requestQueueRetryInterval)
+			defer ticker.Stop()
+			for dbDegraded.Load() {
+				select {
+				case <-ticker.C:
+				case <-timer.C:
+					return echo.NewHTTPError(http.StatusServiceUnavailable, "database is unavailable")
+				case <-ctx.Done():
+					return echo.NewHTTPError(http.StatusServiceUnavailable, "request canceled while waiting for database recovery")
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
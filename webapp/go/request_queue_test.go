@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func newRequestQueueTestServer(maxQueued int, timeout time.Duration) *echo.Echo {
+	e := echo.New()
+	e.Use(RequestQueueMiddleware(maxQueued, timeout))
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	return e
+}
+
+func serveRequestQueueTest(e *echo.Echo) int {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Code
+}
+
+func TestRequestQueueMiddleware_Healthy(t *testing.T) {
+	dbDegraded.Store(false)
+
+	e := newRequestQueueTestServer(1, time.Second)
+	if code := serveRequestQueueTest(e); code != http.StatusOK {
+		t.Errorf("status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestRequestQueueMiddleware_RecoverDuringOutage(t *testing.T) {
+	const outage = 200 * time.Millisecond
+
+	dbDegraded.Store(true)
+	t.Cleanup(func() { dbDegraded.Store(false) })
+	time.AfterFunc(outage, func() { dbDegraded.Store(false) })
+
+	e := newRequestQueueTestServer(10, 2*time.Second)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serveRequestQueueTest(e)
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d: status = %d, want %d", i, code, http.StatusOK)
+		}
+	}
+	if elapsed < outage {
+		t.Errorf("requests finished in %s, want to wait for the %s outage", elapsed, outage)
+	}
+}
+
+func TestRequestQueueMiddleware_Timeout(t *testing.T) {
+	dbDegraded.Store(true)
+	t.Cleanup(func() { dbDegraded.Store(false) })
+
+	e := newRequestQueueTestServer(10, 200*time.Millisecond)
+	if code := serveRequestQueueTest(e); code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestRequestQueueMiddleware_QueueFull(t *testing.T) {
+	dbDegraded.Store(true)
+	t.Cleanup(func() { dbDegraded.Store(false) })
+
+	e := newRequestQueueTestServer(1, 500*time.Millisecond)
+
+	// 1件目がキューを埋めている間に2件目を送る
+	done := make(chan int)
+	go func() {
+		done <- serveRequestQueueTest(e)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if code := serveRequestQueueTest(e); code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	dbDegraded.Store(false)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("queued request status = %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// expectedSchema は、Goのモデルが前提とするテーブルごとのカラムと型 (information_schema.COLUMNS.DATA_TYPE)
+// SELECT * をモデルに読み込むので、カラムの不足だけでなく余分なカラムも不一致とする
+var expectedSchema = map[string]map[string]string{
+	"users": {
+		"id":             "bigint",
+		"name":           "varchar",
+		"display_name":   "varchar",
+		"password":       "varchar",
+		"description":    "text",
+		"force_keep_dns": "tinyint",
+		"updated_at":     "bigint",
+		"icon_hash":      "varchar",
+		"created_at":     "bigint",
+	},
+	"livestreams": {
+		"id":                    "bigint",
+		"user_id":               "bigint",
+		"title":                 "varchar",
+		"description":           "text",
+		"playlist_url":          "varchar",
+		"thumbnail_url":         "varchar",
+		"start_at":              "bigint",
+		"end_at":                "bigint",
+		"pinned_livecomment_id": "bigint",
+		"max_viewers":           "bigint",
+	},
+	"reservation_slots": {
+		"id":       "bigint",
+		"slot":     "bigint",
+		"start_at": "bigint",
+		"end_at":   "bigint",
+	},
+	"icons": {
+		"id":      "bigint",
+		"user_id": "bigint",
+		"image":   "longblob",
+	},
+	"themes": {
+		"id":        "bigint",
+		"user_id":   "bigint",
+		"dark_mode": "tinyint",
+	},
+	"reactions": {
+		"id":                    "bigint",
+		"user_id":               "bigint",
+		"livestream_id":         "bigint",
+		"emoji_name":            "varchar",
+		"emoji_name_normalized": "varchar",
+		"created_at":            "bigint",
+	},
+	"livecomments": {
+		"id":            "bigint",
+		"user_id":       "bigint",
+		"livestream_id": "bigint",
+		"comment":       "varchar",
+		"tip":           "bigint",
+		"created_at":    "bigint",
+	},
+	"livestream_tags": {
+		"id":            "bigint",
+		"livestream_id": "bigint",
+		"tag_id":        "bigint",
+	},
+	"tags": {
+		"id":   "bigint",
+		"name": "varchar",
+	},
+}
+
+type schemaColumn struct {
+	TableName  string `db:"table_name"`
+	ColumnName string `db:"column_name"`
+	DataType   string `db:"data_type"`
+}
+
+// verifyDBSchema は、DBのテーブル定義がexpectedSchemaと一致するかをinformation_schemaから調べる
+// 一致しない場合は、全ての差分を含むエラーを返す
+// 起動時はapplyMigrationsの後に呼ぶので、カラムが足りない場合はそのカラムを追加するマイグレーションがない
+func verifyDBSchema(ctx context.Context, db *sqlx.DB) error {
+	tableNames := slices.Sorted(maps.Keys(expectedSchema))
+
+	query, params, err := sqlx.In("SELECT TABLE_NAME AS table_name, COLUMN_NAME AS column_name, DATA_TYPE AS data_type FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME IN (?)", tableNames)
+	if err != nil {
+		return err
+	}
+	var columns []schemaColumn
+	if err := db.SelectContext(ctx, &columns, query, params...); err != nil {
+		return err
+	}
+
+	actual := make(map[string]map[string]string, len(tableNames))
+	for _, c := range columns {
+		if actual[c.TableName] == nil {
+			actual[c.TableName] = make(map[string]string)
+		}
+		actual[c.TableName][c.ColumnName] = strings.ToLower(c.DataType)
+	}
+
+	var diffs []string
+	missing := false
+	for _, table := range tableNames {
+		got, ok := actual[table]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: table not found", table))
+			missing = true
+			continue
+		}
+		want := expectedSchema[table]
+		for _, column := range slices.Sorted(maps.Keys(want)) {
+			gotType, ok := got[column]
+			switch {
+			case !ok:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: column not found (want %s)", table, column, want[column]))
+				missing = true
+			case gotType != want[column]:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: type is %s (want %s)", table, column, gotType, want[column]))
+			}
+		}
+		for _, column := range slices.Sorted(maps.Keys(got)) {
+			if _, ok := want[column]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: unexpected column (%s)", table, column, got[column]))
+			}
+		}
+	}
+	if missing {
+		diffs = append(diffs, "missing tables and columns must be added by a migration in migrations.go")
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("db schema mismatch:\n%s", strings.Join(diffs, "\n"))
+	}
+	return nil
+}
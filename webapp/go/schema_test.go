@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// cloneExpectedSchema は、書き換えて使うためにexpectedSchemaを複製する
+func cloneExpectedSchema() map[string]map[string]string {
+	schema := make(map[string]map[string]string, len(expectedSchema))
+	for table, columns := range expectedSchema {
+		schema[table] = maps.Clone(columns)
+	}
+	return schema
+}
+
+// onSchemaQuery は、information_schema.COLUMNSへのクエリにcolumns (テーブル名 -> カラム名 -> 型) を返すよう登録する
+func onSchemaQuery(d *fakeDB, columns map[string]map[string]string) {
+	d.onQuery("SELECT", func(query string, _ []driver.Value) (driver.Rows, error) {
+		if !strings.Contains(query, "FROM information_schema.COLUMNS") {
+			return nil, errors.New("fakeDB: unexpected query: " + query)
+		}
+		rows := &fakeRows{columns: []string{"table_name", "column_name", "data_type"}}
+		for _, table := range slices.Sorted(maps.Keys(columns)) {
+			for _, column := range slices.Sorted(maps.Keys(columns[table])) {
+				rows.values = append(rows.values, []driver.Value{table, column, columns[table][column]})
+			}
+		}
+		return rows, nil
+	})
+}
+
+func newFakeSchemaDB(t *testing.T, columns map[string]map[string]string) *sqlx.DB {
+	d := &fakeDB{}
+	onSchemaQuery(d, columns)
+	return d.open(t)
+}
+
+func TestVerifyDBSchema(t *testing.T) {
+	schema := cloneExpectedSchema()
+	// MySQLのバージョンによっては大文字で返る
+	schema["users"]["description"] = "TEXT"
+
+	if err := verifyDBSchema(context.Background(), newFakeSchemaDB(t, schema)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVerifyDBSchema_MissingColumn(t *testing.T) {
+	schema := cloneExpectedSchema()
+	delete(schema["users"], "icon_hash")
+	schema["livestreams"]["max_viewers"] = "varchar"
+	schema["livecomments"]["deleted_at"] = "bigint"
+	delete(schema, "tags")
+
+	err := verifyDBSchema(context.Background(), newFakeSchemaDB(t, schema))
+	if err == nil {
+		t.Fatal("verifyDBSchema must fail on an incomplete schema")
+	}
+	for _, want := range []string{
+		"users.icon_hash: column not found (want varchar)",
+		"livestreams.max_viewers: type is varchar (want bigint)",
+		"livecomments.deleted_at: unexpected column (bigint)",
+		"tags: table not found",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error must contain %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestVerifyDBSchema_ReportsAllMissingColumns(t *testing.T) {
+	// マイグレーションを適用していない初期スキーマでは、追加された全てのカラムを報告する
+	err := verifyDBSchema(context.Background(), newFakeSchemaDB(t, baselineSchema()))
+	if err == nil {
+		t.Fatal("verifyDBSchema must fail on the baseline schema")
+	}
+	for _, want := range []string{
+		"users.force_keep_dns: column not found",
+		"users.updated_at: column not found",
+		"users.icon_hash: column not found",
+		"users.created_at: column not found",
+		"livestreams.pinned_livecomment_id: column not found",
+		"livestreams.max_viewers: column not found",
+		"reactions.emoji_name_normalized: column not found",
+		"must be added by a migration",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error must contain %q, got: %v", want, err)
+		}
+	}
+}
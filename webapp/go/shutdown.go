@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SIGTERMを受け取ってから、処理中のリクエストの完了を待つ時間
+const shutdownTimeout = 30 * time.Second
+
+// runServer は、SIGTERMかSIGINTを受け取るまでHTTPサーバを動かす
+// シグナルを受け取ったら新しい接続の受付をやめ、timeoutまで処理中のリクエストの完了を待ってから返る
+func runServer(ctx context.Context, e *echo.Echo, addr string, timeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- e.Start(addr)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	// Shutdownが返った時点でStartもhttp.ErrServerClosedで返っている
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
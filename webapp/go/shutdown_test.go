@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRunServer_DrainsInFlightRequestOnSIGTERM(t *testing.T) {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	entered := make(chan struct{})
+	e.GET("/slow", func(c echo.Context) error {
+		close(entered)
+		time.Sleep(300 * time.Millisecond)
+		return c.String(http.StatusOK, "done")
+	})
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- runServer(context.Background(), e, "127.0.0.1:0", 5*time.Second)
+	}()
+
+	var addr string
+	for deadline := time.Now().Add(5 * time.Second); addr == ""; {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start listening")
+		}
+		if a := e.ListenerAddr(); a != nil {
+			addr = a.String()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			resCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		resCh <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	<-entered
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	res := <-resCh
+	if res.err != nil {
+		t.Fatalf("in-flight request failed: %v", res.err)
+	}
+	if res.status != http.StatusOK || res.body != "done" {
+		t.Errorf("response = %d %q, want 200 \"done\"", res.status, res.body)
+	}
+
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			t.Errorf("runServer returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop after SIGTERM")
+	}
+}
@@ -1,22 +1,38 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"log"
+	"math"
 	"net/http"
 	"sort"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
+	"golang.org/x/sync/errgroup"
 )
 
 type LivestreamStatistics struct {
-	Rank           int64 `json:"rank"`
-	ViewersCount   int64 `json:"viewers_count"`
-	TotalReactions int64 `json:"total_reactions"`
-	TotalReports   int64 `json:"total_reports"`
-	MaxTip         int64 `json:"max_tip"`
+	Rank               int64   `json:"rank"`
+	ViewersCount       int64   `json:"viewers_count"`
+	ActiveViewersCount int64   `json:"active_viewers_count"`
+	TotalReactions     int64   `json:"total_reactions"`
+	TotalReports       int64   `json:"total_reports"`
+	MaxTip             int64   `json:"max_tip"`
+	AvgTip             float64 `json:"avg_tip"`
+}
+
+// ComparisonResult は、2つの配信の統計情報の比較結果
+// Winnerは、スコア (リアクション数 + チップ合計) の高い方 ("stream1" | "stream2")。同点の場合は "tie"
+type ComparisonResult struct {
+	Stream1 LivestreamStatistics `json:"stream1"`
+	Stream2 LivestreamStatistics `json:"stream2"`
+	Winner  string               `json:"winner"`
 }
 
 type LivestreamRankingEntry struct {
@@ -36,12 +52,14 @@ func (r LivestreamRanking) Less(i, j int) bool {
 }
 
 type UserStatistics struct {
-	Rank              int64  `json:"rank"`
-	ViewersCount      int64  `json:"viewers_count"`
-	TotalReactions    int64  `json:"total_reactions"`
-	TotalLivecomments int64  `json:"total_livecomments"`
-	TotalTip          int64  `json:"total_tip"`
-	FavoriteEmoji     string `json:"favorite_emoji"`
+	Rank                int64  `json:"rank"`
+	ViewersCount        int64  `json:"viewers_count"`
+	TotalReactions      int64  `json:"total_reactions"`
+	TotalLivecomments   int64  `json:"total_livecomments"`
+	TotalTip            int64  `json:"total_tip"`
+	FavoriteEmoji       string `json:"favorite_emoji"`
+	TotalStreamsCount   int64  `json:"total_streams_count"`
+	OngoingStreamsCount int64  `json:"ongoing_streams_count"`
 }
 
 type UserRankingEntry struct {
@@ -60,6 +78,144 @@ func (r UserRanking) Less(i, j int) bool {
 	}
 }
 
+// userStatsCacheTTL は、ユーザ統計をキャッシュする期間 (環境変数USER_STATS_CACHE_TTLで変更できる)
+// ランクは他のユーザの配信でも変わるが、期限切れまでの間は古いランクを許容する
+var userStatsCacheTTL = 10 * time.Second
+
+func init() {
+	ttl, err := positiveDurationFromEnv("USER_STATS_CACHE_TTL", userStatsCacheTTL)
+	if err != nil {
+		log.Fatalf("failed to parse environment variable 'USER_STATS_CACHE_TTL' as positive duration: %v", err)
+	}
+	userStatsCacheTTL = ttl
+}
+
+var userStatsCache = &UserStatsCache{}
+
+type userStatsEntry struct {
+	value      UserStatistics
+	expiration time.Time
+}
+
+// UserStatsCache は、ユーザ名ごとのユーザ統計を保持する
+// 配信へのリアクションなどで統計を捨てられるよう、ユーザIDからユーザ名も引けるようにしておく
+type UserStatsCache struct {
+	data  sync.Map
+	names sync.Map
+}
+
+func (m *UserStatsCache) Set(username string, userID int64, stats UserStatistics, ttl time.Duration) {
+	m.names.Store(userID, username)
+	m.data.Store(username, userStatsEntry{
+		value:      stats,
+		expiration: time.Now().Add(jitteredTTL(ttl)),
+	})
+}
+
+func (m *UserStatsCache) Get(username string) (UserStatistics, bool) {
+	v, ok := m.data.Load(username)
+	if !ok {
+		return UserStatistics{}, false
+	}
+
+	e := v.(userStatsEntry)
+	if time.Now().After(e.expiration) {
+		// 有効期限切れの場合は削除
+		m.data.Delete(username)
+		return UserStatistics{}, false
+	}
+	return e.value, true
+}
+
+// DeleteByUserID は、配信者userIDの配信にリアクション・ライブコメント・入室があった場合に統計を捨てる
+func (m *UserStatsCache) DeleteByUserID(userID int64) {
+	if username, ok := m.names.Load(userID); ok {
+		m.data.Delete(username)
+	}
+}
+
+func (m *UserStatsCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+	m.names.Range(func(key, value interface{}) bool {
+		m.names.Delete(key)
+		return true
+	})
+}
+
+// livestreamStatsCacheTTL は、配信統計をキャッシュする期間 (環境変数LIVESTREAM_STATS_CACHE_TTLで変更できる)
+var livestreamStatsCacheTTL = 5 * time.Second
+
+func init() {
+	ttl, err := positiveDurationFromEnv("LIVESTREAM_STATS_CACHE_TTL", livestreamStatsCacheTTL)
+	if err != nil {
+		log.Fatalf("failed to parse environment variable 'LIVESTREAM_STATS_CACHE_TTL' as positive duration: %v", err)
+	}
+	livestreamStatsCacheTTL = ttl
+}
+
+var livestreamStatsCache = &LivestreamStatsCache{}
+
+type livestreamStatsEntry struct {
+	value LivestreamStatistics
+	// ランキングのスコア (配信比較で使う)
+	score      int64
+	expiration time.Time
+}
+
+// LivestreamStatsCache は、配信IDごとの配信統計を保持する
+type LivestreamStatsCache struct {
+	data sync.Map
+}
+
+func (m *LivestreamStatsCache) Set(livestreamID int64, stats LivestreamStatistics, score int64, ttl time.Duration) {
+	m.data.Store(livestreamID, livestreamStatsEntry{
+		value:      stats,
+		score:      score,
+		expiration: time.Now().Add(jitteredTTL(ttl)),
+	})
+}
+
+func (m *LivestreamStatsCache) Get(livestreamID int64) (LivestreamStatistics, int64, bool) {
+	v, ok := m.data.Load(livestreamID)
+	if !ok {
+		return LivestreamStatistics{}, 0, false
+	}
+
+	e := v.(livestreamStatsEntry)
+	if time.Now().After(e.expiration) {
+		// 有効期限切れの場合は削除
+		m.data.Delete(livestreamID)
+		return LivestreamStatistics{}, 0, false
+	}
+	return e.value, e.score, true
+}
+
+func (m *LivestreamStatsCache) Delete(livestreamID int64) {
+	m.data.Delete(livestreamID)
+}
+
+func (m *LivestreamStatsCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+}
+
+// purgeAllLivestreamStatsCache は、全配信の統計キャッシュを捨てる
+func purgeAllLivestreamStatsCache() {
+	livestreamStatsCache.CleanupAll()
+}
+
+// invalidateLivestreamActivityCaches は、配信にリアクション・ライブコメント・入室があった場合に、
+// その配信と配信者の統計キャッシュを捨てる
+func invalidateLivestreamActivityCaches(livestreamID, ownerID int64) {
+	livestreamStatsCache.Delete(livestreamID)
+	userStatsCache.DeleteByUserID(ownerID)
+}
+
 func getUserStatisticsHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 
@@ -69,6 +225,9 @@ func getUserStatisticsHandler(c echo.Context) error {
 	}
 
 	username := c.Param("username")
+	if stats, ok := userStatsCache.Get(username); ok {
+		return c.JSON(http.StatusOK, stats)
+	}
 	// ユーザごとに、紐づく配信について、累計リアクション数、累計ライブコメント数、累計売上金額を算出
 	// また、現在の合計視聴者数もだす
 
@@ -82,14 +241,96 @@ func getUserStatisticsHandler(c echo.Context) error {
 	}
 
 	// ランク算出
+	scores, err := getUserScores(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user scores: "+err.Error())
+	}
+	rank := scores.ranking().rankOf(username)
+
+	// リアクション数 (ランク算出時に集計済みのものを使い回す)
+	totalReactions := scores.reactions[user.ID]
+
+	// 配信数 (累計、配信中)
+	var streamsCount struct {
+		Total   int64 `db:"total"`
+		Ongoing int64 `db:"ongoing"`
+	}
+	now := time.Now().Unix()
+	if err := dbConn.GetContext(ctx, &streamsCount, "SELECT COUNT(*) AS total, IFNULL(SUM(CASE WHEN start_at <= ? AND end_at > ? THEN 1 ELSE 0 END), 0) AS ongoing FROM livestreams WHERE user_id = ?", now, now, user.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count livestreams: "+err.Error())
+	}
+
+	// ライブコメント数、チップ合計
+	var livecommentStats struct {
+		Count int64 `db:"count"`
+		Tip   int64 `db:"tip"`
+	}
+	if err := dbConn.GetContext(ctx, &livecommentStats, "SELECT COUNT(*) AS count, IFNULL(SUM(l2.tip), 0) AS tip FROM livestreams l INNER JOIN livecomments l2 ON l2.livestream_id = l.id WHERE l.user_id = ?", user.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count livecomments: "+err.Error())
+	}
+	totalLivecomments := livecommentStats.Count
+	totalTip := livecommentStats.Tip
+
+	// 合計視聴者数
+	var viewersCount int64
+	if err := dbConn.GetContext(ctx, &viewersCount, "SELECT COUNT(*) FROM livestreams l INNER JOIN livestream_viewers_history h ON h.livestream_id = l.id WHERE l.user_id = ?", user.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream_view_history: "+err.Error())
+	}
+
+	// お気に入り絵文字
+	var favoriteEmoji string
+	query := `
+	SELECT r.emoji_name_normalized
+	FROM users u
+	INNER JOIN livestreams l ON l.user_id = u.id
+	INNER JOIN reactions r ON r.livestream_id = l.id
+	WHERE u.name = ?
+	GROUP BY r.emoji_name_normalized
+	ORDER BY COUNT(*) DESC, r.emoji_name_normalized DESC
+	LIMIT 1
+	`
+	if err := dbConn.GetContext(ctx, &favoriteEmoji, query, username); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to find favorite emoji: "+err.Error())
+	}
+
+	stats := UserStatistics{
+		Rank:                rank,
+		ViewersCount:        viewersCount,
+		TotalReactions:      totalReactions,
+		TotalLivecomments:   totalLivecomments,
+		TotalTip:            totalTip,
+		FavoriteEmoji:       favoriteEmoji,
+		TotalStreamsCount:   streamsCount.Total,
+		OngoingStreamsCount: streamsCount.Ongoing,
+	}
+	userStatsCache.Set(username, user.ID, stats, userStatsCacheTTL)
+	return c.JSON(http.StatusOK, stats)
+}
+
+// userScores は、ユーザごとの累計リアクション数と累計チップ額 (ユーザのランク算出に使う)
+type userScores struct {
+	users     []*UserModel
+	reactions map[int64]int64
+	tips      map[int64]int64
+}
+
+func getUserScores(ctx context.Context) (userScores, error) {
 	var users []*UserModel
 	if err := dbConn.SelectContext(ctx, &users, "SELECT * FROM users"); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get users: "+err.Error())
+		return userScores{}, err
 	}
 	userIDs := make([]int64, len(users))
 	for i := range users {
 		userIDs[i] = users[i].ID
 	}
+	scores := userScores{
+		users:     users,
+		reactions: make(map[int64]int64),
+		tips:      make(map[int64]int64),
+	}
+	if len(userIDs) == 0 {
+		return scores, nil
+	}
 
 	type userCount struct {
 		UserID int64 `db:"user_id"`
@@ -102,11 +343,10 @@ func getUserStatisticsHandler(c echo.Context) error {
 	INNER JOIN reactions r ON r.livestream_id = l.id
 	WHERE u.id IN (?) GROUP BY u.id`, userIDs)
 	if err := dbConn.SelectContext(ctx, &userCounts, q, params...); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count reactions: "+err.Error())
+		return userScores{}, err
 	}
-	userCountMap := make(map[int64]int64)
 	for i := range userCounts {
-		userCountMap[userCounts[i].UserID] = userCounts[i].Count
+		scores.reactions[userCounts[i].UserID] = userCounts[i].Count
 	}
 
 	type userTip struct {
@@ -119,104 +359,70 @@ func getUserStatisticsHandler(c echo.Context) error {
 		INNER JOIN livecomments l2 ON l2.livestream_id = l.id
 		WHERE u.id IN (?) GROUP BY u.id`, userIDs)
 	if err := dbConn.SelectContext(ctx, &userTips, q, params...); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count tips: "+err.Error())
+		return userScores{}, err
 	}
-	userTipMap := make(map[int64]int64)
 	for i := range userTips {
-		userTipMap[userTips[i].UserID] = userTips[i].Tip
+		scores.tips[userTips[i].UserID] = userTips[i].Tip
 	}
 
+	return scores, nil
+}
+
+// ranking は、スコア (累計リアクション数 + 累計チップ額) の昇順に並べたランキングを返す
+func (s userScores) ranking() UserRanking {
 	var ranking UserRanking
-	for _, user := range users {
-		score := userCountMap[user.ID] + userTipMap[user.ID]
+	for _, user := range s.users {
+		score := s.reactions[user.ID] + s.tips[user.ID]
 		ranking = append(ranking, UserRankingEntry{
 			Username: user.Name,
 			Score:    score,
 		})
 	}
 	sort.Sort(ranking)
+	return ranking
+}
 
+// rankOf は、ユーザのランク (1始まり) を返す
+func (r UserRanking) rankOf(username string) int64 {
 	var rank int64 = 1
-	for i := len(ranking) - 1; i >= 0; i-- {
-		entry := ranking[i]
+	for i := len(r) - 1; i >= 0; i-- {
+		entry := r[i]
 		if entry.Username == username {
 			break
 		}
 		rank++
 	}
+	return rank
+}
 
-	// リアクション数
-	var totalReactions int64
-	query := `SELECT COUNT(*) FROM users u 
-    INNER JOIN livestreams l ON l.user_id = u.id 
-    INNER JOIN reactions r ON r.livestream_id = l.id
-    WHERE u.name = ?
-	`
-	if err := dbConn.GetContext(ctx, &totalReactions, query, username); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count total reactions: "+err.Error())
-	}
-
-	// ライブコメント数、チップ合計
-	var totalLivecomments int64
-	var totalTip int64
-	var livestreams []*LivestreamModel
-	if err := dbConn.SelectContext(ctx, &livestreams, "SELECT * FROM livestreams WHERE user_id = ?", user.ID); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
-	}
-
-	for _, livestream := range livestreams {
-		var livecomments []*LivecommentModel
-		if err := dbConn.SelectContext(ctx, &livecomments, "SELECT * FROM livecomments WHERE livestream_id = ?", livestream.ID); err != nil && !errors.Is(err, sql.ErrNoRows) {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livecomments: "+err.Error())
-		}
+func getLivestreamStatisticsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
 
-		for _, livecomment := range livecomments {
-			totalTip += livecomment.Tip
-			totalLivecomments++
-		}
+	if err := verifyUserSession(c); err != nil {
+		return err
 	}
 
-	// 合計視聴者数
-	var viewersCount int64
-	for _, livestream := range livestreams {
-		var cnt int64
-		if err := dbConn.GetContext(ctx, &cnt, "SELECT COUNT(*) FROM livestream_viewers_history WHERE livestream_id = ?", livestream.ID); err != nil && !errors.Is(err, sql.ErrNoRows) {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream_view_history: "+err.Error())
-		}
-		viewersCount += cnt
+	id, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
 
-	// お気に入り絵文字
-	var favoriteEmoji string
-	query = `
-	SELECT r.emoji_name
-	FROM users u
-	INNER JOIN livestreams l ON l.user_id = u.id
-	INNER JOIN reactions r ON r.livestream_id = l.id
-	WHERE u.name = ?
-	GROUP BY emoji_name
-	ORDER BY COUNT(*) DESC, emoji_name DESC
-	LIMIT 1
-	`
-	if err := dbConn.GetContext(ctx, &favoriteEmoji, query, username); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to find favorite emoji: "+err.Error())
+	stats, _, err := getLivestreamStatistics(ctx, int64(id))
+	if err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
 	}
 
-	stats := UserStatistics{
-		Rank:              rank,
-		ViewersCount:      viewersCount,
-		TotalReactions:    totalReactions,
-		TotalLivecomments: totalLivecomments,
-		TotalTip:          totalTip,
-		FavoriteEmoji:     favoriteEmoji,
-	}
 	return c.JSON(http.StatusOK, stats)
 }
 
-func getLivestreamStatisticsHandler(c echo.Context) error {
+// 配信統計情報比較API
+// GET /api/livestream/:livestream_id/stats/compare/:other_id
+func getLivestreamComparisonHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
 		return err
 	}
 
@@ -224,49 +430,176 @@ func getLivestreamStatisticsHandler(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
 	}
-	livestreamID := int64(id)
+	otherID, err := strconv.Atoi(c.Param("other_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "other_id in path must be integer")
+	}
+	if id == otherID {
+		return echo.NewHTTPError(http.StatusBadRequest, "cannot compare a livestream with itself")
+	}
+
+	var (
+		result         ComparisonResult
+		score1, score2 int64
+	)
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		var err error
+		result.Stream1, score1, err = getLivestreamStatistics(egCtx, int64(id))
+		return err
+	})
+	eg.Go(func() error {
+		var err error
+		result.Stream2, score2, err = getLivestreamStatistics(egCtx, int64(otherID))
+		return err
+	})
+	if err := eg.Wait(); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	switch {
+	case score1 > score2:
+		result.Winner = "stream1"
+	case score1 < score2:
+		result.Winner = "stream2"
+	default:
+		result.Winner = "tie"
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// livestreamStatisticsConcurrency は、1つの配信の統計情報を集計する際に同時に発行するクエリ数の上限
+// DBの接続数 (SetMaxOpenConns) は10なので、比較APIで2配信分を同時に集計しても使い切らないようにする
+const livestreamStatisticsConcurrency = 3
+
+// getLivestreamStatistics は、配信の統計情報と、ランキングのスコア (リアクション数 + チップ合計) を返す
+// エラーはecho.NewHTTPErrorで返す
+func getLivestreamStatistics(ctx context.Context, livestreamID int64) (LivestreamStatistics, int64, error) {
+	if stats, score, ok := livestreamStatsCache.Get(livestreamID); ok {
+		return stats, score, nil
+	}
 
 	var livestream LivestreamModel
 	if err := dbConn.GetContext(ctx, &livestream, "SELECT * FROM livestreams WHERE id = ?", livestreamID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return echo.NewHTTPError(http.StatusBadRequest, "cannot get stats of not found livestream")
+			return LivestreamStatistics{}, 0, echo.NewHTTPError(http.StatusBadRequest, "cannot get stats of not found livestream")
 		} else {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
+			return LivestreamStatistics{}, 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error())
 		}
 	}
 
-	var livestreams []*LivestreamModel
-	if err := dbConn.SelectContext(ctx, &livestreams, "SELECT * FROM livestreams"); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
-	}
+	// 互いに独立した集計は並行して行い、ランク算出だけ全配信の集計を待ってから行う
+	var (
+		livestreamIDs      []int64
+		reactionMap        map[int64]int64
+		totalTipsMap       map[int64]int64
+		viewersCount       int64
+		activeViewersCount int64
+		maxTip             int64
+		avgTip             float64
+		totalReactions     int64
+		totalReports       int64
+	)
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(livestreamStatisticsConcurrency)
+
+	// ランク算出用の全配信のリアクション数、チップ合計
+	eg.Go(func() error {
+		var livestreams []*LivestreamModel
+		if err := dbConn.SelectContext(egCtx, &livestreams, "SELECT * FROM livestreams"); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestreams: "+err.Error())
+		}
 
-	livestreamIDs := make([]int64, len(livestreams))
-	for i := range livestreams {
-		livestreamIDs[i] = livestreams[i].ID
-	}
+		livestreamIDs = make([]int64, len(livestreams))
+		for i := range livestreams {
+			livestreamIDs[i] = livestreams[i].ID
+		}
 
-	type count struct {
-		ID    int64 `db:"id"`
-		Count int64 `db:"count"`
-	}
-	var reactions []count
-	q, params, err := sqlx.In("SELECT l.id, COUNT(*) AS `count` FROM livestreams l INNER JOIN reactions r ON l.id = r.livestream_id WHERE l.id IN (?) GROUP BY l.id", livestreamIDs)
-	if err := dbConn.SelectContext(ctx, &reactions, q, params...); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count reactions: "+err.Error())
-	}
-	reactionMap := make(map[int64]int64)
-	for i := range reactions {
-		reactionMap[reactions[i].ID] = reactions[i].Count
-	}
+		type count struct {
+			ID    int64 `db:"id"`
+			Count int64 `db:"count"`
+		}
+		var reactions []count
+		q, params, err := sqlx.In("SELECT l.id, COUNT(*) AS `count` FROM livestreams l INNER JOIN reactions r ON l.id = r.livestream_id WHERE l.id IN (?) GROUP BY l.id", livestreamIDs)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to construct IN query: "+err.Error())
+		}
+		if err := dbConn.SelectContext(egCtx, &reactions, q, params...); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to count reactions: "+err.Error())
+		}
+		reactionMap = make(map[int64]int64)
+		for i := range reactions {
+			reactionMap[reactions[i].ID] = reactions[i].Count
+		}
 
-	var totalTips []count
-	q, params, err = sqlx.In("SELECT l.id, IFNULL(SUM(l2.tip), 0) AS `count` FROM livestreams l INNER JOIN livecomments l2 ON l.id = l2.livestream_id WHERE l.id IN (?) GROUP BY l.id", livestreamIDs)
-	if err := dbConn.SelectContext(ctx, &totalTips, q, params...); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count tips: "+err.Error())
-	}
-	totalTipsMap := make(map[int64]int64)
-	for i := range totalTips {
-		totalTipsMap[totalTips[i].ID] = totalTips[i].Count
+		var totalTips []count
+		q, params, err = sqlx.In("SELECT l.id, IFNULL(SUM(l2.tip), 0) AS `count` FROM livestreams l INNER JOIN livecomments l2 ON l.id = l2.livestream_id WHERE l.id IN (?) GROUP BY l.id", livestreamIDs)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to construct IN query: "+err.Error())
+		}
+		if err := dbConn.SelectContext(egCtx, &totalTips, q, params...); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to count tips: "+err.Error())
+		}
+		totalTipsMap = make(map[int64]int64)
+		for i := range totalTips {
+			totalTipsMap[totalTips[i].ID] = totalTips[i].Count
+		}
+		return nil
+	})
+
+	// 視聴者数算出
+	eg.Go(func() error {
+		if err := dbConn.GetContext(egCtx, &viewersCount, `SELECT COUNT(*) FROM livestreams l INNER JOIN livestream_viewers_history h ON h.livestream_id = l.id WHERE l.id = ?`, livestreamID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to count livestream viewers: "+err.Error())
+		}
+		return nil
+	})
+
+	// 現在視聴中の視聴者数 (直近の入室またはハートビートから一定時間以内)
+	eg.Go(func() error {
+		if err := dbConn.GetContext(egCtx, &activeViewersCount, `SELECT COUNT(*) FROM livestream_viewers_history WHERE livestream_id = ? AND last_seen_at >= ?`, livestreamID, time.Now().Unix()-activeViewerWindowSeconds); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to count active livestream viewers: "+err.Error())
+		}
+		return nil
+	})
+
+	// 最大チップ額
+	eg.Go(func() error {
+		if err := dbConn.GetContext(egCtx, &maxTip, `SELECT IFNULL(MAX(tip), 0) FROM livestreams l INNER JOIN livecomments l2 ON l2.livestream_id = l.id WHERE l.id = ?`, livestreamID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to find maximum tip livecomment: "+err.Error())
+		}
+		return nil
+	})
+
+	// 平均チップ額 (チップ0のライブコメントは除外して、チップを投げた視聴者の中での平均をとる)
+	eg.Go(func() error {
+		if err := dbConn.GetContext(egCtx, &avgTip, `SELECT IFNULL(AVG(tip), 0.0) FROM livecomments WHERE livestream_id = ? AND tip > 0`, livestreamID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to calculate average tip: "+err.Error())
+		}
+		avgTip = math.Round(avgTip*100) / 100
+		return nil
+	})
+
+	// リアクション数
+	eg.Go(func() error {
+		if err := dbConn.GetContext(egCtx, &totalReactions, "SELECT COUNT(*) FROM livestreams l INNER JOIN reactions r ON r.livestream_id = l.id WHERE l.id = ?", livestreamID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to count total reactions: "+err.Error())
+		}
+		return nil
+	})
+
+	// スパム報告数
+	eg.Go(func() error {
+		if err := dbConn.GetContext(egCtx, &totalReports, `SELECT COUNT(*) FROM livestreams l INNER JOIN livecomment_reports r ON r.livestream_id = l.id WHERE l.id = ?`, livestreamID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to count total spam reports: "+err.Error())
+		}
+		return nil
+	})
+
+	if err := eg.Wait(); err != nil {
+		return LivestreamStatistics{}, 0, err
 	}
 
 	// ランク算出
@@ -290,35 +623,16 @@ func getLivestreamStatisticsHandler(c echo.Context) error {
 		rank++
 	}
 
-	// 視聴者数算出
-	var viewersCount int64
-	if err := dbConn.GetContext(ctx, &viewersCount, `SELECT COUNT(*) FROM livestreams l INNER JOIN livestream_viewers_history h ON h.livestream_id = l.id WHERE l.id = ?`, livestreamID); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count livestream viewers: "+err.Error())
-	}
-
-	// 最大チップ額
-	var maxTip int64
-	if err := dbConn.GetContext(ctx, &maxTip, `SELECT IFNULL(MAX(tip), 0) FROM livestreams l INNER JOIN livecomments l2 ON l2.livestream_id = l.id WHERE l.id = ?`, livestreamID); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to find maximum tip livecomment: "+err.Error())
-	}
-
-	// リアクション数
-	var totalReactions int64
-	if err := dbConn.GetContext(ctx, &totalReactions, "SELECT COUNT(*) FROM livestreams l INNER JOIN reactions r ON r.livestream_id = l.id WHERE l.id = ?", livestreamID); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count total reactions: "+err.Error())
-	}
-
-	// スパム報告数
-	var totalReports int64
-	if err := dbConn.GetContext(ctx, &totalReports, `SELECT COUNT(*) FROM livestreams l INNER JOIN livecomment_reports r ON r.livestream_id = l.id WHERE l.id = ?`, livestreamID); err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to count total spam reports: "+err.Error())
+	stats := LivestreamStatistics{
+		Rank:               rank,
+		ViewersCount:       viewersCount,
+		ActiveViewersCount: activeViewersCount,
+		MaxTip:             maxTip,
+		AvgTip:             avgTip,
+		TotalReactions:     totalReactions,
+		TotalReports:       totalReports,
 	}
-
-	return c.JSON(http.StatusOK, LivestreamStatistics{
-		Rank:           rank,
-		ViewersCount:   viewersCount,
-		MaxTip:         maxTip,
-		TotalReactions: totalReactions,
-		TotalReports:   totalReports,
-	})
+	score := reactionMap[livestreamID] + totalTipsMap[livestreamID]
+	livestreamStatsCache.Set(livestreamID, stats, score, livestreamStatsCacheTTL)
+	return stats, score, nil
 }
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+// newStatsTestServer は、ログイン済みのCookieとユーザ統計APIだけを持つサーバを返す
+func newStatsTestServer(tb testing.TB) (*echo.Echo, string) {
+	useSessionVersion(tb, 1, 0)
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	e.POST("/login", func(c echo.Context) error {
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultSessionIDKey] = uuid.NewString()
+		sess.Values[defaultUserIDKey] = int64(1)
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+		if err := sess.Save(c.Request(), c.Response()); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/api/user/:username/statistics", getUserStatisticsHandler)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) == 0 {
+		tb.Fatal("login did not set a session cookie")
+	}
+	return e, cookies[0].Name + "=" + cookies[0].Value
+}
+
+// fakeUserStatsData は、ユーザ統計の集計に使うユーザ、配信、リアクションの組
+type fakeUserStatsData struct {
+	// ユーザIDの昇順
+	users []string
+	// 配信IDごとの配信者のユーザID
+	livestreamOwners map[int64]int64
+	// 配信IDごとのリアクション数
+	reactions map[int64]int64
+}
+
+// reactionsOf は、ユーザの配信へのリアクション数の合計を返す
+func (s fakeUserStatsData) reactionsOf(userID int64) int64 {
+	var n int64
+	for livestreamID, ownerID := range s.livestreamOwners {
+		if ownerID == userID {
+			n += s.reactions[livestreamID]
+		}
+	}
+	return n
+}
+
+func (s fakeUserStatsData) userID(name string) int64 {
+	for i, u := range s.users {
+		if u == name {
+			return int64(i + 1)
+		}
+	}
+	return 0
+}
+
+// separateReactionCountQuery は、ユーザごとに1回発行していたリアクション数のクエリ
+const separateReactionCountQuery = "SELECT COUNT(*) FROM users u INNER JOIN livestreams l ON l.user_id = u.id INNER JOIN reactions r ON r.livestream_id = l.id WHERE u.name = ?"
+
+// newFakeUserStatsDB は、dataからユーザ統計APIのクエリに答えるfakeDBを作る
+// ライブコメント、視聴者、お気に入り絵文字は0件として扱う
+func newFakeUserStatsDB(data fakeUserStatsData) *fakeDB {
+	d := &fakeDB{}
+	userRow := func(id int64) []driver.Value { return []driver.Value{id, data.users[id-1]} }
+	d.onQuery("SELECT * FROM users WHERE name = ?", func(_ string, args []driver.Value) (driver.Rows, error) {
+		rows := &fakeRows{columns: []string{"id", "name"}}
+		if id := data.userID(args[0].(string)); id != 0 {
+			rows.values = append(rows.values, userRow(id))
+		}
+		return rows, nil
+	})
+	d.onQuery("SELECT * FROM users", func(string, []driver.Value) (driver.Rows, error) {
+		rows := &fakeRows{columns: []string{"id", "name"}}
+		for i := range data.users {
+			rows.values = append(rows.values, userRow(int64(i+1)))
+		}
+		return rows, nil
+	})
+	// ランク算出用のユーザごとのリアクション数 (リアクションのないユーザは行を返さない)
+	d.onQuery("SELECT u.id AS user_id, COUNT(*)", func(_ string, args []driver.Value) (driver.Rows, error) {
+		rows := &fakeRows{columns: []string{"user_id", "count"}}
+		for _, arg := range args {
+			if n := data.reactionsOf(arg.(int64)); n > 0 {
+				rows.values = append(rows.values, []driver.Value{arg, n})
+			}
+		}
+		return rows, nil
+	})
+	d.onQuery(separateReactionCountQuery, func(_ string, args []driver.Value) (driver.Rows, error) {
+		return fakeValue("count", data.reactionsOf(data.userID(args[0].(string)))), nil
+	})
+	d.onQuery("SELECT COUNT(*) AS total", func(string, []driver.Value) (driver.Rows, error) {
+		return &fakeRows{columns: []string{"total", "ongoing"}, values: [][]driver.Value{{int64(0), int64(0)}}}, nil
+	})
+	d.onQuery("SELECT COUNT(*) AS count", func(string, []driver.Value) (driver.Rows, error) {
+		return &fakeRows{columns: []string{"count", "tip"}, values: [][]driver.Value{{int64(0), int64(0)}}}, nil
+	})
+	d.onQuery("SELECT COUNT(*) FROM livestreams l INNER JOIN livestream_viewers_history", func(string, []driver.Value) (driver.Rows, error) {
+		return fakeValue("count", int64(0)), nil
+	})
+	// チップ合計、お気に入り絵文字は0行
+	d.onQuery("", func(string, []driver.Value) (driver.Rows, error) { return &fakeRows{}, nil })
+	return d
+}
+
+func TestGetUserStatisticsHandler_TotalReactions(t *testing.T) {
+	data := fakeUserStatsData{
+		users:            []string{"user1", "alice", "bob", "carol"},
+		livestreamOwners: map[int64]int64{10: 2, 11: 2, 12: 3, 13: 3},
+		// carolは配信していない、bobの配信13にはリアクションがない
+		reactions: map[int64]int64{10: 3, 11: 2, 12: 1},
+	}
+	useFakeDB(t, newFakeUserStatsDB(data))
+	useLivestreamStatsCache(t)
+	e, cookie := newStatsTestServer(t)
+
+	for _, name := range data.users {
+		// ランク算出時の集計を使い回しても、ユーザごとに数えた場合と一致する
+		var want int64
+		if err := dbConn.GetContext(context.Background(), &want, separateReactionCountQuery, name); err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/user/"+name+"/statistics", nil)
+		req.Header.Set("Cookie", cookie)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", name, rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var stats UserStatistics
+		if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+			t.Fatal(err)
+		}
+		if stats.TotalReactions != want {
+			t.Errorf("%s: total_reactions = %d, want %d", name, stats.TotalReactions, want)
+		}
+	}
+}
+
+func TestGetUserStatisticsHandler_QueryCount(t *testing.T) {
+	var counts []int
+	for _, n := range []int{1, 10, 100} {
+		data := fakeUserStatsData{
+			users:            []string{"user1", "alice"},
+			livestreamOwners: make(map[int64]int64, n),
+			reactions:        make(map[int64]int64, n),
+		}
+		for i := range n {
+			data.livestreamOwners[int64(i+1)] = 2
+			data.reactions[int64(i+1)] = 1
+		}
+		d := newFakeUserStatsDB(data)
+		useFakeDB(t, d)
+		useLivestreamStatsCache(t)
+		e, cookie := newStatsTestServer(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/user/alice/statistics", nil)
+		req.Header.Set("Cookie", cookie)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("n=%d: status = %d, want %d: %s", n, rec.Code, http.StatusOK, rec.Body.String())
+		}
+		counts = append(counts, d.queryCount())
+
+		// 配信ごとのクエリやユーザごとのリアクション数のクエリは発行しない
+		for _, prefix := range []string{
+			"SELECT * FROM livestreams WHERE",
+			"SELECT * FROM livecomments WHERE",
+			separateReactionCountQuery,
+		} {
+			if got := d.queriesWithPrefix(prefix); got != 0 {
+				t.Errorf("n=%d: %q was issued %d times, want 0", n, prefix, got)
+			}
+		}
+	}
+
+	// 配信数によらずクエリ数は一定
+	for i := range counts {
+		if counts[i] != counts[0] {
+			t.Errorf("query count must not depend on the number of livestreams: %v", counts)
+			break
+		}
+	}
+}
+
+func TestUserStatsCache_DeleteByUserID(t *testing.T) {
+	cache := &UserStatsCache{}
+	cache.Set("alice", 1, UserStatistics{Rank: 1}, time.Minute)
+	cache.Set("bob", 2, UserStatistics{Rank: 2}, time.Minute)
+
+	cache.DeleteByUserID(1)
+	if _, ok := cache.Get("alice"); ok {
+		t.Error("alice's statistics are still cached after DeleteByUserID")
+	}
+	if stats, ok := cache.Get("bob"); !ok || stats.Rank != 2 {
+		t.Errorf("Get(bob) = %+v, %v, want Rank 2, true", stats, ok)
+	}
+	// キャッシュしていないユーザは何もしない
+	cache.DeleteByUserID(3)
+}
+
+func BenchmarkGetUserStatisticsHandler_Cached(b *testing.B) {
+	// themes以外のクエリはエラーになり、発行されたクエリは記録される
+	d := useFakeThemeDB(b)
+	userStatsCache.CleanupAll()
+	b.Cleanup(userStatsCache.CleanupAll)
+	userStatsCache.Set("alice", 1, UserStatistics{Rank: 1, TotalReactions: 10}, time.Hour)
+
+	e, cookie := newStatsTestServer(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/alice/statistics", nil)
+		req.Header.Set("Cookie", cookie)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			b.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+	b.StopTimer()
+
+	if len(d.queries()) != 0 {
+		b.Errorf("cached path issued %d queries: %v", len(d.queries()), d.queries())
+	}
+}
+
+func useLivestreamStatsCache(tb testing.TB) {
+	purgeAllLivestreamStatsCache()
+	userStatsCache.CleanupAll()
+	tb.Cleanup(func() {
+		purgeAllLivestreamStatsCache()
+		userStatsCache.CleanupAll()
+	})
+}
+
+func TestGetLivestreamStatistics_CacheHit(t *testing.T) {
+	d := useFakeThemeDB(t)
+	useLivestreamStatsCache(t)
+	livestreamStatsCache.Set(1, LivestreamStatistics{Rank: 3, TotalReactions: 5}, 8, time.Hour)
+
+	stats, score, err := getLivestreamStatistics(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Rank != 3 || stats.TotalReactions != 5 || score != 8 {
+		t.Errorf("stats = %+v, score = %d, want cached values", stats, score)
+	}
+	if len(d.queries()) != 0 {
+		t.Errorf("cache hit issued %d queries: %v", len(d.queries()), d.queries())
+	}
+}
+
+func TestGetLivestreamStatistics_AvgTip(t *testing.T) {
+	tests := []struct {
+		name string
+		tips []int64
+		want float64
+	}{
+		// チップ0のライブコメントは平均に含めない
+		{name: "excludes zero tips", tips: []int64{0, 0, 100, 200}, want: 150},
+		{name: "no tips", tips: []int64{0, 0}, want: 0},
+		{name: "no livecomments", tips: nil, want: 0},
+		{name: "rounded to cents", tips: []int64{100, 101, 101}, want: 100.67},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &fakeDB{}
+			d.onQuery("SELECT * FROM livestreams WHERE id = ?", func(string, []driver.Value) (driver.Rows, error) {
+				return &fakeRows{columns: []string{"id", "user_id"}, values: [][]driver.Value{{int64(1), int64(1)}}}, nil
+			})
+			d.onQuery("SELECT * FROM livestreams", func(string, []driver.Value) (driver.Rows, error) {
+				return &fakeRows{columns: []string{"id", "user_id"}, values: [][]driver.Value{{int64(1), int64(1)}}}, nil
+			})
+			d.onQuery("SELECT IFNULL(AVG(tip), 0.0) FROM livecomments", func(query string, _ []driver.Value) (driver.Rows, error) {
+				var sum, n int64
+				for _, tip := range tt.tips {
+					if tip == 0 && strings.Contains(query, "tip > 0") {
+						continue
+					}
+					sum += tip
+					n++
+				}
+				if n == 0 {
+					return fakeValue("avg", float64(0)), nil
+				}
+				return fakeValue("avg", float64(sum)/float64(n)), nil
+			})
+			d.onQuery("SELECT COUNT(*)", func(string, []driver.Value) (driver.Rows, error) { return fakeValue("count", int64(0)), nil })
+			d.onQuery("SELECT IFNULL(MAX(tip), 0)", func(string, []driver.Value) (driver.Rows, error) { return fakeValue("max", int64(0)), nil })
+			// ランク算出用の集計は0行
+			d.onQuery("", func(string, []driver.Value) (driver.Rows, error) { return &fakeRows{}, nil })
+			useFakeDB(t, d)
+			useLivestreamStatsCache(t)
+
+			stats, _, err := getLivestreamStatistics(context.Background(), 1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if stats.AvgTip != tt.want {
+				t.Errorf("avg_tip = %v, want %v", stats.AvgTip, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidateLivestreamActivityCaches(t *testing.T) {
+	useLivestreamStatsCache(t)
+	livestreamStatsCache.Set(1, LivestreamStatistics{Rank: 1}, 0, time.Hour)
+	livestreamStatsCache.Set(2, LivestreamStatistics{Rank: 2}, 0, time.Hour)
+	userStatsCache.Set("alice", 10, UserStatistics{Rank: 1}, time.Hour)
+
+	// 配信者aliceの配信1へのリアクション
+	invalidateLivestreamActivityCaches(1, 10)
+
+	if _, _, ok := livestreamStatsCache.Get(1); ok {
+		t.Error("statistics of the reacted livestream are still cached")
+	}
+	if _, _, ok := livestreamStatsCache.Get(2); !ok {
+		t.Error("statistics of other livestreams must be kept")
+	}
+	if _, ok := userStatsCache.Get("alice"); ok {
+		t.Error("statistics of the livestream owner are still cached")
+	}
+
+	purgeAllLivestreamStatsCache()
+	if _, _, ok := livestreamStatsCache.Get(2); ok {
+		t.Error("statistics are still cached after purgeAllLivestreamStatsCache")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// テーマは登録後ほぼ変更されないため、アイコンハッシュより長めに保持する
+const themeCacheTTL = 60 * time.Second
+
+var themeCache = &ThemeCache{}
+
+type themeEntry struct {
+	value      ThemeModel
+	expiration time.Time
+}
+
+// ThemeCache は、ユーザIDごとのテーマを保持する
+type ThemeCache struct {
+	data sync.Map
+}
+
+func (m *ThemeCache) Set(key int64, theme ThemeModel, ttl time.Duration) {
+	m.data.Store(key, themeEntry{
+		value:      theme,
+		expiration: time.Now().Add(jitteredTTL(ttl)),
+	})
+}
+
+func (m *ThemeCache) Get(key int64) (ThemeModel, bool) {
+	v, ok := m.data.Load(key)
+	if !ok {
+		return ThemeModel{}, false
+	}
+
+	e := v.(themeEntry)
+	if time.Now().After(e.expiration) {
+		// 有効期限切れの場合は削除
+		m.data.Delete(key)
+		return ThemeModel{}, false
+	}
+	return e.value, true
+}
+
+// Delete は、テーマが変更されたユーザのエントリを削除する
+func (m *ThemeCache) Delete(key int64) {
+	m.data.Delete(key)
+}
+
+func (m *ThemeCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+}
+
+func getThemeCache(ctx context.Context, q sqlx.QueryerContext, userID int64) (ThemeModel, error) {
+	if theme, ok := themeCache.Get(userID); ok {
+		return theme, nil
+	}
+
+	themeModel := ThemeModel{}
+	if err := sqlx.GetContext(ctx, q, &themeModel, "SELECT * FROM themes WHERE user_id = ?", userID); err != nil {
+		return ThemeModel{}, err
+	}
+	themeCache.Set(userID, themeModel, themeCacheTTL)
+
+	return themeModel, nil
+}
+
+// getThemeMapCache は、ユーザIDをキーとしたテーマを返す
+// キャッシュにないユーザのテーマだけをまとめて取得する
+func getThemeMapCache(ctx context.Context, q sqlx.QueryerContext, userIDs []int64) (map[int64]ThemeModel, error) {
+	themeMap := make(map[int64]ThemeModel, len(userIDs))
+	missingIDs := make([]int64, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if theme, ok := themeCache.Get(userID); ok {
+			themeMap[userID] = theme
+		} else {
+			missingIDs = append(missingIDs, userID)
+		}
+	}
+	if len(missingIDs) == 0 {
+		return themeMap, nil
+	}
+
+	query, params, err := sqlx.In("SELECT * FROM themes WHERE user_id IN (?)", missingIDs)
+	if err != nil {
+		return nil, err
+	}
+	var themeModels []ThemeModel
+	if err := sqlx.SelectContext(ctx, q, &themeModels, query, params...); err != nil {
+		return nil, err
+	}
+	for _, theme := range themeModels {
+		themeMap[theme.UserID] = theme
+		themeCache.Set(theme.UserID, theme, themeCacheTTL)
+	}
+
+	return themeMap, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useFakeThemeDB は、themesとuser_badgesへのクエリだけに答えるfakeDBに差し替える
+func useFakeThemeDB(tb testing.TB) *fakeDB {
+	d := &fakeDB{}
+	d.onQuery("SELECT * FROM themes", func(_ string, args []driver.Value) (driver.Rows, error) {
+		rows := &fakeRows{columns: []string{"id", "user_id", "dark_mode"}}
+		for _, arg := range args {
+			rows.values = append(rows.values, []driver.Value{arg, arg, true})
+		}
+		return rows, nil
+	})
+	d.onQuery("SELECT COUNT(*) FROM user_badges", func(string, []driver.Value) (driver.Rows, error) {
+		return fakeValue("COUNT(*)", int64(0)), nil
+	})
+	useFakeDB(tb, d)
+	themeCache.CleanupAll()
+	iconHashCache.CleanupAll()
+	tb.Cleanup(func() {
+		themeCache.CleanupAll()
+		iconHashCache.CleanupAll()
+	})
+	return d
+}
+
+func TestFillUserResponseWithoutTx_ThemeCached(t *testing.T) {
+	d := useFakeThemeDB(t)
+	iconHashCache.Set(1, "hash", time.Hour)
+
+	for i := 0; i < 2; i++ {
+		user, err := fillUserResponseWithoutTx(context.Background(), UserModel{ID: 1, Name: "test"}, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if user.Theme.ID != 1 || !user.Theme.DarkMode {
+			t.Errorf("theme = %+v, want {ID:1 DarkMode:true}", user.Theme)
+		}
+	}
+	if n := d.queriesWithPrefix("SELECT * FROM themes"); n != 1 {
+		t.Errorf("themes queried %d times, want 1: %v", n, d.queries())
+	}
+}
+
+func TestGetThemeMapCache_QueriesOnlyMissing(t *testing.T) {
+	d := useFakeThemeDB(t)
+	themeCache.Set(1, ThemeModel{ID: 10, UserID: 1}, time.Hour)
+
+	themeMap, err := getThemeMapCache(context.Background(), dbConn, []int64{1, 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if themeMap[1].ID != 10 || themeMap[2].ID != 2 {
+		t.Errorf("themeMap = %+v, want cached theme for 1 and fetched theme for 2", themeMap)
+	}
+	if len(d.queries()) != 1 || !strings.HasSuffix(d.queries()[0], "IN (?)") {
+		t.Errorf("queries = %v, want a single IN query for the missing user", d.queries())
+	}
+
+	if _, err := getThemeMapCache(context.Background(), dbConn, []int64{1, 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := d.queriesWithPrefix("SELECT * FROM themes"); n != 1 {
+		t.Errorf("themes queried %d times, want 1: %v", n, d.queries())
+	}
+}
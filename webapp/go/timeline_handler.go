@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultTimelineLimit = 50
+	maxTimelineLimit     = 100
+)
+
+const (
+	timelineEventTypeComment  = "comment"
+	timelineEventTypeReaction = "reaction"
+)
+
+// timelineEventModel は、ライブコメントとリアクションをUNIONした結果の1行
+type timelineEventModel struct {
+	Type      string `db:"type"`
+	ID        int64  `db:"id"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+type TimelineEvent struct {
+	Type     string       `json:"type"`
+	At       int64        `json:"at"`
+	Comment  *Livecomment `json:"comment,omitempty"`
+	Reaction *Reaction    `json:"reaction,omitempty"`
+}
+
+// 配信のタイムライン (ライブコメントとリアクションを新しい順に混ぜたもの) 取得API
+// GET /api/livestream/:livestream_id/timeline
+func getTimelineHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	limit := defaultTimelineLimit
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxTimelineLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be integer between 1 and 100")
+		}
+	}
+
+	// cursorより前 (cursorを含まない) のイベントを返す
+	// NOTE: 次のページは最後のイベントのatをcursorに指定して取得する。同一秒のイベントがページをまたぐと取りこぼすが、秒単位のタイムスタンプなので許容する
+	var cursor int64 = math.MaxInt64
+	if v := c.QueryParam("cursor"); v != "" {
+		cursor, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "cursor query parameter must be integer")
+		}
+	}
+
+	events, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) ([]TimelineEvent, error) {
+		var livestreamModel LivestreamModel
+		if err := tx.GetContext(ctx, &livestreamModel, "SELECT * FROM livestreams WHERE id = ?", livestreamID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, echo.NewHTTPError(http.StatusNotFound, "livestream not found")
+			}
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get livestream: "+err.Error()).SetInternal(err)
+		}
+		livestream, err := fillLivestreamResponse(ctx, tx, livestreamModel)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to fill livestream: "+err.Error()).SetInternal(err)
+		}
+
+		var eventModels []timelineEventModel
+		if err := tx.SelectContext(ctx, &eventModels, `
+			(SELECT 'comment' AS type, id, created_at FROM livecomments WHERE livestream_id = ? AND created_at < ?)
+			UNION ALL
+			(SELECT 'reaction' AS type, id, created_at FROM reactions WHERE livestream_id = ? AND created_at < ?)
+			ORDER BY created_at DESC, type ASC, id DESC
+			LIMIT ?`, livestreamID, cursor, livestreamID, cursor, limit); err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get timeline: "+err.Error()).SetInternal(err)
+		}
+
+		events, err := fillTimelineResponse(ctx, tx, eventModels, livestream)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to fill timeline: "+err.Error()).SetInternal(err)
+		}
+		return events, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, events)
+}
+
+// fillTimelineResponse は、ライブコメントとリアクションをそれぞれIN句で一括取得し、
+// 投稿ユーザもまとめて1回で取得してタイムラインを組み立てる
+func fillTimelineResponse(ctx context.Context, tx *sqlx.Tx, eventModels []timelineEventModel, livestream Livestream) ([]TimelineEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
+	if len(eventModels) == 0 {
+		return []TimelineEvent{}, nil
+	}
+
+	var livecommentIDs, reactionIDs []int64
+	for _, m := range eventModels {
+		switch m.Type {
+		case timelineEventTypeComment:
+			livecommentIDs = append(livecommentIDs, m.ID)
+		case timelineEventTypeReaction:
+			reactionIDs = append(reactionIDs, m.ID)
+		}
+	}
+
+	var livecommentModels []LivecommentModel
+	if len(livecommentIDs) > 0 {
+		q, params, err := sqlx.In("SELECT * FROM livecomments WHERE id IN (?)", livecommentIDs)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.SelectContext(ctx, &livecommentModels, q, params...); err != nil {
+			return nil, err
+		}
+	}
+	var reactionModels []ReactionModel
+	if len(reactionIDs) > 0 {
+		q, params, err := sqlx.In("SELECT * FROM reactions WHERE id IN (?)", reactionIDs)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.SelectContext(ctx, &reactionModels, q, params...); err != nil {
+			return nil, err
+		}
+	}
+
+	userIDs := make([]int64, 0, len(livecommentModels)+len(reactionModels))
+	for i := range livecommentModels {
+		userIDs = append(userIDs, livecommentModels[i].UserID)
+	}
+	for i := range reactionModels {
+		userIDs = append(userIDs, reactionModels[i].UserID)
+	}
+	var userModels []UserModel
+	q, params, err := sqlx.In("SELECT * FROM users WHERE id IN (?)", userIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.SelectContext(ctx, &userModels, q, params...); err != nil {
+		return nil, err
+	}
+	users, err := fillUsersResponse(ctx, tx, userModels)
+	if err != nil {
+		return nil, err
+	}
+	userMap := make(map[int64]User, len(users))
+	for i := range users {
+		userMap[users[i].ID] = users[i]
+	}
+
+	livecommentMap := make(map[int64]Livecomment, len(livecommentModels))
+	for _, m := range livecommentModels {
+		livecommentMap[m.ID] = Livecomment{
+			ID:           m.ID,
+			User:         userMap[m.UserID],
+			Livestream:   livestream,
+			Comment:      m.Comment,
+			Tip:          m.Tip,
+			TipFormatted: formatTip(m.Tip),
+			CreatedAt:    m.CreatedAt,
+		}
+	}
+	reactionMap := make(map[int64]Reaction, len(reactionModels))
+	for _, m := range reactionModels {
+		reactionMap[m.ID] = Reaction{
+			ID:         m.ID,
+			EmojiName:  m.EmojiName,
+			User:       userMap[m.UserID],
+			Livestream: livestream,
+			CreatedAt:  m.CreatedAt,
+		}
+	}
+
+	events := make([]TimelineEvent, 0, len(eventModels))
+	for _, m := range eventModels {
+		event := TimelineEvent{
+			Type: m.Type,
+			At:   m.CreatedAt,
+		}
+		switch m.Type {
+		case timelineEventTypeComment:
+			livecomment, ok := livecommentMap[m.ID]
+			if !ok {
+				// 対応する行が見つからないイベントは含めない
+				continue
+			}
+			event.Comment = &livecomment
+		case timelineEventTypeReaction:
+			reaction, ok := reactionMap[m.ID]
+			if !ok {
+				continue
+			}
+			event.Reaction = &reaction
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	tipSentHistoryCacheTTL = 10 * time.Second
+
+	defaultTipSentHistoryLimit = 20
+	maxTipSentHistoryLimit     = 100
+)
+
+// TipHistoryEntry は、チップ付きで投稿したライブコメント1件分の受領記録
+type TipHistoryEntry struct {
+	LivecommentID   int64  `db:"livecomment_id" json:"livecomment_id"`
+	LivestreamID    int64  `db:"livestream_id" json:"livestream_id"`
+	LivestreamTitle string `db:"livestream_title" json:"livestream_title"`
+	Tip             int64  `db:"tip" json:"tip"`
+	Comment         string `db:"comment" json:"comment"`
+	CreatedAt       int64  `db:"created_at" json:"created_at"`
+}
+
+var tipSentHistoryCache = &TipSentHistoryCache{}
+
+type tipSentHistoryKey struct {
+	UserID int64
+	Limit  int
+	Cursor int64
+}
+
+type tipSentHistoryEntry struct {
+	history    []TipHistoryEntry
+	expiration time.Time
+}
+
+// TipSentHistoryCache は、ユーザごと・ページごとのチップ送信履歴を保持する
+type TipSentHistoryCache struct {
+	data sync.Map
+}
+
+func (m *TipSentHistoryCache) Set(key tipSentHistoryKey, history []TipHistoryEntry, ttl time.Duration) {
+	m.data.Store(key, tipSentHistoryEntry{
+		history:    history,
+		expiration: time.Now().Add(jitteredTTL(ttl)),
+	})
+}
+
+func (m *TipSentHistoryCache) Get(key tipSentHistoryKey) ([]TipHistoryEntry, bool) {
+	v, ok := m.data.Load(key)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(tipSentHistoryEntry)
+	if time.Now().After(e.expiration) {
+		m.data.Delete(key)
+		return nil, false
+	}
+	return e.history, true
+}
+
+func (m *TipSentHistoryCache) CleanupAll() {
+	m.data.Range(func(key, value interface{}) bool {
+		m.data.Delete(key)
+		return true
+	})
+}
+
+// チップ送信履歴取得API
+// GET /api/user/me/tip-sent-history
+func getTipSentHistoryHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	// cursorより小さいIDのライブコメントを返す
+	key := tipSentHistoryKey{
+		UserID: userID,
+		Limit:  defaultTipSentHistoryLimit,
+		Cursor: math.MaxInt64,
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTipSentHistoryLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit query parameter must be integer between 1 and 100")
+		}
+		key.Limit = n
+	}
+	if v := c.QueryParam("cursor"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "cursor query parameter must be integer")
+		}
+		key.Cursor = n
+	}
+
+	if history, ok := tipSentHistoryCache.Get(key); ok {
+		return c.JSON(http.StatusOK, history)
+	}
+
+	history, err := getTipSentHistory(ctx, key)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get tip sent history: "+err.Error())
+	}
+	tipSentHistoryCache.Set(key, history, tipSentHistoryCacheTTL)
+
+	return c.JSON(http.StatusOK, history)
+}
+
+func getTipSentHistory(ctx context.Context, key tipSentHistoryKey) ([]TipHistoryEntry, error) {
+	history := []TipHistoryEntry{}
+	if err := dbConn.SelectContext(ctx, &history, `
+		SELECT lc.id AS livecomment_id, lc.livestream_id, l.title AS livestream_title, lc.tip, lc.comment, lc.created_at FROM livecomments lc
+		INNER JOIN livestreams l ON l.id = lc.livestream_id
+		WHERE lc.user_id = ? AND lc.tip > 0 AND lc.id < ?
+		ORDER BY lc.created_at DESC, lc.id DESC
+		LIMIT ?`, key.UserID, key.Cursor, key.Limit); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
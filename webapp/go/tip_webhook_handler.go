@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	tipWebhookTimeout = 5 * time.Second
+	// シークレットは32バイトの乱数を16進数で表したもの
+	tipWebhookSecretBytes = 32
+	// 通知を送るワーカ数と、送信待ちにしておける通知の数 (あふれた通知は捨てる)
+	tipWebhookWorkers   = 4
+	tipWebhookQueueSize = 1024
+)
+
+var errTipWebhookAddressNotAllowed = errors.New("webhook address is not allowed")
+
+// tipWebhookClient は、内部ネットワークへ接続しないWebhook送信用のクライアント
+// 名前解決後の接続先を検査するので、登録後にDNSの向き先を変えられても内部へは届かない
+var tipWebhookClient = &http.Client{
+	Timeout: tipWebhookTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: tipWebhookTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+					return fmt.Errorf("%w: %s", errTipWebhookAddressNotAllowed, address)
+				}
+				return nil
+			},
+		}).DialContext,
+		MaxIdleConnsPerHost: tipWebhookWorkers,
+	},
+}
+
+// tipWebhookQueue は、送信待ちのチップ通知
+var tipWebhookQueue = make(chan Livecomment, tipWebhookQueueSize)
+
+type TipWebhookModel struct {
+	ID           int64  `db:"id"`
+	LivestreamID int64  `db:"livestream_id"`
+	WebhookURL   string `db:"webhook_url"`
+	MinTip       int64  `db:"min_tip"`
+	Secret       string `db:"secret"`
+}
+
+type PostTipWebhookRequest struct {
+	WebhookURL string `json:"webhook_url"`
+	MinTip     int64  `json:"min_tip"`
+}
+
+// TipWebhook は、登録時にのみ返すレスポンス (シークレットを含む)
+type TipWebhook struct {
+	ID           int64  `json:"id"`
+	LivestreamID int64  `json:"livestream_id"`
+	WebhookURL   string `json:"webhook_url"`
+	MinTip       int64  `json:"min_tip"`
+	Secret       string `json:"secret"`
+}
+
+// TipWebhookPayload は、Webhookの送信先にPOSTする内容
+type TipWebhookPayload struct {
+	LivecommentID int64 `json:"livecomment_id"`
+	Tip           int64 `json:"tip"`
+	User          User  `json:"user"`
+}
+
+// チップ通知Webhook登録API (配信者のみ)
+// POST /api/livestream/:livestream_id/subscribe-tips
+func postTipWebhookHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req *PostTipWebhookRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	if err := validateTipWebhookURL(req.WebhookURL); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid webhook_url: "+err.Error())
+	}
+	if len(req.WebhookURL) > MaxURLLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("webhook_url must be at most %d characters", MaxURLLength))
+	}
+	if req.MinTip < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "min_tip must not be negative")
+	}
+
+	secret, err := newTipWebhookSecret()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate webhook secret: "+err.Error())
+	}
+
+	webhookModel := TipWebhookModel{
+		LivestreamID: int64(livestreamID),
+		WebhookURL:   req.WebhookURL,
+		MinTip:       req.MinTip,
+		Secret:       secret,
+	}
+	webhookID, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (int64, error) {
+		if _, err := lockOwnLivestream(ctx, tx, int64(livestreamID), userID); err != nil {
+			return 0, err
+		}
+
+		rs, err := tx.NamedExecContext(ctx, "INSERT INTO tip_webhooks (livestream_id, webhook_url, min_tip, secret) VALUES (:livestream_id, :webhook_url, :min_tip, :secret)", webhookModel)
+		if err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert tip webhook: "+err.Error()).SetInternal(err)
+		}
+		webhookID, err := rs.LastInsertId()
+		if err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted tip webhook id: "+err.Error()).SetInternal(err)
+		}
+		return webhookID, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+
+	return c.JSON(http.StatusCreated, TipWebhook{
+		ID:           webhookID,
+		LivestreamID: webhookModel.LivestreamID,
+		WebhookURL:   webhookModel.WebhookURL,
+		MinTip:       webhookModel.MinTip,
+		Secret:       webhookModel.Secret,
+	})
+}
+
+// チップ通知Webhook削除API (配信者のみ)
+// DELETE /api/livestream/:livestream_id/subscribe-tips/:webhook_id
+func deleteTipWebhookHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	livestreamID, err := strconv.Atoi(c.Param("livestream_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "livestream_id in path must be integer")
+	}
+	webhookID, err := strconv.Atoi(c.Param("webhook_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "webhook_id in path must be integer")
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	if _, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (struct{}, error) {
+		if _, err := lockOwnLivestream(ctx, tx, int64(livestreamID), userID); err != nil {
+			return struct{}{}, err
+		}
+
+		rs, err := tx.ExecContext(ctx, "DELETE FROM tip_webhooks WHERE id = ? AND livestream_id = ?", webhookID, livestreamID)
+		if err != nil {
+			return struct{}{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete tip webhook: "+err.Error()).SetInternal(err)
+		}
+		affected, err := rs.RowsAffected()
+		if err != nil {
+			return struct{}{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get affected rows: "+err.Error()).SetInternal(err)
+		}
+		if affected == 0 {
+			return struct{}{}, echo.NewHTTPError(http.StatusNotFound, "tip webhook not found")
+		}
+		return struct{}{}, nil
+	}); err != nil {
+		return txHTTPError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func newTipWebhookSecret() (string, error) {
+	b := make([]byte, tipWebhookSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validateTipWebhookURL は、Webhookの送信先が外部のhttpまたはhttpsのURLであることを確かめる
+// ホスト名の名前解決先はここでは検査せず、送信時にtipWebhookClientが検査する
+func validateTipWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+	if u.User != nil {
+		return errors.New("userinfo is not allowed")
+	}
+	host := u.Hostname()
+	if host == "" {
+		return errors.New("host is required")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicIP(ip) {
+			return errTipWebhookAddressNotAllowed
+		}
+		return nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".isucon.local") {
+		return errTipWebhookAddressNotAllowed
+	}
+	return nil
+}
+
+// isPublicIP は、ipがループバック・プライベート・リンクローカルなど内部向けのアドレスでなければtrueを返す
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified())
+}
+
+// notifyTipWebhooks は、チップ額がしきい値以上のWebhookへの通知を送信待ちに積む
+// 通知の失敗や送信待ちがあふれた場合はログに出すだけで、ライブコメントの投稿には影響させない
+func notifyTipWebhooks(logger echo.Logger, livecomment Livecomment) {
+	if livecomment.Tip <= 0 {
+		return
+	}
+
+	select {
+	case tipWebhookQueue <- livecomment:
+	default:
+		logger.Warnf("tip webhook queue is full, dropped notification for livecomment %d", livecomment.ID)
+	}
+}
+
+// runTipWebhookWorkers は、送信待ちのチップ通知をworkers個のワーカで送信する
+func runTipWebhookWorkers(logger echo.Logger, workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for livecomment := range tipWebhookQueue {
+				deliverTipWebhooks(logger, livecomment)
+			}
+		}()
+	}
+}
+
+func deliverTipWebhooks(logger echo.Logger, livecomment Livecomment) {
+	ctx, cancel := context.WithTimeout(context.Background(), tipWebhookTimeout)
+	defer cancel()
+
+	var webhooks []TipWebhookModel
+	if err := dbConn.SelectContext(ctx, &webhooks, "SELECT * FROM tip_webhooks WHERE livestream_id = ? AND min_tip <= ?", livecomment.Livestream.ID, livecomment.Tip); err != nil {
+		logger.Errorf("failed to get tip webhooks: %v", err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(TipWebhookPayload{
+		LivecommentID: livecomment.ID,
+		Tip:           livecomment.Tip,
+		User:          livecomment.User,
+	})
+	if err != nil {
+		logger.Errorf("failed to marshal tip webhook payload: %v", err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if err := sendTipWebhook(ctx, webhook, payload); err != nil {
+			logger.Warnf("failed to send tip webhook (id=%d): %v", webhook.ID, err)
+		}
+	}
+}
+
+func sendTipWebhook(ctx context.Context, webhook TipWebhookModel, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("X-Webhook-Secret", webhook.Secret)
+
+	resp, err := tipWebhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -3,7 +3,14 @@ package main
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/labstack/echo/v4"
 )
@@ -42,6 +49,153 @@ func getTagHandler(c echo.Context) error {
 	})
 }
 
+const (
+	defaultTagSearchLimit = 20
+	maxTagSearchLimit     = 100
+	// 短すぎる接頭辞では大半のタグに一致してしまうため、検索を受け付けない
+	minTagSearchPrefixLength = 2
+)
+
+// タグ検索API
+// GET /api/tags/search?name=<prefix>
+func searchTagsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	name := c.QueryParam("name")
+	if utf8.RuneCountInString(name) < minTagSearchPrefixLength {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("name query parameter must be at least %d characters", minTagSearchPrefixLength))
+	}
+
+	limit := defaultTagSearchLimit
+	if v := c.QueryParam("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxTagSearchLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit query parameter must be integer between 1 and %d", maxTagSearchLimit))
+		}
+	}
+
+	// uniq_tag_nameを使った前方一致の範囲検索にする
+	var tagModels []*TagModel
+	query := queryWithIndexHint("SELECT * FROM tags", "uniq_tag_name") + " WHERE name LIKE CONCAT(?, '%') ORDER BY name LIMIT ?"
+	if err := dbConn.SelectContext(ctx, &tagModels, query, escapeLikePattern(name), limit); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to search tags: "+err.Error())
+	}
+
+	tags := make([]Tag, len(tagModels))
+	for i := range tagModels {
+		tags[i] = Tag{
+			ID:   tagModels[i].ID,
+			Name: tagModels[i].Name,
+		}
+	}
+	return c.JSON(http.StatusOK, tags)
+}
+
+// escapeLikePattern は、LIKEのワイルドカード (%と_) とエスケープ文字を文字どおりに一致するようエスケープする
+func escapeLikePattern(s string) string {
+	return likePatternEscaper.Replace(s)
+}
+
+var likePatternEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+const (
+	defaultPopularTagsLimit = 10
+	maxPopularTagsLimit     = 50
+)
+
+// popularTagsCacheTTL は、人気タグをキャッシュする期間 (環境変数POPULAR_TAGS_CACHE_TTLで変更できる)
+var popularTagsCacheTTL = 30 * time.Second
+
+func init() {
+	ttl, err := positiveDurationFromEnv("POPULAR_TAGS_CACHE_TTL", popularTagsCacheTTL)
+	if err != nil {
+		log.Fatalf("failed to parse environment variable 'POPULAR_TAGS_CACHE_TTL' as positive duration: %v", err)
+	}
+	popularTagsCacheTTL = ttl
+}
+
+type PopularTag struct {
+	Tag
+	LivestreamCount int64 `json:"livestream_count"`
+}
+
+type PopularTagModel struct {
+	ID              int64  `db:"id"`
+	Name            string `db:"name"`
+	LivestreamCount int64  `db:"livestream_count"`
+}
+
+var popularTagsCache = &PopularTagsCache{}
+
+// PopularTagsCache は、配信数の多い順に上位maxPopularTagsLimit件のタグを保持する
+// limitごとに持たず、上位から切り出して返す
+type PopularTagsCache struct {
+	mu         sync.RWMutex
+	tags       []PopularTag
+	expiration time.Time
+}
+
+func (m *PopularTagsCache) Set(tags []PopularTag, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tags = tags
+	m.expiration = time.Now().Add(jitteredTTL(ttl))
+}
+
+func (m *PopularTagsCache) Get() ([]PopularTag, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.tags == nil || time.Now().After(m.expiration) {
+		return nil, false
+	}
+	return m.tags, true
+}
+
+func (m *PopularTagsCache) CleanupAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tags = nil
+}
+
+// 人気タグ取得API
+// GET /api/tags/popular
+func getPopularTagsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	limit := defaultPopularTagsLimit
+	if v := c.QueryParam("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPopularTagsLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit query parameter must be integer between 1 and %d", maxPopularTagsLimit))
+		}
+	}
+
+	tags, ok := popularTagsCache.Get()
+	if !ok {
+		var tagModels []PopularTagModel
+		query := "SELECT t.id, t.name, COUNT(lt.livestream_id) AS livestream_count FROM tags t LEFT JOIN livestream_tags lt ON t.id = lt.tag_id GROUP BY t.id ORDER BY livestream_count DESC, t.id ASC LIMIT ?"
+		if err := dbConn.SelectContext(ctx, &tagModels, query, maxPopularTagsLimit); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to get popular tags: "+err.Error())
+		}
+
+		tags = make([]PopularTag, len(tagModels))
+		for i := range tagModels {
+			tags[i] = PopularTag{
+				Tag: Tag{
+					ID:   tagModels[i].ID,
+					Name: tagModels[i].Name,
+				},
+				LivestreamCount: tagModels[i].LivestreamCount,
+			}
+		}
+		popularTagsCache.Set(tags, popularTagsCacheTTL)
+	}
+
+	return c.JSON(http.StatusOK, tags[:min(limit, len(tags))])
+}
+
 // 配信者のテーマ取得API
 // GET /api/user/:username/theme
 func getStreamerThemeHandler(c echo.Context) error {
@@ -49,7 +203,7 @@ func getStreamerThemeHandler(c echo.Context) error {
 
 	if err := verifyUserSession(c); err != nil {
 		// echo.NewHTTPErrorが返っているのでそのまま出力
-		c.Logger().Printf("verifyUserSession: %+v\n", err)
+		loggerFromContext(ctx).Info("verifyUserSession failed", "error", err)
 		return err
 	}
 
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"cmp"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeTagDB は、tagsテーブルへの前方一致検索と人気タグの集計だけに答えるfakeDB
+type fakeTagDB struct {
+	*fakeDB
+
+	names []string
+	// タグ名 -> そのタグが付いた配信数
+	livestreamCounts map[string]int64
+}
+
+func useFakeTagDB(tb testing.TB, d *fakeTagDB) {
+	d.fakeDB = &fakeDB{}
+	d.onQuery("SELECT t.id, t.name, COUNT(lt.livestream_id) AS livestream_count FROM tags t", func(_ string, args []driver.Value) (driver.Rows, error) {
+		return d.popularTags(args[0].(int64)), nil
+	})
+	d.onQuery("SELECT * FROM tags USE INDEX (uniq_tag_name) WHERE name LIKE", func(_ string, args []driver.Value) (driver.Rows, error) {
+		prefix, limit := args[0].(string), args[1].(int64)
+
+		names := slices.Sorted(slices.Values(d.names))
+		rows := &fakeRows{columns: []string{"id", "name"}}
+		for i, name := range names {
+			if strings.HasPrefix(name, prefix) && int64(len(rows.values)) < limit {
+				rows.values = append(rows.values, []driver.Value{int64(i + 1), name})
+			}
+		}
+		return rows, nil
+	})
+	useFakeDB(tb, d.fakeDB)
+}
+
+// popularTags は、配信数の降順、タグIDの昇順に並べた上位limit件を返す
+func (d *fakeTagDB) popularTags(limit int64) driver.Rows {
+	type row struct {
+		id    int64
+		name  string
+		count int64
+	}
+	var tags []row
+	for i, name := range d.names {
+		tags = append(tags, row{id: int64(i + 1), name: name, count: d.livestreamCounts[name]})
+	}
+	slices.SortFunc(tags, func(a, b row) int {
+		return cmp.Or(cmp.Compare(b.count, a.count), cmp.Compare(a.id, b.id))
+	})
+
+	rows := &fakeRows{columns: []string{"id", "name", "livestream_count"}}
+	for _, tag := range tags[:min(int(limit), len(tags))] {
+		rows.values = append(rows.values, []driver.Value{tag.id, tag.name, tag.count})
+	}
+	return rows
+}
+
+func TestGetPopularTagsHandler(t *testing.T) {
+	d := &fakeTagDB{
+		names:            []string{"game", "music", "talk", "sports", "art"},
+		livestreamCounts: map[string]int64{"game": 3, "music": 7, "sports": 3, "art": 1},
+	}
+	useFakeTagDB(t, d)
+	popularTagsCache.CleanupAll()
+	t.Cleanup(popularTagsCache.CleanupAll)
+
+	e := echo.New()
+	e.GET("/api/tags/popular", getPopularTagsHandler)
+
+	get := func(query string) []PopularTag {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/tags/popular"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var tags []PopularTag
+		if err := json.Unmarshal(rec.Body.Bytes(), &tags); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return tags
+	}
+	names := func(tags []PopularTag) []string {
+		var names []string
+		for _, tag := range tags {
+			names = append(names, fmt.Sprintf("%s:%d", tag.Name, tag.LivestreamCount))
+		}
+		return names
+	}
+
+	// 配信数が同じタグはID順、配信のないタグは0件として最後に並ぶ
+	want := []string{"music:7", "game:3", "sports:3", "art:1", "talk:0"}
+	if got := names(get("")); !slices.Equal(got, want) {
+		t.Errorf("popular tags = %v, want %v", got, want)
+	}
+	if got := names(get("?limit=2")); !slices.Equal(got, want[:2]) {
+		t.Errorf("popular tags with limit=2 = %v, want %v", got, want[:2])
+	}
+	if len(d.queries()) != 1 {
+		t.Errorf("queries = %v, want a single query served from the cache afterwards", d.queries())
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/tags/popular?limit=51", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("limit=51: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSearchTagsHandler(t *testing.T) {
+	d := &fakeTagDB{}
+	for i := 0; i < 25; i++ {
+		d.names = append(d.names, fmt.Sprintf("game-%02d", i), fmt.Sprintf("music-%02d", i))
+	}
+	useFakeTagDB(t, d)
+
+	e := echo.New()
+	e.GET("/api/tags/search", searchTagsHandler)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantCount  int
+	}{
+		{query: "name=ga", wantStatus: http.StatusOK, wantCount: defaultTagSearchLimit},
+		{query: "name=ga&limit=100", wantStatus: http.StatusOK, wantCount: 25},
+		{query: "name=music-1", wantStatus: http.StatusOK, wantCount: 10},
+		{query: "name=sports", wantStatus: http.StatusOK, wantCount: 0},
+		{query: "name=g", wantStatus: http.StatusBadRequest},
+		{query: "", wantStatus: http.StatusBadRequest},
+		{query: "name=ga&limit=101", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/tags/search?"+tt.query, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d: %s", tt.query, rec.Code, tt.wantStatus, rec.Body.String())
+			continue
+		}
+		if tt.wantStatus != http.StatusOK {
+			continue
+		}
+
+		var tags []Tag
+		if err := json.Unmarshal(rec.Body.Bytes(), &tags); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.query, err)
+		}
+		if len(tags) != tt.wantCount {
+			t.Errorf("%s: got %d tags, want %d", tt.query, len(tags), tt.wantCount)
+		}
+		prefix := strings.TrimPrefix(strings.Split(tt.query, "&")[0], "name=")
+		for _, tag := range tags {
+			if !strings.HasPrefix(tag.Name, prefix) {
+				t.Errorf("%s: tag %q does not match the prefix", tt.query, tag.Name)
+			}
+		}
+		if !slices.IsSortedFunc(tags, func(a, b Tag) int { return strings.Compare(a.Name, b.Name) }) {
+			t.Errorf("%s: tags are not ordered by name: %v", tt.query, tags)
+		}
+	}
+}
+
+func TestEscapeLikePattern(t *testing.T) {
+	tests := map[string]string{
+		"game":     "game",
+		"100%":     `100\%`,
+		"snake_ca": `snake\_ca`,
+		`back\`:    `back\\`,
+	}
+	for in, want := range tests {
+		if got := escapeLikePattern(in); got != want {
+			t.Errorf("escapeLikePattern(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// MySQLのデッドロック検出時のエラー番号 (ER_LOCK_DEADLOCK)
+	mysqlErrLockDeadlock = 1213
+	// デッドロックで失敗したトランザクションを再実行する最大回数
+	txDeadlockRetries = 3
+)
+
+// WithTransaction は、fnをトランザクション内で実行する
+// fnがエラーを返した場合はロールバックし、成功した場合はコミットする
+// デッドロックで失敗した場合はトランザクションごと再実行するので、fnは再実行可能でなければならない
+func WithTransaction[T any](ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(*sqlx.Tx) (T, error)) (T, error) {
+	var (
+		result T
+		err    error
+	)
+	for i := 0; i <= txDeadlockRetries; i++ {
+		result, err = runTransaction(ctx, db, opts, fn)
+		if !isDeadlockError(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	return result, err
+}
+
+func runTransaction[T any](ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(*sqlx.Tx) (T, error)) (T, error) {
+	var zero T
+
+	tx, err := db.BeginTxx(ctx, opts)
+	if err != nil {
+		return zero, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	result, err := fn(tx)
+	if err != nil {
+		return zero, rollbackWithError(tx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return zero, rollbackWithError(tx, fmt.Errorf("failed to commit: %w", err))
+	}
+
+	return result, nil
+}
+
+// rollbackWithError は、ロールバックに失敗した場合にそのエラーを元のエラーに連結して返す
+// 既に終了済みのトランザクションに対するロールバック(sql.ErrTxDone)は無視する
+func rollbackWithError(tx *sqlx.Tx, err error) error {
+	if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+		return errors.Join(err, fmt.Errorf("failed to rollback: %w", rbErr))
+	}
+	return err
+}
+
+func isDeadlockError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrLockDeadlock
+}
+
+// txHTTPError は、WithTransactionが返したエラーをハンドラから返すエラーに変換する
+// fn内で生成されたecho.HTTPErrorはそのまま返す
+func txHTTPError(err error) error {
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// newFakeTxDB は、全ての更新系クエリを受け付け、何番目に実行したクエリかをLastInsertIdとして返すfakeDBを作る
+func newFakeTxDB() *fakeDB {
+	d := &fakeDB{}
+	d.onExec("", func(string, []driver.Value) (driver.Result, error) {
+		return fakeResult{lastInsertID: int64(len(d.execLog)), rowsAffected: 1}, nil
+	})
+	return d
+}
+
+func TestWithTransaction_Commit(t *testing.T) {
+	d := newFakeTxDB()
+	db := d.open(t)
+
+	got, err := WithTransaction(context.Background(), db, nil, func(tx *sqlx.Tx) (int, error) {
+		return 42, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 42 {
+		t.Errorf("result = %d, want 42", got)
+	}
+	if d.commits != 1 || d.rollbacks != 0 {
+		t.Errorf("commits = %d, rollbacks = %d, want 1, 0", d.commits, d.rollbacks)
+	}
+}
+
+func TestWithTransaction_BeginError(t *testing.T) {
+	beginErr := errors.New("begin failed")
+	d := newFakeTxDB()
+	d.onBegin = func() error { return beginErr }
+	db := d.open(t)
+
+	called := false
+	_, err := WithTransaction(context.Background(), db, nil, func(tx *sqlx.Tx) (int, error) {
+		called = true
+		return 0, nil
+	})
+	if !errors.Is(err, beginErr) {
+		t.Fatalf("err = %v, want %v", err, beginErr)
+	}
+	if called {
+		t.Error("fn must not be called when begin fails")
+	}
+}
+
+func TestWithTransaction_FnError(t *testing.T) {
+	fnErr := errors.New("fn failed")
+	d := newFakeTxDB()
+	db := d.open(t)
+
+	got, err := WithTransaction(context.Background(), db, nil, func(tx *sqlx.Tx) (int, error) {
+		return 42, fnErr
+	})
+	if !errors.Is(err, fnErr) {
+		t.Fatalf("err = %v, want %v", err, fnErr)
+	}
+	if got != 0 {
+		t.Errorf("result = %d, want zero value on error", got)
+	}
+	if d.commits != 0 || d.rollbacks != 1 {
+		t.Errorf("commits = %d, rollbacks = %d, want 0, 1", d.commits, d.rollbacks)
+	}
+}
+
+func TestWithTransaction_FnErrorWithRollbackError(t *testing.T) {
+	fnErr := errors.New("fn failed")
+	rollbackErr := errors.New("rollback failed")
+	d := newFakeTxDB()
+	d.onRollback = func() error { return rollbackErr }
+	db := d.open(t)
+
+	_, err := WithTransaction(context.Background(), db, nil, func(tx *sqlx.Tx) (int, error) {
+		return 0, fnErr
+	})
+	if !errors.Is(err, fnErr) {
+		t.Errorf("err = %v, want to wrap %v", err, fnErr)
+	}
+	if !errors.Is(err, rollbackErr) {
+		t.Errorf("err = %v, want to wrap %v", err, rollbackErr)
+	}
+}
+
+func TestWithTransaction_CommitError(t *testing.T) {
+	commitErr := errors.New("commit failed")
+	d := newFakeTxDB()
+	d.onCommit = func() error { return commitErr }
+	db := d.open(t)
+
+	got, err := WithTransaction(context.Background(), db, nil, func(tx *sqlx.Tx) (int, error) {
+		return 42, nil
+	})
+	if !errors.Is(err, commitErr) {
+		t.Fatalf("err = %v, want %v", err, commitErr)
+	}
+	if got != 0 {
+		t.Errorf("result = %d, want zero value on error", got)
+	}
+	if d.commits != 1 {
+		t.Errorf("commits = %d, want 1", d.commits)
+	}
+}
+
+func TestWithTransaction_RetryOnDeadlock(t *testing.T) {
+	d := newFakeTxDB()
+	db := d.open(t)
+
+	calls := 0
+	got, err := WithTransaction(context.Background(), db, nil, func(tx *sqlx.Tx) (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, &mysql.MySQLError{Number: mysqlErrLockDeadlock, Message: "Deadlock found"}
+		}
+		return 42, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 42 {
+		t.Errorf("result = %d, want 42", got)
+	}
+	if calls != 2 {
+		t.Errorf("fn calls = %d, want 2", calls)
+	}
+	if d.commits != 1 || d.rollbacks != 1 {
+		t.Errorf("commits = %d, rollbacks = %d, want 1, 1", d.commits, d.rollbacks)
+	}
+}
+
+func TestWithTransaction_DeadlockRetryExhausted(t *testing.T) {
+	d := newFakeTxDB()
+	db := d.open(t)
+
+	calls := 0
+	_, err := WithTransaction(context.Background(), db, nil, func(tx *sqlx.Tx) (int, error) {
+		calls++
+		return 0, &mysql.MySQLError{Number: mysqlErrLockDeadlock, Message: "Deadlock found"}
+	})
+	if !isDeadlockError(err) {
+		t.Fatalf("err = %v, want deadlock error", err)
+	}
+	if calls != txDeadlockRetries+1 {
+		t.Errorf("fn calls = %d, want %d", calls, txDeadlockRetries+1)
+	}
+}
+
+func TestWithTransaction_NoRetryOnOtherMySQLError(t *testing.T) {
+	d := newFakeTxDB()
+	db := d.open(t)
+
+	calls := 0
+	_, err := WithTransaction(context.Background(), db, nil, func(tx *sqlx.Tx) (int, error) {
+		calls++
+		return 0, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if calls != 1 {
+		t.Errorf("fn calls = %d, want 1", calls)
+	}
+}
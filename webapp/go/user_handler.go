@@ -6,10 +6,16 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/goccy/go-json"
@@ -38,6 +44,46 @@ func init() {
 		panic(err)
 	}
 	noimage = b
+
+	ttl, err := iconHashCacheTTLFromEnv()
+	if err != nil {
+		log.Fatalf("failed to parse environment variable 'ICON_HASH_CACHE_TTL' as positive duration: %v", err)
+	}
+	iconHashCacheTTL = ttl
+
+	if v, ok := os.LookupEnv("MAX_ICON_BYTES"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("failed to parse environment variable 'MAX_ICON_BYTES' as positive integer: %s", v)
+		}
+		maxIconBytes = n
+	}
+
+	if v, ok := os.LookupEnv("MAX_ICON_CACHE_ENTRIES"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("failed to parse environment variable 'MAX_ICON_CACHE_ENTRIES' as positive integer: %s", v)
+		}
+		maxIconCacheEntries = n
+	}
+}
+
+// maxIconBytes は、アップロードできるアイコン画像の最大サイズ (環境変数MAX_ICON_BYTESで変更できる)
+var maxIconBytes = 1 << 20
+
+// アイコンとして受け付ける画像形式
+var allowedIconContentTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// validateIconImage は、アイコン画像のサイズと形式を検証する
+// 形式は拡張子やリクエストヘッダではなく、先頭512バイトから判定する
+func validateIconImage(image []byte) error {
+	if len(image) > maxIconBytes {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("icon image must be at most %d bytes", maxIconBytes))
+	}
+	if contentType := http.DetectContentType(image); !slices.Contains(allowedIconContentTypes, contentType) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unsupported icon image type: "+contentType)
+	}
+	return nil
 }
 
 type UserModel struct {
@@ -46,6 +92,14 @@ type UserModel struct {
 	DisplayName    string `db:"display_name"`
 	Description    string `db:"description"`
 	HashedPassword string `db:"password"`
+	// 認証済み配信者など、DNSレコードを削除しないユーザ
+	ForceKeepDNS bool `db:"force_keep_dns"`
+	// プロフィールの最終更新日時 (Last-Modifiedに使う)
+	UpdatedAt int64 `db:"updated_at"`
+	// アイコン画像のハッシュ (アイコン未登録、またはカラム追加前に登録されたアイコンの場合はNULL)
+	IconHash sql.NullString `db:"icon_hash"`
+	// 登録日時 (カラム追加前に登録されたユーザは0)
+	CreatedAt int64 `db:"created_at"`
 }
 
 type User struct {
@@ -55,6 +109,7 @@ type User struct {
 	Description string `json:"description,omitempty"`
 	Theme       Theme  `json:"theme,omitempty"`
 	IconHash    string `json:"icon_hash,omitempty"`
+	BadgeCount  int    `json:"badge_count"`
 }
 
 type Theme struct {
@@ -81,12 +136,69 @@ type PostUserRequestTheme struct {
 	DarkMode bool `json:"dark_mode"`
 }
 
+// PatchUserRequest は、nilでない項目だけを更新する
+type PatchUserRequest struct {
+	DisplayName *string               `json:"display_name"`
+	Description *string               `json:"description"`
+	Theme       *PostUserRequestTheme `json:"theme"`
+}
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	// Password is non-hashed password.
 	Password string `json:"password"`
 }
 
+const (
+	notificationEventFollowerNew    = "follower_new"
+	notificationEventStreamStarting = "stream_starting"
+	notificationEventTipReceived    = "tip_received"
+)
+
+var notificationEventTypes = []string{
+	notificationEventFollowerNew,
+	notificationEventStreamStarting,
+	notificationEventTipReceived,
+}
+
+type NotificationPrefModel struct {
+	UserID    int64  `db:"user_id"`
+	EventType string `db:"event_type"`
+	Enabled   bool   `db:"enabled"`
+}
+
+type NotificationPref struct {
+	EventType string `json:"event_type"`
+	Enabled   bool   `json:"enabled"`
+}
+
+type UserPrivacyModel struct {
+	UserID            int64 `db:"user_id"`
+	ShowDescription   bool  `db:"show_description"`
+	ShowDisplayName   bool  `db:"show_display_name"`
+	ShowOnLeaderboard bool  `db:"show_on_leaderboard"`
+}
+
+type UserPrivacy struct {
+	ShowDescription bool `json:"show_description"`
+	ShowDisplayName bool `json:"show_display_name"`
+	// ShowOnLeaderboard は、配信のチップランキングに名前を表示するか
+	ShowOnLeaderboard bool `json:"show_on_leaderboard"`
+}
+
+type PatchUserPrivacyRequest struct {
+	ShowDescription   *bool `json:"show_description"`
+	ShowDisplayName   *bool `json:"show_display_name"`
+	ShowOnLeaderboard *bool `json:"show_on_leaderboard"`
+}
+
+// 設定が存在しないユーザはすべて公開扱いとする
+var defaultUserPrivacy = UserPrivacy{
+	ShowDescription:   true,
+	ShowDisplayName:   true,
+	ShowOnLeaderboard: true,
+}
+
 type PostIconRequest struct {
 	Image []byte `json:"image"`
 }
@@ -108,6 +220,10 @@ func getIconHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
 	}
 
+	if size := c.QueryParam("size"); size != "" && size != iconSizeOriginal {
+		return getIconThumbnail(c, user.ID, size)
+	}
+
 	h, err := getIconHashCache(ctx, user.ID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get icon hash: "+err.Error())
@@ -124,6 +240,12 @@ func getIconHandler(c echo.Context) error {
 		}
 	}
 
+	if iconFileCache != nil {
+		if p, ok := iconFileCache.Get(user.ID, h); ok {
+			return c.File(p)
+		}
+	}
+
 	var image []byte
 	if err := dbConn.GetContext(ctx, &image, "SELECT image FROM icons WHERE user_id = ?", user.ID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -133,6 +255,15 @@ func getIconHandler(c echo.Context) error {
 		}
 	}
 
+	if iconFileCache != nil {
+		p, err := iconFileCache.Put(user.ID, image)
+		if err == nil {
+			return c.File(p)
+		}
+		// ディスクに書けない場合もDBから読んだ画像を返す
+		loggerFromContext(ctx).Warn("failed to cache icon", "error", err)
+	}
+
 	return c.Blob(http.StatusOK, "image/jpeg", image)
 }
 
@@ -153,36 +284,151 @@ func postIconHandler(c echo.Context) error {
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
 	}
+	if err := validateIconImage(req.Image); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
+	iconID, err := replaceUserIcon(ctx, userID, req.Image, "")
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+		return txHTTPError(err)
 	}
-	defer tx.Rollback()
 
-	if _, err := tx.ExecContext(ctx, "DELETE FROM icons WHERE user_id = ?", userID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete old user icon: "+err.Error())
+	return c.JSON(http.StatusCreated, &PostIconResponse{
+		ID: iconID,
+	})
+}
+
+// アイコン更新API (楽観的ロック付き)
+// PATCH /api/user/me/icon
+func patchIconHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
 	}
 
-	rs, err := tx.ExecContext(ctx, "INSERT INTO icons (user_id, image) VALUES (?, ?)", userID, req.Image)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert new user icon: "+err.Error())
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var image []byte
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		fh, err := c.FormFile("image")
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "failed to get image from multipart form: "+err.Error())
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "failed to open uploaded image: "+err.Error())
+		}
+		defer f.Close()
+		image, err = io.ReadAll(f)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "failed to read uploaded image: "+err.Error())
+		}
+	} else {
+		var req *PostIconRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+		}
+		image = req.Image
+	}
+	if err := validateIconImage(image); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
 	}
 
-	iconID, err := rs.LastInsertId()
+	iconID, err := replaceUserIcon(ctx, userID, image, c.Request().Header.Get("If-Match"))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted icon id: "+err.Error())
+		return txHTTPError(err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	c.Response().Header().Set("ETag", strconv.Quote(iconHash(image)))
+	return c.JSON(http.StatusOK, &PostIconResponse{
+		ID: iconID,
+	})
+}
+
+// replaceUserIcon は、ユーザのアイコンを差し替えて、新しいアイコンのIDを返す
+// ifMatchが空でなければ、現在のアイコンのハッシュと一致する場合のみ差し替える
+func replaceUserIcon(ctx context.Context, userID int64, image []byte, ifMatch string) (int64, error) {
+	iconID, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (int64, error) {
+		// 楽観的ロック: 現在のアイコンがクライアントの把握しているものと異なれば更新しない
+		if ifMatch != "" {
+			var current []byte
+			if err := tx.GetContext(ctx, &current, "SELECT image FROM icons WHERE user_id = ? FOR UPDATE", userID); err != nil {
+				if !errors.Is(err, sql.ErrNoRows) {
+					return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get user icon: "+err.Error()).SetInternal(err)
+				}
+				current = noimage
+			}
+			if !etagMatches(ifMatch, iconHash(current)) {
+				return 0, echo.NewHTTPError(http.StatusPreconditionFailed, "icon has been modified")
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM icons WHERE user_id = ?", userID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete old user icon: "+err.Error()).SetInternal(err)
+		}
+
+		// 古いアイコンから生成したサムネイルは破棄する
+		if _, err := tx.ExecContext(ctx, "DELETE FROM icon_thumbnails WHERE user_id = ?", userID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete old icon thumbnails: "+err.Error()).SetInternal(err)
+		}
+
+		rs, err := tx.ExecContext(ctx, "INSERT INTO icons (user_id, image) VALUES (?, ?)", userID, image)
+		if err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert new user icon: "+err.Error()).SetInternal(err)
+		}
+
+		iconID, err := rs.LastInsertId()
+		if err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted icon id: "+err.Error())
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET icon_hash = ? WHERE id = ?", iconHash(image), userID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to update user icon hash: "+err.Error()).SetInternal(err)
+		}
+		return iconID, nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
 	iconHashCache.Delete(userID)
+	if iconFileCache != nil {
+		if err := iconFileCache.Delete(userID); err != nil {
+			return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to delete cached icon: "+err.Error())
+		}
+	}
 
-	return c.JSON(http.StatusCreated, &PostIconResponse{
-		ID: iconID,
-	})
+	if err := touchUser(ctx, userID); err != nil {
+		return 0, echo.NewHTTPError(http.StatusInternalServerError, "failed to update user: "+err.Error())
+	}
+
+	return iconID, nil
+}
+
+// etagMatches は、If-Matchヘッダの値がetagに一致するかを返す
+func etagMatches(ifMatch, etag string) bool {
+	for _, v := range strings.Split(ifMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" {
+			return true
+		}
+		if unquoted, err := strconv.Unquote(strings.TrimPrefix(v, "W/")); err == nil && unquoted == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// iconHash は、アイコン画像のハッシュ (ETag) を返す
+func iconHash(image []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(image))
 }
 
 func getMeHandler(c echo.Context) error {
@@ -203,16 +449,307 @@ func getMeHandler(c echo.Context) error {
 	if errors.Is(err, sql.ErrNoRows) {
 		return echo.NewHTTPError(http.StatusNotFound, "not found user that has the userid in session")
 	}
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
+	}
+
+	user, err := fillUserResponseWithoutTx(ctx, userModel, userModel.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill user: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// プロフィール更新API
+// PATCH /api/user/me
+func patchMeHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req PatchUserRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+
+	userModel, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (UserModel, error) {
+		var (
+			sets []string
+			args []interface{}
+		)
+		if req.DisplayName != nil {
+			sets = append(sets, "display_name = ?")
+			args = append(args, *req.DisplayName)
+		}
+		if req.Description != nil {
+			sets = append(sets, "description = ?")
+			args = append(args, *req.Description)
+		}
+		if len(sets) > 0 || req.Theme != nil {
+			sets = append(sets, "updated_at = ?")
+			args = append(args, time.Now().Unix())
+			query := "UPDATE users SET " + strings.Join(sets, ", ") + " WHERE id = ?"
+			if _, err := tx.ExecContext(ctx, query, append(args, userID)...); err != nil {
+				return UserModel{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to update user: "+err.Error()).SetInternal(err)
+			}
+		}
+
+		if req.Theme != nil {
+			if _, err := tx.ExecContext(ctx, "UPDATE themes SET dark_mode = ? WHERE user_id = ?", req.Theme.DarkMode, userID); err != nil {
+				return UserModel{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to update theme: "+err.Error()).SetInternal(err)
+			}
+		}
+
+		userModel := UserModel{}
+		err := tx.GetContext(ctx, &userModel, "SELECT * FROM users WHERE id = ?", userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return UserModel{}, echo.NewHTTPError(http.StatusNotFound, "not found user that has the userid in session")
+		}
+		if err != nil {
+			return UserModel{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error()).SetInternal(err)
+		}
+		return userModel, nil
+	})
+	if err != nil {
+		return txHTTPError(err)
+	}
+	if req.Theme != nil {
+		themeCache.Delete(userID)
+	}
+
+	user, err := fillUserResponseWithoutTx(ctx, userModel, userModel.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill user: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// 通知設定取得API
+// GET /api/user/me/notification-preferences
+func getNotificationPreferencesHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	prefs, err := getNotificationPreferences(ctx, dbConn, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get notification preferences: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, prefs)
+}
+
+// 通知設定更新API
+// PATCH /api/user/me/notification-preferences
+func patchNotificationPreferencesHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req map[string]bool
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+	for eventType := range req {
+		if !slices.Contains(notificationEventTypes, eventType) {
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown notification event type: "+eventType)
+		}
+	}
+
+	tx, err := dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	for eventType, enabled := range req {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_notification_prefs (user_id, event_type, enabled) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE enabled = ?", userID, eventType, enabled, enabled); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to update notification preference: "+err.Error())
+		}
+	}
+
+	prefs, err := getNotificationPreferences(ctx, tx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get notification preferences: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, prefs)
+}
+
+// getNotificationPreferences は、全イベント種別の通知設定を返す
+// 未設定のイベント種別は有効扱いとする
+func getNotificationPreferences(ctx context.Context, q sqlx.QueryerContext, userID int64) ([]NotificationPref, error) {
+	var prefModels []NotificationPrefModel
+	if err := sqlx.SelectContext(ctx, q, &prefModels, "SELECT * FROM user_notification_prefs WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	enabledMap := make(map[string]bool, len(prefModels))
+	for _, m := range prefModels {
+		enabledMap[m.EventType] = m.Enabled
+	}
+
+	prefs := make([]NotificationPref, len(notificationEventTypes))
+	for i, eventType := range notificationEventTypes {
+		enabled, ok := enabledMap[eventType]
+		if !ok {
+			enabled = true
+		}
+		prefs[i] = NotificationPref{
+			EventType: eventType,
+			Enabled:   enabled,
+		}
+	}
+	return prefs, nil
+}
+
+// プロフィール公開設定更新API
+// PATCH /api/user/me/privacy
+func patchUserPrivacyHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	defer c.Request().Body.Close()
+
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	var req PatchUserPrivacyRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
+	}
+
+	tx, err := dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
+	}
+	defer tx.Rollback()
+
+	privacy, err := getUserPrivacy(ctx, tx, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user privacy: "+err.Error())
+	}
+	if req.ShowDescription != nil {
+		privacy.ShowDescription = *req.ShowDescription
+	}
+	if req.ShowDisplayName != nil {
+		privacy.ShowDisplayName = *req.ShowDisplayName
+	}
+	if req.ShowOnLeaderboard != nil {
+		privacy.ShowOnLeaderboard = *req.ShowOnLeaderboard
+	}
+
+	privacyModel := UserPrivacyModel{
+		UserID:            userID,
+		ShowDescription:   privacy.ShowDescription,
+		ShowDisplayName:   privacy.ShowDisplayName,
+		ShowOnLeaderboard: privacy.ShowOnLeaderboard,
+	}
+	if _, err := tx.NamedExecContext(ctx, "INSERT INTO user_privacy (user_id, show_description, show_display_name, show_on_leaderboard) VALUES (:user_id, :show_description, :show_display_name, :show_on_leaderboard) ON DUPLICATE KEY UPDATE show_description = VALUES(show_description), show_display_name = VALUES(show_display_name), show_on_leaderboard = VALUES(show_on_leaderboard)", privacyModel); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update user privacy: "+err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+	}
+
+	// 公開設定によって他のユーザから見えるプロフィールが変わる
+	if err := touchUser(ctx, userID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update user: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, privacy)
+}
+
+func getUserPrivacy(ctx context.Context, q sqlx.QueryerContext, userID int64) (UserPrivacy, error) {
+	var privacyModel UserPrivacyModel
+	if err := sqlx.GetContext(ctx, q, &privacyModel, "SELECT * FROM user_privacy WHERE user_id = ?", userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return defaultUserPrivacy, nil
+		}
+		return UserPrivacy{}, err
+	}
+	return UserPrivacy{
+		ShowDescription:   privacyModel.ShowDescription,
+		ShowDisplayName:   privacyModel.ShowDisplayName,
+		ShowOnLeaderboard: privacyModel.ShowOnLeaderboard,
+	}, nil
+}
+
+// getUserPrivacyMap は、ユーザIDをキーとした公開設定を返す
+// 設定が存在しないユーザはmapに含まれないので、呼び出し側でdefaultUserPrivacyを使うこと
+func getUserPrivacyMap(ctx context.Context, q sqlx.QueryerContext, userIDs []int64) (map[int64]UserPrivacy, error) {
+	privacyMap := make(map[int64]UserPrivacy, len(userIDs))
+	if len(userIDs) == 0 {
+		return privacyMap, nil
 	}
 
-	user, err := fillUserResponseWithoutTx(ctx, userModel)
+	query, params, err := sqlx.In("SELECT * FROM user_privacy WHERE user_id IN (?)", userIDs)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill user: "+err.Error())
+		return nil, err
+	}
+	var privacyModels []UserPrivacyModel
+	if err := sqlx.SelectContext(ctx, q, &privacyModels, query, params...); err != nil {
+		return nil, err
+	}
+	for _, m := range privacyModels {
+		privacyMap[m.UserID] = UserPrivacy{
+			ShowDescription:   m.ShowDescription,
+			ShowDisplayName:   m.ShowDisplayName,
+			ShowOnLeaderboard: m.ShowOnLeaderboard,
+		}
 	}
+	return privacyMap, nil
+}
 
-	return c.JSON(http.StatusOK, user)
+// noViewerID は、閲覧者を特定しないレスポンスの組み立てに使うユーザID (全ての公開設定を適用する)
+const noViewerID int64 = 0
+
+// applyUserPrivacy は、非公開に設定された項目をレスポンスから取り除く
+func applyUserPrivacy(user User, privacy UserPrivacy) User {
+	if !privacy.ShowDescription {
+		user.Description = ""
+	}
+	if !privacy.ShowDisplayName {
+		user.DisplayName = ""
+	}
+	return user
 }
 
 // ユーザ登録API
@@ -235,51 +772,105 @@ func registerHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate hashed password: "+err.Error())
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
-	}
-	defer tx.Rollback()
-
+	now := time.Now().Unix()
 	userModel := UserModel{
 		Name:           req.Name,
 		DisplayName:    req.DisplayName,
 		Description:    req.Description,
 		HashedPassword: string(hashedPassword),
+		UpdatedAt:      now,
+		CreatedAt:      now,
+	}
+
+	var user User
+	err = withUserDNSRecord(req.Name, func() error {
+		var err error
+		user, err = WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (User, error) {
+			return insertUser(ctx, tx, userModel, req.Theme.DarkMode)
+		})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errDNSRecordPending) {
+			return echo.NewHTTPError(http.StatusConflict, "the username is being registered")
+		}
+		return txHTTPError(err)
 	}
 
-	result, err := tx.NamedExecContext(ctx, "INSERT INTO users (name, display_name, description, password) VALUES(:name, :display_name, :description, :password)", userModel)
+	return c.JSON(http.StatusCreated, user)
+}
+
+// insertUser は、ユーザとその初期設定を登録する
+func insertUser(ctx context.Context, tx *sqlx.Tx, userModel UserModel, darkMode bool) (User, error) {
+	result, err := tx.NamedExecContext(ctx, "INSERT INTO users (name, display_name, description, password, updated_at, created_at) VALUES(:name, :display_name, :description, :password, :updated_at, :created_at)", userModel)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert user: "+err.Error())
+		return User{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert user: "+err.Error()).SetInternal(err)
 	}
 
 	userID, err := result.LastInsertId()
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted user id: "+err.Error())
+		return User{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get last inserted user id: "+err.Error())
 	}
 
 	userModel.ID = userID
 
 	themeModel := ThemeModel{
 		UserID:   userID,
-		DarkMode: req.Theme.DarkMode,
+		DarkMode: darkMode,
 	}
 	if _, err := tx.NamedExecContext(ctx, "INSERT INTO themes (user_id, dark_mode) VALUES(:user_id, :dark_mode)", themeModel); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to insert user theme: "+err.Error())
+		return User{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert user theme: "+err.Error()).SetInternal(err)
 	}
+	// 初期化でユーザIDが再利用される場合に備え、古いテーマを捨てる
+	themeCache.Delete(userID)
 
-	records.Store(req.Name+".u.isucon.local.", powerDNSSubdomainAddress)
+	if _, err := tx.ExecContext(ctx, "INSERT INTO user_privacy (user_id) VALUES(?)", userID); err != nil {
+		return User{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to insert user privacy: "+err.Error()).SetInternal(err)
+	}
 
-	user, err := fillUserResponse(ctx, tx, userModel)
+	user, err := fillUserResponse(ctx, tx, userModel, userModel.ID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill user: "+err.Error())
+		return User{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to fill user: "+err.Error()).SetInternal(err)
 	}
+	return user, nil
+}
 
-	if err := tx.Commit(); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+// pendingDNSRecord は、登録処理中のユーザ名を示すrecordsの値
+// 名前解決の対象にはならない
+type pendingDNSRecord struct{}
+
+var errDNSRecordPending = errors.New("dns record is pending")
+
+// afterUserCommitHook は、ユーザ登録のコミット直後に呼ばれる (テスト用)
+var afterUserCommitHook = func() {}
+
+// withUserDNSRecord は、ユーザ登録の結果とrecordsの状態が食い違わないようにregisterを実行する
+// 登録処理中はpendingDNSRecordでユーザ名を押さえ、同名の並行登録はerrDNSRecordPendingで弾く
+// registerが成功していればpanicした場合でもレコードを登録し、失敗した場合は押さえたレコードを取り消す
+func withUserDNSRecord(name string, register func() error) error {
+	fqdn := name + ".u.isucon.local."
+	v, loaded := records.LoadOrStore(fqdn, pendingDNSRecord{})
+	if loaded {
+		if _, ok := v.(pendingDNSRecord); ok {
+			return errDNSRecordPending
+		}
 	}
 
-	return c.JSON(http.StatusCreated, user)
+	committed := false
+	defer func() {
+		if committed {
+			records.Store(fqdn, powerDNSSubdomainAddress)
+		} else if !loaded {
+			records.CompareAndDelete(fqdn, pendingDNSRecord{})
+		}
+	}()
+
+	if err := register(); err != nil {
+		return err
+	}
+	committed = true
+	afterUserCommitHook()
+	return nil
 }
 
 // ユーザログインAPI
@@ -293,24 +884,20 @@ func loginHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "failed to decode the request body as json")
 	}
 
-	tx, err := dbConn.BeginTxx(ctx, nil)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to begin transaction: "+err.Error())
-	}
-	defer tx.Rollback()
-
-	userModel := UserModel{}
-	// usernameはUNIQUEなので、whereで一意に特定できる
-	err = tx.GetContext(ctx, &userModel, "SELECT * FROM users WHERE name = ?", req.Username)
-	if errors.Is(err, sql.ErrNoRows) {
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid username or password")
-	}
+	userModel, err := WithTransaction(ctx, dbConn, nil, func(tx *sqlx.Tx) (UserModel, error) {
+		userModel := UserModel{}
+		// usernameはUNIQUEなので、whereで一意に特定できる
+		err := tx.GetContext(ctx, &userModel, "SELECT * FROM users WHERE name = ?", req.Username)
+		if errors.Is(err, sql.ErrNoRows) {
+			return UserModel{}, echo.NewHTTPError(http.StatusUnauthorized, "invalid username or password")
+		}
+		if err != nil {
+			return UserModel{}, echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error()).SetInternal(err)
+		}
+		return userModel, nil
+	})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
-	}
-
-	if err := tx.Commit(); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to commit: "+err.Error())
+		return txHTTPError(err)
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(userModel.HashedPassword), []byte(req.Password))
@@ -321,6 +908,11 @@ func loginHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to compare hash and password: "+err.Error())
 	}
 
+	sessionVersion, err := getSessionVersion(ctx, userModel.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get session version: "+err.Error())
+	}
+
 	sessionEndAt := time.Now().Add(1 * time.Hour)
 
 	sessionID := uuid.NewString()
@@ -339,7 +931,38 @@ func loginHandler(c echo.Context) error {
 	sess.Values[defaultUserIDKey] = userModel.ID
 	sess.Values[defaultUsernameKey] = userModel.Name
 	sess.Values[defaultSessionExpiresKey] = sessionEndAt.Unix()
+	sess.Values[defaultSessionVersionKey] = sessionVersion
+
+	if err := sess.Save(c.Request(), c.Response()); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save session: "+err.Error())
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// ユーザログアウトAPI
+// POST /api/logout
+func logoutHandler(c echo.Context) error {
+	if err := verifyUserSession(c); err != nil {
+		// echo.NewHTTPErrorが返っているのでそのまま出力
+		return err
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	sessionExpires := sess.Values[defaultSessionExpiresKey].(int64)
+
+	// Cookieを削除しても、保存されていたCookieを再送すれば使えてしまうので、セッションIDを失効させる
+	if sessionID, ok := sess.Values[defaultSessionIDKey].(string); ok {
+		revokeSession(sessionID, time.Unix(sessionExpires, 0))
+	}
 
+	sess.Options = &sessions.Options{
+		Domain: "u.isucon.local",
+		MaxAge: -1,
+		Path:   "/",
+	}
 	if err := sess.Save(c.Request(), c.Response()); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save session: "+err.Error())
 	}
@@ -366,14 +989,64 @@ func getUserHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get user: "+err.Error())
 	}
 
-	user, err := fillUserResponseWithoutTx(ctx, userModel)
+	// If-None-Matchがある場合はIf-Modified-Sinceより優先する (同じ秒の更新はupdated_atでは区別できない)
+	ifNoneMatch := c.Request().Header.Get("If-None-Match")
+	c.Response().Header().Set(echo.HeaderLastModified, time.Unix(userModel.UpdatedAt, 0).UTC().Format(http.TimeFormat))
+	if ifNoneMatch == "" && isNotModifiedSince(c.Request().Header.Get(echo.HeaderIfModifiedSince), userModel.UpdatedAt) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	// error already checked
+	sess, _ := session.Get(defaultSessionIDKey, c)
+	// existence already checked
+	userID := sess.Values[defaultUserIDKey].(int64)
+
+	// 本人以外には公開設定を適用する
+	user, err := fillUserResponseWithoutTx(ctx, userModel, userID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fill user: "+err.Error())
 	}
 
+	etag, err := userETag(user)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to compute etag: "+err.Error())
+	}
+	c.Response().Header().Set("ETag", strconv.Quote(etag))
+	if ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
 	return c.JSON(http.StatusOK, user)
 }
 
+// userETag は、閲覧者に返すユーザのレスポンスのハッシュ (ETag) を返す
+// 公開設定やバッジ数など、users.updated_atに現れない変更も反映される
+func userETag(user User) (string, error) {
+	b, err := json.Marshal(user)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// isNotModifiedSince は、If-Modified-Sinceの日時以降にupdatedAtが更新されていなければtrueを返す
+func isNotModifiedSince(ifModifiedSince string, updatedAt int64) bool {
+	if ifModifiedSince == "" {
+		return false
+	}
+	t, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	return t.Unix() >= updatedAt
+}
+
+// touchUser は、ユーザのプロフィールの最終更新日時を現在時刻にする
+func touchUser(ctx context.Context, userID int64) error {
+	_, err := dbConn.ExecContext(ctx, "UPDATE users SET updated_at = ? WHERE id = ?", time.Now().Unix(), userID)
+	return err
+}
+
 func verifyUserSession(c echo.Context) error {
 	sess, err := session.Get(defaultSessionIDKey, c)
 	if err != nil {
@@ -385,7 +1058,7 @@ func verifyUserSession(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusForbidden, "failed to get EXPIRES value from session")
 	}
 
-	_, ok = sess.Values[defaultUserIDKey].(int64)
+	userID, ok := sess.Values[defaultUserIDKey].(int64)
 	if !ok {
 		return echo.NewHTTPError(http.StatusUnauthorized, "failed to get USERID value from session")
 	}
@@ -395,12 +1068,47 @@ func verifyUserSession(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "session has expired")
 	}
 
+	if sessionID, ok := sess.Values[defaultSessionIDKey].(string); ok && isSessionRevoked(sessionID) {
+		return echo.NewHTTPError(http.StatusUnauthorized, "session has been revoked")
+	}
+
+	// パスワード変更前に発行されたセッションは使えない (世代を持たない古いセッションは0とみなす)
+	sessionVersion, _ := sess.Values[defaultSessionVersionKey].(int64)
+	currentVersion, err := getSessionVersion(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get session version: "+err.Error())
+	}
+	if sessionVersion < currentVersion {
+		return echo.NewHTTPError(http.StatusUnauthorized, "session has been invalidated by a password change")
+	}
+
 	return nil
 }
 
-func fillUserResponse(ctx context.Context, tx *sqlx.Tx, userModel UserModel) (User, error) {
-	themeModel := ThemeModel{}
-	if err := tx.GetContext(ctx, &themeModel, "SELECT * FROM themes WHERE user_id = ?", userModel.ID); err != nil {
+// revokedSessions は、ログアウトで失効させたセッションIDの集合
+// 値はセッションの有効期限で、期限を過ぎたセッションは有効期限の確認で弾かれるので集合から取り除く
+var revokedSessions sync.Map
+
+func revokeSession(sessionID string, expiresAt time.Time) {
+	revokedSessions.Store(sessionID, expiresAt)
+	time.AfterFunc(time.Until(expiresAt), func() {
+		revokedSessions.Delete(sessionID)
+	})
+}
+
+func isSessionRevoked(sessionID string) bool {
+	_, ok := revokedSessions.Load(sessionID)
+	return ok
+}
+
+// fillUserResponse は、ユーザのレスポンスを組み立てる
+// viewerID以外のユーザには公開設定を適用する (閲覧者を特定しない場合はnoViewerIDを渡す)
+func fillUserResponse(ctx context.Context, tx *sqlx.Tx, userModel UserModel, viewerID int64) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
+	themeModel, err := getThemeCache(ctx, tx, userModel.ID)
+	if err != nil {
 		return User{}, err
 	}
 
@@ -409,6 +1117,11 @@ func fillUserResponse(ctx context.Context, tx *sqlx.Tx, userModel UserModel) (Us
 		return User{}, err
 	}
 
+	badgeCount, err := getBadgeCount(ctx, tx, userModel.ID)
+	if err != nil {
+		return User{}, err
+	}
+
 	user := User{
 		ID:          userModel.ID,
 		Name:        userModel.Name,
@@ -418,15 +1131,29 @@ func fillUserResponse(ctx context.Context, tx *sqlx.Tx, userModel UserModel) (Us
 			ID:       themeModel.ID,
 			DarkMode: themeModel.DarkMode,
 		},
-		IconHash: iconHash,
+		IconHash:   iconHash,
+		BadgeCount: badgeCount,
+	}
+
+	if userModel.ID != viewerID {
+		privacy, err := getUserPrivacy(ctx, tx, userModel.ID)
+		if err != nil {
+			return User{}, err
+		}
+		user = applyUserPrivacy(user, privacy)
 	}
 
 	return user, nil
 }
 
-func fillUserResponseWithoutTx(ctx context.Context, userModel UserModel) (User, error) {
-	themeModel := ThemeModel{}
-	if err := dbConn.GetContext(ctx, &themeModel, "SELECT * FROM themes WHERE user_id = ?", userModel.ID); err != nil {
+// fillUserResponseWithoutTx は、ユーザのレスポンスを組み立てる
+// viewerID以外のユーザには公開設定を適用する (閲覧者を特定しない場合はnoViewerIDを渡す)
+func fillUserResponseWithoutTx(ctx context.Context, userModel UserModel, viewerID int64) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
+	themeModel, err := getThemeCache(ctx, dbConn, userModel.ID)
+	if err != nil {
 		return User{}, err
 	}
 
@@ -435,6 +1162,11 @@ func fillUserResponseWithoutTx(ctx context.Context, userModel UserModel) (User,
 		return User{}, err
 	}
 
+	badgeCount, err := getBadgeCount(ctx, dbConn, userModel.ID)
+	if err != nil {
+		return User{}, err
+	}
+
 	user := User{
 		ID:          userModel.ID,
 		Name:        userModel.Name,
@@ -444,16 +1176,59 @@ func fillUserResponseWithoutTx(ctx context.Context, userModel UserModel) (User,
 			ID:       themeModel.ID,
 			DarkMode: themeModel.DarkMode,
 		},
-		IconHash: iconHash,
+		IconHash:   iconHash,
+		BadgeCount: badgeCount,
+	}
+
+	if userModel.ID != viewerID {
+		privacy, err := getUserPrivacy(ctx, dbConn, userModel.ID)
+		if err != nil {
+			return User{}, err
+		}
+		user = applyUserPrivacy(user, privacy)
 	}
 
 	return user, nil
 }
 
-var iconHashCache = &IconHashCache{}
+var iconHashCache = &ShardedIconHashCache{}
+
+// iconHashCacheTTL は、アイコンハッシュをキャッシュする期間 (環境変数ICON_HASH_CACHE_TTLで変更できる)
+var iconHashCacheTTL = 2 * time.Second
+
+// iconHashPreloadTTL は、起動時に載せたアイコンハッシュをキャッシュする期間
+// アイコン更新時はキャッシュを消すので、起動直後のアクセスが落ち着くまで保持しておく
+const iconHashPreloadTTL = 10 * time.Minute
+
+func iconHashCacheTTLFromEnv() (time.Duration, error) {
+	return positiveDurationFromEnv("ICON_HASH_CACHE_TTL", iconHashCacheTTL)
+}
+
+// positiveDurationFromEnv は、環境変数keyをtime.ParseDurationの形式で読む
+// 未設定の場合はdefを返し、0以下の期間はエラーにする
+func positiveDurationFromEnv(key string, def time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive: %s", v)
+	}
+	return d, nil
+}
+
+// maxIconCacheEntries は、アイコンハッシュをキャッシュするユーザ数の上限 (環境変数MAX_ICON_CACHE_ENTRIESで変更できる)
+var maxIconCacheEntries = 10000
 
+// IconHashCache は、ユーザIDごとのアイコンハッシュを保持する
+// 上限を超えて追加する場合は、有効期限が最も近いエントリを追い出す
 type IconHashCache struct {
-	data sync.Map
+	mu   sync.RWMutex
+	data map[int64]entry
 }
 
 type entry struct {
@@ -462,46 +1237,221 @@ type entry struct {
 }
 
 func (m *IconHashCache) Set(key int64, hash string, ttl time.Duration) {
-	m.data.Store(key, entry{
+	m.set(key, hash, ttl, maxIconCacheEntries)
+}
+
+// set は、エントリ数がmaxEntriesを超えないようにハッシュを保持する
+func (m *IconHashCache) set(key int64, hash string, ttl time.Duration, maxEntries int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data[key]; !ok && len(m.data) >= maxEntries {
+		m.evictLocked(key)
+	}
+	m.storeLocked(key, hash, ttl)
+}
+
+// store は、エントリ数の上限を確認せずにハッシュを保持し、新しいキーを追加したかを返す
+func (m *IconHashCache) store(key int64, hash string, ttl time.Duration) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.storeLocked(key, hash, ttl)
+}
+
+func (m *IconHashCache) storeLocked(key int64, hash string, ttl time.Duration) bool {
+	if m.data == nil {
+		m.data = make(map[int64]entry)
+	}
+	_, exists := m.data[key]
+	m.data[key] = entry{
 		value:      hash,
-		expiration: time.Now().Add(ttl),
-	})
+		expiration: time.Now().Add(jitteredTTL(ttl)),
+	}
+	return !exists
+}
+
+// evict は、keep以外で有効期限が最も近いエントリを削除し、削除したかを返す
+func (m *IconHashCache) evict(keep int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.evictLocked(keep)
+}
+
+// evictLocked は、全エントリを走査して削除対象を選ぶので、保持するエントリ数に比例した時間がかかる
+func (m *IconHashCache) evictLocked(keep int64) bool {
+	var (
+		victim     int64
+		expiration time.Time
+		found      bool
+	)
+	for k, e := range m.data {
+		if k == keep {
+			continue
+		}
+		if !found || e.expiration.Before(expiration) {
+			victim, expiration, found = k, e.expiration, true
+		}
+	}
+	if found {
+		delete(m.data, victim)
+	}
+	return found
+}
+
+// jitteredTTL は、ttlを±20%の範囲でランダムにずらす
+// 同時に登録されたエントリが一斉に期限切れになり、DBへの再取得が集中するのを防ぐ
+func jitteredTTL(ttl time.Duration) time.Duration {
+	spread := int64(ttl) * 2 / 5
+	if spread <= 0 {
+		return ttl
+	}
+	return ttl - ttl/5 + time.Duration(rand.Int64N(spread))
 }
 
 func (m *IconHashCache) Get(key int64) (interface{}, bool) {
-	v, ok := m.data.Load(key)
+	v, ok, _ := m.get(key)
+	return v, ok
+}
+
+// get は、有効期限切れのエントリを削除した場合にremovedをtrueにする
+func (m *IconHashCache) get(key int64) (v interface{}, ok bool, removed bool) {
+	m.mu.RLock()
+	e, ok := m.data[key]
+	m.mu.RUnlock()
 	if !ok {
-		return nil, false
+		return nil, false, false
 	}
 
-	e := v.(entry)
 	if time.Now().After(e.expiration) {
 		// 有効期限切れの場合は削除
-		m.data.Delete(key)
-		return nil, false
+		m.mu.Lock()
+		// ロックを取り直す間に再登録されたエントリは消さない
+		if current, ok := m.data[key]; ok && time.Now().After(current.expiration) {
+			delete(m.data, key)
+			removed = true
+		}
+		m.mu.Unlock()
+		return nil, false, removed
 	}
-	return e.value, true
+	return e.value, true, false
 }
 
 func (m *IconHashCache) Delete(key int64) {
-	m.data.Delete(key)
+	m.remove(key)
+}
+
+// remove は、keyのエントリを削除し、削除したかを返す
+func (m *IconHashCache) remove(key int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.data[key]
+	delete(m.data, key)
+	return ok
+}
+
+func (m *IconHashCache) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.data)
 }
 
 func (m *IconHashCache) Cleanup() {
-	m.data.Range(func(key, value interface{}) bool {
-		e := value.(entry)
-		if time.Now().After(e.expiration) {
-			m.data.Delete(key)
+	m.cleanup()
+}
+
+// cleanup は、有効期限切れのエントリを削除し、削除した件数を返す
+func (m *IconHashCache) cleanup() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	removed := 0
+	for k, e := range m.data {
+		if now.After(e.expiration) {
+			delete(m.data, k)
+			removed++
 		}
-		return true
-	})
+	}
+	return removed
 }
 
 func (m *IconHashCache) CleanupAll() {
-	m.data.Range(func(key, value interface{}) bool {
-		m.data.Delete(key)
-		return true
-	})
+	m.cleanupAll()
+}
+
+// cleanupAll は、全エントリを削除し、削除した件数を返す
+func (m *IconHashCache) cleanupAll() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := len(m.data)
+	clear(m.data)
+	return removed
+}
+
+const iconHashCacheShards = 256
+
+// ShardedIconHashCache は、ユーザIDごとにIconHashCacheを振り分けて保持する
+// 高並列なアイコンハッシュの参照で、単一のsync.Mapへアクセスが集中するのを避ける
+type ShardedIconHashCache struct {
+	shards [iconHashCacheShards]IconHashCache
+	// entries は、全シャードのエントリ数の合計
+	entries atomic.Int64
+}
+
+func (m *ShardedIconHashCache) shard(key int64) *IconHashCache {
+	return &m.shards[uint64(key)%iconHashCacheShards]
+}
+
+// Set は、全シャードのエントリ数の合計がmaxIconCacheEntriesを超えないようにハッシュを保持する
+// 超えた場合は、追加したシャードから順に有効期限が最も近いエントリを1件追い出す
+// キーの偏りで特定のシャードにエントリが集まっても、上限まではキャッシュできる
+func (m *ShardedIconHashCache) Set(key int64, hash string, ttl time.Duration) {
+	if !m.shard(key).store(key, hash, ttl) {
+		return
+	}
+	if m.entries.Add(1) <= int64(maxIconCacheEntries) {
+		return
+	}
+	start := uint64(key) % iconHashCacheShards
+	for i := uint64(0); i < iconHashCacheShards; i++ {
+		if m.shards[(start+i)%iconHashCacheShards].evict(key) {
+			m.entries.Add(-1)
+			return
+		}
+	}
+}
+
+func (m *ShardedIconHashCache) Get(key int64) (interface{}, bool) {
+	v, ok, removed := m.shard(key).get(key)
+	if removed {
+		m.entries.Add(-1)
+	}
+	return v, ok
+}
+
+func (m *ShardedIconHashCache) Delete(key int64) {
+	if m.shard(key).remove(key) {
+		m.entries.Add(-1)
+	}
+}
+
+func (m *ShardedIconHashCache) Len() int {
+	n := 0
+	for i := range m.shards {
+		n += m.shards[i].Len()
+	}
+	return n
+}
+
+func (m *ShardedIconHashCache) Cleanup() {
+	for i := range m.shards {
+		m.entries.Add(-int64(m.shards[i].cleanup()))
+	}
+}
+
+func (m *ShardedIconHashCache) CleanupAll() {
+	for i := range m.shards {
+		m.entries.Add(-int64(m.shards[i].cleanupAll()))
+	}
 }
 
 func getIconHashCache(ctx context.Context, userID int64) (string, error) {
@@ -510,22 +1460,69 @@ func getIconHashCache(ctx context.Context, userID int64) (string, error) {
 		return v.(string), nil
 	}
 
-	var image []byte
-	if err := dbConn.GetContext(ctx, &image, "SELECT image FROM icons WHERE user_id = ?", userID); err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return "", err
-		}
-		image = noimage
+	// アイコン画像を読まずに済むよう、usersに保存したハッシュを優先する
+	var storedHash sql.NullString
+	if err := dbConn.GetContext(ctx, &storedHash, "SELECT icon_hash FROM users WHERE id = ?", userID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
 	}
 
-	hash := fmt.Sprintf("%x", sha256.Sum256(image))
+	hash := storedHash.String
+	if !storedHash.Valid {
+		var image []byte
+		if err := dbConn.GetContext(ctx, &image, "SELECT image FROM icons WHERE user_id = ?", userID); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return "", err
+			}
+			image = noimage
+		}
+		hash = iconHash(image)
+	}
 
-	iconHashCache.Set(userID, hash, time.Second*2)
+	iconHashCache.Set(userID, hash, iconHashCacheTTL)
 
 	return hash, nil
 }
 
+// initIconHashCache は、起動直後にアイコンへのリクエストが集中してもDBを引かずに済むよう、全ユーザのアイコンハッシュをキャッシュに載せる
+// アイコン未登録のユーザはnoimageのハッシュを使う
+func initIconHashCache(ctx context.Context, db *sqlx.DB, logger echo.Logger) error {
+	start := time.Now()
+
+	rows, err := db.QueryxContext(ctx, "SELECT u.id, i.image FROM users u LEFT JOIN icons i ON i.user_id = u.id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	noimageHash := iconHash(noimage)
+	n := 0
+	for rows.Next() {
+		var (
+			userID int64
+			image  []byte
+		)
+		if err := rows.Scan(&userID, &image); err != nil {
+			return err
+		}
+		hash := noimageHash
+		if image != nil {
+			hash = iconHash(image)
+		}
+		iconHashCache.Set(userID, hash, iconHashPreloadTTL)
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	logger.Infof("loaded %d icon hashes in %s", n, time.Since(start))
+	return nil
+}
+
 func fillUsersResponse(ctx context.Context, tx *sqlx.Tx, userModels []UserModel) ([]User, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	if len(userModels) == 0 {
 		return []User{}, nil
 	}
@@ -534,17 +1531,19 @@ func fillUsersResponse(ctx context.Context, tx *sqlx.Tx, userModels []UserModel)
 		userIDs[i] = user.ID
 	}
 
-	themeModels := make([]ThemeModel, len(userIDs))
-	sql, params, err := sqlx.In("SELECT * FROM themes WHERE user_id IN (?)", userIDs)
+	themeMap, err := getThemeMapCache(ctx, tx, userIDs)
 	if err != nil {
 		return nil, err
 	}
-	if err := tx.SelectContext(ctx, &themeModels, sql, params...); err != nil {
+
+	privacyMap, err := getUserPrivacyMap(ctx, tx, userIDs)
+	if err != nil {
 		return nil, err
 	}
-	themeMap := make(map[int64]ThemeModel)
-	for _, theme := range themeModels {
-		themeMap[theme.UserID] = theme
+
+	badgeCountMap, err := getBadgeCountMap(ctx, tx, userIDs)
+	if err != nil {
+		return nil, err
 	}
 
 	users := make([]User, len(userIDs))
@@ -559,7 +1558,12 @@ func fillUsersResponse(ctx context.Context, tx *sqlx.Tx, userModels []UserModel)
 			return nil, err
 		}
 
-		users[i] = User{
+		privacy, ok := privacyMap[user.ID]
+		if !ok {
+			privacy = defaultUserPrivacy
+		}
+
+		users[i] = applyUserPrivacy(User{
 			ID:          user.ID,
 			Name:        user.Name,
 			DisplayName: user.DisplayName,
@@ -568,14 +1572,18 @@ func fillUsersResponse(ctx context.Context, tx *sqlx.Tx, userModels []UserModel)
 				ID:       theme.ID,
 				DarkMode: theme.DarkMode,
 			},
-			IconHash: hash,
-		}
+			IconHash:   hash,
+			BadgeCount: badgeCountMap[user.ID],
+		}, privacy)
 	}
 
 	return users, nil
 }
 
 func fillUsersResponseWithoutTx(ctx context.Context, userModels []UserModel) ([]User, error) {
+	ctx, cancel := context.WithTimeout(ctx, FillResponseTimeout)
+	defer cancel()
+
 	if len(userModels) == 0 {
 		return []User{}, nil
 	}
@@ -584,17 +1592,19 @@ func fillUsersResponseWithoutTx(ctx context.Context, userModels []UserModel) ([]
 		userIDs[i] = user.ID
 	}
 
-	themeModels := make([]ThemeModel, len(userIDs))
-	sql, params, err := sqlx.In("SELECT * FROM themes WHERE user_id IN (?)", userIDs)
+	themeMap, err := getThemeMapCache(ctx, dbConn, userIDs)
 	if err != nil {
 		return nil, err
 	}
-	if err := dbConn.SelectContext(ctx, &themeModels, sql, params...); err != nil {
+
+	privacyMap, err := getUserPrivacyMap(ctx, dbConn, userIDs)
+	if err != nil {
 		return nil, err
 	}
-	themeMap := make(map[int64]ThemeModel)
-	for _, theme := range themeModels {
-		themeMap[theme.UserID] = theme
+
+	badgeCountMap, err := getBadgeCountMap(ctx, dbConn, userIDs)
+	if err != nil {
+		return nil, err
 	}
 
 	users := make([]User, len(userIDs))
@@ -609,7 +1619,12 @@ func fillUsersResponseWithoutTx(ctx context.Context, userModels []UserModel) ([]
 			return nil, err
 		}
 
-		users[i] = User{
+		privacy, ok := privacyMap[user.ID]
+		if !ok {
+			privacy = defaultUserPrivacy
+		}
+
+		users[i] = applyUserPrivacy(User{
 			ID:          user.ID,
 			Name:        user.Name,
 			DisplayName: user.DisplayName,
@@ -618,8 +1633,9 @@ func fillUsersResponseWithoutTx(ctx context.Context, userModels []UserModel) ([]
 				ID:       theme.ID,
 				DarkMode: theme.DarkMode,
 			},
-			IconHash: hash,
-		}
+			IconHash:   hash,
+			BadgeCount: badgeCountMap[user.ID],
+		}, privacy)
 	}
 
 	return users, nil
@@ -0,0 +1,755 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+func TestJitteredTTL(t *testing.T) {
+	const ttl = 2 * time.Second
+
+	cache := &IconHashCache{}
+	var minOffset, maxOffset time.Duration
+	for i := 0; i < 1000; i++ {
+		before := time.Now()
+		cache.Set(int64(i), "hash", ttl)
+
+		e, ok := cache.data[int64(i)]
+		if !ok {
+			t.Fatal("entry not found")
+		}
+		offset := e.expiration.Sub(before)
+		if offset < ttl*4/5 || offset > ttl*6/5+time.Millisecond {
+			t.Fatalf("expiration offset %s is out of ttl±20%%", offset)
+		}
+		if i == 0 || offset < minOffset {
+			minOffset = offset
+		}
+		if i == 0 || offset > maxOffset {
+			maxOffset = offset
+		}
+	}
+
+	// 時刻の経過による誤差ではなく、ジッターによってばらついていることを確認する
+	if spread := maxOffset - minOffset; spread < ttl/10 {
+		t.Errorf("expirations are not jittered enough: spread = %s", spread)
+	}
+}
+
+func TestJitteredTTL_Zero(t *testing.T) {
+	if got := jitteredTTL(0); got != 0 {
+		t.Errorf("jitteredTTL(0) = %s, want 0", got)
+	}
+}
+
+func TestIconHashCacheTTLFromEnv(t *testing.T) {
+	t.Setenv("ICON_HASH_CACHE_TTL", "100ms")
+	ttl, err := iconHashCacheTTLFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ttl != 100*time.Millisecond {
+		t.Fatalf("ttl = %s, want 100ms", ttl)
+	}
+
+	cache := &ShardedIconHashCache{}
+	cache.Set(1, "hash", ttl)
+	time.Sleep(150 * time.Millisecond)
+	if _, ok := cache.Get(1); ok {
+		t.Error("entry is still cached after the configured TTL")
+	}
+}
+
+func TestIconHashCacheTTLFromEnv_Invalid(t *testing.T) {
+	for _, v := range []string{"0s", "-1s", "2"} {
+		t.Setenv("ICON_HASH_CACHE_TTL", v)
+		if _, err := iconHashCacheTTLFromEnv(); err == nil {
+			t.Errorf("ICON_HASH_CACHE_TTL=%q must be rejected", v)
+		}
+	}
+}
+
+func TestShardedIconHashCache(t *testing.T) {
+	cache := &ShardedIconHashCache{}
+	for i := int64(0); i < iconHashCacheShards*2; i++ {
+		cache.Set(i, "hash", time.Minute)
+	}
+
+	// 同じシャードに振り分けられるキーが互いに影響しないこと
+	cache.Delete(1)
+	if _, ok := cache.Get(1); ok {
+		t.Error("deleted key 1 is still cached")
+	}
+	if v, ok := cache.Get(1 + iconHashCacheShards); !ok || v.(string) != "hash" {
+		t.Errorf("Get(%d) = %v, %v, want hash, true", 1+iconHashCacheShards, v, ok)
+	}
+
+	cache.CleanupAll()
+	for i := int64(0); i < iconHashCacheShards*2; i++ {
+		if _, ok := cache.Get(i); ok {
+			t.Fatalf("key %d is still cached after CleanupAll", i)
+		}
+	}
+}
+
+func TestIconHashCache_EvictsSoonestExpiration(t *testing.T) {
+	cache := &IconHashCache{}
+	cache.set(1, "hash1", time.Hour, 2)
+	cache.set(2, "hash2", time.Minute, 2)
+	// 既存のキーの更新では追い出さない
+	cache.set(1, "hash1", time.Hour, 2)
+	if n := cache.Len(); n != 2 {
+		t.Fatalf("Len() = %d, want 2", n)
+	}
+
+	cache.set(3, "hash3", time.Hour, 2)
+	if n := cache.Len(); n != 2 {
+		t.Errorf("Len() = %d, want 2", n)
+	}
+	if _, ok := cache.Get(2); ok {
+		t.Error("entry with the soonest expiration was not evicted")
+	}
+	for _, key := range []int64{1, 3} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("key %d was evicted", key)
+		}
+	}
+}
+
+func TestShardedIconHashCache_MaxEntries(t *testing.T) {
+	orig := maxIconCacheEntries
+	maxIconCacheEntries = iconHashCacheShards * 2
+	t.Cleanup(func() { maxIconCacheEntries = orig })
+
+	cache := &ShardedIconHashCache{}
+	for i := int64(0); i < iconHashCacheShards*10; i++ {
+		cache.Set(i, "hash", time.Minute)
+	}
+	if n := cache.Len(); n != maxIconCacheEntries {
+		t.Errorf("Len() = %d, want %d", n, maxIconCacheEntries)
+	}
+}
+
+func TestShardedIconHashCache_MaxEntriesAcrossShards(t *testing.T) {
+	orig := maxIconCacheEntries
+	maxIconCacheEntries = iconHashCacheShards * 2
+	t.Cleanup(func() { maxIconCacheEntries = orig })
+
+	// 全て同じシャードに振り分けられるキーでも、全体の上限まではキャッシュする
+	cache := &ShardedIconHashCache{}
+	for i := 0; i < maxIconCacheEntries; i++ {
+		cache.Set(int64(i)*iconHashCacheShards, "hash", time.Minute)
+	}
+	if n := cache.Len(); n != maxIconCacheEntries {
+		t.Fatalf("Len() = %d, want %d", n, maxIconCacheEntries)
+	}
+
+	// 削除したエントリは上限の計算から外れる
+	cache.Delete(0)
+	cache.Set(1, "hash", time.Minute)
+	if n := cache.Len(); n != maxIconCacheEntries {
+		t.Errorf("Len() = %d, want %d", n, maxIconCacheEntries)
+	}
+	if _, ok := cache.Get(iconHashCacheShards); !ok {
+		t.Error("an entry was evicted although the cache was below the limit")
+	}
+
+	cache.Set(2, "hash", time.Minute)
+	if n := cache.Len(); n != maxIconCacheEntries {
+		t.Errorf("Len() = %d, want %d", n, maxIconCacheEntries)
+	}
+	if _, ok := cache.Get(2); !ok {
+		t.Error("the entry just added was evicted")
+	}
+}
+
+type iconHashCacher interface {
+	Set(key int64, hash string, ttl time.Duration)
+	Get(key int64) (interface{}, bool)
+}
+
+const iconHashCacheBenchmarkGoroutines = 10000
+
+// benchmarkIconHashCache は、b.N回のGet/Setを10,000 goroutineに分けて並列に実行する
+func benchmarkIconHashCache(b *testing.B, cache iconHashCacher) {
+	for i := int64(0); i < iconHashCacheBenchmarkGoroutines; i++ {
+		cache.Set(i, "hash", time.Hour)
+	}
+
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for g := 0; g < iconHashCacheBenchmarkGoroutines; g++ {
+		n := b.N / iconHashCacheBenchmarkGoroutines
+		if g < b.N%iconHashCacheBenchmarkGoroutines {
+			n++
+		}
+		wg.Add(1)
+		go func(g, n int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				key := int64((g + i) % iconHashCacheBenchmarkGoroutines)
+				// アイコンハッシュは参照が大半なので、Setは一部のみ
+				if i%16 == 0 {
+					cache.Set(key, "hash", time.Hour)
+				} else {
+					cache.Get(key)
+				}
+			}
+		}(g, n)
+	}
+	wg.Wait()
+}
+
+func BenchmarkIconHashCache_Single(b *testing.B) {
+	benchmarkIconHashCache(b, &IconHashCache{})
+}
+
+func BenchmarkIconHashCache_Sharded(b *testing.B) {
+	benchmarkIconHashCache(b, &ShardedIconHashCache{})
+}
+
+func TestWithUserDNSRecord_PanicAfterCommit(t *testing.T) {
+	const name = "dns-panic-after-commit"
+	fqdn := name + ".u.isucon.local."
+	t.Cleanup(func() {
+		records.Delete(fqdn)
+		afterUserCommitHook = func() {}
+	})
+
+	afterUserCommitHook = func() {
+		panic("crash between commit and records.Store")
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		withUserDNSRecord(name, func() error {
+			// コミットまで成功した
+			return nil
+		})
+	}()
+
+	// DBにはユーザが存在するので、名前解決できる必要がある
+	v, ok := records.Load(fqdn)
+	if !ok || v != powerDNSSubdomainAddress {
+		t.Errorf("records[%q] = %v, %v, want %q, true", fqdn, v, ok, powerDNSSubdomainAddress)
+	}
+}
+
+func TestWithUserDNSRecord_RegisterFailed(t *testing.T) {
+	const name = "dns-register-failed"
+	fqdn := name + ".u.isucon.local."
+	t.Cleanup(func() {
+		records.Delete(fqdn)
+	})
+
+	errRegister := errors.New("rollback")
+	if err := withUserDNSRecord(name, func() error {
+		// 登録処理中は名前解決できない値で押さえられている
+		if v, _ := records.Load(fqdn); v != (pendingDNSRecord{}) {
+			t.Errorf("records[%q] = %v during registration, want pending", fqdn, v)
+		}
+		return errRegister
+	}); !errors.Is(err, errRegister) {
+		t.Errorf("err = %v, want %v", err, errRegister)
+	}
+
+	// ロールバックされたユーザのレコードは残らない
+	if v, ok := records.Load(fqdn); ok {
+		t.Errorf("records[%q] = %v, want not found", fqdn, v)
+	}
+}
+
+func TestWithUserDNSRecord_ConcurrentRegistration(t *testing.T) {
+	const name = "dns-concurrent"
+	fqdn := name + ".u.isucon.local."
+	t.Cleanup(func() {
+		records.Delete(fqdn)
+	})
+
+	err := withUserDNSRecord(name, func() error {
+		// 同名の登録が並行して行われた場合は弾かれる
+		if err := withUserDNSRecord(name, func() error {
+			t.Error("concurrent registration must not run")
+			return nil
+		}); !errors.Is(err, errDNSRecordPending) {
+			t.Errorf("err = %v, want %v", err, errDNSRecordPending)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if v, _ := records.Load(fqdn); v != powerDNSSubdomainAddress {
+		t.Errorf("records[%q] = %v, want %q", fqdn, v, powerDNSSubdomainAddress)
+	}
+}
+
+func TestIsNotModifiedSince(t *testing.T) {
+	updatedAt := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	lastModified := updatedAt.Format(http.TimeFormat)
+
+	tests := []struct {
+		name            string
+		ifModifiedSince string
+		want            bool
+	}{
+		{name: "no header", ifModifiedSince: "", want: false},
+		{name: "returned Last-Modified", ifModifiedSince: lastModified, want: true},
+		{name: "after update", ifModifiedSince: updatedAt.Add(time.Hour).Format(http.TimeFormat), want: true},
+		{name: "before update", ifModifiedSince: updatedAt.Add(-time.Second).Format(http.TimeFormat), want: false},
+		{name: "invalid", ifModifiedSince: "yesterday", want: false},
+	}
+	for _, tt := range tests {
+		if got := isNotModifiedSince(tt.ifModifiedSince, updatedAt.Unix()); got != tt.want {
+			t.Errorf("%s: isNotModifiedSince(%q) = %v, want %v", tt.name, tt.ifModifiedSince, got, tt.want)
+		}
+	}
+}
+
+func TestGetUserHandler_ETag(t *testing.T) {
+	const (
+		viewerID = int64(1)
+		userID   = int64(2)
+	)
+	updatedAt := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC).Unix()
+	showDescription := true
+
+	d := &fakeDB{}
+	d.onQuery("SELECT * FROM users WHERE name = ?", func(string, []driver.Value) (driver.Rows, error) {
+		return &fakeRows{
+			columns: []string{"id", "name", "display_name", "description", "updated_at"},
+			values:  [][]driver.Value{{userID, "alice", "Alice", "hello", updatedAt}},
+		}, nil
+	})
+	d.onQuery("SELECT * FROM user_privacy WHERE user_id = ?", func(string, []driver.Value) (driver.Rows, error) {
+		return &fakeRows{
+			columns: []string{"user_id", "show_description", "show_display_name", "show_on_leaderboard"},
+			values:  [][]driver.Value{{userID, showDescription, true, true}},
+		}, nil
+	})
+	useFakeDB(t, d)
+	useSessionVersion(t, viewerID, 0)
+	iconHashCache.Set(userID, "hash", time.Hour)
+	themeCache.Set(userID, ThemeModel{ID: userID, UserID: userID}, time.Hour)
+	badgeCountCache.Set(userID, 0, time.Hour)
+	t.Cleanup(func() {
+		iconHashCache.Delete(userID)
+		themeCache.Delete(userID)
+		badgeCountCache.Delete(userID)
+	})
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	e.GET("/api/user/:username", func(c echo.Context) error {
+		// ログイン済みのセッションとして扱う
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultUserIDKey] = viewerID
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+		return getUserHandler(c)
+	})
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/alice", nil)
+		req.Header = header
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get(http.Header{})
+	if first.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", first.Code, http.StatusOK, first.Body.String())
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("ETag is not set")
+	}
+	if rec := get(http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusNotModified {
+		t.Errorf("status with matching ETag = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	// updated_atと同じ秒に公開設定が変わっても、ETagが変わるので古いレスポンスを使わせない
+	showDescription = false
+	rec := get(http.Header{
+		"If-None-Match":     {etag},
+		"If-Modified-Since": {first.Header().Get(echo.HeaderLastModified)},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status after privacy change = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Error("ETag must change when the response changes")
+	}
+	var user User
+	if err := json.Unmarshal(rec.Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Description != "" {
+		t.Errorf("description = %q, want hidden", user.Description)
+	}
+}
+
+// fakeIconDB は、usersのicon_hashとiconsのimageだけを返すfakeDB
+type fakeIconDB struct {
+	*fakeDB
+
+	// nilの場合はNULLを返す
+	iconHash *string
+	// nilの場合はアイコン未登録として0行を返す
+	image []byte
+}
+
+func useFakeIconDB(t *testing.T, d *fakeIconDB) {
+	d.fakeDB = &fakeDB{}
+	d.onQuery("SELECT icon_hash FROM users", func(string, []driver.Value) (driver.Rows, error) {
+		var v driver.Value
+		if d.iconHash != nil {
+			v = *d.iconHash
+		}
+		return fakeValue("icon_hash", v), nil
+	})
+	d.onQuery("SELECT image FROM icons", func(string, []driver.Value) (driver.Rows, error) {
+		if d.image == nil {
+			return &fakeRows{columns: []string{"image"}}, nil
+		}
+		return fakeValue("image", d.image), nil
+	})
+	d.onQuery("SELECT u.id, i.image FROM users", func(string, []driver.Value) (driver.Rows, error) {
+		// ユーザ1はアイコン登録済み、ユーザ2は未登録
+		return &fakeRows{
+			columns: []string{"id", "image"},
+			values:  [][]driver.Value{{int64(1), d.image}, {int64(2), nil}},
+		}, nil
+	})
+	useFakeDB(t, d.fakeDB)
+	iconHashCache.CleanupAll()
+	t.Cleanup(iconHashCache.CleanupAll)
+}
+
+func TestGetIconHashCache_UsesStoredHash(t *testing.T) {
+	// アイコン登録後は、usersに保存したハッシュだけで解決し、画像を読まない
+	stored := "stored-hash"
+	d := &fakeIconDB{iconHash: &stored, image: []byte("icon")}
+	useFakeIconDB(t, d)
+
+	got, err := getIconHashCache(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != stored {
+		t.Errorf("hash = %q, want %q", got, stored)
+	}
+	for _, q := range d.queries() {
+		if strings.Contains(q, "FROM icons") {
+			t.Errorf("icon image was read on the fast path: %s", q)
+		}
+	}
+}
+
+func TestGetIconHashCache_FallbackToImage(t *testing.T) {
+	tests := []struct {
+		name  string
+		image []byte
+		want  string
+	}{
+		{name: "icon registered before backfill", image: []byte("icon"), want: iconHash([]byte("icon"))},
+		{name: "no icon", image: nil, want: iconHash(noimage)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeIconDB(t, &fakeIconDB{image: tt.image})
+
+			got, err := getIconHashCache(context.Background(), 1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("hash = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitIconHashCache(t *testing.T) {
+	d := &fakeIconDB{image: []byte("icon")}
+	useFakeIconDB(t, d)
+
+	if err := initIconHashCache(context.Background(), dbConn, echo.New().Logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.resetLog()
+
+	// 起動直後のアクセスが落ち着くまで、通常のTTLより長く保持する
+	shard := iconHashCache.shard(1)
+	shard.mu.RLock()
+	expiration := shard.data[1].expiration
+	shard.mu.RUnlock()
+	if want := time.Now().Add(iconHashPreloadTTL / 2); expiration.Before(want) {
+		t.Errorf("preloaded hash expires at %s, want after %s", expiration, want)
+	}
+
+	for userID, want := range map[int64]string{1: iconHash([]byte("icon")), 2: iconHash(noimage)} {
+		got, err := getIconHashCache(context.Background(), userID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != want {
+			t.Errorf("hash of user %d = %q, want %q", userID, got, want)
+		}
+	}
+	if len(d.queries()) != 0 {
+		t.Errorf("warmed cache issued queries: %v", d.queries())
+	}
+}
+
+func TestLogout_RevokesReplayedSession(t *testing.T) {
+	useSessionVersion(t, 1, 0)
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+	e.POST("/login", func(c echo.Context) error {
+		sess, _ := session.Get(defaultSessionIDKey, c)
+		sess.Values[defaultSessionIDKey] = uuid.NewString()
+		sess.Values[defaultUserIDKey] = int64(1)
+		sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+		if err := sess.Save(c.Request(), c.Response()); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	e.POST("/api/logout", logoutHandler)
+	e.GET("/me", func(c echo.Context) error {
+		if err := verifyUserSession(c); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	do := func(method, path, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/login", "")
+	cookies := rec.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("login did not set a session cookie")
+	}
+	cookie := cookies[0].Name + "=" + cookies[0].Value
+
+	if rec := do(http.MethodGet, "/me", cookie); rec.Code != http.StatusOK {
+		t.Fatalf("before logout: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := do(http.MethodPost, "/api/logout", cookie); rec.Code != http.StatusOK {
+		t.Fatalf("logout: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	// ログアウト前のCookieを再送しても、失効したセッションとして弾く
+	if rec := do(http.MethodGet, "/me", cookie); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed session: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRevokeSession_RemovedAtExpiry(t *testing.T) {
+	sessionID := uuid.NewString()
+	revokeSession(sessionID, time.Now().Add(50*time.Millisecond))
+	if !isSessionRevoked(sessionID) {
+		t.Fatal("session must be revoked")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for isSessionRevoked(sessionID) {
+		if time.Now().After(deadline) {
+			t.Fatal("revoked session must be removed after its expiry")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// fakeProfileDB は、1人のユーザのプロフィールとテーマだけを持つfakeDB
+type fakeProfileDB struct {
+	*fakeDB
+
+	displayName string
+	description string
+	darkMode    bool
+}
+
+func useFakeProfileDB(t *testing.T, d *fakeProfileDB) {
+	d.fakeDB = &fakeDB{}
+	d.onQuery("SELECT * FROM users", func(string, []driver.Value) (driver.Rows, error) {
+		return &fakeRows{
+			columns: []string{"id", "name", "display_name", "description"},
+			values:  [][]driver.Value{{int64(1), "alice", d.displayName, d.description}},
+		}, nil
+	})
+	d.onQuery("SELECT * FROM themes", func(string, []driver.Value) (driver.Rows, error) {
+		return &fakeRows{
+			columns: []string{"id", "user_id", "dark_mode"},
+			values:  [][]driver.Value{{int64(1), int64(1), d.darkMode}},
+		}, nil
+	})
+	d.onQuery("SELECT COUNT(*) FROM user_badges", func(string, []driver.Value) (driver.Rows, error) {
+		return fakeValue("COUNT(*)", int64(0)), nil
+	})
+	d.onExec("UPDATE users SET ", func(query string, args []driver.Value) (driver.Result, error) {
+		// SET句の列に、プレースホルダの順で引数を割り当てる
+		set := strings.TrimSuffix(strings.TrimPrefix(query, "UPDATE users SET "), " WHERE id = ?")
+		for i, column := range strings.Split(set, ", ") {
+			switch strings.TrimSuffix(column, " = ?") {
+			case "display_name":
+				d.displayName = args[i].(string)
+			case "description":
+				d.description = args[i].(string)
+			}
+		}
+		return driver.RowsAffected(1), nil
+	})
+	d.onExec("UPDATE themes SET dark_mode", func(_ string, args []driver.Value) (driver.Result, error) {
+		d.darkMode = args[0].(bool)
+		return driver.RowsAffected(1), nil
+	})
+	useFakeDB(t, d.fakeDB)
+}
+
+func TestPatchMeHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		want        User
+		wantUpdates []string
+	}{
+		{
+			name:        "display_name only",
+			body:        `{"display_name":"Alice"}`,
+			want:        User{DisplayName: "Alice", Description: "old description", Theme: Theme{ID: 1, DarkMode: false}},
+			wantUpdates: []string{"UPDATE users SET display_name = ?, updated_at = ? WHERE id = ?"},
+		},
+		{
+			name:        "theme only",
+			body:        `{"theme":{"dark_mode":true}}`,
+			want:        User{DisplayName: "old name", Description: "old description", Theme: Theme{ID: 1, DarkMode: true}},
+			wantUpdates: []string{"UPDATE users SET updated_at = ? WHERE id = ?", "UPDATE themes SET dark_mode = ? WHERE user_id = ?"},
+		},
+		{
+			name: "combined",
+			body: `{"display_name":"Alice","description":"hello","theme":{"dark_mode":true}}`,
+			want: User{DisplayName: "Alice", Description: "hello", Theme: Theme{ID: 1, DarkMode: true}},
+			wantUpdates: []string{
+				"UPDATE users SET display_name = ?, description = ?, updated_at = ? WHERE id = ?",
+				"UPDATE themes SET dark_mode = ? WHERE user_id = ?",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &fakeProfileDB{displayName: "old name", description: "old description"}
+			useFakeProfileDB(t, d)
+			t.Cleanup(func() {
+				themeCache.CleanupAll()
+				iconHashCache.CleanupAll()
+			})
+			useSessionVersion(t, 1, 0)
+			iconHashCache.Set(1, "hash", time.Hour)
+			// 更新前のテーマがキャッシュされていても、更新後のテーマを返す
+			themeCache.Set(1, ThemeModel{ID: 1, UserID: 1, DarkMode: false}, time.Hour)
+
+			e := echo.New()
+			e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+			e.PATCH("/api/user/me", func(c echo.Context) error {
+				// ログイン済みのセッションとして扱う
+				sess, _ := session.Get(defaultSessionIDKey, c)
+				sess.Values[defaultUserIDKey] = int64(1)
+				sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+				return patchMeHandler(c)
+			})
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/api/user/me", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+
+			var got User
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if got.DisplayName != tt.want.DisplayName || got.Description != tt.want.Description || got.Theme != tt.want.Theme {
+				t.Errorf("user = %+v, want %+v", got, tt.want)
+			}
+			if execs := d.execQueries(); strings.Join(execs, "\n") != strings.Join(tt.wantUpdates, "\n") {
+				t.Errorf("execs = %q, want %q", execs, tt.wantUpdates)
+			}
+		})
+	}
+}
+
+func TestIconHandlers_Validation(t *testing.T) {
+	oversized := append(append([]byte{}, noimage...), make([]byte, maxIconBytes)...)
+	pdf := []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj\n")
+	tests := []struct {
+		name    string
+		method  string
+		handler echo.HandlerFunc
+		image   []byte
+		want    int
+	}{
+		{name: "post oversized", method: http.MethodPost, handler: postIconHandler, image: oversized, want: http.StatusBadRequest},
+		{name: "post pdf", method: http.MethodPost, handler: postIconHandler, image: pdf, want: http.StatusBadRequest},
+		{name: "post jpeg", method: http.MethodPost, handler: postIconHandler, image: noimage, want: http.StatusCreated},
+		{name: "patch oversized", method: http.MethodPatch, handler: patchIconHandler, image: oversized, want: http.StatusBadRequest},
+		{name: "patch pdf", method: http.MethodPatch, handler: patchIconHandler, image: pdf, want: http.StatusBadRequest},
+		{name: "patch jpeg", method: http.MethodPatch, handler: patchIconHandler, image: noimage, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newFakeTxDB()
+			useFakeDB(t, d)
+			useSessionVersion(t, 1, 0)
+
+			e := echo.New()
+			e.Use(session.Middleware(sessions.NewCookieStore([]byte("test-secret"))))
+			e.Add(tt.method, "/api/icon", func(c echo.Context) error {
+				// ログイン済みのセッションとして扱う
+				sess, _ := session.Get(defaultSessionIDKey, c)
+				sess.Values[defaultUserIDKey] = int64(1)
+				sess.Values[defaultSessionExpiresKey] = time.Now().Add(1 * time.Hour).Unix()
+				return tt.handler(c)
+			})
+
+			body, err := json.Marshal(PostIconRequest{Image: tt.image})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(tt.method, "/api/icon", strings.NewReader(string(body))))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if execs := d.execQueries(); tt.want == http.StatusBadRequest && len(execs) != 0 {
+				t.Errorf("rejected icon was written: %v", execs)
+			}
+		})
+	}
+}
@@ -1,7 +1,16 @@
-TRUNCATE TABLE reservation_slots;
 TRUNCATE TABLE tags;
 TRUNCATE TABLE users;
 
+-- 予約枠の検索に使う複合インデックスを追加するため作り直す
+DROP TABLE IF EXISTS `reservation_slots`;
+CREATE TABLE `reservation_slots` (
+    `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    `slot` BIGINT NOT NULL,
+    `start_at` BIGINT NOT NULL,
+    `end_at` BIGINT NOT NULL,
+    KEY `idx_start_at_end_at` (`start_at`, `end_at`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
 DROP TABLE IF EXISTS `livestreams`;
 CREATE TABLE `livestreams` (
     `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
@@ -12,7 +21,10 @@ CREATE TABLE `livestreams` (
     `thumbnail_url` VARCHAR(255) NOT NULL,
     `start_at` BIGINT NOT NULL,
     `end_at` BIGINT NOT NULL,
-    KEY `idx_user_id` (`user_id`)
+    `pinned_livecomment_id` BIGINT NULL,
+    `max_viewers` BIGINT NOT NULL DEFAULT 0,
+    KEY `idx_user_id` (`user_id`),
+    FULLTEXT INDEX `ft_livestreams_search` (`title`, `description`) WITH PARSER ngram
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
 
 DROP TABLE IF EXISTS `livestream_tags`;
@@ -29,6 +41,15 @@ CREATE TABLE `icons` (
   `image` LONGBLOB NOT NULL
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
 
+DROP TABLE IF EXISTS `icon_thumbnails`;
+CREATE TABLE `icon_thumbnails` (
+  `user_id` BIGINT NOT NULL,
+  `size` VARCHAR(10) NOT NULL,
+  `image` LONGBLOB NOT NULL,
+  `mime_type` VARCHAR(255) NOT NULL,
+  PRIMARY KEY (`user_id`, `size`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
 DROP TABLE IF EXISTS `ng_words`;
 CREATE TABLE `ng_words` (
   `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
@@ -62,10 +83,17 @@ CREATE TABLE `reactions` (
      `user_id` bigint NOT NULL,
      `livestream_id` bigint NOT NULL,
      `emoji_name` varchar(255) COLLATE utf8mb4_bin NOT NULL,
+     -- 大文字小文字を区別せずに集計するための正規化済み絵文字名
+     `emoji_name_normalized` varchar(255) COLLATE utf8mb4_bin GENERATED ALWAYS AS (LOWER(`emoji_name`)) STORED,
      `created_at` bigint NOT NULL,
      PRIMARY KEY (`id`),
      KEY `idx_07` (`livestream_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+-- 1ユーザ・1配信・1絵文字につきリアクションを1つに制限する場合 (REACTION_DEDUP_MODE=reject|ignore) は、
+-- 初期データの投入後に重複を取り除いてから一意制約を追加する (一意制約がないとアプリケーションは起動しない)
+-- 集計と同じく大文字小文字を区別しないよう、正規化済みの絵文字名に制約をかける
+-- ベンチマーカーは同じ絵文字を何度も送り、すべて統計に数えるため既定では追加しない
+--   ALTER TABLE `reactions` ADD UNIQUE KEY `uniq_user_id_livestream_id_emoji_name_normalized` (`user_id`, `livestream_id`, `emoji_name_normalized`);
 
 DROP TABLE IF EXISTS `livecomment_reports`;
 CREATE TABLE `livecomment_reports` (
@@ -83,7 +111,120 @@ CREATE TABLE `livestream_viewers_history` (
   `user_id` BIGINT NOT NULL,
   `livestream_id` BIGINT NOT NULL,
   `created_at` BIGINT NOT NULL,
-  KEY `idx_01` (`livestream_id`)
+  `last_seen_at` BIGINT NOT NULL DEFAULT 0,
+  KEY `idx_01` (`livestream_id`),
+  UNIQUE `uniq_user_id_livestream_id` (`user_id`, `livestream_id`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `user_notification_prefs`;
+CREATE TABLE `user_notification_prefs` (
+  `user_id` BIGINT NOT NULL,
+  `event_type` VARCHAR(50) NOT NULL,
+  `enabled` BOOLEAN NOT NULL,
+  PRIMARY KEY (`user_id`, `event_type`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `livestream_moderators`;
+CREATE TABLE `livestream_moderators` (
+  `livestream_id` BIGINT NOT NULL,
+  `user_id` BIGINT NOT NULL,
+  `granted_at` BIGINT NOT NULL,
+  `is_co_streamer` BOOLEAN NOT NULL DEFAULT false,
+  PRIMARY KEY (`livestream_id`, `user_id`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `co_stream_requests`;
+CREATE TABLE `co_stream_requests` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `livestream_id` BIGINT NOT NULL,
+  `requester_user_id` BIGINT NOT NULL,
+  `status` VARCHAR(20) NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  KEY `idx_livestream_id_status` (`livestream_id`, `status`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `user_privacy`;
+CREATE TABLE `user_privacy` (
+  `user_id` BIGINT NOT NULL PRIMARY KEY,
+  `show_description` BOOLEAN NOT NULL DEFAULT true,
+  `show_display_name` BOOLEAN NOT NULL DEFAULT true,
+  `show_on_leaderboard` BOOLEAN NOT NULL DEFAULT true
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `stream_clips`;
+CREATE TABLE `stream_clips` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `livestream_id` BIGINT NOT NULL,
+  `submitter_user_id` BIGINT NOT NULL,
+  `title` VARCHAR(255) NOT NULL,
+  `offset_seconds` BIGINT NOT NULL,
+  `duration_seconds` BIGINT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  KEY `idx_livestream_id` (`livestream_id`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `clip_reactions`;
+CREATE TABLE `clip_reactions` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `clip_id` BIGINT NOT NULL,
+  `user_id` BIGINT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  KEY `idx_clip_id` (`clip_id`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `tip_webhooks`;
+CREATE TABLE `tip_webhooks` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `livestream_id` BIGINT NOT NULL,
+  `webhook_url` VARCHAR(255) NOT NULL,
+  `min_tip` BIGINT NOT NULL DEFAULT 0,
+  `secret` VARCHAR(64) NOT NULL,
+  KEY `idx_livestream_id_min_tip` (`livestream_id`, `min_tip`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `user_badges`;
+CREATE TABLE `user_badges` (
+  `user_id` BIGINT NOT NULL,
+  `badge_type` VARCHAR(50) NOT NULL,
+  `earned_at` BIGINT NOT NULL,
+  PRIMARY KEY (`user_id`, `badge_type`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `audit_log`;
+CREATE TABLE `audit_log` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `user_id` BIGINT NOT NULL,
+  `action` VARCHAR(100) NOT NULL,
+  `target_id` BIGINT NOT NULL,
+  `metadata` JSON DEFAULT NULL,
+  `created_at` BIGINT NOT NULL,
+  KEY `idx_created_at` (`created_at`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `livecomment_drafts`;
+CREATE TABLE `livecomment_drafts` (
+  `user_id` BIGINT NOT NULL,
+  `livestream_id` BIGINT NOT NULL,
+  `comment` VARCHAR(255) NOT NULL,
+  `tip` BIGINT NOT NULL DEFAULT 0,
+  `updated_at` BIGINT NOT NULL,
+  UNIQUE KEY `uniq_user_livestream` (`user_id`, `livestream_id`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `livestream_announcements`;
+CREATE TABLE `livestream_announcements` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `livestream_id` BIGINT NOT NULL,
+  `message` VARCHAR(500) NOT NULL,
+  `expires_at` BIGINT NOT NULL,
+  `created_at` BIGINT NOT NULL,
+  INDEX `livestream_id_expires_at` (`livestream_id`, `expires_at`)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+DROP TABLE IF EXISTS `user_session_versions`;
+CREATE TABLE `user_session_versions` (
+  `user_id` BIGINT NOT NULL PRIMARY KEY,
+  `version` BIGINT NOT NULL
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
 
 ALTER TABLE `themes` auto_increment = 1;
@@ -7,6 +7,10 @@ CREATE TABLE `users` (
   `display_name` VARCHAR(255) NOT NULL,
   `password` VARCHAR(255) NOT NULL,
   `description` TEXT NOT NULL,
+  `force_keep_dns` BOOLEAN NOT NULL DEFAULT false,
+  `updated_at` BIGINT NOT NULL DEFAULT 0,
+  `icon_hash` VARCHAR(64) DEFAULT NULL,
+  `created_at` BIGINT NOT NULL DEFAULT 0,
   UNIQUE `uniq_user_name` (`name`)
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
 
@@ -33,7 +37,10 @@ CREATE TABLE `livestreams` (
   `playlist_url` VARCHAR(255) NOT NULL,
   `thumbnail_url` VARCHAR(255) NOT NULL,
   `start_at` BIGINT NOT NULL,
-  `end_at` BIGINT NOT NULL
+  `end_at` BIGINT NOT NULL,
+  `pinned_livecomment_id` BIGINT NULL,
+  `max_viewers` BIGINT NOT NULL DEFAULT 0,
+  FULLTEXT INDEX `ft_livestreams_search` (`title`, `description`) WITH PARSER ngram
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
 
 -- ライブ配信予約枠
@@ -41,7 +48,8 @@ CREATE TABLE `reservation_slots` (
   `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
   `slot` BIGINT NOT NULL,
   `start_at` BIGINT NOT NULL,
-  `end_at` BIGINT NOT NULL
+  `end_at` BIGINT NOT NULL,
+  KEY `idx_start_at_end_at` (`start_at`, `end_at`)
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
 
 -- ライブストリームに付与される、サービスで定義されたタグ
@@ -63,7 +71,9 @@ CREATE TABLE `livestream_viewers_history` (
   `id` BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
   `user_id` BIGINT NOT NULL,
   `livestream_id` BIGINT NOT NULL,
-  `created_at` BIGINT NOT NULL
+  `created_at` BIGINT NOT NULL,
+  `last_seen_at` BIGINT NOT NULL DEFAULT 0,
+  UNIQUE `uniq_user_id_livestream_id` (`user_id`, `livestream_id`)
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
 
 -- ライブ配信に対するライブコメント
@@ -102,5 +112,15 @@ CREATE TABLE `reactions` (
   `livestream_id` BIGINT NOT NULL,
   -- :innocent:, :tada:, etc...
   `emoji_name` VARCHAR(255) NOT NULL,
+  -- 大文字小文字を区別せずに集計するための正規化済み絵文字名
+  `emoji_name_normalized` VARCHAR(255) GENERATED ALWAYS AS (LOWER(`emoji_name`)) STORED,
   `created_at` BIGINT NOT NULL
-) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
\ No newline at end of file
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+
+-- 適用済みのスキーマ変更 (go/migrations.go)
+-- 新規環境ではこのファイルで作成済みなので、全て適用済みとして記録する
+CREATE TABLE `schema_migrations` (
+  `version` INT NOT NULL PRIMARY KEY,
+  `applied_at` BIGINT NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;
+INSERT INTO `schema_migrations` (`version`, `applied_at`) VALUES (1, 0), (2, 0), (3, 0), (4, 0), (5, 0), (6, 0), (7, 0), (8, 0), (9, 0), (10, 0);